@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"smart-finder/shared/types"
+)
+
+// 客户端接口的版本与响应格式
+//
+// /api/v1/ 下的接口成功时返回 {"data": ...}，失败时返回
+// {"error": {"code": "...", "message": "..."}}，错误码见 shared/types。
+// 早期不带版本的 /api/ 路径与 /md5 作为已弃用的别名保留，响应格式不变，
+// 并通过 Deprecation 与 Link 响应头指向新路径。
+const apiV1Prefix = "/api/v1"
+
+//go:embed openapi.json
+var openAPIDoc []byte
+
+// apiRoute 同时注册在 /api/v1 与已弃用的 /api 下的接口
+type apiRoute struct {
+	path    string
+	handler http.HandlerFunc
+	cors    bool // 允许网关页面等跨域调用
+}
+
+var apiRoutes = []apiRoute{
+	{"/health", healthHandler, true},
+	{"/status", statusHandler, false},
+	{"/directories", directoriesHandler, false},
+	{"/ignore-patterns", ignorePatternsHandler, false},
+	{"/settings", settingsHandler, false},
+	{"/path2url", path2urlHandler, false},
+	{"/files", filesHandler, false},
+	{"/files/hardlinks", hardlinksHandler, false},
+	{"/files/delete", batchDeleteFilesByMD5Handler, true},
+	{"/md5", apiMD5FileHandler, true},
+	{"/thumb", thumbHandler, true},
+	{"/locate/md5", md5Handler, true},
+	{"/resolve", resolveHandler, true},
+	{"/index/summary", indexSummaryHandler, true},
+	{"/scan/trigger", scanTriggerHandler, true},
+	{"/scan/status", scanStatusHandler, true},
+	{"/export", exportHandler, false},
+	{"/import", importHandler, false},
+	{"/registry", registryHandler, false},
+	{"/backups", backupsHandler, false},
+	{"/backups/restore", backupRestoreHandler, false},
+	{"/backups/rebuild", backupRebuildHandler, false},
+}
+
+// registerAPIRoutes 注册 /api/v1 接口、OpenAPI 文档与已弃用的别名
+func registerAPIRoutes() {
+	for _, route := range apiRoutes {
+		h := route.handler
+		if route.cors {
+			h = corsMiddleware(h)
+		}
+		http.HandleFunc(apiV1Prefix+route.path, v1(h))
+		http.HandleFunc("/api"+route.path, deprecated(h, apiV1Prefix+route.path))
+	}
+	http.HandleFunc(apiV1Prefix+"/openapi.json", openAPIHandler)
+	http.HandleFunc(apiV1Prefix+"/", v1(func(w http.ResponseWriter, r *http.Request) {
+		fail(w, r, 404, types.ErrCodeNotFound, "接口不存在")
+	}))
+
+	// 网关的 md5.html 早期探测与跳转的地址：带 X-Check-Request 时检查文件
+	// 是否存在，否则在文件管理器中定位文件
+	http.HandleFunc("/md5", deprecated(corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Check-Request") == "true" {
+			apiMD5FileHandler(w, r)
+			return
+		}
+		md5Handler(w, r)
+	}), apiV1Prefix+"/locate/md5"))
+}
+
+type v1Key struct{}
+
+// v1 标记请求使用 /api/v1 的响应格式
+func v1(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(w, r.WithContext(context.WithValue(r.Context(), v1Key{}, true)))
+	}
+}
+
+func isV1(r *http.Request) bool {
+	return r.Context().Value(v1Key{}) != nil
+}
+
+// deprecated 已弃用的路径，响应头指向替代的 /api/v1 路径
+func deprecated(next http.HandlerFunc, successor string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// respond 返回 JSON 数据，/api/v1 接口包装为 {"data": ...}；status 为 204 时没有响应体
+func respond(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	if isV1(r) {
+		v = types.Envelope[any]{Data: v}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// fail 返回错误，/api/v1 接口为 JSON 信封，已弃用的路径保持纯文本
+func fail(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if !isV1(r) {
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Del("Content-Disposition")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(types.Envelope[any]{Error: &types.APIError{Code: code, Message: message}})
+}
+
+// sameOrigin 判断请求是否来自本机服务自己的页面；浏览器跨域请求带的 Origin
+// 与 Host 不同，不带 Origin 的是命令行工具等非浏览器客户端
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && u.Host == r.Host
+}
+
+// methodNotAllowed 不支持的请求方法，allowed 为支持的方法
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	fail(w, r, 405, types.ErrCodeMethodNotAllowed, "不支持的方法，应为 "+strings.Join(allowed, "、"))
+}
+
+// OpenAPI 文档
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Write(openAPIDoc)
+}
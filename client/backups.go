@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"smart-finder/client/internal/backup"
+	"smart-finder/client/internal/db"
+	"smart-finder/client/internal/indexer"
+	"smart-finder/shared/types"
+)
+
+// startBackgroundServices 启动定时扫描和定时备份，只会执行一次
+func startBackgroundServices() {
+	servicesOnce.Do(func() {
+		go indexer.GetGlobalScheduler().Start()
+		go backupScheduler.Start()
+		go registryPublisher.Start()
+	})
+}
+
+func setDBProblems(problems []string) {
+	dbProblemsMu.Lock()
+	defer dbProblemsMu.Unlock()
+	dbProblems = problems
+}
+
+func getDBProblems() []string {
+	dbProblemsMu.RLock()
+	defer dbProblemsMu.RUnlock()
+	return dbProblems
+}
+
+// afterDatabaseRepaired 恢复或重建后重新检查完整性并恢复正常运行
+func afterDatabaseRepaired() error {
+	problems, err := db.CheckIntegrity(dbConn)
+	if err != nil {
+		problems = []string{err.Error()}
+	}
+	setDBProblems(problems)
+	if len(problems) > 0 {
+		return fmt.Errorf("修复后完整性检查仍失败: %v", problems)
+	}
+	if err := loadMonitoredDirs(); err != nil {
+		log.Printf("重新加载监控目录失败: %v", err)
+	}
+	indexSummary.RebuildAsync()
+	thumbCache.Reload()
+	startBackgroundServices()
+	return nil
+}
+
+// 备份列表与手动备份API
+func backupsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		cfg := backupScheduler.Config()
+		backups, err := backup.List(cfg.Dir)
+		if err != nil {
+			fail(w, r, 500, types.ErrCodeInternal, "读取备份目录失败")
+			return
+		}
+		lastRun, lastErr := backupScheduler.LastResult()
+		resp := map[string]interface{}{
+			"dir":      cfg.Dir,
+			"interval": cfg.Interval.String(),
+			"keep":     cfg.Keep,
+			"backups":  backups,
+			"integrity": map[string]interface{}{
+				"ok":       len(getDBProblems()) == 0,
+				"problems": getDBProblems(),
+			},
+		}
+		if !lastRun.IsZero() {
+			resp["lastRun"] = lastRun.Format(time.RFC3339)
+		}
+		if lastErr != nil {
+			resp["lastError"] = lastErr.Error()
+		}
+		respond(w, r, 200, resp)
+	case "POST":
+		if len(getDBProblems()) > 0 {
+			fail(w, r, 409, types.ErrCodeDatabaseDamaged, "数据库已损坏，不能创建备份")
+			return
+		}
+		info, err := backupScheduler.RunNow(r.Context())
+		if err != nil {
+			fail(w, r, 500, types.ErrCodeInternal, fmt.Sprintf("备份失败: %v", err))
+			return
+		}
+		respond(w, r, 201, info)
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
+	}
+}
+
+// 从备份恢复API，请求体 {"name": "md5fs-20060102-150405.db"}，name 为 latest 或空时使用最新的备份
+func backupRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if !sameOrigin(r) {
+		fail(w, r, 403, types.ErrCodeForbidden, "不允许其他网页发起该请求")
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，无效的JSON格式")
+			return
+		}
+	}
+
+	cfg := backupScheduler.Config()
+	path, err := backup.Resolve(cfg.Dir, req.Name)
+	if err != nil {
+		fail(w, r, 404, types.ErrCodeNotFound, err.Error())
+		return
+	}
+	if err := backup.Restore(r.Context(), dbConn, path, cfg.Dir); err != nil {
+		fail(w, r, 500, types.ErrCodeInternal, fmt.Sprintf("恢复失败: %v", err))
+		return
+	}
+	if err := afterDatabaseRepaired(); err != nil {
+		fail(w, r, 500, types.ErrCodeInternal, err.Error())
+		return
+	}
+
+	log.Printf("已从备份恢复数据库: %s", path)
+	respond(w, r, 200, map[string]string{
+		"status":   "restored",
+		"snapshot": path,
+	})
+}
+
+// 重建索引API：保留监控目录等配置，清空文件索引后重新扫描
+func backupRebuildHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if !sameOrigin(r) {
+		fail(w, r, 403, types.ErrCodeForbidden, "不允许其他网页发起该请求")
+		return
+	}
+	if err := backup.Rebuild(r.Context(), dbConn); err != nil {
+		fail(w, r, 500, types.ErrCodeInternal, fmt.Sprintf("重建失败: %v", err))
+		return
+	}
+	if err := afterDatabaseRepaired(); err != nil {
+		fail(w, r, 500, types.ErrCodeInternal, err.Error())
+		return
+	}
+	indexer.GetGlobalScheduler().TriggerManualScan()
+
+	respond(w, r, 200, map[string]string{
+		"status":  "rebuilding",
+		"message": "索引已清空，正在重新扫描",
+	})
+}
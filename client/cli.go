@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"smart-finder/client/internal/backup"
+	"smart-finder/client/internal/db"
+	"smart-finder/client/internal/snapshot"
+)
+
+// rewriteFlags 可重复的 --rewrite from=to 参数
+type rewriteFlags []snapshot.PathRewrite
+
+func (f *rewriteFlags) String() string {
+	parts := make([]string, len(*f))
+	for i, rw := range *f {
+		parts[i] = rw.From + "=" + rw.To
+	}
+	return strings.Join(parts, ",")
+}
+
+func (f *rewriteFlags) Set(s string) error {
+	rw, err := snapshot.ParsePathRewrite(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, rw)
+	return nil
+}
+
+const cliUsage = `用法:
+  smart-finder-client                    启动托盘和本地服务
+  smart-finder-client export [选项]      导出索引快照
+  smart-finder-client import [选项]      导入索引快照
+  smart-finder-client backup [选项]      立即备份数据库
+  smart-finder-client restore [选项]     从备份恢复数据库
+  smart-finder-client check              检查数据库完整性
+  smart-finder-client rebuild            清空文件索引，保留配置，下次启动时重新扫描
+  smart-finder-client version            显示版本
+`
+
+// cliCommands runCLI 支持的子命令
+var cliCommands = []string{
+	"export", "import", "backup", "restore", "check", "rebuild",
+	"version", "--version", "-v", "help", "--help", "-h",
+}
+
+// isCLICommand 判断启动参数是否为子命令
+func isCLICommand(name string) bool {
+	for _, c := range cliCommands {
+		if c == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLI 执行命令行子命令，返回进程退出码
+func runCLI(args []string) int {
+	var err error
+	switch args[0] {
+	case "export":
+		err = runExport(args[1:])
+	case "import":
+		err = runImport(args[1:])
+	case "backup":
+		err = runBackup(args[1:])
+	case "restore":
+		err = runRestore(args[1:])
+	case "check":
+		err = runCheck()
+	case "rebuild":
+		err = runRebuild()
+	case "version", "--version", "-v":
+		fmt.Println(Version)
+	case "help", "--help", "-h":
+		fmt.Print(cliUsage)
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n\n%s", args[0], cliUsage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "错误:", err)
+		return 1
+	}
+	return 0
+}
+
+func runExport(args []string) error {
+	fset := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fset.String("out", "-", "输出文件，- 表示标准输出")
+	formatStr := fset.String("format", "", "快照格式: ndjson、csv 或 sqlite，默认根据输出文件扩展名推断")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := resolveFormat(*formatStr, *out)
+	if err != nil {
+		return err
+	}
+	if format == snapshot.FormatSQLite && *out == "-" {
+		return fmt.Errorf("sqlite 格式需要通过 --out 指定输出文件")
+	}
+
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var w io.Writer = os.Stdout
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	ctx := context.Background()
+	if format == snapshot.FormatSQLite {
+		return snapshot.ExportSQLite(ctx, w, conn)
+	}
+	return snapshot.Export(ctx, w, conn, format, Version)
+}
+
+func runImport(args []string) error {
+	fset := flag.NewFlagSet("import", flag.ContinueOnError)
+	in := fset.String("in", "-", "输入文件，- 表示标准输入")
+	formatStr := fset.String("format", "", "快照格式: ndjson、csv 或 sqlite，默认根据输入文件扩展名推断")
+	modeStr := fset.String("mode", "merge", "导入模式: merge 合并或 replace 替换")
+	var rewrites rewriteFlags
+	fset.Var(&rewrites, "rewrite", "路径前缀替换 from=to，可重复，例如 /Volumes/NAS=/mnt/nas")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	format, err := resolveFormat(*formatStr, *in)
+	if err != nil {
+		return err
+	}
+	mode, err := snapshot.ParseImportMode(*modeStr)
+	if err != nil {
+		return err
+	}
+	if format == snapshot.FormatSQLite && *in == "-" {
+		return fmt.Errorf("sqlite 格式需要通过 --in 指定输入文件")
+	}
+
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	opts := snapshot.ImportOptions{Mode: mode, Rewrites: rewrites}
+	ctx := context.Background()
+	var stats snapshot.ImportStats
+	if format == snapshot.FormatSQLite {
+		stats, err = snapshot.ImportSQLite(ctx, *in, conn, opts)
+	} else {
+		var r io.Reader = os.Stdin
+		if *in != "-" {
+			f, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		stats, err = snapshot.Import(ctx, r, conn, format, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("导入完成: 文件 %d（跳过已存在 %d），监控目录 %d，忽略规则 %d，设置 %d\n",
+		stats.Files, stats.FilesSkipped, stats.MonitoredDirs, stats.IgnorePatterns, stats.Settings)
+	return nil
+}
+
+// resolveFormat 优先使用显式指定的格式，否则根据文件扩展名推断，标准输入输出默认为 NDJSON
+func resolveFormat(formatStr, path string) (snapshot.Format, error) {
+	if formatStr != "" {
+		return snapshot.ParseFormat(formatStr)
+	}
+	if path == "-" {
+		return snapshot.FormatNDJSON, nil
+	}
+	return snapshot.FormatFromPath(path)
+}
+
+func runBackup(args []string) error {
+	fset := flag.NewFlagSet("backup", flag.ContinueOnError)
+	dir := fset.String("dir", "", "备份目录，默认使用设置中的备份目录")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	target := *dir
+	if target == "" {
+		target = backup.LoadConfig(conn, defaultBackupDir()).Dir
+	}
+	info, err := backup.Create(context.Background(), conn, target)
+	if err != nil {
+		return err
+	}
+	fmt.Println("备份完成:", info.Path)
+	return nil
+}
+
+func runRestore(args []string) error {
+	fset := flag.NewFlagSet("restore", flag.ContinueOnError)
+	from := fset.String("from", "", "快照文件路径")
+	name := fset.String("name", "latest", "备份目录中的备份名，latest 表示最新的备份")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	dir := backup.LoadConfig(conn, defaultBackupDir()).Dir
+	path := *from
+	if path == "" {
+		if path, err = backup.Resolve(dir, *name); err != nil {
+			return err
+		}
+	}
+	if err := backup.Restore(context.Background(), conn, path, dir); err != nil {
+		return err
+	}
+	fmt.Println("已从备份恢复:", path)
+	return nil
+}
+
+func runCheck() error {
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	problems, err := db.CheckIntegrity(conn)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("完整性检查失败:\n  %s\n可使用 restore 从最新的备份恢复（restore --name <备份名> 指定备份），或 rebuild 重新扫描",
+			strings.Join(problems, "\n  "))
+	}
+	fmt.Println("数据库完好")
+	return nil
+}
+
+func runRebuild() error {
+	conn, err := openDatabase()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := backup.Rebuild(context.Background(), conn); err != nil {
+		return err
+	}
+	fmt.Println("文件索引已清空，客户端启动后将重新扫描监控目录")
+	return nil
+}
@@ -0,0 +1,386 @@
+// Package backup 定时备份客户端数据库，并提供恢复与重建
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-finder/client/internal/db"
+)
+
+const (
+	// DefaultInterval 默认备份间隔
+	DefaultInterval = 24 * time.Hour
+	// DefaultKeep 默认保留的备份数量
+	DefaultKeep = 7
+
+	filePrefix = "md5fs-"
+	fileSuffix = ".db"
+	timeLayout = "20060102-150405"
+)
+
+// Info 备份文件信息
+type Info struct {
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Config 备份配置
+type Config struct {
+	Dir      string        `json:"dir"`
+	Interval time.Duration `json:"interval"`
+	Keep     int           `json:"keep"`
+}
+
+// LoadConfig 从设置表读取备份配置，defaultDir 为未配置目录时使用的目录
+func LoadConfig(dbConn *sql.DB, defaultDir string) Config {
+	cfg := Config{
+		Dir:      db.GetSetting(dbConn, db.SettingBackupDir, defaultDir),
+		Interval: DefaultInterval,
+		Keep:     DefaultKeep,
+	}
+	if v := db.GetSetting(dbConn, db.SettingBackupInterval, ""); v != "" {
+		if d, err := ParseInterval(v); err == nil {
+			cfg.Interval = d
+		}
+	}
+	if v := db.GetSetting(dbConn, db.SettingBackupKeep, ""); v != "" {
+		if n, err := ParseKeep(v); err == nil {
+			cfg.Keep = n
+		}
+	}
+	return cfg
+}
+
+// ParseInterval 解析备份间隔，0 表示关闭自动备份
+func ParseInterval(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("无效的备份间隔: %s", s)
+	}
+	if d != 0 && d < time.Minute {
+		return 0, fmt.Errorf("备份间隔不能小于1分钟: %s", s)
+	}
+	return d, nil
+}
+
+// ParseKeep 解析保留数量
+func ParseKeep(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("无效的备份保留数量: %s", s)
+	}
+	return n, nil
+}
+
+// Create 在 dir 下创建一份一致的数据库快照，并校验快照完整性
+func Create(ctx context.Context, dbConn *sql.DB, dir string) (Info, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Info{}, err
+	}
+
+	// 备份名精确到秒，同一秒内再次备份（如恢复前的备份）时顺延，避免覆盖已有的备份
+	now := time.Now().Truncate(time.Second)
+	name := filePrefix + now.Format(timeLayout) + fileSuffix
+	path := filepath.Join(dir, name)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		now = now.Add(time.Second)
+		name = filePrefix + now.Format(timeLayout) + fileSuffix
+		path = filepath.Join(dir, name)
+	}
+	tmpPath := path + ".tmp"
+
+	if err := db.Backup(ctx, dbConn, tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return Info{}, err
+	}
+	if err := Verify(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return Info{}, err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return Info{}, err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return Info{}, err
+	}
+	return Info{Name: name, Path: path, Size: fi.Size(), CreatedAt: now}, nil
+}
+
+// Verify 打开快照并执行完整性检查
+func Verify(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	conn, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	problems, err := db.CheckIntegrity(conn)
+	if err != nil {
+		return fmt.Errorf("快照 %s 无法读取: %w", filepath.Base(path), err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("快照 %s 完整性检查失败: %s", filepath.Base(path), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// List 按创建时间从新到旧列出 dir 下的备份
+func List(dir string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []Info{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := make([]Info, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+		createdAt, err := time.ParseInLocation(timeLayout,
+			strings.TrimSuffix(strings.TrimPrefix(name, filePrefix), fileSuffix), time.Local)
+		if err != nil {
+			continue
+		}
+		fi, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Info{
+			Name:      name,
+			Path:      filepath.Join(dir, name),
+			Size:      fi.Size(),
+			CreatedAt: createdAt,
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups, nil
+}
+
+// Rotate 删除超出保留数量的旧备份
+func Rotate(dir string, keep int) error {
+	backups, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(backups); i++ {
+		if err := os.Remove(backups[i].Path); err != nil {
+			return err
+		}
+		log.Printf("删除旧备份: %s", backups[i].Name)
+	}
+	return nil
+}
+
+// Resolve 将备份名解析为 dir 下的路径，"latest" 表示最新的备份
+func Resolve(dir, name string) (string, error) {
+	if name == "latest" || name == "" {
+		backups, err := List(dir)
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("目录 %s 下没有可用的备份", dir)
+		}
+		return backups[0].Path, nil
+	}
+	// 只允许引用备份目录内的文件
+	if filepath.Base(name) != name {
+		return "", fmt.Errorf("无效的备份名: %s", name)
+	}
+	return filepath.Join(dir, name), nil
+}
+
+// Restore 校验快照后以其内容覆盖当前数据库
+//
+// 覆盖前会在 dir 下为当前数据库保存一份快照，恢复失误时可以回退。
+// 当前数据库已损坏时这份快照会校验失败，此时跳过。
+func Restore(ctx context.Context, dbConn *sql.DB, snapshotPath, dir string) error {
+	if err := Verify(snapshotPath); err != nil {
+		return err
+	}
+	if dir != "" {
+		if info, err := Create(ctx, dbConn, dir); err != nil {
+			log.Printf("恢复前备份当前数据库失败，继续恢复: %v", err)
+		} else {
+			log.Printf("恢复前已备份当前数据库: %s", info.Name)
+		}
+	}
+	return db.Restore(ctx, dbConn, snapshotPath)
+}
+
+// Rebuild 用空索引替换当前数据库，并尽量保留监控目录、忽略规则和设置，
+// 之后由扫描器重新建立文件索引
+func Rebuild(ctx context.Context, dbConn *sql.DB) error {
+	tmp, err := os.MkdirTemp("", "smart-finder-rebuild-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	fresh, err := db.InitDB(filepath.Join(tmp, "md5fs.db"))
+	if err != nil {
+		return err
+	}
+	defer fresh.Close()
+
+	salvage(dbConn, fresh)
+	return db.Restore(ctx, dbConn, filepath.Join(tmp, "md5fs.db"))
+}
+
+// salvage 尽力从可能已损坏的数据库中复制配置类数据
+func salvage(src, dst *sql.DB) {
+	if dirs, err := db.GetMonitoredDirectories(src); err == nil {
+		for _, dir := range dirs {
+			db.UpdateMonitoredDir(dst, dir, "add")
+		}
+	} else {
+		log.Printf("无法读取监控目录: %v", err)
+	}
+	if patterns, err := db.GetIgnoredPatterns(src); err == nil {
+		if err := db.UpdateIgnoredPatterns(dst, strings.Join(patterns, "\n")); err != nil {
+			log.Printf("无法保存忽略规则: %v", err)
+		}
+	} else {
+		log.Printf("无法读取忽略规则: %v", err)
+	}
+	if settings, err := db.GetSettings(src); err == nil {
+		for key, value := range settings {
+			db.SetSetting(dst, key, value)
+		}
+	} else {
+		log.Printf("无法读取设置: %v", err)
+	}
+}
+
+// Scheduler 定时备份器
+type Scheduler struct {
+	dbConn     *sql.DB
+	defaultDir string
+	reload     chan struct{}
+	stopChan   chan struct{}
+	stopOnce   sync.Once
+
+	mu      sync.Mutex
+	lastRun time.Time
+	lastErr error
+}
+
+// NewScheduler 创建定时备份器，defaultDir 为未配置备份目录时使用的目录
+func NewScheduler(dbConn *sql.DB, defaultDir string) *Scheduler {
+	return &Scheduler{
+		dbConn:     dbConn,
+		defaultDir: defaultDir,
+		reload:     make(chan struct{}, 1),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Config 返回当前生效的备份配置
+func (s *Scheduler) Config() Config {
+	return LoadConfig(s.dbConn, s.defaultDir)
+}
+
+// Start 启动定时备份，阻塞直到 Stop 被调用
+func (s *Scheduler) Start() {
+	log.Println("启动定时备份器...")
+	for {
+		cfg := s.Config()
+		var timer <-chan time.Time
+		if cfg.Interval > 0 {
+			wait := cfg.Interval
+			if last := s.lastBackupTime(cfg.Dir); !last.IsZero() {
+				wait = time.Until(last.Add(cfg.Interval))
+			}
+			if wait < 0 {
+				wait = 0
+			}
+			timer = time.After(wait)
+		}
+
+		select {
+		case <-timer:
+			if _, err := s.RunNow(context.Background()); err != nil {
+				log.Printf("定时备份失败: %v", err)
+			}
+		case <-s.reload:
+		case <-s.stopChan:
+			log.Println("定时备份器已停止")
+			return
+		}
+	}
+}
+
+// Stop 停止定时备份
+func (s *Scheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+}
+
+// Reload 配置变更后重新计算下次备份时间
+func (s *Scheduler) Reload() {
+	select {
+	case s.reload <- struct{}{}:
+	default:
+	}
+}
+
+// RunNow 立即执行一次备份并清理旧备份
+func (s *Scheduler) RunNow(ctx context.Context) (Info, error) {
+	cfg := s.Config()
+	info, err := Create(ctx, s.dbConn, cfg.Dir)
+
+	s.mu.Lock()
+	s.lastRun, s.lastErr = time.Now(), err
+	s.mu.Unlock()
+
+	if err != nil {
+		return Info{}, err
+	}
+	log.Printf("数据库已备份: %s", info.Path)
+
+	if err := Rotate(cfg.Dir, cfg.Keep); err != nil {
+		log.Printf("清理旧备份失败: %v", err)
+	}
+	return info, nil
+}
+
+// LastResult 返回最近一次备份的时间和错误
+func (s *Scheduler) LastResult() (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastRun, s.lastErr
+}
+
+func (s *Scheduler) lastBackupTime(dir string) time.Time {
+	backups, err := List(dir)
+	if err != nil || len(backups) == 0 {
+		return time.Time{}
+	}
+	return backups[0].CreatedAt
+}
@@ -0,0 +1,172 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"smart-finder/client/internal/db"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "md5fs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func countFiles(t *testing.T, conn *sql.DB) int {
+	t.Helper()
+	var n int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM files").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCreateRestoreRoundTrip(t *testing.T) {
+	conn := openDB(t)
+	dir := t.TempDir()
+	if _, err := conn.Exec("INSERT INTO files (md5, path, filename, size) VALUES (?, ?, ?, ?)",
+		helloMD5, "/data/a.txt", "a.txt", 5); err != nil {
+		t.Fatal(err)
+	}
+	db.UpdateMonitoredDir(conn, "/data", "add")
+
+	info, err := Create(context.Background(), conn, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := conn.Exec("DELETE FROM files"); err != nil {
+		t.Fatal(err)
+	}
+	path, err := Resolve(dir, "latest")
+	if err != nil || path != info.Path {
+		t.Fatalf("Resolve(latest) = %s, %v, want %s", path, err, info.Path)
+	}
+	if err := Restore(context.Background(), conn, path, dir); err != nil {
+		t.Fatal(err)
+	}
+	if n := countFiles(t, conn); n != 1 {
+		t.Errorf("恢复后 files = %d, want 1", n)
+	}
+
+	// 恢复前的备份与原备份同在一秒内创建时不能覆盖原备份
+	backups, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("backups = %+v, 应包含恢复前的备份", backups)
+	}
+	if backups[1].Name != info.Name {
+		t.Errorf("最旧的备份 = %s, want %s", backups[1].Name, info.Name)
+	}
+	if err := Verify(backups[0].Path); err != nil {
+		t.Error(err)
+	}
+	pre, err := sql.Open("sqlite", "file:"+backups[0].Path+"?mode=ro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pre.Close()
+	if n := countFiles(t, pre); n != 0 {
+		t.Errorf("恢复前的备份 files = %d, want 0", n)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	conn := openDB(t)
+	dir := t.TempDir()
+	var names []string
+	for i := 0; i < 3; i++ {
+		info, err := Create(context.Background(), conn, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, info.Name)
+	}
+	if err := Rotate(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 || backups[0].Name != names[2] || backups[1].Name != names[1] {
+		t.Errorf("backups = %+v, want %v", backups, names[1:])
+	}
+}
+
+func TestResolve(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Resolve(dir, "latest"); err == nil {
+		t.Error("没有备份时 Resolve(latest) 应返回错误")
+	}
+	if _, err := Resolve(dir, "../md5fs.db"); err == nil {
+		t.Error("备份目录外的路径应返回错误")
+	}
+	if path, err := Resolve(dir, "md5fs-20250101-030000.db"); err != nil || path != filepath.Join(dir, "md5fs-20250101-030000.db") {
+		t.Errorf("Resolve = %s, %v", path, err)
+	}
+}
+
+func TestRestoreRejectsDamagedSnapshot(t *testing.T) {
+	conn := openDB(t)
+	if _, err := conn.Exec("INSERT INTO files (md5, path, filename, size) VALUES (?, ?, ?, ?)",
+		helloMD5, "/data/a.txt", "a.txt", 5); err != nil {
+		t.Fatal(err)
+	}
+	bad := filepath.Join(t.TempDir(), "bad.db")
+	if err := os.WriteFile(bad, []byte("not a database"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Restore(context.Background(), conn, bad, ""); err == nil {
+		t.Fatal("损坏的快照应返回错误")
+	}
+	if n := countFiles(t, conn); n != 1 {
+		t.Errorf("恢复失败后 files = %d, 当前数据库不应改变", n)
+	}
+}
+
+func TestRebuildKeepsConfig(t *testing.T) {
+	conn := openDB(t)
+	if _, err := conn.Exec("INSERT INTO files (md5, path, filename, size) VALUES (?, ?, ?, ?)",
+		helloMD5, "/data/a.txt", "a.txt", 5); err != nil {
+		t.Fatal(err)
+	}
+	db.UpdateMonitoredDir(conn, "/data", "add")
+	if err := db.UpdateIgnoredPatterns(conn, "*.tmp"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSetting(conn, "scan_interval", "30m"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Rebuild(context.Background(), conn); err != nil {
+		t.Fatal(err)
+	}
+	if n := countFiles(t, conn); n != 0 {
+		t.Errorf("重建后 files = %d, want 0", n)
+	}
+	dirs, _ := db.GetMonitoredDirectories(conn)
+	patterns, _ := db.GetIgnoredPatterns(conn)
+	settings, _ := db.GetSettings(conn)
+	if len(dirs) != 1 || dirs[0] != "/data" {
+		t.Errorf("dirs = %v", dirs)
+	}
+	if len(patterns) != 1 || patterns[0] != "*.tmp" {
+		t.Errorf("patterns = %v", patterns)
+	}
+	if settings["scan_interval"] != "30m" {
+		t.Errorf("settings = %v", settings)
+	}
+}
@@ -8,4 +8,8 @@ type FileIndex struct {
 	Filename   string    `json:"filename"`
 	Size       int64     `json:"size"`
 	ModifiedAt time.Time `json:"modified_at"`
+	LinkType   string    `json:"link_type"`
+	LinkTarget string    `json:"link_target,omitempty"`
+	InodeKey   string    `json:"-"`
+	LinkCount  uint64    `json:"link_count"`
 }
@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"modernc.org/sqlite"
+)
+
+// backupPagesPerStep 每步复制的页数，分步复制可以让写入方在步骤之间获得锁
+const backupPagesPerStep = 256
+
+// sqliteBackuper modernc sqlite 驱动连接提供的在线备份接口
+type sqliteBackuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// Backup 使用 SQLite 在线备份 API 将数据库一致地复制到 dstPath
+//
+// 与直接复制 md5fs.db 不同，备份期间仍可正常读写，且不会遗漏 WAL 中的内容。
+func Backup(ctx context.Context, dbConn *sql.DB, dstPath string) error {
+	return runBackup(ctx, dbConn, func(b sqliteBackuper) (*sqlite.Backup, error) {
+		return b.NewBackup(dstPath)
+	})
+}
+
+// Restore 使用在线备份 API 以 srcPath 的内容覆盖当前数据库
+func Restore(ctx context.Context, dbConn *sql.DB, srcPath string) error {
+	return runBackup(ctx, dbConn, func(b sqliteBackuper) (*sqlite.Backup, error) {
+		return b.NewRestore(srcPath)
+	})
+}
+
+func runBackup(ctx context.Context, dbConn *sql.DB, start func(sqliteBackuper) (*sqlite.Backup, error)) error {
+	conn, err := dbConn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		b, ok := driverConn.(sqliteBackuper)
+		if !ok {
+			return fmt.Errorf("数据库驱动不支持在线备份")
+		}
+		backup, err := start(b)
+		if err != nil {
+			return err
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				backup.Finish()
+				return err
+			}
+			more, err := backup.Step(backupPagesPerStep)
+			if err != nil {
+				backup.Finish()
+				return err
+			}
+			if !more {
+				break
+			}
+		}
+		return backup.Finish()
+	})
+}
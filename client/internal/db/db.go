@@ -9,6 +9,12 @@ import (
 	_ "modernc.org/sqlite"
 )
 
+// Queryer *sql.DB 与 *sql.Tx 共有的查询方法，读取函数接受它以便在事务中使用
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
 func InitDB(dbPath string) (*sql.DB, error) {
 	// 确保目录存在
 	dir := filepath.Dir(dbPath)
@@ -43,16 +49,97 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		pattern TEXT NOT NULL UNIQUE
 	);
+	CREATE TABLE IF NOT EXISTS settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);
+	-- 索引时提取的文件元数据，以内容的MD5为键
+	CREATE TABLE IF NOT EXISTS file_metadata (
+		md5 TEXT PRIMARY KEY,
+		mime TEXT NOT NULL DEFAULT '',
+		width INTEGER NOT NULL DEFAULT 0,
+		height INTEGER NOT NULL DEFAULT 0,
+		taken_at DATETIME,
+		camera_make TEXT NOT NULL DEFAULT '',
+		camera_model TEXT NOT NULL DEFAULT '',
+		latitude REAL,
+		longitude REAL,
+		duration REAL NOT NULL DEFAULT 0,
+		pages INTEGER NOT NULL DEFAULT 0,
+		title TEXT NOT NULL DEFAULT '',
+		extracted_at DATETIME
+	);
+	-- 监控目录中链接数大于1的文件的所有路径，同一inode只有主路径写入 files 表
+	CREATE TABLE IF NOT EXISTS hardlinks (
+		path TEXT PRIMARY KEY,
+		inode_key TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		scan_flag INTEGER NOT NULL DEFAULT 1
+	);
 	
 	-- 添加索引优化查询性能
 	CREATE INDEX IF NOT EXISTS idx_files_path ON files(path);
 	CREATE INDEX IF NOT EXISTS idx_files_scan_flag ON files(scan_flag);
 	CREATE INDEX IF NOT EXISTS idx_files_modified_at ON files(modified_at);
 	CREATE INDEX IF NOT EXISTS idx_files_size ON files(size);
+	CREATE INDEX IF NOT EXISTS idx_file_metadata_mime ON file_metadata(mime);
+	CREATE INDEX IF NOT EXISTS idx_file_metadata_taken_at ON file_metadata(taken_at);
+	CREATE INDEX IF NOT EXISTS idx_hardlinks_inode_key ON hardlinks(inode_key);
     `
 	_, err = db.Exec(createTableSQL)
 	if err != nil {
 		return nil, fmt.Errorf("create table failed: %w", err)
 	}
+
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("migrate failed: %w", err)
+	}
 	return db, nil
 }
+
+// fileColumns 为旧版本数据库补齐的 files 表字段
+var fileColumns = []struct {
+	name       string
+	definition string
+}{
+	{"link_type", "TEXT NOT NULL DEFAULT ''"},
+	{"link_target", "TEXT NOT NULL DEFAULT ''"},
+	{"inode_key", "TEXT NOT NULL DEFAULT ''"},
+	{"link_count", "INTEGER NOT NULL DEFAULT 1"},
+}
+
+// migrate 对已有数据库做增量升级
+func migrate(db *sql.DB) error {
+	for _, col := range fileColumns {
+		if err := ensureColumn(db, "files", col.name, col.definition); err != nil {
+			return err
+		}
+	}
+	_, err := db.Exec("CREATE INDEX IF NOT EXISTS idx_files_inode_key ON files(inode_key)")
+	return err
+}
+
+// ensureColumn 在字段不存在时添加字段
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
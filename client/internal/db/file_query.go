@@ -0,0 +1,523 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-finder/shared/types"
+)
+
+// 可排序字段，键为查询参数中的名称
+var sortColumns = map[string]string{
+	"modified_at": "modified_at",
+	"size":        "size",
+	"filename":    "filename",
+	"path":        "path",
+	"md5":         "files.md5",
+}
+
+// fileFrom 查询文件时连接元数据表，尚未提取元数据的文件 m.md5 为 NULL
+const fileFrom = "files LEFT JOIN file_metadata m ON m.md5 = files.md5"
+
+// knownExtensions 按MIME类型过滤时参与匹配的常见扩展名
+var knownExtensions = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".bmp", ".webp", ".svg", ".tif", ".tiff", ".heic", ".ico",
+	".mp4", ".mov", ".m4v", ".avi", ".mkv", ".webm", ".wmv", ".flv",
+	".mp3", ".m4a", ".wav", ".flac", ".aac", ".ogg",
+	".pdf", ".txt", ".md", ".markdown", ".csv", ".json", ".xml", ".html", ".htm", ".css", ".js",
+	".doc", ".docx", ".xls", ".xlsx", ".ppt", ".pptx",
+	".zip", ".gz", ".tar", ".7z", ".rar",
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 1000
+)
+
+// FileQuery /api/files 的结构化查询条件
+type FileQuery struct {
+	Search         string
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  *time.Time
+	ModifiedBefore *time.Time
+	Extensions     []string // 小写，带点
+	MIME           string   // 完整类型或 "image/" 这样的前缀，未提取元数据的文件只按 knownExtensions 推断
+	Root           string   // 监控目录
+	PathPrefix     string
+	HashPrefix     string
+	Sort           string
+	Desc           bool
+	PageSize       int
+	Page           int    // 偏移分页，提供 Cursor 时忽略
+	Cursor         string // 游标分页
+
+	// 以下条件按提取的元数据过滤，尚未提取元数据的文件不匹配
+	TakenAfter  *time.Time
+	TakenBefore *time.Time
+	Camera      string // 相机厂商或型号包含的文本
+	MinWidth    *int64
+	MinHeight   *int64
+	MinDuration *float64 // 秒
+	MaxDuration *float64
+	HasLocation bool   // 只返回带GPS位置的照片
+	Title       string // PDF 标题包含的文本
+}
+
+// fileCursor 游标内容：上一页最后一条记录的排序值和 rowid
+type fileCursor struct {
+	Sort  string      `json:"s"`
+	Desc  bool        `json:"d"`
+	Value interface{} `json:"v"`
+	RowID int64       `json:"r"`
+}
+
+// ParseFileQuery 从URL参数解析查询条件
+func ParseFileQuery(values url.Values) (FileQuery, error) {
+	q := FileQuery{
+		Search:     values.Get("search"),
+		MIME:       strings.ToLower(values.Get("mime")),
+		Root:       values.Get("root"),
+		PathPrefix: values.Get("pathPrefix"),
+		HashPrefix: strings.ToLower(values.Get("hashPrefix")),
+		Sort:       "modified_at",
+		Desc:       true,
+		PageSize:   defaultPageSize,
+		Page:       1,
+		Cursor:     values.Get("cursor"),
+	}
+
+	var err error
+	if q.MinSize, err = parseInt64Param(values, "minSize"); err != nil {
+		return q, err
+	}
+	if q.MaxSize, err = parseInt64Param(values, "maxSize"); err != nil {
+		return q, err
+	}
+	if q.ModifiedAfter, err = parseTimeParam(values, "modifiedAfter"); err != nil {
+		return q, err
+	}
+	if q.ModifiedBefore, err = parseTimeParam(values, "modifiedBefore"); err != nil {
+		return q, err
+	}
+	if q.TakenAfter, err = parseTimeParam(values, "takenAfter"); err != nil {
+		return q, err
+	}
+	if q.TakenBefore, err = parseTimeParam(values, "takenBefore"); err != nil {
+		return q, err
+	}
+	if q.MinWidth, err = parseInt64Param(values, "minWidth"); err != nil {
+		return q, err
+	}
+	if q.MinHeight, err = parseInt64Param(values, "minHeight"); err != nil {
+		return q, err
+	}
+	if q.MinDuration, err = parseFloatParam(values, "minDuration"); err != nil {
+		return q, err
+	}
+	if q.MaxDuration, err = parseFloatParam(values, "maxDuration"); err != nil {
+		return q, err
+	}
+	q.Camera = values.Get("camera")
+	q.Title = values.Get("title")
+	switch v := values.Get("hasLocation"); v {
+	case "", "false", "0":
+	case "true", "1":
+		q.HasLocation = true
+	default:
+		return q, fmt.Errorf("无效的参数 hasLocation: %s", v)
+	}
+
+	for _, v := range values["ext"] {
+		for _, ext := range strings.Split(v, ",") {
+			ext = strings.ToLower(strings.TrimSpace(ext))
+			if ext == "" {
+				continue
+			}
+			if !strings.HasPrefix(ext, ".") {
+				ext = "." + ext
+			}
+			q.Extensions = append(q.Extensions, ext)
+		}
+	}
+
+	if q.HashPrefix != "" {
+		if len(q.HashPrefix) > 32 || strings.Trim(q.HashPrefix, "0123456789abcdef") != "" {
+			return q, fmt.Errorf("无效的哈希前缀: %s", q.HashPrefix)
+		}
+	}
+
+	if sort := values.Get("sort"); sort != "" {
+		if _, ok := sortColumns[sort]; !ok {
+			return q, fmt.Errorf("不支持的排序字段: %s", sort)
+		}
+		q.Sort = sort
+		// 指定排序字段时默认升序，修改时间除外
+		q.Desc = sort == "modified_at"
+	}
+	switch strings.ToLower(values.Get("order")) {
+	case "":
+	case "asc":
+		q.Desc = false
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("不支持的排序方向: %s", values.Get("order"))
+	}
+
+	if v := values.Get("pageSize"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n >= 1 {
+			q.PageSize = n
+		}
+	}
+	if q.PageSize > maxPageSize {
+		q.PageSize = maxPageSize
+	}
+	if v := values.Get("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n >= 1 {
+			q.Page = n
+		}
+	}
+	return q, nil
+}
+
+func parseInt64Param(values url.Values, name string) (*int64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("无效的参数 %s: %s", name, v)
+	}
+	return &n, nil
+}
+
+func parseFloatParam(values url.Values, name string) (*float64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("无效的参数 %s: %s", name, v)
+	}
+	return &n, nil
+}
+
+// parseTimeParam 支持 RFC3339 时间、日期（本地时区零点）和 Unix 秒
+func parseTimeParam(values url.Values, name string) (*time.Time, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		return &t, nil
+	}
+	if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+		t := time.Unix(n, 0)
+		return &t, nil
+	}
+	return nil, fmt.Errorf("无效的时间参数 %s: %s", name, v)
+}
+
+// FileQueryResult 查询结果
+type FileQueryResult = types.FileList
+
+// FileRow 文件索引记录
+type FileRow = types.FileInfo
+
+// where 构造过滤条件
+//
+// 大小、修改时间、路径和哈希前缀都转换为范围条件，以便使用
+// idx_files_size、idx_files_modified_at、idx_files_path 和主键索引。
+func (q FileQuery) where() (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+	if q.Search != "" {
+		like := "%" + q.Search + "%"
+		conds = append(conds, "(filename LIKE ? OR path LIKE ?)")
+		args = append(args, like, like)
+	}
+	if q.MinSize != nil {
+		conds = append(conds, "size >= ?")
+		args = append(args, *q.MinSize)
+	}
+	if q.MaxSize != nil {
+		conds = append(conds, "size <= ?")
+		args = append(args, *q.MaxSize)
+	}
+	if q.ModifiedAfter != nil {
+		conds = append(conds, "modified_at >= ?")
+		args = append(args, modifiedAtArg(*q.ModifiedAfter))
+	}
+	if q.ModifiedBefore != nil {
+		conds = append(conds, "modified_at < ?")
+		args = append(args, modifiedAtArg(*q.ModifiedBefore))
+	}
+
+	// 扩展名与MIME类型满足其一即可
+	var parts []string
+	for _, ext := range q.Extensions {
+		parts = append(parts, "filename LIKE ?")
+		args = append(args, "%"+ext)
+	}
+	if q.MIME != "" {
+		// 已提取元数据的文件按内容识别的类型匹配，其余按扩展名推断，
+		// knownExtensions 以外的扩展名要等元数据提取后才能匹配
+		typ, prefix := mimeMatch(q.MIME)
+		if prefix {
+			parts = append(parts, "m.mime LIKE ?")
+			args = append(args, typ+"%")
+		} else {
+			parts = append(parts, "m.mime = ?")
+			args = append(args, typ)
+		}
+		if exts := extensionsForMIME(q.MIME); len(exts) > 0 {
+			extParts := make([]string, len(exts))
+			for i, ext := range exts {
+				extParts[i] = "filename LIKE ?"
+				args = append(args, "%"+ext)
+			}
+			parts = append(parts, "(m.md5 IS NULL AND ("+strings.Join(extParts, " OR ")+"))")
+		}
+	}
+	if len(parts) > 0 {
+		conds = append(conds, "("+strings.Join(parts, " OR ")+")")
+	}
+
+	if q.Root != "" {
+		root := strings.TrimRight(q.Root, `/\`)
+		conds = append(conds, "path > ? AND path < ?")
+		args = append(args, root+string(filepath.Separator), prefixUpperBound(root+string(filepath.Separator)))
+	}
+	if q.PathPrefix != "" {
+		conds = append(conds, "path >= ? AND path < ?")
+		args = append(args, q.PathPrefix, prefixUpperBound(q.PathPrefix))
+	}
+	if q.HashPrefix != "" {
+		conds = append(conds, "files.md5 >= ? AND files.md5 < ?")
+		args = append(args, q.HashPrefix, prefixUpperBound(q.HashPrefix))
+	}
+
+	if q.TakenAfter != nil {
+		conds = append(conds, "m.taken_at >= ?")
+		args = append(args, q.TakenAfter.UTC())
+	}
+	if q.TakenBefore != nil {
+		conds = append(conds, "m.taken_at < ?")
+		args = append(args, q.TakenBefore.UTC())
+	}
+	if q.Camera != "" {
+		like := "%" + q.Camera + "%"
+		conds = append(conds, "(m.camera_make LIKE ? OR m.camera_model LIKE ?)")
+		args = append(args, like, like)
+	}
+	if q.MinWidth != nil {
+		conds = append(conds, "m.width >= ?")
+		args = append(args, *q.MinWidth)
+	}
+	if q.MinHeight != nil {
+		conds = append(conds, "m.height >= ?")
+		args = append(args, *q.MinHeight)
+	}
+	if q.MinDuration != nil {
+		conds = append(conds, "m.duration >= ?")
+		args = append(args, *q.MinDuration)
+	}
+	if q.MaxDuration != nil {
+		conds = append(conds, "m.duration > 0 AND m.duration <= ?")
+		args = append(args, *q.MaxDuration)
+	}
+	if q.HasLocation {
+		conds = append(conds, "m.latitude IS NOT NULL")
+	}
+	if q.Title != "" {
+		conds = append(conds, "m.title LIKE ?")
+		args = append(args, "%"+q.Title+"%")
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// modifiedAtArg 把时间转换为与 modified_at 列相同的时区
+//
+// 驱动把时间保存为 Time.String() 的文本，扫描器写入的是本地时区的修改时间，
+// 文本比较只在时区相同时与时间先后一致，因此参数也交给驱动按本地时区格式化。
+func modifiedAtArg(t time.Time) time.Time {
+	return t.Local()
+}
+
+// prefixUpperBound 返回所有以 prefix 开头的字符串的上界
+func prefixUpperBound(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return string(b) + "\xff"
+}
+
+// mimeMatch 解析MIME过滤条件，"image/" 或 "image/*" 为前缀匹配
+func mimeMatch(typ string) (string, bool) {
+	prefix := strings.HasSuffix(typ, "/") || strings.HasSuffix(typ, "/*")
+	return strings.TrimSuffix(typ, "*"), prefix
+}
+
+// extensionsForMIME 返回MIME类型（或前缀）对应的扩展名
+func extensionsForMIME(typ string) []string {
+	typ, prefix := mimeMatch(typ)
+
+	var exts []string
+	for _, ext := range knownExtensions {
+		t := mime.TypeByExtension(ext)
+		if ext == ".md" || ext == ".markdown" {
+			t = "text/markdown"
+		}
+		t = strings.ToLower(strings.TrimSpace(strings.SplitN(t, ";", 2)[0]))
+		if t == "" {
+			continue
+		}
+		if (prefix && strings.HasPrefix(t, typ)) || (!prefix && t == typ) {
+			exts = append(exts, ext)
+		}
+	}
+	return exts
+}
+
+// QueryFiles 执行结构化查询
+//
+// 排序以 rowid 作为次序键，单列索引 (col, rowid) 可以直接满足排序，
+// 游标分页使用行值比较 (col, rowid) > (?, ?)，深翻页不需要 OFFSET。
+func QueryFiles(dbConn *sql.DB, q FileQuery) (FileQueryResult, error) {
+	result := FileQueryResult{Files: make([]FileRow, 0)}
+	where, args := q.where()
+
+	if err := dbConn.QueryRow("SELECT COUNT(*) FROM "+fileFrom+" "+where, args...).Scan(&result.Total); err != nil {
+		return result, err
+	}
+
+	col := sortColumns[q.Sort]
+	// 游标中保存排序列的原始值；modified_at 以驱动写入的文本形式比较
+	cursorExpr := col
+	if col == "modified_at" {
+		cursorExpr = "CAST(modified_at AS TEXT)"
+	}
+	dir, cmp := "ASC", ">"
+	if q.Desc {
+		dir, cmp = "DESC", "<"
+	}
+
+	dataArgs := append([]interface{}{}, args...)
+	paging := ""
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor)
+		if err != nil {
+			return result, err
+		}
+		if c.Sort != q.Sort || c.Desc != q.Desc {
+			return result, fmt.Errorf("游标与排序条件不一致")
+		}
+		cond := fmt.Sprintf("(%s, files.rowid) %s (?, ?)", col, cmp)
+		if where == "" {
+			where = "WHERE " + cond
+		} else {
+			where += " AND " + cond
+		}
+		dataArgs = append(dataArgs, c.Value, c.RowID)
+	} else {
+		paging = " OFFSET ?"
+	}
+
+	dataSQL := fmt.Sprintf(
+		"SELECT files.rowid, files.md5, path, filename, size, modified_at, link_type, link_count, %s, %s FROM %s %s ORDER BY %s %s, files.rowid %s LIMIT ?%s",
+		cursorExpr, metadataColumns, fileFrom, where, col, dir, dir, paging)
+	dataArgs = append(dataArgs, q.PageSize)
+	if paging != "" {
+		dataArgs = append(dataArgs, (q.Page-1)*q.PageSize)
+	}
+
+	rows, err := dbConn.Query(dataSQL, dataArgs...)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+
+	var (
+		lastRowID int64
+		lastValue interface{}
+	)
+	for rows.Next() {
+		var (
+			f     FileRow
+			value interface{}
+			meta  metadataRow
+		)
+		dest := append([]interface{}{&lastRowID, &f.MD5, &f.Path, &f.Filename, &f.Size, &f.ModifiedAt,
+			&f.LinkType, &f.LinkCount, &value}, meta.dest()...)
+		if err := rows.Scan(dest...); err != nil {
+			return result, err
+		}
+		f.Metadata = meta.value()
+		lastValue = value
+		result.Files = append(result.Files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	if len(result.Files) == q.PageSize {
+		result.NextCursor = encodeCursor(fileCursor{Sort: q.Sort, Desc: q.Desc, Value: lastValue, RowID: lastRowID})
+	}
+	return result, nil
+}
+
+func encodeCursor(c fileCursor) string {
+	if b, ok := c.Value.([]byte); ok {
+		c.Value = string(b)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (fileCursor, error) {
+	var c fileCursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("无效的游标")
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return c, fmt.Errorf("无效的游标")
+	}
+	// JSON 数字还原为整数，与 size 列比较
+	if n, ok := c.Value.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			c.Value = i
+		} else {
+			return c, fmt.Errorf("无效的游标")
+		}
+	}
+	return c, nil
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openQueryDB 创建测试数据库，本地时区固定为 UTC+8，
+// 与 UTC 表示的查询参数不同，才能发现按文本比较时间的问题
+func openQueryDB(t *testing.T) *sql.DB {
+	t.Helper()
+	local := time.Local
+	time.Local = time.FixedZone("CST", 8*3600)
+	t.Cleanup(func() { time.Local = local })
+
+	conn, err := InitDB(filepath.Join(t.TempDir(), "md5fs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// 与扫描器一样写入本地时区的修改时间；c.txt 与 d.txt 修改时间相同，由 rowid 决定次序
+	base := time.Date(2024, 5, 1, 20, 0, 0, 0, time.Local)
+	files := []struct {
+		name     string
+		size     int64
+		modified time.Time
+	}{
+		{"a.txt", 300, base},
+		{"b.jpg", 100, base.Add(time.Hour)},
+		{"c.txt", 200, base.Add(2 * time.Hour)},
+		{"d.pdf", 200, base.Add(2 * time.Hour)},
+		{"e.JPG", 500, base.Add(-24 * time.Hour)},
+	}
+	for i, f := range files {
+		if _, err := conn.Exec("INSERT INTO files (md5, path, filename, size, modified_at) VALUES (?, ?, ?, ?, ?)",
+			fmt.Sprintf("%032x", i+1), "/data/"+f.name, f.name, f.size, f.modified); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return conn
+}
+
+func queryNames(t *testing.T, conn *sql.DB, raw string) []string {
+	t.Helper()
+	values, _ := url.ParseQuery(raw)
+	q, err := ParseFileQuery(values)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := QueryFiles(conn, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(result.Files))
+	for _, f := range result.Files {
+		names = append(names, f.Filename)
+	}
+	return names
+}
+
+func TestQueryFilesModifiedRange(t *testing.T) {
+	conn := openQueryDB(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		// 2024-05-01T12:00:00Z 即本地时间 20:00
+		{"modifiedAfter=2024-05-01T12:00:00Z&sort=filename", "[a.txt b.jpg c.txt d.pdf]"},
+		{"modifiedAfter=2024-05-01T21:00:00%2B09:00&sort=filename", "[a.txt b.jpg c.txt d.pdf]"},
+		{"modifiedBefore=2024-05-01T13:00:00Z&sort=filename", "[a.txt e.JPG]"},
+		{"modifiedAfter=2024-05-01T12:30:00Z&modifiedBefore=2024-05-01T14:00:00Z&sort=filename", "[b.jpg]"},
+		{"modifiedAfter=2024-05-01&modifiedBefore=2024-05-02&sort=filename", "[a.txt b.jpg c.txt d.pdf]"},
+		{fmt.Sprintf("modifiedAfter=%d&sort=filename", time.Date(2024, 5, 1, 14, 0, 0, 0, time.UTC).Unix()), "[c.txt d.pdf]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(queryNames(t, conn, tt.query)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestQueryFilesCursorPaging(t *testing.T) {
+	conn := openQueryDB(t)
+	for _, raw := range []string{
+		"sort=modified_at",
+		"sort=modified_at&order=asc",
+		"sort=size",
+		"sort=size&order=desc",
+		"sort=filename",
+		"sort=md5&order=desc",
+		"sort=size&ext=txt,pdf",
+	} {
+		values, _ := url.ParseQuery(raw)
+		q, err := ParseFileQuery(values)
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.PageSize = 100
+		all, err := QueryFiles(conn, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// 每页两条，沿游标翻页应得到与一次性查询相同的顺序
+		q.PageSize = 2
+		var paged []string
+		for page := 0; ; page++ {
+			if page > len(all.Files) {
+				t.Fatalf("%s: 游标翻页没有结束", raw)
+			}
+			result, err := QueryFiles(conn, q)
+			if err != nil {
+				t.Fatalf("%s: %v", raw, err)
+			}
+			if result.Total != all.Total {
+				t.Errorf("%s: total = %d, want %d", raw, result.Total, all.Total)
+			}
+			for _, f := range result.Files {
+				paged = append(paged, f.Filename)
+			}
+			if result.NextCursor == "" {
+				break
+			}
+			q.Cursor = result.NextCursor
+		}
+		var want []string
+		for _, f := range all.Files {
+			want = append(want, f.Filename)
+		}
+		if fmt.Sprint(paged) != fmt.Sprint(want) {
+			t.Errorf("%s: 游标翻页 %v, want %v", raw, paged, want)
+		}
+	}
+}
+
+func TestQueryFilesCursorMismatch(t *testing.T) {
+	conn := openQueryDB(t)
+	q, err := ParseFileQuery(url.Values{"sort": {"size"}, "pageSize": {"2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := QueryFiles(conn, q)
+	if err != nil || result.NextCursor == "" {
+		t.Fatalf("result = %+v, %v", result, err)
+	}
+
+	q.Sort = "filename"
+	q.Cursor = result.NextCursor
+	if _, err := QueryFiles(conn, q); err == nil {
+		t.Error("排序字段与游标不一致时应返回错误")
+	}
+	q.Cursor = "not-a-cursor"
+	if _, err := QueryFiles(conn, q); err == nil {
+		t.Error("无效的游标应返回错误")
+	}
+}
+
+func TestQueryFilesMIMEByExtension(t *testing.T) {
+	conn := openQueryDB(t)
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"mime=image/&sort=filename", "[b.jpg e.JPG]"},
+		{"mime=image/*&sort=filename", "[b.jpg e.JPG]"},
+		{"mime=application/pdf&sort=filename", "[d.pdf]"},
+		{"mime=application/pdf&ext=jpg&sort=filename", "[b.jpg d.pdf e.JPG]"},
+		{"mime=video/&sort=filename", "[]"},
+	}
+	for _, tt := range tests {
+		if got := fmt.Sprint(queryNames(t, conn, tt.query)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
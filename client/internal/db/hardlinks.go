@@ -0,0 +1,66 @@
+package db
+
+import (
+	"database/sql"
+	"sort"
+)
+
+// HardlinkGroup 监控目录中指向同一inode的一组路径
+type HardlinkGroup struct {
+	InodeKey  string   `json:"inode_key"`
+	MD5       string   `json:"md5"`
+	Path      string   `json:"path"` // 写入索引的主路径，即组内最小的路径
+	Size      int64    `json:"size"`
+	LinkCount int      `json:"link_count"` // 监控目录中的路径数，不含目录外的链接
+	Paths     []string `json:"paths"`
+}
+
+// SaveHardlink 记录硬链接的一个路径，并标记为本轮扫描存在
+func SaveHardlink(dbConn *sql.DB, path, inodeKey string, size int64) error {
+	_, err := dbConn.Exec(`
+		INSERT INTO hardlinks (path, inode_key, size, scan_flag) VALUES (?, ?, ?, 1)
+		ON CONFLICT(path) DO UPDATE SET inode_key = excluded.inode_key, size = excluded.size, scan_flag = 1
+	`, path, inodeKey, size)
+	return err
+}
+
+// GetHardlinkGroups 返回监控目录中至少有两个路径的硬链接分组，按大小降序；
+// sharedBytes 为这些路径因共享数据而未额外占用的空间
+func GetHardlinkGroups(dbConn *sql.DB) ([]HardlinkGroup, int64, error) {
+	rows, err := dbConn.Query(`
+		SELECT h.inode_key, h.path, h.size,
+			COALESCE((SELECT f.md5 FROM files f WHERE f.inode_key = h.inode_key ORDER BY f.path LIMIT 1), '')
+		FROM hardlinks h
+		WHERE h.inode_key IN (SELECT inode_key FROM hardlinks GROUP BY inode_key HAVING COUNT(*) > 1)
+		ORDER BY h.inode_key, h.path`)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	groups := make([]HardlinkGroup, 0)
+	for rows.Next() {
+		var inodeKey, path, md5 string
+		var size int64
+		if err := rows.Scan(&inodeKey, &path, &size, &md5); err != nil {
+			return nil, 0, err
+		}
+		if n := len(groups); n == 0 || groups[n-1].InodeKey != inodeKey {
+			// 路径升序，第一个即主路径
+			groups = append(groups, HardlinkGroup{InodeKey: inodeKey, MD5: md5, Path: path, Size: size})
+		}
+		g := &groups[len(groups)-1]
+		g.Paths = append(g.Paths, path)
+		g.LinkCount++
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var sharedBytes int64
+	for _, g := range groups {
+		sharedBytes += g.Size * int64(g.LinkCount-1)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Size > groups[j].Size })
+	return groups, sharedBytes, nil
+}
@@ -7,7 +7,7 @@ import (
 )
 
 // GetIgnoredPatterns retrieves all ignored patterns from the database.
-func GetIgnoredPatterns(dbConn *sql.DB) ([]string, error) {
+func GetIgnoredPatterns(dbConn Queryer) ([]string, error) {
 	rows, err := dbConn.Query("SELECT pattern FROM ignored_patterns")
 	if err != nil {
 		return nil, err
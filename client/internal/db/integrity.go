@@ -0,0 +1,26 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// CheckIntegrity 执行 PRAGMA integrity_check，返回发现的问题，数据库完好时返回空列表
+func CheckIntegrity(dbConn *sql.DB) ([]string, error) {
+	rows, err := dbConn.Query("PRAGMA integrity_check")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return nil, err
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	return problems, rows.Err()
+}
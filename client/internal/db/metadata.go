@@ -0,0 +1,87 @@
+package db
+
+import (
+	"database/sql"
+	"time"
+
+	"smart-finder/shared/types"
+)
+
+// metadataColumns 查询 file_metadata 的字段，表别名为 m，与 metadataRow.dest 对应
+const metadataColumns = "m.md5, m.mime, m.width, m.height, m.taken_at, m.camera_make, m.camera_model, " +
+	"m.latitude, m.longitude, m.duration, m.pages, m.title"
+
+// SaveMetadata 保存文件元数据，元数据只取决于文件内容，以MD5为键
+func SaveMetadata(dbConn *sql.DB, md5 string, m *types.FileMetadata) error {
+	// 统一为 UTC，按文本比较时间范围才正确
+	var takenAt interface{}
+	if m.TakenAt != nil {
+		takenAt = m.TakenAt.UTC()
+	}
+	_, err := dbConn.Exec(`
+		INSERT OR REPLACE INTO file_metadata (md5, mime, width, height, taken_at, camera_make, camera_model,
+			latitude, longitude, duration, pages, title, extracted_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, md5, m.MIME, m.Width, m.Height, takenAt, m.CameraMake, m.CameraModel,
+		m.Latitude, m.Longitude, m.Duration, m.Pages, m.Title, time.Now())
+	return err
+}
+
+// GetMetadata 获取文件元数据，尚未提取时返回 nil
+func GetMetadata(dbConn *sql.DB, md5 string) (*types.FileMetadata, error) {
+	var row metadataRow
+	err := dbConn.QueryRow("SELECT "+metadataColumns+" FROM file_metadata m WHERE m.md5 = ?", md5).Scan(row.dest()...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return row.value(), nil
+}
+
+// DeleteOrphanMetadata 删除已不在索引中的文件的元数据
+func DeleteOrphanMetadata(dbConn *sql.DB) (int64, error) {
+	result, err := dbConn.Exec("DELETE FROM file_metadata WHERE md5 NOT IN (SELECT md5 FROM files)")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// metadataRow LEFT JOIN file_metadata 时可能为 NULL 的字段
+type metadataRow struct {
+	md5, mime, cameraMake, cameraModel, title sql.NullString
+	width, height, pages                      sql.NullInt64
+	latitude, longitude, duration             sql.NullFloat64
+	takenAt                                   sql.NullTime
+}
+
+func (r *metadataRow) dest() []interface{} {
+	return []interface{}{&r.md5, &r.mime, &r.width, &r.height, &r.takenAt, &r.cameraMake, &r.cameraModel,
+		&r.latitude, &r.longitude, &r.duration, &r.pages, &r.title}
+}
+
+// value 转换为 API 中的结构，文件没有元数据时返回 nil
+func (r *metadataRow) value() *types.FileMetadata {
+	if !r.md5.Valid {
+		return nil
+	}
+	m := &types.FileMetadata{
+		MIME:        r.mime.String,
+		Width:       int(r.width.Int64),
+		Height:      int(r.height.Int64),
+		CameraMake:  r.cameraMake.String,
+		CameraModel: r.cameraModel.String,
+		Duration:    r.duration.Float64,
+		Pages:       int(r.pages.Int64),
+		Title:       r.title.String,
+	}
+	if r.takenAt.Valid {
+		m.TakenAt = &r.takenAt.Time
+	}
+	if r.latitude.Valid && r.longitude.Valid {
+		m.Latitude, m.Longitude = &r.latitude.Float64, &r.longitude.Float64
+	}
+	return m
+}
@@ -6,7 +6,7 @@ import (
 )
 
 // GetMonitoredDirectories 获取所有监控目录
-func GetMonitoredDirectories(dbConn *sql.DB) ([]string, error) {
+func GetMonitoredDirectories(dbConn Queryer) ([]string, error) {
 	rows, err := dbConn.Query("SELECT path FROM monitored_directories")
 	if err != nil {
 		return nil, err
@@ -51,6 +51,12 @@ func UpdateMonitoredDir(dbConn *sql.DB, path string, action string) {
 			tx.Rollback()
 			return
 		}
+		_, err = tx.Exec("DELETE FROM hardlinks WHERE path LIKE ?", path+"%")
+		if err != nil {
+			log.Println("删除硬链接记录失败:", err)
+			tx.Rollback()
+			return
+		}
 		err = tx.Commit()
 		if err != nil {
 			log.Println("提交事务失败:", err)
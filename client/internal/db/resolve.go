@@ -0,0 +1,39 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// MaxResolveBatch ResolveHashes 单次允许的最大哈希数
+const MaxResolveBatch = 1000
+
+// ResolveHashes 用一条 md5 IN (...) 查询解析多个哈希，走 files 的主键索引
+//
+// hashes 需为小写；未找到的哈希不出现在结果中。
+func ResolveHashes(dbConn *sql.DB, hashes []string) (map[string]FileRow, error) {
+	found := make(map[string]FileRow, len(hashes))
+	if len(hashes) == 0 {
+		return found, nil
+	}
+	args := make([]interface{}, len(hashes))
+	for i, hash := range hashes {
+		args[i] = hash
+	}
+	query := "SELECT md5, path, filename, size, modified_at, link_type, link_count FROM files WHERE md5 IN (" +
+		strings.TrimSuffix(strings.Repeat("?,", len(hashes)), ",") + ")"
+	rows, err := dbConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f FileRow
+		if err := rows.Scan(&f.MD5, &f.Path, &f.Filename, &f.Size, &f.ModifiedAt, &f.LinkType, &f.LinkCount); err != nil {
+			return nil, err
+		}
+		found[strings.ToLower(f.MD5)] = f
+	}
+	return found, rows.Err()
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"database/sql"
+)
+
+// 设置项键名
+const (
+	// SettingSymlinkPolicy 符号链接处理策略
+	SettingSymlinkPolicy = "symlink_policy"
+	// SettingBackupDir 自动备份目录
+	SettingBackupDir = "backup_dir"
+	// SettingBackupInterval 自动备份间隔，Go duration 格式，0 表示关闭
+	SettingBackupInterval = "backup_interval"
+	// SettingBackupKeep 保留的备份数量
+	SettingBackupKeep = "backup_keep"
+	// SettingRegistryURL 登记的网关地址，为空表示不登记
+	SettingRegistryURL = "registry_url"
+	// SettingRegistryToken 网关的 registry.token
+	SettingRegistryToken = "registry_token"
+	// SettingRegistryName 向其他用户显示的主机名，默认为计算机名
+	SettingRegistryName = "registry_name"
+	// SettingRegistryRoots 发布的监控目录，每行一个；未列出的目录不发布
+	SettingRegistryRoots = "registry_roots"
+	// SettingRegistryPaths 发布路径的方式：full、relative 或 none
+	SettingRegistryPaths = "registry_paths"
+	// SettingRegistryClientID 本机在网关上的标识，首次登记时生成
+	SettingRegistryClientID = "registry_client_id"
+	// SettingThumbCacheMB 缩略图缓存的磁盘配额，单位 MB，0 表示不缓存
+	SettingThumbCacheMB = "thumb_cache_mb"
+	// SettingThumbPregenerate 是否在索引时预先生成缩略图
+	SettingThumbPregenerate = "thumb_pregenerate"
+)
+
+// GetSetting 获取设置项，不存在时返回默认值
+func GetSetting(dbConn *sql.DB, key, defaultValue string) string {
+	var value string
+	err := dbConn.QueryRow("SELECT value FROM settings WHERE key = ?", key).Scan(&value)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// GetSettings 获取所有设置项
+func GetSettings(dbConn Queryer) (map[string]string, error) {
+	rows, err := dbConn.Query("SELECT key, value FROM settings")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+// SetSetting 保存设置项
+func SetSetting(dbConn *sql.DB, key, value string) error {
+	_, err := dbConn.Exec(`
+		INSERT INTO settings (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value
+	`, key, value)
+	return err
+}
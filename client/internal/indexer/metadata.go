@@ -0,0 +1,42 @@
+package indexer
+
+import (
+	"log"
+	"sync"
+
+	"smart-finder/client/internal/metadata"
+	"smart-finder/shared/types"
+)
+
+var (
+	indexedHooksMu sync.RWMutex
+	indexedHooks   []func(md5sum, path string, m *types.FileMetadata)
+)
+
+// OnFileIndexed 注册保存元数据后的回调，添加目录时的扫描与定时扫描都会调用；
+// 回调在扫描协程中执行，耗时的处理会拖慢扫描
+func OnFileIndexed(f func(md5sum, path string, m *types.FileMetadata)) {
+	indexedHooksMu.Lock()
+	defer indexedHooksMu.Unlock()
+	indexedHooks = append(indexedHooks, f)
+}
+
+// notifyIndexed 调用 OnFileIndexed 注册的回调
+func notifyIndexed(md5sum, path string, m *types.FileMetadata) {
+	indexedHooksMu.RLock()
+	hooks := indexedHooks
+	indexedHooksMu.RUnlock()
+	for _, f := range hooks {
+		f(md5sum, path, m)
+	}
+}
+
+// extractMetadata 提取文件元数据，失败只记录日志，不影响索引；
+// 部分提取器失败时仍返回已提取的部分
+func extractMetadata(path string) *types.FileMetadata {
+	m, err := metadata.Extract(path)
+	if err != nil {
+		log.Printf("提取元数据失败 %s: %v", path, err)
+	}
+	return m
+}
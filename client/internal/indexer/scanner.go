@@ -8,6 +8,8 @@ import (
 
 	"smart-finder/client/internal/core"
 	"smart-finder/client/internal/db"
+	"smart-finder/shared/utils"
+	"smart-finder/shared/walk"
 )
 
 var (
@@ -26,84 +28,117 @@ func Scanner(dbConn *sql.DB, root string) error {
 		// Decide if you want to continue without ignore patterns or return the error
 	}
 
-	// First, count the total number of files to be indexed.
-	total := 0
-	filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip files that can't be accessed
-		}
+	policy, err := walk.ParseSymlinkPolicy(db.GetSetting(dbConn, db.SettingSymlinkPolicy, string(walk.DefaultSymlinkPolicy)))
+	if err != nil {
+		log.Printf("Invalid symlink policy, using default: %v", err)
+		policy = walk.DefaultSymlinkPolicy
+	}
 
-		// Check against ignore patterns
+	ignore := func(path string, info os.FileInfo) bool {
 		for _, pattern := range ignorePatterns {
 			matched, _ := filepath.Match(pattern, info.Name())
 			if matched {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
+				return true
 			}
 		}
+		return false
+	}
 
-		if !info.IsDir() {
+	// First, count the total number of files to be indexed and pick the
+	// smallest path of each hardlink group as the one written to files.
+	total := 0
+	primaryPaths := make(map[string]string)
+	walk.Tree(root, walk.Options{
+		Policy: policy,
+		Ignore: ignore,
+		OnFile: func(entry walk.Entry) {
 			total++
-		}
-		return nil
+			if inodeKey, linkCount, ok := walk.FileIdentity(entry.Path, entry.Info); ok && linkCount > 1 {
+				if p, seen := primaryPaths[inodeKey]; !seen || entry.Path < p {
+					primaryPaths[inodeKey] = entry.Path
+				}
+			}
+		},
 	})
 	IndexingTotal = total
 	IndexingDone = 0
 
 	// Formal indexing
-	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
+	return walk.Tree(root, walk.Options{
+		Policy: policy,
+		Ignore: ignore,
+		OnSkip: func(path, reason string) {
+			log.Printf("Skipping %s: %s", path, reason)
+		},
+		OnError: func(path string, err error) {
 			log.Printf("Error accessing a file or directory: %s, error: %v, skipping", path, err)
-			return nil
-		}
-
-		// Check against ignore patterns
-		for _, pattern := range ignorePatterns {
-			matched, _ := filepath.Match(pattern, info.Name())
-			if matched {
-				if info.IsDir() {
-					return filepath.SkipDir
+		},
+		OnFile: func(entry walk.Entry) {
+			defer func() { IndexingDone++ }()
+
+			path, info := entry.Path, entry.Info
+			linkType := entry.LinkType
+			inodeKey, linkCount, ok := walk.FileIdentity(path, info)
+			if ok && linkCount > 1 {
+				if err := db.SaveHardlink(dbConn, path, inodeKey, info.Size()); err != nil {
+					log.Printf("Failed to record hardlink: %s, error: %v", path, err)
+				}
+				if p, seen := primaryPaths[inodeKey]; !seen {
+					primaryPaths[inodeKey] = path
+				} else if p != path {
+					log.Printf("Skipping %s: %s", path, walk.SkipReasonHardlink)
+					return
+				}
+				if linkType == walk.LinkTypeNone {
+					linkType = walk.LinkTypeHardlink
 				}
-				return nil
 			}
-		}
 
-		if info.IsDir() {
-			return nil // Skip directories themselves
-		}
-
-		md5sum, err := CalculateMD5(path)
-		if err != nil {
-			log.Printf("Error calculating MD5 for: %s, error: %v, skipping", path, err)
-			return nil
-		}
+			md5sum, err := utils.CalculateMD5(path)
+			if err != nil {
+				log.Printf("Error calculating MD5 for: %s, error: %v, skipping", path, err)
+				return
+			}
 
-		fileIndex := core.FileIndex{
-			MD5:        md5sum,
-			Path:       path,
-			Filename:   info.Name(),
-			Size:       info.Size(),
-			ModifiedAt: info.ModTime(),
-		}
+			fileIndex := core.FileIndex{
+				MD5:        md5sum,
+				Path:       path,
+				Filename:   filepath.Base(path),
+				Size:       info.Size(),
+				ModifiedAt: info.ModTime(),
+				LinkType:   linkType,
+				LinkTarget: entry.LinkTarget,
+				InodeKey:   inodeKey,
+				LinkCount:  linkCount,
+			}
 
-		// Insert or update
-		_, err = dbConn.Exec(`
-            INSERT INTO files (md5, path, filename, size, modified_at)
-            VALUES (?, ?, ?, ?, ?)
+			// Insert or update
+			_, err = dbConn.Exec(`
+            INSERT INTO files (md5, path, filename, size, modified_at, link_type, link_target, inode_key, link_count)
+            VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
             ON CONFLICT(md5) DO UPDATE SET
                 path=excluded.path,
                 filename=excluded.filename,
                 size=excluded.size,
-                modified_at=excluded.modified_at
-        `, fileIndex.MD5, fileIndex.Path, fileIndex.Filename, fileIndex.Size, fileIndex.ModifiedAt)
-		if err != nil {
-			log.Printf("Failed to index file: %s, error: %v", path, err)
-		}
+                modified_at=excluded.modified_at,
+                link_type=excluded.link_type,
+                link_target=excluded.link_target,
+                inode_key=excluded.inode_key,
+                link_count=excluded.link_count
+        `, fileIndex.MD5, fileIndex.Path, fileIndex.Filename, fileIndex.Size, fileIndex.ModifiedAt,
+				fileIndex.LinkType, fileIndex.LinkTarget, fileIndex.InodeKey, fileIndex.LinkCount)
+			if err != nil {
+				log.Printf("Failed to index file: %s, error: %v", path, err)
+				return
+			}
 
-		IndexingDone++
-		return nil
+			if m := extractMetadata(path); m != nil {
+				if err := db.SaveMetadata(dbConn, md5sum, m); err != nil {
+					log.Printf("Failed to save metadata: %s, error: %v", path, err)
+				} else {
+					notifyIndexed(md5sum, path, m)
+				}
+			}
+		},
 	})
 }
-
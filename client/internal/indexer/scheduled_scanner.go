@@ -13,6 +13,9 @@ import (
 
 	"smart-finder/client/internal/core"
 	"smart-finder/client/internal/db"
+	"smart-finder/shared/types"
+	"smart-finder/shared/utils"
+	"smart-finder/shared/walk"
 )
 
 // min 返回两个整数中的较小值
@@ -24,39 +27,55 @@ func min(a, b int) int {
 }
 
 // ScanStatus 扫描状态
-type ScanStatus struct {
-	IsScanning    bool      `json:"is_scanning"`
-	StartTime     time.Time `json:"start_time"`
-	TotalFiles    int64     `json:"total_files"`
-	ProcessedFiles int64    `json:"processed_files"`
-	SkippedFiles  int64     `json:"skipped_files"`
-	ErrorFiles    int64     `json:"error_files"`
-	DeletedFiles  int64     `json:"deleted_files"`
-	CurrentDir    string    `json:"current_dir"`
-	Progress      float64   `json:"progress"`
-	ElapsedTime   string    `json:"elapsed_time"`
-}
+type ScanStatus = types.ScanStatus
 
 // FileRecord 文件记录结构
 type FileRecord struct {
-	Path       string
-	MD5        string
-	Size       int64
-	ModifiedAt time.Time
+	Path        string
+	MD5         string
+	Size        int64
+	ModifiedAt  time.Time
+	LinkType    string
+	LinkCount   uint64
+	HasMetadata bool
 }
 
 // ScheduledScanner 定时扫描器
 type ScheduledScanner struct {
-	dbConn          *sql.DB
-	scanInterval    time.Duration
-	batchSize       int
-	maxConcurrency  int
-	status          ScanStatus
-	statusMu        sync.RWMutex
-	stopChan        chan struct{}
-	manualTrigger   chan struct{}
-	isRunning       int32
-	dbMutex         sync.Mutex  // 添加数据库操作互斥锁
+	dbConn         *sql.DB
+	scanInterval   time.Duration
+	batchSize      int
+	maxConcurrency int
+	status         ScanStatus
+	statusMu       sync.RWMutex
+	stopChan       chan struct{}
+	manualTrigger  chan struct{}
+	isRunning      int32
+	dbMutex        sync.Mutex // 添加数据库操作互斥锁
+	symlinkPolicy  walk.SymlinkPolicy
+	primaryPaths   map[string]string // 本轮扫描中硬链接的inode -> 组内最小的路径，只有该路径写入 files 表
+	primaryMu      sync.Mutex
+	onComplete     []func() // 每次扫描完成后调用，需在 Start 之前注册
+
+	// 自启动以来的累计计数，供 /metrics 使用
+	scansTotal   atomic.Int64
+	filesHashed  atomic.Int64
+	bytesHashed  atomic.Int64
+	errorsTotal  atomic.Int64
+	queueDepth   atomic.Int64
+	lastDuration time.Duration // 由 statusMu 保护
+	lastScanEnd  time.Time     // 由 statusMu 保护
+}
+
+// Counters 扫描器自启动以来的累计计数
+type Counters struct {
+	ScansTotal   int64         // 完成的扫描次数
+	LastDuration time.Duration // 最近一次完成的扫描耗时
+	LastScanEnd  time.Time
+	FilesHashed  int64 // 计算了MD5的文件数
+	BytesHashed  int64 // 计算MD5读取的字节数
+	Errors       int64
+	QueueDepth   int64 // 已遍历到、尚未处理完的文件数
 }
 
 // NewScheduledScanner 创建新的定时扫描器
@@ -64,13 +83,18 @@ func NewScheduledScanner(dbConn *sql.DB, interval time.Duration) *ScheduledScann
 	return &ScheduledScanner{
 		dbConn:         dbConn,
 		scanInterval:   interval,
-		batchSize:      500,  // 批量处理大小
-		maxConcurrency: 3,    // 最大并发数，避免过度占用资源
+		batchSize:      500, // 批量处理大小
+		maxConcurrency: 3,   // 最大并发数，避免过度占用资源
 		stopChan:       make(chan struct{}),
 		manualTrigger:  make(chan struct{}, 1),
 	}
 }
 
+// OnScanComplete 注册扫描完成后的回调，需在 Start 之前调用
+func (s *ScheduledScanner) OnScanComplete(f func()) {
+	s.onComplete = append(s.onComplete, f)
+}
+
 // Start 启动定时扫描器
 func (s *ScheduledScanner) Start() {
 	if !atomic.CompareAndSwapInt32(&s.isRunning, 0, 1) {
@@ -118,8 +142,14 @@ func (s *ScheduledScanner) TriggerManualScan() {
 func (s *ScheduledScanner) GetStatus() ScanStatus {
 	s.statusMu.RLock()
 	defer s.statusMu.RUnlock()
-	
+
 	status := s.status
+	if s.status.SkipReasons != nil {
+		status.SkipReasons = make(map[string]int64, len(s.status.SkipReasons))
+		for reason, n := range s.status.SkipReasons {
+			status.SkipReasons[reason] = n
+		}
+	}
 	if status.IsScanning && !status.StartTime.IsZero() {
 		status.ElapsedTime = time.Since(status.StartTime).Round(time.Second).String()
 		if status.TotalFiles > 0 {
@@ -129,6 +159,28 @@ func (s *ScheduledScanner) GetStatus() ScanStatus {
 	return status
 }
 
+// Counters 返回累计计数
+func (s *ScheduledScanner) Counters() Counters {
+	s.statusMu.RLock()
+	lastDuration, lastScanEnd := s.lastDuration, s.lastScanEnd
+	s.statusMu.RUnlock()
+	return Counters{
+		ScansTotal:   s.scansTotal.Load(),
+		LastDuration: lastDuration,
+		LastScanEnd:  lastScanEnd,
+		FilesHashed:  s.filesHashed.Load(),
+		BytesHashed:  s.bytesHashed.Load(),
+		Errors:       s.errorsTotal.Load(),
+		QueueDepth:   s.queueDepth.Load(),
+	}
+}
+
+// addError 同时计入本轮扫描状态和累计错误数
+func (s *ScheduledScanner) addError() {
+	atomic.AddInt64(&s.status.ErrorFiles, 1)
+	s.errorsTotal.Add(1)
+}
+
 // updateStatus 更新扫描状态
 func (s *ScheduledScanner) updateStatus(update func(*ScanStatus)) {
 	s.statusMu.Lock()
@@ -142,7 +194,7 @@ func (s *ScheduledScanner) performScan() {
 	s.statusMu.RLock()
 	isScanning := s.status.IsScanning
 	s.statusMu.RUnlock()
-	
+
 	if isScanning {
 		log.Println("扫描已在进行中，跳过本次扫描")
 		return
@@ -154,9 +206,9 @@ func (s *ScheduledScanner) performScan() {
 	// 初始化扫描状态
 	s.updateStatus(func(status *ScanStatus) {
 		*status = ScanStatus{
-			IsScanning:  true,
-			StartTime:   startTime,
-			CurrentDir:  "准备中...",
+			IsScanning: true,
+			StartTime:  startTime,
+			CurrentDir: "准备中...",
 		}
 	})
 
@@ -186,17 +238,28 @@ func (s *ScheduledScanner) performScan() {
 		// 继续执行，不中断扫描
 	}
 
+	// 读取符号链接策略
+	policy, err := walk.ParseSymlinkPolicy(db.GetSetting(s.dbConn, db.SettingSymlinkPolicy, string(walk.DefaultSymlinkPolicy)))
+	if err != nil {
+		log.Printf("符号链接策略无效，使用默认策略: %v", err)
+		policy = walk.DefaultSymlinkPolicy
+	}
+	s.symlinkPolicy = policy
+	s.primaryMu.Lock()
+	s.primaryPaths = make(map[string]string)
+	s.primaryMu.Unlock()
+
 	// 标记扫描开始
 	if err := s.markScanStart(); err != nil {
 		log.Printf("标记扫描开始失败: %v", err)
 		return
 	}
 
-	// 第一阶段：统计总文件数
+	// 第一阶段：统计总文件数，并为每组硬链接选出主路径
 	s.updateStatus(func(status *ScanStatus) {
 		status.CurrentDir = "统计文件数量..."
 	})
-	
+
 	totalFiles := s.countTotalFiles(monitoredDirs, ignorePatterns)
 	s.updateStatus(func(status *ScanStatus) {
 		status.TotalFiles = totalFiles
@@ -214,7 +277,7 @@ func (s *ScheduledScanner) performScan() {
 	s.updateStatus(func(status *ScanStatus) {
 		status.CurrentDir = "清理过时文件..."
 	})
-	
+
 	deletedCount, err := s.cleanupMissingFiles()
 	if err != nil {
 		log.Printf("清理过时文件失败: %v", err)
@@ -225,69 +288,68 @@ func (s *ScheduledScanner) performScan() {
 	}
 
 	duration := time.Since(startTime)
+	s.scansTotal.Add(1)
+	s.updateStatus(func(status *ScanStatus) {
+		s.lastDuration = duration
+		s.lastScanEnd = time.Now()
+	})
 	finalStatus := s.GetStatus()
 	log.Printf("扫描完成 - 总计: %d, 处理: %d, 跳过: %d, 错误: %d, 删除: %d, 耗时: %v",
-		finalStatus.TotalFiles, finalStatus.ProcessedFiles, finalStatus.SkippedFiles, 
+		finalStatus.TotalFiles, finalStatus.ProcessedFiles, finalStatus.SkippedFiles,
 		finalStatus.ErrorFiles, finalStatus.DeletedFiles, duration)
+
+	for _, f := range s.onComplete {
+		f()
+	}
 }
 
-// countTotalFiles 统计总文件数
+// countTotalFiles 统计总文件数，同时记录每组硬链接中最小的路径，
+// 使每次扫描写入索引的都是同一个路径
 func (s *ScheduledScanner) countTotalFiles(monitoredDirs []string, ignorePatterns []string) int64 {
 	var total int64
-	
+
 	for _, rootDir := range monitoredDirs {
-		filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return nil
-			}
-			
-			if s.shouldIgnore(path, info, ignorePatterns) {
-				if info.IsDir() {
-					return filepath.SkipDir
-				}
-				return nil
-			}
-			
-			if !info.IsDir() {
+		walk.Tree(rootDir, walk.Options{
+			Policy: s.symlinkPolicy,
+			Ignore: func(path string, info os.FileInfo) bool {
+				return s.shouldIgnore(path, info, ignorePatterns)
+			},
+			OnFile: func(entry walk.Entry) {
 				atomic.AddInt64(&total, 1)
-			}
-			return nil
+				if inodeKey, linkCount, ok := walk.FileIdentity(entry.Path, entry.Info); ok && linkCount > 1 {
+					s.notePrimary(inodeKey, entry.Path)
+				}
+			},
 		})
 	}
-	
+
 	return total
 }
 
 // scanDirectory 扫描目录
 func (s *ScheduledScanner) scanDirectory(rootDir string, ignorePatterns []string) {
-	var fileBatch []string
-
-	err := filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			atomic.AddInt64(&s.status.ErrorFiles, 1)
-			return nil
-		}
-
-		if s.shouldIgnore(path, info, ignorePatterns) {
-			if info.IsDir() {
-				return filepath.SkipDir
+	var fileBatch []walk.Entry
+
+	err := walk.Tree(rootDir, walk.Options{
+		Policy: s.symlinkPolicy,
+		Ignore: func(path string, info os.FileInfo) bool {
+			return s.shouldIgnore(path, info, ignorePatterns)
+		},
+		OnFile: func(entry walk.Entry) {
+			fileBatch = append(fileBatch, entry)
+			s.queueDepth.Add(1)
+
+			// 批量处理
+			if len(fileBatch) >= s.batchSize {
+				s.processBatch(fileBatch)
+				fileBatch = fileBatch[:0]
 			}
-			return nil
-		}
-
-		if info.IsDir() {
-			return nil
-		}
-
-		fileBatch = append(fileBatch, path)
-
-		// 批量处理
-		if len(fileBatch) >= s.batchSize {
-			s.processBatch(fileBatch)
-			fileBatch = fileBatch[:0]
-		}
-
-		return nil
+		},
+		OnSkip: s.recordSkip,
+		OnError: func(path string, err error) {
+			log.Printf("访问失败 %s: %v", path, err)
+			s.addError()
+		},
 	})
 
 	if err != nil {
@@ -300,8 +362,24 @@ func (s *ScheduledScanner) scanDirectory(rootDir string, ignorePatterns []string
 	}
 }
 
+// recordSkip 记录被跳过的条目及原因
+func (s *ScheduledScanner) recordSkip(path, reason string) {
+	log.Printf("跳过 %s: %s", path, reason)
+	s.updateStatus(func(status *ScanStatus) {
+		if status.SkipReasons == nil {
+			status.SkipReasons = make(map[string]int64)
+		}
+		status.SkipReasons[reason]++
+	})
+}
+
 // processBatch 批量处理文件
-func (s *ScheduledScanner) processBatch(filePaths []string) {
+func (s *ScheduledScanner) processBatch(entries []walk.Entry) {
+	filePaths := make([]string, len(entries))
+	for i, entry := range entries {
+		filePaths[i] = entry.Path
+	}
+
 	// 批量获取现有文件信息
 	existingFiles, err := s.getExistingFileInfo(filePaths)
 	if err != nil {
@@ -313,49 +391,92 @@ func (s *ScheduledScanner) processBatch(filePaths []string) {
 	semaphore := make(chan struct{}, concurrency)
 	var wg sync.WaitGroup
 
-	for _, filePath := range filePaths {
+	for _, entry := range entries {
 		wg.Add(1)
-		go func(path string) {
+		go func(entry walk.Entry) {
 			defer wg.Done()
+			defer s.queueDepth.Add(-1)
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			s.processFile(path, existingFiles)
-		}(filePath)
+			s.processFile(entry, existingFiles)
+		}(entry)
 	}
 
 	wg.Wait()
 }
 
 // processFile 处理单个文件
-func (s *ScheduledScanner) processFile(filePath string, existingFiles map[string]FileRecord) {
+func (s *ScheduledScanner) processFile(entry walk.Entry, existingFiles map[string]FileRecord) {
+	filePath := entry.Path
 	fileInfo, err := os.Stat(filePath)
 	if err != nil {
 		log.Printf("获取文件信息失败 %s: %v", filePath, err)
-		atomic.AddInt64(&s.status.ErrorFiles, 1)
+		s.addError()
+		return
+	}
+
+	// 遍历后文件可能已被替换，再次确认是普通文件，避免读取FIFO等阻塞
+	if reason := walk.SpecialFileReason(fileInfo.Mode()); reason != "" {
+		s.recordSkip(filePath, reason)
 		return
 	}
 
+	// 识别硬链接：记录每个路径，同一inode只索引主路径
+	linkType := entry.LinkType
+	inodeKey, linkCount, ok := walk.FileIdentity(filePath, fileInfo)
+	if ok && linkCount > 1 {
+		s.dbMutex.Lock()
+		err := db.SaveHardlink(s.dbConn, filePath, inodeKey, fileInfo.Size())
+		s.dbMutex.Unlock()
+		if err != nil {
+			log.Printf("记录硬链接失败 %s: %v", filePath, err)
+		}
+		if !s.isPrimary(inodeKey, filePath) {
+			atomic.AddInt64(&s.status.SkippedFiles, 1)
+			s.recordSkip(filePath, walk.SkipReasonHardlink)
+			return
+		}
+		if linkType == walk.LinkTypeNone {
+			linkType = walk.LinkTypeHardlink
+		}
+	}
+
 	// 标记文件存在
 	if err := s.markFileExists(filePath); err != nil {
 		log.Printf("标记文件存在失败 %s: %v", filePath, err)
 	}
 
 	// 检查是否需要重新计算MD5
+	var (
+		md5sum      string
+		hasMetadata bool
+	)
 	if existing, found := existingFiles[filePath]; found {
 		if existing.Size == fileInfo.Size() && existing.ModifiedAt.Equal(fileInfo.ModTime()) {
-			// 文件未变化，跳过
-			atomic.AddInt64(&s.status.SkippedFiles, 1)
-			return
+			if existing.LinkType == linkType && existing.LinkCount == linkCount {
+				// 文件未变化，跳过；补充提取升级前索引的文件的元数据
+				if !existing.HasMetadata {
+					s.saveMetadata(existing.MD5, filePath)
+				}
+				atomic.AddInt64(&s.status.SkippedFiles, 1)
+				return
+			}
+			// 内容未变，仅更新链接信息
+			md5sum, hasMetadata = existing.MD5, existing.HasMetadata
 		}
 	}
 
 	// 计算MD5
-	md5sum, err := CalculateMD5(filePath)
-	if err != nil {
-		log.Printf("计算MD5失败 %s: %v", filePath, err)
-		atomic.AddInt64(&s.status.ErrorFiles, 1)
-		return
+	if md5sum == "" {
+		md5sum, err = utils.CalculateMD5(filePath)
+		if err != nil {
+			log.Printf("计算MD5失败 %s: %v", filePath, err)
+			s.addError()
+			return
+		}
+		s.filesHashed.Add(1)
+		s.bytesHashed.Add(fileInfo.Size())
 	}
 
 	// 更新数据库
@@ -365,24 +486,77 @@ func (s *ScheduledScanner) processFile(filePath string, existingFiles map[string
 		Filename:   fileInfo.Name(),
 		Size:       fileInfo.Size(),
 		ModifiedAt: fileInfo.ModTime(),
+		LinkType:   linkType,
+		LinkTarget: entry.LinkTarget,
+		InodeKey:   inodeKey,
+		LinkCount:  linkCount,
 	}
 
 	s.dbMutex.Lock()
 	_, err = s.dbConn.Exec(`
-		INSERT OR REPLACE INTO files (md5, path, filename, size, modified_at, scan_flag)
-		VALUES (?, ?, ?, ?, ?, 1)
-	`, fileIndex.MD5, fileIndex.Path, fileIndex.Filename, fileIndex.Size, fileIndex.ModifiedAt)
+		INSERT OR REPLACE INTO files (md5, path, filename, size, modified_at, scan_flag,
+			link_type, link_target, inode_key, link_count)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?, ?)
+	`, fileIndex.MD5, fileIndex.Path, fileIndex.Filename, fileIndex.Size, fileIndex.ModifiedAt,
+		fileIndex.LinkType, fileIndex.LinkTarget, fileIndex.InodeKey, fileIndex.LinkCount)
 	s.dbMutex.Unlock()
 
 	if err != nil {
 		log.Printf("更新数据库失败 %s: %v", filePath, err)
-		atomic.AddInt64(&s.status.ErrorFiles, 1)
+		s.addError()
 		return
 	}
 
+	if !hasMetadata {
+		s.saveMetadata(md5sum, filePath)
+	}
 	atomic.AddInt64(&s.status.ProcessedFiles, 1)
 }
 
+// saveMetadata 提取并保存文件元数据
+func (s *ScheduledScanner) saveMetadata(md5sum, filePath string) {
+	m := extractMetadata(filePath)
+	if m == nil {
+		return
+	}
+	s.dbMutex.Lock()
+	err := db.SaveMetadata(s.dbConn, md5sum, m)
+	s.dbMutex.Unlock()
+	if err != nil {
+		log.Printf("保存元数据失败 %s: %v", filePath, err)
+		return
+	}
+	notifyIndexed(md5sum, filePath, m)
+}
+
+// notePrimary 记录硬链接组内较小的路径
+func (s *ScheduledScanner) notePrimary(inodeKey, path string) {
+	s.primaryMu.Lock()
+	defer s.primaryMu.Unlock()
+	if s.primaryPaths == nil {
+		s.primaryPaths = make(map[string]string)
+	}
+	if p, ok := s.primaryPaths[inodeKey]; !ok || path < p {
+		s.primaryPaths[inodeKey] = path
+	}
+}
+
+// isPrimary 判断 path 是否为硬链接组的主路径；统计阶段之后才出现的inode
+// 由第一个处理到的路径作为主路径
+func (s *ScheduledScanner) isPrimary(inodeKey, path string) bool {
+	s.primaryMu.Lock()
+	defer s.primaryMu.Unlock()
+	if s.primaryPaths == nil {
+		s.primaryPaths = make(map[string]string)
+	}
+	p, ok := s.primaryPaths[inodeKey]
+	if !ok {
+		s.primaryPaths[inodeKey] = path
+		return true
+	}
+	return p == path
+}
+
 // shouldIgnore 检查是否应该忽略文件/目录
 func (s *ScheduledScanner) shouldIgnore(path string, info os.FileInfo, patterns []string) bool {
 	for _, pattern := range patterns {
@@ -403,7 +577,10 @@ func (s *ScheduledScanner) shouldIgnore(path string, info os.FileInfo, patterns
 func (s *ScheduledScanner) markScanStart() error {
 	s.dbMutex.Lock()
 	defer s.dbMutex.Unlock()
-	_, err := s.dbConn.Exec("UPDATE files SET scan_flag = 0")
+	if _, err := s.dbConn.Exec("UPDATE files SET scan_flag = 0"); err != nil {
+		return err
+	}
+	_, err := s.dbConn.Exec("UPDATE hardlinks SET scan_flag = 0")
 	return err
 }
 
@@ -423,6 +600,13 @@ func (s *ScheduledScanner) cleanupMissingFiles() (int64, error) {
 	if err != nil {
 		return 0, err
 	}
+	if _, err := s.dbConn.Exec("DELETE FROM hardlinks WHERE scan_flag = 0"); err != nil {
+		log.Printf("清理硬链接记录失败: %v", err)
+	}
+	// 内容已不在任何索引文件中的元数据
+	if _, err := db.DeleteOrphanMetadata(s.dbConn); err != nil {
+		log.Printf("清理元数据失败: %v", err)
+	}
 	return result.RowsAffected()
 }
 
@@ -440,7 +624,8 @@ func (s *ScheduledScanner) getExistingFileInfo(paths []string) (map[string]FileR
 		args[i] = path
 	}
 
-	query := fmt.Sprintf("SELECT path, md5, size, modified_at FROM files WHERE path IN (%s)",
+	query := fmt.Sprintf(`SELECT path, files.md5, size, modified_at, link_type, link_count, m.md5 IS NOT NULL
+		FROM files LEFT JOIN file_metadata m ON m.md5 = files.md5 WHERE path IN (%s)`,
 		strings.Join(placeholders, ","))
 
 	rows, err := s.dbConn.Query(query, args...)
@@ -452,7 +637,8 @@ func (s *ScheduledScanner) getExistingFileInfo(paths []string) (map[string]FileR
 	result := make(map[string]FileRecord)
 	for rows.Next() {
 		var record FileRecord
-		err := rows.Scan(&record.Path, &record.MD5, &record.Size, &record.ModifiedAt)
+		err := rows.Scan(&record.Path, &record.MD5, &record.Size, &record.ModifiedAt, &record.LinkType, &record.LinkCount,
+			&record.HasMetadata)
 		if err != nil {
 			continue
 		}
@@ -472,11 +658,11 @@ var (
 func InitGlobalScheduler(dbConn *sql.DB, interval time.Duration) {
 	schedulerMu.Lock()
 	defer schedulerMu.Unlock()
-	
+
 	if GlobalScheduler != nil {
 		GlobalScheduler.Stop()
 	}
-	
+
 	GlobalScheduler = NewScheduledScanner(dbConn, interval)
 }
 
@@ -485,4 +671,4 @@ func GetGlobalScheduler() *ScheduledScanner {
 	schedulerMu.Lock()
 	defer schedulerMu.Unlock()
 	return GlobalScheduler
-}
\ No newline at end of file
+}
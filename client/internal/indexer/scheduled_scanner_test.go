@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-finder/client/internal/db"
+)
+
+func TestHardlinkGroups(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "a.txt")
+	if err := os.WriteFile(first, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"c.txt", "b.txt"} {
+		if err := os.Link(first, filepath.Join(root, name)); err != nil {
+			t.Skipf("不支持硬链接: %v", err)
+		}
+	}
+	// 监控目录外的链接不计入分组
+	if err := os.Link(first, filepath.Join(t.TempDir(), "outside.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "d.txt"), []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "md5fs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	db.UpdateMonitoredDir(conn, root, "add")
+
+	s := NewScheduledScanner(conn, time.Hour)
+	for scan := 1; scan <= 2; scan++ {
+		s.performScan()
+
+		var path string
+		if err := conn.QueryRow("SELECT path FROM files WHERE md5 = ?", "5d41402abc4b2a76b9719d911017c592").Scan(&path); err != nil {
+			t.Fatal(err)
+		}
+		if path != first {
+			t.Errorf("scan %d: 索引的路径 = %s, 应为组内最小的路径 %s", scan, path, first)
+		}
+
+		groups, sharedBytes, err := db.GetHardlinkGroups(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 1 {
+			t.Fatalf("scan %d: groups = %+v", scan, groups)
+		}
+		g := groups[0]
+		want := []string{first, filepath.Join(root, "b.txt"), filepath.Join(root, "c.txt")}
+		if g.Path != first || g.LinkCount != 3 || len(g.Paths) != 3 || g.MD5 != "5d41402abc4b2a76b9719d911017c592" {
+			t.Fatalf("scan %d: group = %+v", scan, g)
+		}
+		for i := range want {
+			if g.Paths[i] != want[i] {
+				t.Errorf("scan %d: paths = %v, want %v", scan, g.Paths, want)
+			}
+		}
+		if sharedBytes != 10 {
+			t.Errorf("scan %d: sharedBytes = %d, want 10", scan, sharedBytes)
+		}
+	}
+	// 第二次扫描时主路径不变，不重新计算MD5
+	if c := s.Counters(); c.FilesHashed != 2 {
+		t.Errorf("FilesHashed = %d, want 2", c.FilesHashed)
+	}
+
+	// 删除的链接在下一次扫描后移出分组
+	if err := os.Remove(filepath.Join(root, "c.txt")); err != nil {
+		t.Fatal(err)
+	}
+	s.performScan()
+	groups, sharedBytes, err := db.GetHardlinkGroups(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 || groups[0].LinkCount != 2 || sharedBytes != 5 {
+		t.Errorf("after remove: groups = %+v, sharedBytes = %d", groups, sharedBytes)
+	}
+}
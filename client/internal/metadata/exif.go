@@ -0,0 +1,356 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"smart-finder/shared/types"
+)
+
+// EXIF 标签
+const (
+	tagImageWidth         = 0x0100
+	tagImageLength        = 0x0101
+	tagMake               = 0x010F
+	tagModel              = 0x0110
+	tagOrientation        = 0x0112
+	tagDateTime           = 0x0132
+	tagExifIFD            = 0x8769
+	tagGPSIFD             = 0x8825
+	tagDateTimeOriginal   = 0x9003
+	tagOffsetTimeOriginal = 0x9011
+	tagPixelXDimension    = 0xA002
+	tagPixelYDimension    = 0xA003
+
+	tagGPSLatitudeRef  = 1
+	tagGPSLatitude     = 2
+	tagGPSLongitudeRef = 3
+	tagGPSLongitude    = 4
+)
+
+// TIFF 字段类型
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+)
+
+const (
+	maxIFDEntries = 1024 // 超过时视为损坏的文件
+	maxExifString = 256
+)
+
+var errNoExif = errors.New("没有EXIF数据")
+
+// exifExtractor 读取 JPEG 与 TIFF 的 EXIF：拍摄时间、相机和GPS位置
+type exifExtractor struct{}
+
+func (exifExtractor) Match(mimeType string) bool {
+	return mimeType == "image/jpeg" || mimeType == "image/tiff"
+}
+
+func (exifExtractor) Extract(r io.ReadSeeker, size int64, m *types.FileMetadata) error {
+	if m.MIME == "image/tiff" {
+		return parseTIFF(r, size, m)
+	}
+	data, err := jpegExif(r, size)
+	if err == errNoExif {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return parseTIFF(bytes.NewReader(data), int64(len(data)), m)
+}
+
+// jpegExif 返回 JPEG 中 APP1 段的 TIFF 数据，size 为文件长度，段长度超出时视为损坏的文件
+func jpegExif(r io.Reader, size int64) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil {
+		return nil, err
+	}
+	if soi != [2]byte{0xFF, 0xD8} {
+		return nil, errors.New("不是JPEG文件")
+	}
+	pos := int64(len(soi))
+	for {
+		marker, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if marker != 0xFF {
+			return nil, errors.New("JPEG段标记错误")
+		}
+		kind, err := br.ReadByte()
+		pos += 2
+		for err == nil && kind == 0xFF { // 填充字节
+			kind, err = br.ReadByte()
+			pos++
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case kind == 0xD8 || (kind >= 0xD0 && kind <= 0xD7) || kind == 0x01:
+			continue // 没有长度的标记
+		case kind == 0xDA || kind == 0xD9:
+			return nil, errNoExif // 图像数据开始，EXIF 只出现在其前面
+		}
+		var length uint16
+		if err := binary.Read(br, binary.BigEndian, &length); err != nil {
+			return nil, err
+		}
+		if length < 2 || pos+int64(length) > size {
+			return nil, errors.New("JPEG段长度错误")
+		}
+		pos += int64(length)
+		segment := make([]byte, length-2)
+		if _, err := io.ReadFull(br, segment); err != nil {
+			return nil, err
+		}
+		if kind == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:], nil
+		}
+	}
+}
+
+// tiffReader 按TIFF头声明的字节序读取IFD
+type tiffReader struct {
+	r     io.ReadSeeker
+	size  int64
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count uint32
+	value [4]byte // 值或值的偏移
+}
+
+func (t *tiffReader) readAt(off int64, n int) ([]byte, error) {
+	if off < 0 || n < 0 || off+int64(n) > t.size {
+		return nil, errors.New("偏移超出文件范围")
+	}
+	if _, err := t.r.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, n)
+	_, err := io.ReadFull(t.r, buf)
+	return buf, err
+}
+
+// readIFD 读取一个IFD的所有条目
+func (t *tiffReader) readIFD(off int64) (map[uint16]ifdEntry, error) {
+	head, err := t.readAt(off, 2)
+	if err != nil {
+		return nil, err
+	}
+	n := int(t.order.Uint16(head))
+	if n > maxIFDEntries {
+		return nil, fmt.Errorf("IFD条目过多: %d", n)
+	}
+	data, err := t.readAt(off+2, n*12)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		b := data[i*12:]
+		e := ifdEntry{typ: t.order.Uint16(b[2:]), count: t.order.Uint32(b[4:])}
+		copy(e.value[:], b[8:12])
+		entries[t.order.Uint16(b)] = e
+	}
+	return entries, nil
+}
+
+// data 返回条目的原始数据
+func (t *tiffReader) data(e ifdEntry) ([]byte, error) {
+	var unit int
+	switch e.typ {
+	case typeByte, typeASCII, typeUndefined:
+		unit = 1
+	case typeShort:
+		unit = 2
+	case typeLong:
+		unit = 4
+	case typeRational:
+		unit = 8
+	default:
+		return nil, fmt.Errorf("不支持的字段类型: %d", e.typ)
+	}
+	n := int64(e.count) * int64(unit)
+	if n > 4096 {
+		return nil, errors.New("字段过长")
+	}
+	if n <= 4 {
+		return e.value[:n], nil
+	}
+	return t.readAt(int64(t.order.Uint32(e.value[:])), int(n))
+}
+
+func (t *tiffReader) string(entries map[uint16]ifdEntry, tag uint16) string {
+	e, ok := entries[tag]
+	if !ok || e.typ != typeASCII {
+		return ""
+	}
+	b, err := t.data(e)
+	if err != nil {
+		return ""
+	}
+	if len(b) > maxExifString {
+		b = b[:maxExifString]
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func (t *tiffReader) uint(entries map[uint16]ifdEntry, tag uint16) (uint32, bool) {
+	e, ok := entries[tag]
+	if !ok || e.count < 1 {
+		return 0, false
+	}
+	switch e.typ {
+	case typeShort:
+		return uint32(t.order.Uint16(e.value[:])), true
+	case typeLong:
+		return t.order.Uint32(e.value[:]), true
+	}
+	return 0, false
+}
+
+// coordinate 读取以度、分、秒三个有理数表示的GPS坐标
+func (t *tiffReader) coordinate(entries map[uint16]ifdEntry, tag, refTag uint16) *float64 {
+	ref := t.string(entries, refTag)
+	e, ok := entries[tag]
+	if ref == "" || !ok || e.typ != typeRational || e.count != 3 {
+		return nil
+	}
+	b, err := t.data(e)
+	if err != nil {
+		return nil
+	}
+	var v float64
+	for i, div := range []float64{1, 60, 3600} {
+		num, den := t.order.Uint32(b[i*8:]), t.order.Uint32(b[i*8+4:])
+		if den == 0 {
+			return nil
+		}
+		v += float64(num) / float64(den) / div
+	}
+	if ref == "S" || ref == "W" {
+		v = -v
+	}
+	return &v
+}
+
+// Orientation 返回 JPEG 的 EXIF 方向（1-8），size 为文件长度，没有EXIF或无法解析时返回 1
+func Orientation(r io.Reader, size int64) int {
+	data, err := jpegExif(r, size)
+	if err != nil {
+		return 1
+	}
+	t, ifd0, err := readTIFFHeader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return 1
+	}
+	if o, ok := t.uint(ifd0, tagOrientation); ok && o >= 1 && o <= 8 {
+		return int(o)
+	}
+	return 1
+}
+
+// readTIFFHeader 读取TIFF头与第一个IFD，r 的开头为TIFF头
+func readTIFFHeader(r io.ReadSeeker, size int64) (*tiffReader, map[uint16]ifdEntry, error) {
+	t := &tiffReader{r: r, size: size}
+	head, err := t.readAt(0, 8)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch string(head[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, nil, errors.New("TIFF头错误")
+	}
+	if t.order.Uint16(head[2:]) != 42 {
+		return nil, nil, errors.New("TIFF头错误")
+	}
+	ifd0, err := t.readIFD(int64(t.order.Uint32(head[4:])))
+	if err != nil {
+		return nil, nil, err
+	}
+	return t, ifd0, nil
+}
+
+// parseTIFF 解析TIFF结构中的EXIF字段，r 的开头为TIFF头
+func parseTIFF(r io.ReadSeeker, size int64, m *types.FileMetadata) error {
+	t, ifd0, err := readTIFFHeader(r, size)
+	if err != nil {
+		return err
+	}
+	m.CameraMake = t.string(ifd0, tagMake)
+	m.CameraModel = t.string(ifd0, tagModel)
+	taken, offset := t.string(ifd0, tagDateTime), ""
+	width, _ := t.uint(ifd0, tagImageWidth)
+	height, _ := t.uint(ifd0, tagImageLength)
+
+	if off, ok := t.uint(ifd0, tagExifIFD); ok {
+		if exif, err := t.readIFD(int64(off)); err == nil {
+			if s := t.string(exif, tagDateTimeOriginal); s != "" {
+				taken, offset = s, t.string(exif, tagOffsetTimeOriginal)
+			}
+			if w, ok := t.uint(exif, tagPixelXDimension); ok {
+				width = w
+			}
+			if h, ok := t.uint(exif, tagPixelYDimension); ok {
+				height = h
+			}
+		}
+	}
+	if off, ok := t.uint(ifd0, tagGPSIFD); ok {
+		if gps, err := t.readIFD(int64(off)); err == nil {
+			lat := t.coordinate(gps, tagGPSLatitude, tagGPSLatitudeRef)
+			lon := t.coordinate(gps, tagGPSLongitude, tagGPSLongitudeRef)
+			if lat != nil && lon != nil {
+				m.Latitude, m.Longitude = lat, lon
+			}
+		}
+	}
+
+	if at, ok := parseExifTime(taken, offset); ok {
+		m.TakenAt = &at
+	}
+	// JPEG 的尺寸以解码器读到的为准
+	if m.Width == 0 && m.Height == 0 {
+		m.Width, m.Height = int(width), int(height)
+	}
+	return nil
+}
+
+// parseExifTime 解析 "2006:01:02 15:04:05"，没有时区偏移时按本地时间
+func parseExifTime(s, offset string) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if offset != "" {
+		if t, err := time.Parse("2006:01:02 15:04:05-07:00", s+offset); err == nil {
+			return t, true
+		}
+	}
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", s, time.Local)
+	return t, err == nil
+}
@@ -0,0 +1,31 @@
+package metadata
+
+import (
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+
+	"smart-finder/shared/types"
+)
+
+// imageExtractor 用标准库解码器读取图片尺寸，只解析文件头
+type imageExtractor struct{}
+
+func (imageExtractor) Match(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+func (imageExtractor) Extract(r io.ReadSeeker, size int64, m *types.FileMetadata) error {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return err
+	}
+	m.Width, m.Height = cfg.Width, cfg.Height
+	return nil
+}
@@ -0,0 +1,140 @@
+// Package metadata 索引时从文件内容中提取元数据
+//
+// 先按文件头识别MIME类型，再交给匹配该类型的提取器填写其余字段。
+// 提取器通过 Register 注册，内置的提取器处理图片尺寸、JPEG/TIFF 的
+// EXIF、PDF 的页数与标题以及 MP4/MOV 的时长。
+package metadata
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"smart-finder/shared/types"
+)
+
+// sniffLen 识别MIME类型读取的文件头长度，与 http.DetectContentType 相同
+const sniffLen = 512
+
+// Extractor 提取某类文件的元数据
+type Extractor interface {
+	// Match 根据识别出的MIME类型判断是否处理该文件
+	Match(mimeType string) bool
+	// Extract 读取文件并填写 m 中对应的字段，r 位于文件开头
+	Extract(r io.ReadSeeker, size int64, m *types.FileMetadata) error
+}
+
+var (
+	extractorsMu sync.RWMutex
+	extractors   []Extractor
+)
+
+// Register 注册提取器，按注册顺序执行，后执行的提取器可以覆盖已填写的字段
+func Register(e Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+	extractors = append(extractors, e)
+}
+
+func init() {
+	Register(imageExtractor{})
+	Register(exifExtractor{})
+	Register(pdfExtractor{})
+	Register(mp4Extractor{})
+}
+
+// Extract 提取文件的元数据
+//
+// 能识别MIME类型时总是返回元数据；某个提取器失败时同时返回已提取的
+// 部分与错误，调用方可以照常保存。
+func Extract(path string) (*types.FileMetadata, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	m := &types.FileMetadata{MIME: DetectMIME(filepath.Base(path), head[:n])}
+
+	extractorsMu.RLock()
+	list := append([]Extractor(nil), extractors...)
+	extractorsMu.RUnlock()
+
+	var errs []error
+	for _, e := range list {
+		if !e.Match(m.MIME) {
+			continue
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return m, err
+		}
+		if err := e.Extract(f, info.Size(), m); err != nil {
+			errs = append(errs, fmt.Errorf("%T: %w", e, err))
+		}
+	}
+	return m, errors.Join(errs...)
+}
+
+// DetectMIME 按文件头识别MIME类型，结果不含参数
+//
+// 文件头只能识别出通用类型（application/octet-stream、text/plain 或作为
+// 容器的 application/zip）时使用扩展名对应的类型，例如 .csv、.docx。
+func DetectMIME(name string, head []byte) string {
+	typ := sniff(head)
+	if typ == "application/octet-stream" || typ == "text/plain" || typ == "application/zip" {
+		if byExt := typeByExtension(name); byExt != "" {
+			return byExt
+		}
+	}
+	return typ
+}
+
+// sniff 在 http.DetectContentType 的基础上补充 TIFF 与 ISO 媒体文件的品牌
+func sniff(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(head) >= 12 && string(head[4:8]) == "ftyp":
+		switch string(head[8:12]) {
+		case "qt  ":
+			return "video/quicktime"
+		case "M4A ", "M4B ":
+			return "audio/mp4"
+		case "heic", "heix", "mif1", "msf1":
+			return "image/heic"
+		case "3gp4", "3gp5", "3gp6", "3g2a":
+			return "video/3gpp"
+		}
+	}
+	return baseType(http.DetectContentType(head))
+}
+
+func typeByExtension(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".md" || ext == ".markdown" {
+		return "text/markdown"
+	}
+	return baseType(mime.TypeByExtension(ext))
+}
+
+// baseType 去掉MIME类型中的参数，如 charset
+func baseType(typ string) string {
+	typ, _, _ = strings.Cut(typ, ";")
+	return strings.ToLower(strings.TrimSpace(typ))
+}
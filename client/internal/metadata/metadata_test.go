@@ -0,0 +1,403 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-finder/shared/types"
+)
+
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	data     []byte
+}
+
+func ascii(tag uint16, s string) tiffEntry {
+	return tiffEntry{tag, typeASCII, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func short(tag uint16, v uint16) tiffEntry {
+	return tiffEntry{tag, typeShort, 1, binary.LittleEndian.AppendUint16(nil, v)}
+}
+
+// rationals 以度、分、秒写入GPS坐标，每项为分子与分母
+func rationals(tag uint16, v ...uint32) tiffEntry {
+	var b []byte
+	for _, n := range v {
+		b = binary.LittleEndian.AppendUint32(b, n)
+	}
+	return tiffEntry{tag, typeRational, uint32(len(v) / 2), b}
+}
+
+// buildTIFF 生成小端序的TIFF结构，IFD0 之后依次放置 EXIF 与 GPS 子IFD，
+// 超过 4 字节的值紧跟在各自的IFD后面
+func buildTIFF(ifd0, exif, gps []tiffEntry) []byte {
+	ifd0 = append([]tiffEntry(nil), ifd0...)
+	if exif != nil {
+		ifd0 = append(ifd0, tiffEntry{tagExifIFD, typeLong, 1, make([]byte, 4)})
+	}
+	if gps != nil {
+		ifd0 = append(ifd0, tiffEntry{tagGPSIFD, typeLong, 1, make([]byte, 4)})
+	}
+	ifdSize := func(entries []tiffEntry) int {
+		n := 2 + 12*len(entries) + 4
+		for _, e := range entries {
+			if len(e.data) > 4 {
+				n += len(e.data)
+			}
+		}
+		return n
+	}
+	exifOff := 8 + ifdSize(ifd0)
+	gpsOff := exifOff + ifdSize(exif)
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			ifd0[i].data = binary.LittleEndian.AppendUint32(nil, uint32(exifOff))
+		case tagGPSIFD:
+			ifd0[i].data = binary.LittleEndian.AppendUint32(nil, uint32(gpsOff))
+		}
+	}
+
+	out := []byte("II*\x00\x08\x00\x00\x00")
+	for _, entries := range [][]tiffEntry{ifd0, exif, gps} {
+		if entries == nil {
+			continue
+		}
+		dataOff := len(out) + 2 + 12*len(entries) + 4
+		var values []byte
+		out = binary.LittleEndian.AppendUint16(out, uint16(len(entries)))
+		for _, e := range entries {
+			out = binary.LittleEndian.AppendUint16(out, e.tag)
+			out = binary.LittleEndian.AppendUint16(out, e.typ)
+			out = binary.LittleEndian.AppendUint32(out, e.count)
+			if len(e.data) > 4 {
+				out = binary.LittleEndian.AppendUint32(out, uint32(dataOff+len(values)))
+				values = append(values, e.data...)
+			} else {
+				var v [4]byte
+				copy(v[:], e.data)
+				out = append(out, v[:]...)
+			}
+		}
+		out = append(out, 0, 0, 0, 0) // 没有下一个IFD
+		out = append(out, values...)
+	}
+	return out
+}
+
+// sampleTIFF 带相机、拍摄时间、方向与GPS位置的EXIF
+func sampleTIFF() []byte {
+	return buildTIFF(
+		[]tiffEntry{ascii(tagMake, "Canon"), ascii(tagModel, "EOS R5"), short(tagOrientation, 6), ascii(tagDateTime, "2020:01:01 00:00:00")},
+		[]tiffEntry{ascii(tagDateTimeOriginal, "2024:05:01 12:30:00"), ascii(tagOffsetTimeOriginal, "+08:00")},
+		[]tiffEntry{
+			ascii(tagGPSLatitudeRef, "N"), rationals(tagGPSLatitude, 30, 1, 15, 1, 0, 1),
+			ascii(tagGPSLongitudeRef, "W"), rationals(tagGPSLongitude, 120, 1, 30, 1, 36, 10),
+		},
+	)
+}
+
+// buildJPEG 编码 4x3 的图片，tiff 不为空时在 SOI 之后插入 APP1 段
+func buildJPEG(t testing.TB, tiff []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 3)), nil); err != nil {
+		t.Fatal(err)
+	}
+	img := buf.Bytes()
+	if tiff == nil {
+		return img
+	}
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	out := append([]byte{}, img[:2]...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, img[2:]...)
+}
+
+// buildPDF 生成有两页、/Info 中带标题的PDF
+func buildPDF(title string) []byte {
+	return []byte("%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 >> endobj\n" +
+		"3 0 obj << /Type /Page /Parent 2 0 R >> endobj\n" +
+		"4 0 obj << /Type /Page /Parent 2 0 R >> endobj\n" +
+		"5 0 obj << /Title " + title + " >> endobj\n" +
+		"trailer << /Root 1 0 R /Info 5 0 R >>\n%%EOF\n")
+}
+
+// buildObjStmPDF 把 /Info 字典放在压缩的对象流中
+func buildObjStmPDF(t testing.TB, info string) []byte {
+	t.Helper()
+	header := "5 0 "
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte(header + info))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return []byte(fmt.Sprintf("%%PDF-1.5\n"+
+		"2 0 obj << /Type /Pages /Kids [] /Count 7 >> endobj\n"+
+		"6 0 obj << /Type /ObjStm /N 1 /First %d /Filter /FlateDecode /Length %d >> stream\n%s\nendstream endobj\n"+
+		"trailer << /Info 5 0 R >>\n%%%%EOF\n", len(header), z.Len(), z.Bytes()))
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(out, typ...), body...)
+}
+
+// mvhd 生成 mvhd 的内容，版本 1 的时间与时长为 64 位
+func mvhd(version byte, timescale uint32, duration uint64) []byte {
+	out := []byte{version, 0, 0, 0}
+	if version == 1 {
+		out = append(out, make([]byte, 16)...)
+		out = binary.BigEndian.AppendUint32(out, timescale)
+		return binary.BigEndian.AppendUint64(out, duration)
+	}
+	out = append(out, make([]byte, 8)...)
+	out = binary.BigEndian.AppendUint32(out, timescale)
+	return binary.BigEndian.AppendUint32(out, uint32(duration))
+}
+
+func buildMP4(moov ...[]byte) []byte {
+	ftyp := box("ftyp", []byte("isom\x00\x00\x02\x00isom"))
+	return append(append(ftyp, box("mdat", make([]byte, 32))...), box("moov", moov...)...)
+}
+
+func extractBytes(e Extractor, mimeType string, data []byte) (*types.FileMetadata, error) {
+	m := &types.FileMetadata{MIME: mimeType}
+	err := e.Extract(bytes.NewReader(data), int64(len(data)), m)
+	return m, err
+}
+
+func TestExtractJPEG(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.jpg")
+	if err := os.WriteFile(path, buildJPEG(t, sampleTIFF()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := Extract(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.MIME != "image/jpeg" || m.Width != 4 || m.Height != 3 {
+		t.Errorf("mime/size = %s %dx%d", m.MIME, m.Width, m.Height)
+	}
+	if m.CameraMake != "Canon" || m.CameraModel != "EOS R5" {
+		t.Errorf("camera = %q %q", m.CameraMake, m.CameraModel)
+	}
+	// DateTimeOriginal 优先于 DateTime，并按 OffsetTimeOriginal 解析时区
+	if want := time.Date(2024, 5, 1, 4, 30, 0, 0, time.UTC); m.TakenAt == nil || !m.TakenAt.Equal(want) {
+		t.Errorf("taken_at = %v, want %v", m.TakenAt, want)
+	}
+	if m.Latitude == nil || m.Longitude == nil ||
+		math.Abs(*m.Latitude-30.25) > 1e-9 || math.Abs(*m.Longitude+120.501) > 1e-9 {
+		t.Errorf("gps = %v %v", m.Latitude, m.Longitude)
+	}
+}
+
+func TestExtractTIFF(t *testing.T) {
+	tiff := buildTIFF([]tiffEntry{ascii(tagModel, "X100"), short(tagImageWidth, 640), short(tagImageLength, 480)}, nil, nil)
+	m, err := extractBytes(exifExtractor{}, "image/tiff", tiff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.CameraModel != "X100" || m.Width != 640 || m.Height != 480 || m.TakenAt != nil || m.Latitude != nil {
+		t.Errorf("metadata = %+v", m)
+	}
+	if got := DetectMIME("a.bin", tiff); got != "image/tiff" {
+		t.Errorf("DetectMIME = %s", got)
+	}
+}
+
+func TestOrientation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data []byte
+		want int
+	}{
+		{"exif", buildJPEG(t, sampleTIFF()), 6},
+		{"no exif", buildJPEG(t, nil), 1},
+		{"out of range", buildJPEG(t, buildTIFF([]tiffEntry{short(tagOrientation, 9)}, nil, nil)), 1},
+		{"not jpeg", []byte("GIF89a"), 1},
+	} {
+		if got := Orientation(bytes.NewReader(tc.data), int64(len(tc.data))); got != tc.want {
+			t.Errorf("%s: Orientation = %d, want %d", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestExifCorrupt(t *testing.T) {
+	valid := buildJPEG(t, sampleTIFF())
+	tiff := sampleTIFF()
+
+	// APP1 段声明的长度超出文件
+	overlong := append([]byte{}, valid[:4]...)
+	overlong = append(overlong, 0xFF, 0xFF)
+	overlong = append(overlong, valid[6:40]...)
+
+	// IFD0 的偏移指向文件之外
+	badIFD := append([]byte{}, tiff...)
+	binary.LittleEndian.PutUint32(badIFD[4:], 1<<31)
+
+	// IFD0 声明的条目过多
+	manyEntries := append([]byte{}, tiff...)
+	binary.LittleEndian.PutUint16(manyEntries[8:], 0xFFFF)
+
+	// 字段值的偏移指向文件之外、GPS 坐标的数量不是 3：忽略该字段，其余照常读取
+	badValue := buildTIFF(
+		[]tiffEntry{{tagMake, typeASCII, 64, binary.LittleEndian.AppendUint32(nil, 1<<30)}, ascii(tagModel, "EOS R5")},
+		nil,
+		[]tiffEntry{ascii(tagGPSLatitudeRef, "N"), rationals(tagGPSLatitude, 30, 1), ascii(tagGPSLongitudeRef, "E"), rationals(tagGPSLongitude, 120, 1, 0, 1, 0, 1)},
+	)
+
+	for _, tc := range []struct {
+		name     string
+		mimeType string
+		data     []byte
+		wantErr  bool
+	}{
+		{"truncated jpeg", "image/jpeg", valid[:30], true},
+		{"overlong segment", "image/jpeg", overlong, true},
+		{"not jpeg", "image/jpeg", []byte("not a jpeg"), true},
+		{"no exif", "image/jpeg", buildJPEG(t, nil), false},
+		{"truncated tiff", "image/tiff", tiff[:20], true},
+		{"bad header", "image/tiff", []byte("IX*\x00\x08\x00\x00\x00"), true},
+		{"ifd out of range", "image/tiff", badIFD, true},
+		{"too many entries", "image/tiff", manyEntries, true},
+		{"bad value", "image/tiff", badValue, false},
+	} {
+		m, err := extractBytes(exifExtractor{}, tc.mimeType, tc.data)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if m.CameraMake != "" || m.Latitude != nil || m.Longitude != nil {
+			t.Errorf("%s: metadata = %+v", tc.name, m)
+		}
+		if tc.name == "bad value" && m.CameraModel != "EOS R5" {
+			t.Errorf("%s: 其余字段应照常读取, model = %q", tc.name, m.CameraModel)
+		}
+	}
+}
+
+func TestExtractPDF(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		data      []byte
+		wantPages int
+		wantTitle string
+	}{
+		{"literal title", buildPDF(`(Hello \(World\)\041)`), 2, "Hello (World)!"},
+		{"utf-16 hex title", buildPDF("<FEFF4E2D6587>"), 2, "中文"},
+		{"object stream", buildObjStmPDF(t, "<< /Title (Packed) >>"), 7, "Packed"},
+		{"encrypted", append(buildPDF("(Secret)"), "trailer << /Encrypt 9 0 R >>\n"...), 2, ""},
+		{"truncated", buildPDF("(Hello)")[:100], 0, ""},
+		{"unterminated title", buildPDF("(Hello"), 2, ""},
+		{"odd hex title", buildPDF("<48656C6C6F2>"), 2, "Hello"},
+	} {
+		m, err := extractBytes(pdfExtractor{}, "application/pdf", tc.data)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if m.Pages != tc.wantPages || m.Title != tc.wantTitle {
+			t.Errorf("%s: pages = %d, title = %q, want %d %q", tc.name, m.Pages, m.Title, tc.wantPages, tc.wantTitle)
+		}
+	}
+}
+
+func TestPDFObjectStreamCorrupt(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body string
+	}{
+		// /N 乘 2 溢出时不能越过头部读取
+		{"huge count", "<< /Type /ObjStm /N 9223372036854775807 /First 4 >> stream\n5 0 << /Title (X) >>\nendstream"},
+		{"count exceeds header", "<< /Type /ObjStm /N 3 /First 4 >> stream\n5 0 << /Title (X) >>\nendstream"},
+		{"first beyond stream", "<< /Type /ObjStm /N 1 /First 4096 >> stream\n5 0 \nendstream"},
+		{"offset beyond stream", "<< /Type /ObjStm /N 2 /First 8 >> stream\n5 0 6 99 ()\nendstream"},
+		{"negative order", "<< /Type /ObjStm /N 2 /First 8 >> stream\n5 9 6 2 ()()\nendstream"},
+		{"bad flate", "<< /Type /ObjStm /N 1 /First 4 /Filter /FlateDecode >> stream\nnot zlib\nendstream"},
+		{"no endstream", "<< /Type /ObjStm /N 1 /First 4 >> stream\n5 0 ()"},
+	} {
+		if objects := objectStream([]byte(tc.body)); len(objects) != 0 {
+			t.Errorf("%s: objects = %q", tc.name, objects)
+		}
+	}
+}
+
+func TestExtractMP4(t *testing.T) {
+	// moov 的长度延续到文件末尾（长度字段为 0）
+	tail := buildMP4()
+	tail = append(tail[:len(tail)-8], append([]byte{0, 0, 0, 0}, "moov"...)...)
+	tail = append(tail, box("mvhd", mvhd(0, 600, 1800))...)
+
+	// 64 位长度
+	large := append(binary.BigEndian.AppendUint32(nil, 1), "moov"...)
+	mvhdBox := box("mvhd", mvhd(0, 10, 25))
+	large = binary.BigEndian.AppendUint64(large, uint64(16+len(mvhdBox)))
+	large = append(append(box("ftyp", []byte("isom")), large...), mvhdBox...)
+
+	for _, tc := range []struct {
+		name    string
+		data    []byte
+		want    float64
+		wantErr bool
+	}{
+		{"version 0", buildMP4(box("mvhd", mvhd(0, 1000, 2500))), 2.5, false},
+		{"version 1", buildMP4(box("trak"), box("mvhd", mvhd(1, 90000, 90000*3600))), 3600, false},
+		{"size to end", tail, 3, false},
+		{"64-bit size", large, 2.5, false},
+		{"unknown duration", buildMP4(box("mvhd", mvhd(0, 1000, 0xFFFFFFFF))), 0, false},
+		{"zero timescale", buildMP4(box("mvhd", mvhd(0, 0, 100))), 0, false},
+		{"no moov", box("ftyp", []byte("isom")), 0, true},
+		{"no mvhd", buildMP4(box("trak")), 0, true},
+		{"mvhd too short", buildMP4(box("mvhd", mvhd(1, 1000, 2500)[:24])), 0, true},
+		{"box exceeds parent", buildMP4(append(binary.BigEndian.AppendUint32(nil, 4096), "mvhd"...)), 0, true},
+		{"box shorter than header", buildMP4(append(binary.BigEndian.AppendUint32(nil, 4), "mvhd"...)), 0, true},
+		{"huge 64-bit size", append(append(binary.BigEndian.AppendUint32(nil, 1), "free"...), 0x7F, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF), 0, true},
+		{"truncated", buildMP4(box("mvhd", mvhd(0, 1000, 2500)))[:60], 0, true},
+	} {
+		m, err := extractBytes(mp4Extractor{}, "video/mp4", tc.data)
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tc.name, err, tc.wantErr)
+		}
+		if m.Duration != tc.want {
+			t.Errorf("%s: duration = %v, want %v", tc.name, m.Duration, tc.want)
+		}
+	}
+}
+
+// FuzzExtractors 任意输入都不能让提取器崩溃或越界读取
+func FuzzExtractors(f *testing.F) {
+	f.Add(buildJPEG(f, sampleTIFF()))
+	f.Add(sampleTIFF())
+	f.Add(buildPDF("<FEFF4E2D6587>"))
+	f.Add(buildObjStmPDF(f, "<< /Title (Packed) >>"))
+	f.Add(buildMP4(box("mvhd", mvhd(1, 1000, 2500))))
+
+	mimeTypes := []string{"image/jpeg", "image/tiff", "application/pdf", "video/mp4"}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, e := range extractors {
+			for _, typ := range mimeTypes {
+				if e.Match(typ) {
+					extractBytes(e, typ, data)
+				}
+			}
+		}
+		Orientation(bytes.NewReader(data), int64(len(data)))
+	})
+}
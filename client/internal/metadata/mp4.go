@@ -0,0 +1,109 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"smart-finder/shared/types"
+)
+
+// mp4Extractor 从 ISO 媒体文件（MP4、MOV、M4A、3GP）的 moov/mvhd 读取时长，
+// 通过 Seek 跳过媒体数据，不读取整个文件
+type mp4Extractor struct{}
+
+func (mp4Extractor) Match(mimeType string) bool {
+	switch mimeType {
+	case "video/mp4", "video/quicktime", "audio/mp4", "video/3gpp":
+		return true
+	}
+	return false
+}
+
+func (mp4Extractor) Extract(r io.ReadSeeker, size int64, m *types.FileMetadata) error {
+	moov, moovSize, err := findBox(r, 0, size, "moov")
+	if err != nil {
+		return err
+	}
+	mvhd, mvhdSize, err := findBox(r, moov, moov+moovSize, "mvhd")
+	if err != nil {
+		return err
+	}
+	if mvhdSize < 4 {
+		return errors.New("mvhd过短")
+	}
+	if _, err := r.Seek(mvhd, io.SeekStart); err != nil {
+		return err
+	}
+	var version [4]byte // 版本与标志
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return err
+	}
+	// 版本 1 的时间与时长为 64 位，读取的字段不能超出 mvhd
+	need := int64(4 + 16)
+	if version[0] == 1 {
+		need = 4 + 28
+	}
+	if mvhdSize < need {
+		return errors.New("mvhd过短")
+	}
+
+	var timescale, duration uint64
+	if version[0] == 1 {
+		var v struct {
+			Created, Modified uint64
+			Timescale         uint32
+			Duration          uint64
+		}
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return err
+		}
+		timescale, duration = uint64(v.Timescale), v.Duration
+	} else {
+		var v struct {
+			Created, Modified, Timescale, Duration uint32
+		}
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return err
+		}
+		timescale, duration = uint64(v.Timescale), uint64(v.Duration)
+	}
+	// 时长未知时为全 1
+	if timescale == 0 || duration == 0 || duration == 0xFFFFFFFF || duration == 1<<64-1 {
+		return nil
+	}
+	m.Duration = float64(duration) / float64(timescale)
+	return nil
+}
+
+// findBox 在 [start, end) 范围内查找指定类型的 box，返回内容的起始位置与长度
+func findBox(r io.ReadSeeker, start, end int64, typ string) (int64, int64, error) {
+	for pos := start; pos+8 <= end; {
+		if _, err := r.Seek(pos, io.SeekStart); err != nil {
+			return 0, 0, err
+		}
+		var head [16]byte
+		if _, err := io.ReadFull(r, head[:8]); err != nil {
+			return 0, 0, err
+		}
+		size, headLen := int64(binary.BigEndian.Uint32(head[:4])), int64(8)
+		switch size {
+		case 0: // 延续到范围末尾
+			size = end - pos
+		case 1: // 64 位长度
+			if _, err := io.ReadFull(r, head[8:16]); err != nil {
+				return 0, 0, err
+			}
+			size, headLen = int64(binary.BigEndian.Uint64(head[8:16])), 16
+		}
+		// 与剩余长度比较，64 位长度很大时 pos+size 会溢出
+		if size < headLen || size > end-pos {
+			return 0, 0, errors.New("box长度错误")
+		}
+		if string(head[4:8]) == typ {
+			return pos + headLen, size - headLen, nil
+		}
+		pos += size
+	}
+	return 0, 0, errors.New("没有找到" + typ)
+}
@@ -0,0 +1,266 @@
+package metadata
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/hex"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"smart-finder/shared/types"
+)
+
+// maxPDFSize 更大的PDF不提取元数据，避免索引时占用过多内存
+const maxPDFSize = 64 << 20
+
+var (
+	pdfObjectRe = regexp.MustCompile(`(?s)(\d+)\s+\d+\s+obj\b(.*?)\bendobj`)
+	pdfPagesRe  = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfObjStmRe = regexp.MustCompile(`/Type\s*/ObjStm\b`)
+	pdfCountRe  = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfInfoRe   = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	pdfRefRe    = regexp.MustCompile(`^(\d+)\s+\d+\s+R`)
+)
+
+// pdfExtractor 读取PDF的页数与文档信息中的标题
+//
+// 不做完整的语法解析：收集所有对象（包括对象流中压缩的对象），页数取
+// 页面树节点中最大的 /Count，标题取 trailer 的 /Info 指向的字典。
+type pdfExtractor struct{}
+
+func (pdfExtractor) Match(mimeType string) bool {
+	return mimeType == "application/pdf"
+}
+
+func (pdfExtractor) Extract(r io.ReadSeeker, size int64, m *types.FileMetadata) error {
+	if size > maxPDFSize {
+		return nil
+	}
+	data, err := io.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return err
+	}
+	objects := pdfObjects(data)
+
+	for _, body := range objects {
+		if !pdfPagesRe.Match(body) {
+			continue
+		}
+		if match := pdfCountRe.FindSubmatch(body); match != nil {
+			if n, err := strconv.Atoi(string(match[1])); err == nil && n > m.Pages {
+				m.Pages = n
+			}
+		}
+	}
+
+	// 加密文档的字符串也是加密的
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil
+	}
+	refs := pdfInfoRe.FindAllSubmatch(data, -1)
+	if len(refs) == 0 {
+		return nil
+	}
+	// 增量更新时最后一个 trailer 有效
+	info := objects[string(refs[len(refs)-1][1])]
+	m.Title = pdfDictString(info, "/Title", objects)
+	return nil
+}
+
+// pdfObjects 返回对象号到对象内容的映射，后出现的定义覆盖先出现的
+func pdfObjects(data []byte) map[string][]byte {
+	objects := make(map[string][]byte)
+	var streams [][]byte
+	for _, match := range pdfObjectRe.FindAllSubmatch(data, -1) {
+		objects[string(match[1])] = match[2]
+		if pdfObjStmRe.Match(match[2]) {
+			streams = append(streams, match[2])
+		}
+	}
+	for _, body := range streams {
+		for num, obj := range objectStream(body) {
+			if _, ok := objects[num]; !ok {
+				objects[num] = obj
+			}
+		}
+	}
+	return objects
+}
+
+// objectStream 解出对象流中的对象，只支持 FlateDecode 与未压缩的流
+func objectStream(body []byte) map[string][]byte {
+	dict, stream, ok := bytes.Cut(body, []byte("stream"))
+	if !ok {
+		return nil
+	}
+	end := bytes.LastIndex(stream, []byte("endstream"))
+	if end < 0 {
+		return nil
+	}
+	stream = bytes.TrimLeft(stream[:end], "\r\n")
+
+	if bytes.Contains(dict, []byte("/Filter")) {
+		if !bytes.Contains(dict, []byte("/FlateDecode")) || bytes.Contains(dict, []byte("/DecodeParms")) {
+			return nil
+		}
+		zr, err := zlib.NewReader(bytes.NewReader(stream))
+		if err != nil {
+			return nil
+		}
+		// 流末尾可能有多余的字节，读到出错为止
+		stream, _ = io.ReadAll(io.LimitReader(zr, maxPDFSize))
+	}
+
+	n, first := pdfInt(dict, "/N"), pdfInt(dict, "/First")
+	if n <= 0 || first <= 0 || first > len(stream) {
+		return nil
+	}
+	// 每个对象在头部占两个数，n 大于头部能容纳的数量时为损坏的流，不按 n 分配
+	header := strings.Fields(string(stream[:first]))
+	if n > len(header)/2 {
+		return nil
+	}
+	objects := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		start, err := strconv.Atoi(header[2*i+1])
+		if err != nil {
+			return nil
+		}
+		end := len(stream) - first
+		if i+1 < n {
+			if end, err = strconv.Atoi(header[2*i+3]); err != nil {
+				return nil
+			}
+		}
+		if start < 0 || start > end || first+end > len(stream) {
+			return nil
+		}
+		objects[header[2*i]] = stream[first+start : first+end]
+	}
+	return objects
+}
+
+func pdfInt(dict []byte, key string) int {
+	match := regexp.MustCompile(regexp.QuoteMeta(key) + `\s+(\d+)`).FindSubmatch(dict)
+	if match == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(string(match[1]))
+	return n
+}
+
+// pdfDictString 读取字典中字符串类型的值，值可以是间接引用
+func pdfDictString(dict []byte, key string, objects map[string][]byte) string {
+	i := bytes.Index(dict, []byte(key))
+	if i < 0 {
+		return ""
+	}
+	value := bytes.TrimLeft(dict[i+len(key):], " \t\r\n")
+	if match := pdfRefRe.FindSubmatch(value); match != nil {
+		value = bytes.TrimSpace(objects[string(match[1])])
+	}
+	raw, ok := pdfString(value)
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(decodePDFText(raw))
+}
+
+// pdfString 解析开头的字面量字符串 (...) 或十六进制字符串 <...>
+func pdfString(b []byte) ([]byte, bool) {
+	if len(b) == 0 {
+		return nil, false
+	}
+	if b[0] == '<' && !bytes.HasPrefix(b, []byte("<<")) {
+		end := bytes.IndexByte(b, '>')
+		if end < 0 {
+			return nil, false
+		}
+		digits := strings.Join(strings.Fields(string(b[1:end])), "")
+		if len(digits)%2 == 1 {
+			digits += "0"
+		}
+		out, err := hex.DecodeString(digits)
+		return out, err == nil
+	}
+	if b[0] != '(' {
+		return nil, false
+	}
+
+	var out []byte
+	depth := 0
+	for i := 1; i < len(b); i++ {
+		c := b[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return out, true
+			}
+			depth--
+		case '\\':
+			i++
+			if i >= len(b) {
+				return nil, false
+			}
+			switch e := b[i]; e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n': // 续行
+				if e == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+					i++
+				}
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for k := 0; k < 2 && i+1 < len(b) && b[i+1] >= '0' && b[i+1] <= '7'; k++ {
+						i++
+						v = v*8 + int(b[i]-'0')
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		out = append(out, c)
+	}
+	return nil, false
+}
+
+// decodePDFText 解码文本字符串：带 BOM 的 UTF-16BE 或 UTF-8，其余按 PDFDocEncoding
+// 近似为 Latin-1，不少生成器直接写入 UTF-8，这种情况保持原样
+func decodePDFText(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		b = b[2:]
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+		}
+		return string(utf16.Decode(units))
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:])
+	case utf8.Valid(b):
+		return string(b)
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
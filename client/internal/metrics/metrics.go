@@ -0,0 +1,96 @@
+// Package metrics 以 Prometheus 格式导出客户端的索引与扫描指标
+package metrics
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"smart-finder/client/internal/indexer"
+)
+
+const namespace = "smartfinder_client"
+
+var (
+	indexFilesDesc = prometheus.NewDesc(namespace+"_index_files",
+		"索引中的文件数", nil, nil)
+	scansDesc = prometheus.NewDesc(namespace+"_scans_total",
+		"完成的扫描次数", nil, nil)
+	scanDurationDesc = prometheus.NewDesc(namespace+"_last_scan_duration_seconds",
+		"最近一次完成的扫描耗时", nil, nil)
+	scanEndDesc = prometheus.NewDesc(namespace+"_last_scan_end_timestamp_seconds",
+		"最近一次扫描完成的时间", nil, nil)
+	scanRunningDesc = prometheus.NewDesc(namespace+"_scan_running",
+		"是否正在扫描", nil, nil)
+	filesHashedDesc = prometheus.NewDesc(namespace+"_files_hashed_total",
+		"计算了MD5的文件数，用 rate() 得到每秒哈希的文件数", nil, nil)
+	bytesHashedDesc = prometheus.NewDesc(namespace+"_bytes_hashed_total",
+		"计算MD5读取的字节数", nil, nil)
+	errorsDesc = prometheus.NewDesc(namespace+"_scan_errors_total",
+		"扫描中处理失败的文件数", nil, nil)
+	queueDepthDesc = prometheus.NewDesc(namespace+"_scan_queue_depth",
+		"扫描已遍历到、尚未处理完的文件数（客户端没有文件系统监听，此为扫描队列）", nil, nil)
+)
+
+// Collector 在每次采集时读取扫描器计数和索引大小
+type Collector struct {
+	db      func() *sql.DB
+	scanner func() *indexer.ScheduledScanner
+}
+
+// NewCollector 创建采集器，数据库和扫描器在恢复备份后可能被替换，因此每次采集时获取
+func NewCollector(db func() *sql.DB, scanner func() *indexer.ScheduledScanner) *Collector {
+	return &Collector{db: db, scanner: scanner}
+}
+
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		indexFilesDesc, scansDesc, scanDurationDesc, scanEndDesc, scanRunningDesc,
+		filesHashedDesc, bytesHashedDesc, errorsDesc, queueDepthDesc,
+	} {
+		ch <- d
+	}
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	if dbConn := c.db(); dbConn != nil {
+		var count int64
+		if err := dbConn.QueryRow("SELECT COUNT(*) FROM files").Scan(&count); err != nil {
+			log.Printf("统计索引大小失败: %v", err)
+		} else {
+			ch <- prometheus.MustNewConstMetric(indexFilesDesc, prometheus.GaugeValue, float64(count))
+		}
+	}
+
+	s := c.scanner()
+	if s == nil {
+		return
+	}
+	counters := s.Counters()
+	status := s.GetStatus()
+	ch <- prometheus.MustNewConstMetric(scansDesc, prometheus.CounterValue, float64(counters.ScansTotal))
+	ch <- prometheus.MustNewConstMetric(scanDurationDesc, prometheus.GaugeValue, counters.LastDuration.Seconds())
+	if !counters.LastScanEnd.IsZero() {
+		ch <- prometheus.MustNewConstMetric(scanEndDesc, prometheus.GaugeValue, float64(counters.LastScanEnd.Unix()))
+	}
+	running := 0.0
+	if status.IsScanning {
+		running = 1
+	}
+	ch <- prometheus.MustNewConstMetric(scanRunningDesc, prometheus.GaugeValue, running)
+	ch <- prometheus.MustNewConstMetric(filesHashedDesc, prometheus.CounterValue, float64(counters.FilesHashed))
+	ch <- prometheus.MustNewConstMetric(bytesHashedDesc, prometheus.CounterValue, float64(counters.BytesHashed))
+	ch <- prometheus.MustNewConstMetric(errorsDesc, prometheus.CounterValue, float64(counters.Errors))
+	ch <- prometheus.MustNewConstMetric(queueDepthDesc, prometheus.GaugeValue, float64(counters.QueueDepth))
+}
+
+// Handler 返回 /metrics 处理器，包含客户端指标及 Go 运行时、进程指标
+func Handler(c *Collector) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c, collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
@@ -0,0 +1,376 @@
+// Package registry 向网关登记本机，并发布所选监控目录的索引摘要
+//
+// 登记是可选的：配置了网关地址并选择了要发布的监控目录后，发布器定期
+// 向网关发送心跳，索引摘要变化（或网关没有本机的记录）时发布这些目录
+// 中文件的哈希与大小，按设置附带完整路径、相对目录的路径或不附带路径。
+// 其他监控目录中的文件不会离开本机。
+package registry
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-finder/client/internal/db"
+	"smart-finder/shared/constants"
+	"smart-finder/shared/types"
+)
+
+const (
+	// Interval 心跳间隔，索引有变化时随心跳重新发布
+	Interval = 10 * time.Minute
+	// requestTimeout 单次发布或心跳的超时
+	requestTimeout = 2 * time.Minute
+)
+
+// 发布路径的方式
+const (
+	PathsFull     = "full"     // 本机上的完整路径
+	PathsRelative = "relative" // 以监控目录名开头的相对路径，不透露目录所在位置
+	PathsNone     = "none"     // 只发布哈希与大小
+)
+
+// Config 登记配置
+type Config struct {
+	URL   string   `json:"url"` // 为空时不登记
+	Name  string   `json:"name"`
+	Roots []string `json:"roots"` // 只包含仍在监控中的目录
+	Paths string   `json:"paths"`
+
+	token string
+}
+
+// Enabled 判断是否需要登记
+func (c Config) Enabled() bool {
+	return c.URL != "" && len(c.Roots) > 0
+}
+
+// LoadConfig 从设置表读取登记配置
+func LoadConfig(dbConn *sql.DB) Config {
+	cfg := Config{
+		URL:   db.GetSetting(dbConn, db.SettingRegistryURL, ""),
+		Name:  db.GetSetting(dbConn, db.SettingRegistryName, ""),
+		Paths: db.GetSetting(dbConn, db.SettingRegistryPaths, PathsFull),
+		token: db.GetSetting(dbConn, db.SettingRegistryToken, ""),
+	}
+	if cfg.Name == "" {
+		cfg.Name, _ = os.Hostname()
+	}
+	if ParsePaths(cfg.Paths) != nil {
+		cfg.Paths = PathsFull
+	}
+	monitored, _ := db.GetMonitoredDirectories(dbConn)
+	for _, root := range SplitRoots(db.GetSetting(dbConn, db.SettingRegistryRoots, "")) {
+		for _, dir := range monitored {
+			if filepath.Clean(dir) == filepath.Clean(root) {
+				cfg.Roots = append(cfg.Roots, dir)
+				break
+			}
+		}
+	}
+	return cfg
+}
+
+// ParseURL 校验网关地址，空字符串表示不登记
+func ParseURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("网关地址应为 http(s) 地址: %s", s)
+	}
+	return nil
+}
+
+// ParsePaths 校验发布路径的方式
+func ParsePaths(s string) error {
+	switch s {
+	case PathsFull, PathsRelative, PathsNone:
+		return nil
+	}
+	return fmt.Errorf("无效的路径发布方式: %s，应为 full、relative 或 none", s)
+}
+
+// SplitRoots 拆分每行一个的目录列表
+func SplitRoots(s string) []string {
+	var roots []string
+	for _, line := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			roots = append(roots, line)
+		}
+	}
+	return roots
+}
+
+// Files 返回 cfg.Roots 中要发布的文件，按哈希与路径排序
+func Files(dbConn *sql.DB, cfg Config) ([]types.RegistryFile, error) {
+	rows, err := dbConn.Query("SELECT md5, path, size FROM files")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make([]types.RegistryFile, 0)
+	for rows.Next() {
+		var f types.RegistryFile
+		if err := rows.Scan(&f.MD5, &f.Path, &f.Size); err != nil {
+			return nil, err
+		}
+		root, ok := rootOf(cfg.Roots, f.Path)
+		if !ok {
+			continue
+		}
+		switch cfg.Paths {
+		case PathsNone:
+			f.Path = ""
+		case PathsRelative:
+			rel, err := filepath.Rel(root, f.Path)
+			if err != nil {
+				continue
+			}
+			f.Path = filepath.ToSlash(filepath.Join(filepath.Base(root), rel))
+		}
+		files = append(files, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].MD5 != files[j].MD5 {
+			return files[i].MD5 < files[j].MD5
+		}
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// rootOf 返回 path 所在的目录
+func rootOf(roots []string, path string) (string, bool) {
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if strings.HasPrefix(path, root) &&
+			(len(path) == len(root) || os.IsPathSeparator(path[len(root)]) || os.IsPathSeparator(root[len(root)-1])) {
+			return root, true
+		}
+	}
+	return "", false
+}
+
+// Digest 计算文件列表的摘要，files 需已排序
+func Digest(files []types.RegistryFile) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\t%s\t%d\n", f.MD5, f.Path, f.Size)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Status 发布器的状态
+type Status struct {
+	Config
+	ClientID      string    `json:"client_id,omitempty"`
+	Files         int       `json:"files"`
+	LastRun       time.Time `json:"last_run,omitzero"`
+	LastPublished time.Time `json:"last_published,omitzero"`
+	LastError     string    `json:"last_error,omitempty"`
+}
+
+// Publisher 定期向网关发送心跳并在索引变化时发布
+type Publisher struct {
+	dbConn   *sql.DB
+	version  string
+	client   *http.Client
+	reload   chan struct{}
+	stopChan chan struct{}
+	stopOnce sync.Once
+
+	mu            sync.Mutex
+	digest        string // 最近一次成功发布的摘要
+	files         int
+	lastRun       time.Time
+	lastPublished time.Time
+	lastErr       error
+}
+
+// NewPublisher 创建发布器，version 为客户端版本
+func NewPublisher(dbConn *sql.DB, version string) *Publisher {
+	return &Publisher{
+		dbConn:   dbConn,
+		version:  version,
+		client:   &http.Client{Timeout: requestTimeout},
+		reload:   make(chan struct{}, 1),
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Config 返回当前生效的登记配置
+func (p *Publisher) Config() Config {
+	return LoadConfig(p.dbConn)
+}
+
+// Start 启动定期发布，阻塞直到 Stop 被调用
+func (p *Publisher) Start() {
+	for {
+		var timer <-chan time.Time
+		if p.Config().Enabled() {
+			if err := p.RunNow(context.Background()); err != nil {
+				log.Printf("向网关发布索引摘要失败: %v", err)
+			}
+			timer = time.After(Interval)
+		}
+
+		select {
+		case <-timer:
+		case <-p.reload:
+		case <-p.stopChan:
+			return
+		}
+	}
+}
+
+// Stop 停止定期发布
+func (p *Publisher) Stop() {
+	p.stopOnce.Do(func() { close(p.stopChan) })
+}
+
+// Reload 配置变更后立即按新配置发布
+func (p *Publisher) Reload() {
+	select {
+	case p.reload <- struct{}{}:
+	default:
+	}
+}
+
+// RunNow 立即发送心跳，网关的摘要与本机不一致时重新发布
+func (p *Publisher) RunNow(ctx context.Context) error {
+	err := p.run(ctx)
+	p.mu.Lock()
+	p.lastRun, p.lastErr = time.Now(), err
+	p.mu.Unlock()
+	return err
+}
+
+func (p *Publisher) run(ctx context.Context) error {
+	cfg := p.Config()
+	if !cfg.Enabled() {
+		return errors.New("未配置网关地址或要发布的目录")
+	}
+	clientID, err := p.clientID()
+	if err != nil {
+		return err
+	}
+	files, err := Files(p.dbConn, cfg)
+	if err != nil {
+		return err
+	}
+	digest := Digest(files)
+
+	p.mu.Lock()
+	published := p.digest == digest
+	p.mu.Unlock()
+	if published {
+		var resp types.RegistryHeartbeatResponse
+		if err := p.post(ctx, cfg, constants.RegistryHeartbeatEndpoint,
+			types.RegistryHeartbeat{ClientID: clientID, Digest: digest}, &resp); err != nil {
+			return err
+		}
+		if resp.Current {
+			return nil
+		}
+	}
+
+	err = p.post(ctx, cfg, constants.RegistryPublishEndpoint, types.RegistryPublish{
+		ClientID: clientID,
+		Name:     cfg.Name,
+		Version:  p.version,
+		Digest:   digest,
+		Files:    files,
+	}, nil)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.digest, p.files, p.lastPublished = digest, len(files), time.Now()
+	p.mu.Unlock()
+	log.Printf("已向网关发布 %d 个文件", len(files))
+	return nil
+}
+
+// post 以 gzip 压缩的 JSON 发送请求，resp 不为 nil 时解析响应
+func (p *Publisher) post(ctx context.Context, cfg Config, endpoint string, body, resp any) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(body); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(cfg.URL, "/")+endpoint, &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Authorization", "Bearer "+cfg.token)
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("网关返回 %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+	if resp != nil {
+		return json.NewDecoder(res.Body).Decode(resp)
+	}
+	return nil
+}
+
+// clientID 返回本机的标识，首次使用时生成并保存
+func (p *Publisher) clientID() (string, error) {
+	if id := db.GetSetting(p.dbConn, db.SettingRegistryClientID, ""); id != "" {
+		return id, nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	return id, db.SetSetting(p.dbConn, db.SettingRegistryClientID, id)
+}
+
+// Status 返回当前配置与最近一次发布的结果
+func (p *Publisher) Status() Status {
+	s := Status{
+		Config:   p.Config(),
+		ClientID: db.GetSetting(p.dbConn, db.SettingRegistryClientID, ""),
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s.Files, s.LastRun, s.LastPublished = p.files, p.lastRun, p.lastPublished
+	if p.lastErr != nil {
+		s.LastError = p.lastErr.Error()
+	}
+	return s
+}
@@ -0,0 +1,246 @@
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"smart-finder/client/internal/db"
+)
+
+// csvHeader CSV 快照的列
+var csvHeader = []string{
+	"type", "key", "value", "md5", "path", "filename", "size",
+	"modified_at", "link_type", "link_target", "link_count",
+}
+
+// flushEvery 每写出多少条记录刷新一次输出
+const flushEvery = 1000
+
+// Export 以 NDJSON 或 CSV 格式流式导出索引
+//
+// 所有表在同一个读事务中读取，扫描进行中导出的也是一致的快照。
+func Export(ctx context.Context, w io.Writer, dbConn *sql.DB, format Format, appVersion string) error {
+	var enc recordWriter
+	switch format {
+	case FormatNDJSON:
+		enc = newNDJSONWriter(w)
+	case FormatCSV:
+		enc = newCSVWriter(w)
+	default:
+		return fmt.Errorf("格式 %s 不支持流式导出", format)
+	}
+
+	tx, err := dbConn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	if err := enc.Write(Record{
+		Type:       RecordHeader,
+		Version:    FormatVersion,
+		AppVersion: appVersion,
+		ExportedAt: &now,
+	}); err != nil {
+		return err
+	}
+
+	dirs, err := db.GetMonitoredDirectories(tx)
+	if err != nil {
+		return err
+	}
+	for _, dir := range dirs {
+		if err := enc.Write(Record{Type: RecordMonitoredDir, Value: dir}); err != nil {
+			return err
+		}
+	}
+
+	patterns, err := db.GetIgnoredPatterns(tx)
+	if err != nil {
+		return err
+	}
+	for _, pattern := range patterns {
+		if err := enc.Write(Record{Type: RecordIgnorePattern, Value: pattern}); err != nil {
+			return err
+		}
+	}
+
+	settings, err := db.GetSettings(tx)
+	if err != nil {
+		return err
+	}
+	for key, value := range settings {
+		if err := enc.Write(Record{Type: RecordSetting, Key: key, Value: value}); err != nil {
+			return err
+		}
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT md5, path, filename, size, modified_at, link_type, link_target, link_count
+		FROM files ORDER BY path`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for n := 1; rows.Next(); n++ {
+		rec := Record{Type: RecordFile}
+		var modifiedAt time.Time
+		if err := rows.Scan(&rec.MD5, &rec.Path, &rec.Filename, &rec.Size, &modifiedAt,
+			&rec.LinkType, &rec.LinkTarget, &rec.LinkCount); err != nil {
+			return err
+		}
+		rec.ModifiedAt = &modifiedAt
+		if err := enc.Write(rec); err != nil {
+			return err
+		}
+		if n%flushEvery == 0 {
+			if err := enc.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// ExportSQLite 使用在线备份 API 将数据库备份到临时文件后写出
+func ExportSQLite(ctx context.Context, w io.Writer, dbConn *sql.DB) error {
+	tmp, err := os.CreateTemp("", "smart-finder-export-*.db")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := db.Backup(ctx, dbConn, tmpPath); err != nil {
+		return err
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// recordWriter 记录编码器
+type recordWriter interface {
+	Write(rec Record) error
+	Flush() error
+}
+
+// flusher 由 http.ResponseWriter 等实现，用于把缓冲数据推送给对端
+type flusher interface {
+	Flush()
+}
+
+type ndjsonWriter struct {
+	dst io.Writer
+	buf *bufio.Writer
+	enc *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buf := bufio.NewWriter(w)
+	return &ndjsonWriter{dst: w, buf: buf, enc: json.NewEncoder(buf)}
+}
+
+func (n *ndjsonWriter) Write(rec Record) error {
+	return n.enc.Encode(rec)
+}
+
+func (n *ndjsonWriter) Flush() error {
+	if err := n.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := n.dst.(flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+type csvWriter struct {
+	dst         io.Writer
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{dst: w, w: csv.NewWriter(w)}
+}
+
+func (c *csvWriter) Write(rec Record) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.wroteHeader = true
+	}
+
+	if rec.Type == RecordHeader {
+		// CSV 中头信息拆分为多行键值对
+		for _, kv := range [][2]string{
+			{"version", strconv.Itoa(rec.Version)},
+			{"app_version", rec.AppVersion},
+			{"exported_at", formatTime(rec.ExportedAt, time.RFC3339)},
+		} {
+			row := make([]string, len(csvHeader))
+			row[0], row[1], row[2] = RecordHeader, kv[0], kv[1]
+			if err := c.w.Write(row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	row := make([]string, len(csvHeader))
+	row[0] = rec.Type
+	switch rec.Type {
+	case RecordFile:
+		row[3] = rec.MD5
+		row[4] = rec.Path
+		row[5] = rec.Filename
+		row[6] = strconv.FormatInt(rec.Size, 10)
+		row[7] = formatTime(rec.ModifiedAt, time.RFC3339Nano)
+		row[8] = rec.LinkType
+		row[9] = rec.LinkTarget
+		row[10] = strconv.FormatInt(rec.LinkCount, 10)
+	default:
+		row[1] = rec.Key
+		row[2] = rec.Value
+	}
+	return c.w.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return err
+	}
+	if f, ok := c.dst.(flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+func formatTime(t *time.Time, layout string) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(layout)
+}
@@ -0,0 +1,308 @@
+package snapshot
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"smart-finder/client/internal/db"
+)
+
+// ImportMode 导入模式
+type ImportMode string
+
+const (
+	// ImportMerge 合并到现有索引，已存在的记录保持不变
+	ImportMerge ImportMode = "merge"
+	// ImportReplace 清空现有索引后导入
+	ImportReplace ImportMode = "replace"
+)
+
+// ParseImportMode 解析导入模式，空串为合并
+func ParseImportMode(s string) (ImportMode, error) {
+	switch m := ImportMode(s); m {
+	case "":
+		return ImportMerge, nil
+	case ImportMerge, ImportReplace:
+		return m, nil
+	default:
+		return "", fmt.Errorf("不支持的导入模式: %s", s)
+	}
+}
+
+// ImportOptions 导入选项
+type ImportOptions struct {
+	Mode     ImportMode
+	Rewrites []PathRewrite
+}
+
+// ImportStats 导入结果统计
+type ImportStats struct {
+	Files          int `json:"files"`
+	FilesSkipped   int `json:"filesSkipped"`
+	MonitoredDirs  int `json:"monitoredDirs"`
+	IgnorePatterns int `json:"ignorePatterns"`
+	Settings       int `json:"settings"`
+}
+
+// recordReader 记录解码器，读完时返回 io.EOF
+type recordReader interface {
+	Read() (Record, error)
+}
+
+// Import 从 NDJSON 或 CSV 快照导入索引，整个导入在一个事务中完成
+func Import(ctx context.Context, r io.Reader, dbConn *sql.DB, format Format, opts ImportOptions) (ImportStats, error) {
+	var dec recordReader
+	switch format {
+	case FormatNDJSON:
+		dec = newNDJSONReader(r)
+	case FormatCSV:
+		dec = newCSVReader(r)
+	default:
+		return ImportStats{}, fmt.Errorf("格式 %s 不支持流式导入", format)
+	}
+	return importRecords(ctx, dec, dbConn, opts)
+}
+
+// ImportSQLite 从 SQLite 快照文件导入索引
+//
+// 快照先复制到临时文件并升级到当前表结构（兼容旧版本直接复制的 md5fs.db），
+// 再转为 NDJSON 流按与文本格式相同的规则合并。
+func ImportSQLite(ctx context.Context, path string, dbConn *sql.DB, opts ImportOptions) (ImportStats, error) {
+	tmp, err := os.CreateTemp("", "smart-finder-import-*.db")
+	if err != nil {
+		return ImportStats{}, err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	src, err := os.Open(path)
+	if err != nil {
+		tmp.Close()
+		return ImportStats{}, err
+	}
+	_, err = io.Copy(tmp, src)
+	src.Close()
+	tmp.Close()
+	if err != nil {
+		return ImportStats{}, err
+	}
+
+	snap, err := db.InitDB(tmpPath)
+	if err != nil {
+		return ImportStats{}, fmt.Errorf("无法打开快照: %w", err)
+	}
+	defer snap.Close()
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(Export(ctx, pw, snap, FormatNDJSON, ""))
+	}()
+	defer pr.Close()
+	return Import(ctx, pr, dbConn, FormatNDJSON, opts)
+}
+
+func importRecords(ctx context.Context, dec recordReader, dbConn *sql.DB, opts ImportOptions) (ImportStats, error) {
+	var stats ImportStats
+
+	tx, err := dbConn.BeginTx(ctx, nil)
+	if err != nil {
+		return stats, err
+	}
+	defer tx.Rollback()
+
+	if opts.Mode == ImportReplace {
+		for _, table := range []string{"files", "monitored_directories", "ignored_patterns", "settings"} {
+			if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+				return stats, err
+			}
+		}
+	}
+
+	insertFile, err := tx.Prepare(`
+		INSERT INTO files (md5, path, filename, size, modified_at, scan_flag, link_type, link_target, link_count)
+		VALUES (?, ?, ?, ?, ?, 1, ?, ?, ?)
+		ON CONFLICT(md5) DO NOTHING`)
+	if err != nil {
+		return stats, err
+	}
+	defer insertFile.Close()
+
+	for line := 1; ; line++ {
+		rec, err := dec.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return stats, fmt.Errorf("第 %d 条记录解析失败: %w", line, err)
+		}
+
+		switch rec.Type {
+		case RecordHeader:
+			if rec.Version > FormatVersion {
+				return stats, fmt.Errorf("快照版本 %d 高于当前支持的版本 %d", rec.Version, FormatVersion)
+			}
+		case RecordMonitoredDir:
+			res, err := tx.Exec("INSERT OR IGNORE INTO monitored_directories (path) VALUES (?)",
+				rewritePath(rec.Value, opts.Rewrites))
+			if err != nil {
+				return stats, err
+			}
+			stats.MonitoredDirs += affected(res)
+		case RecordIgnorePattern:
+			res, err := tx.Exec("INSERT OR IGNORE INTO ignored_patterns (pattern) VALUES (?)", rec.Value)
+			if err != nil {
+				return stats, err
+			}
+			stats.IgnorePatterns += affected(res)
+		case RecordSetting:
+			res, err := tx.Exec("INSERT OR IGNORE INTO settings (key, value) VALUES (?, ?)", rec.Key, rec.Value)
+			if err != nil {
+				return stats, err
+			}
+			stats.Settings += affected(res)
+		case RecordFile:
+			if len(rec.MD5) != 32 || rec.Path == "" {
+				return stats, fmt.Errorf("第 %d 条记录不是有效的文件记录", line)
+			}
+			linkTarget := rec.LinkTarget
+			if linkTarget != "" {
+				linkTarget = rewritePath(linkTarget, opts.Rewrites)
+			}
+			linkCount := rec.LinkCount
+			if linkCount < 1 {
+				linkCount = 1
+			}
+			// 与扫描器一样以本地时区保存，按修改时间过滤和排序时才能直接比较文本
+			var modifiedAt time.Time
+			if rec.ModifiedAt != nil {
+				modifiedAt = rec.ModifiedAt.Local()
+			}
+			res, err := insertFile.Exec(rec.MD5, rewritePath(rec.Path, opts.Rewrites), rec.Filename,
+				rec.Size, modifiedAt, rec.LinkType, linkTarget, linkCount)
+			if err != nil {
+				return stats, err
+			}
+			if affected(res) > 0 {
+				stats.Files++
+			} else {
+				stats.FilesSkipped++
+			}
+		default:
+			// 忽略未知记录类型，便于新版本快照向后兼容
+		}
+	}
+
+	return stats, tx.Commit()
+}
+
+func affected(res sql.Result) int {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+type ndjsonReader struct {
+	dec *json.Decoder
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	return &ndjsonReader{dec: json.NewDecoder(bufio.NewReader(r))}
+}
+
+func (n *ndjsonReader) Read() (Record, error) {
+	var rec Record
+	err := n.dec.Decode(&rec)
+	return rec, err
+}
+
+type csvReader struct {
+	r      *csv.Reader
+	header Record
+	// pending CSV 头信息读完后待返回的下一条记录
+	pending *Record
+	started bool
+}
+
+func newCSVReader(r io.Reader) *csvReader {
+	cr := csv.NewReader(bufio.NewReader(r))
+	cr.FieldsPerRecord = len(csvHeader)
+	return &csvReader{r: cr}
+}
+
+func (c *csvReader) Read() (Record, error) {
+	if !c.started {
+		c.started = true
+		if _, err := c.r.Read(); err != nil { // 列名
+			return Record{}, err
+		}
+		// 合并开头的多行头信息
+		c.header = Record{Type: RecordHeader}
+		for {
+			rec, err := c.readRow()
+			if err != nil && err != io.EOF {
+				return Record{}, err
+			}
+			if err == io.EOF || rec.Type != RecordHeader {
+				if err == nil {
+					c.pending = &rec
+				}
+				return c.header, nil
+			}
+			switch rec.Key {
+			case "version":
+				c.header.Version, _ = strconv.Atoi(rec.Value)
+			case "app_version":
+				c.header.AppVersion = rec.Value
+			case "exported_at":
+				if t, err := time.Parse(time.RFC3339, rec.Value); err == nil {
+					c.header.ExportedAt = &t
+				}
+			}
+		}
+	}
+	if c.pending != nil {
+		rec := *c.pending
+		c.pending = nil
+		return rec, nil
+	}
+	return c.readRow()
+}
+
+func (c *csvReader) readRow() (Record, error) {
+	row, err := c.r.Read()
+	if err != nil {
+		return Record{}, err
+	}
+	rec := Record{Type: row[0]}
+	if rec.Type != RecordFile {
+		rec.Key, rec.Value = row[1], row[2]
+		return rec, nil
+	}
+
+	rec.MD5, rec.Path, rec.Filename = row[3], row[4], row[5]
+	if rec.Size, err = strconv.ParseInt(row[6], 10, 64); err != nil {
+		return rec, fmt.Errorf("无效的文件大小 %q", row[6])
+	}
+	modifiedAt, err := time.Parse(time.RFC3339Nano, row[7])
+	if err != nil {
+		return rec, fmt.Errorf("无效的修改时间 %q", row[7])
+	}
+	rec.ModifiedAt = &modifiedAt
+	rec.LinkType, rec.LinkTarget = row[8], row[9]
+	if row[10] != "" {
+		if rec.LinkCount, err = strconv.ParseInt(row[10], 10, 64); err != nil {
+			return rec, fmt.Errorf("无效的链接数 %q", row[10])
+		}
+	}
+	return rec, nil
+}
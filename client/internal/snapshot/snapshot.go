@@ -0,0 +1,147 @@
+// Package snapshot 导出与导入索引快照
+//
+// 快照包含文件索引、监控目录、忽略规则和客户端设置，支持 NDJSON、CSV
+// 两种流式文本格式，以及通过 SQLite 在线备份得到的一致性数据库副本。
+package snapshot
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FormatVersion 快照格式版本
+const FormatVersion = 1
+
+// Format 快照格式
+type Format string
+
+const (
+	FormatNDJSON Format = "ndjson"
+	FormatCSV    Format = "csv"
+	FormatSQLite Format = "sqlite"
+)
+
+// ParseFormat 解析快照格式
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatNDJSON, FormatCSV, FormatSQLite:
+		return f, nil
+	case "jsonl":
+		return FormatNDJSON, nil
+	case "db":
+		return FormatSQLite, nil
+	default:
+		return "", fmt.Errorf("不支持的快照格式: %s", s)
+	}
+}
+
+// FormatFromPath 根据文件扩展名推断快照格式
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".ndjson", ".jsonl", ".json":
+		return FormatNDJSON, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".db", ".sqlite", ".sqlite3":
+		return FormatSQLite, nil
+	default:
+		return "", fmt.Errorf("无法根据扩展名识别快照格式: %s", path)
+	}
+}
+
+// ContentType 返回格式对应的 MIME 类型
+func (f Format) ContentType() string {
+	switch f {
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	default:
+		return "application/vnd.sqlite3"
+	}
+}
+
+// Extension 返回格式对应的文件扩展名
+func (f Format) Extension() string {
+	switch f {
+	case FormatNDJSON:
+		return ".ndjson"
+	case FormatCSV:
+		return ".csv"
+	default:
+		return ".db"
+	}
+}
+
+// 记录类型
+const (
+	RecordHeader        = "header"
+	RecordMonitoredDir  = "monitored_dir"
+	RecordIgnorePattern = "ignore_pattern"
+	RecordSetting       = "setting"
+	RecordFile          = "file"
+)
+
+// Record 快照中的一条记录，NDJSON 每行对应一条
+type Record struct {
+	Type string `json:"type"`
+
+	// header
+	Version    int        `json:"version,omitempty"`
+	AppVersion string     `json:"app_version,omitempty"`
+	ExportedAt *time.Time `json:"exported_at,omitempty"`
+
+	// monitored_dir / ignore_pattern / setting
+	Key   string `json:"key,omitempty"`
+	Value string `json:"value,omitempty"`
+
+	// file
+	MD5        string     `json:"md5,omitempty"`
+	Path       string     `json:"path,omitempty"`
+	Filename   string     `json:"filename,omitempty"`
+	Size       int64      `json:"size,omitempty"`
+	ModifiedAt *time.Time `json:"modified_at,omitempty"`
+	LinkType   string     `json:"link_type,omitempty"`
+	LinkTarget string     `json:"link_target,omitempty"`
+	LinkCount  int64      `json:"link_count,omitempty"`
+}
+
+// PathRewrite 导入时的路径前缀替换规则，例如 /Volumes/NAS → /mnt/nas
+type PathRewrite struct {
+	From string
+	To   string
+}
+
+// ParsePathRewrite 解析 "from=to" 形式的替换规则
+func ParsePathRewrite(s string) (PathRewrite, error) {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok || from == "" {
+		return PathRewrite{}, fmt.Errorf("无效的路径替换规则 %q，应为 from=to", s)
+	}
+	return PathRewrite{From: from, To: to}, nil
+}
+
+// rewritePath 按第一条匹配的规则替换路径前缀，只在路径分隔符边界上匹配
+func rewritePath(path string, rewrites []PathRewrite) string {
+	for _, rw := range rewrites {
+		from := strings.TrimRight(rw.From, `/\`)
+		if path == from {
+			return rw.To
+		}
+		if strings.HasPrefix(path, from) {
+			rest := path[len(from):]
+			if rest[0] == '/' || rest[0] == '\\' {
+				to := strings.TrimRight(rw.To, `/\`)
+				if strings.Contains(to, `\`) && !strings.Contains(to, "/") {
+					rest = strings.ReplaceAll(rest, "/", `\`)
+				} else if strings.Contains(to, "/") {
+					rest = strings.ReplaceAll(rest, `\`, "/")
+				}
+				return to + rest
+			}
+		}
+	}
+	return path
+}
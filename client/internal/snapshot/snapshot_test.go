@@ -0,0 +1,136 @@
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-finder/client/internal/db"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "md5fs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestRewritePath(t *testing.T) {
+	rewrites := []PathRewrite{
+		{From: "/Volumes/NAS/", To: "/mnt/nas"},
+		{From: `D:\Photos`, To: "/srv/photos"},
+		{From: "/home/me", To: `E:\backup`},
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/Volumes/NAS/a/b.txt", "/mnt/nas/a/b.txt"},
+		{"/Volumes/NAS", "/mnt/nas"},
+		// 只在路径分隔符边界上匹配
+		{"/Volumes/NAS2/a.txt", "/Volumes/NAS2/a.txt"},
+		{`D:\Photos\2024\a.jpg`, "/srv/photos/2024/a.jpg"},
+		{"/home/me/docs/a.txt", `E:\backup\docs\a.txt`},
+		{"/other/a.txt", "/other/a.txt"},
+	}
+	for _, tt := range tests {
+		if got := rewritePath(tt.path, rewrites); got != tt.want {
+			t.Errorf("rewritePath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := ParsePathRewrite("/Volumes/NAS"); err == nil {
+		t.Error("缺少 = 的规则应返回错误")
+	}
+	if rw, err := ParsePathRewrite("/a=/b=c"); err != nil || rw.From != "/a" || rw.To != "/b=c" {
+		t.Errorf("ParsePathRewrite = %+v, %v", rw, err)
+	}
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	for _, format := range []Format{FormatNDJSON, FormatCSV} {
+		t.Run(string(format), func(t *testing.T) {
+			src := openDB(t)
+			modified := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+			if _, err := src.Exec(`INSERT INTO files (md5, path, filename, size, modified_at, link_type, link_target, link_count)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				helloMD5, "/Volumes/NAS/docs/a,\"b\".txt", "a,\"b\".txt", 5, modified, "symlink", "/Volumes/NAS/real.txt", 1); err != nil {
+				t.Fatal(err)
+			}
+			db.UpdateMonitoredDir(src, "/Volumes/NAS/docs", "add")
+			if err := db.SetSetting(src, "scan_interval", "30m"); err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+			if err := Export(context.Background(), &buf, src, format, "test"); err != nil {
+				t.Fatal(err)
+			}
+
+			dst := openDB(t)
+			stats, err := Import(context.Background(), bytes.NewReader(buf.Bytes()), dst, format, ImportOptions{
+				Mode:     ImportMerge,
+				Rewrites: []PathRewrite{{From: "/Volumes/NAS", To: "/mnt/nas"}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Files != 1 || stats.MonitoredDirs != 1 || stats.Settings != 1 {
+				t.Errorf("stats = %+v", stats)
+			}
+
+			var path, filename, linkTarget string
+			var size int64
+			if err := dst.QueryRow("SELECT path, filename, size, link_target FROM files WHERE md5 = ?", helloMD5).
+				Scan(&path, &filename, &size, &linkTarget); err != nil {
+				t.Fatal(err)
+			}
+			if path != "/mnt/nas/docs/a,\"b\".txt" || filename != "a,\"b\".txt" || size != 5 || linkTarget != "/mnt/nas/real.txt" {
+				t.Errorf("file = %q %q %d %q", path, filename, size, linkTarget)
+			}
+			dirs, err := db.GetMonitoredDirectories(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dirs) != 1 || dirs[0] != "/mnt/nas/docs" {
+				t.Errorf("dirs = %v", dirs)
+			}
+
+			// 再次以 merge 导入时已存在的记录保持不变
+			stats, err = Import(context.Background(), bytes.NewReader(buf.Bytes()), dst, format, ImportOptions{Mode: ImportMerge})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stats.Files != 0 || stats.FilesSkipped != 1 {
+				t.Errorf("merge stats = %+v", stats)
+			}
+		})
+	}
+}
+
+func TestImportCSVInvalid(t *testing.T) {
+	dst := openDB(t)
+	tests := []string{
+		"type,key\nfile,x\n",
+		strings.Join(csvHeader, ",") + "\nfile,,,not-a-md5,/a.txt,a.txt,1,2024-05-01T12:30:00Z,,,1\n",
+	}
+	for _, body := range tests {
+		if _, err := Import(context.Background(), strings.NewReader(body), dst, FormatCSV, ImportOptions{Mode: ImportMerge}); err == nil {
+			t.Errorf("Import(%q) 应返回错误", body)
+		}
+	}
+	var n int
+	dst.QueryRow("SELECT COUNT(*) FROM files").Scan(&n)
+	if n != 0 {
+		t.Errorf("失败的导入不应留下记录, files = %d", n)
+	}
+}
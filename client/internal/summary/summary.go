@@ -0,0 +1,104 @@
+// Package summary 维护索引的布隆过滤器摘要
+//
+// 摘要在扫描、导入或恢复后重新生成，供 /api/index/summary 提供给网关和
+// 脚本，判断哈希是否可能在本机上。
+package summary
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"smart-finder/shared/bloom"
+)
+
+// Snapshot 一次生成的摘要
+type Snapshot struct {
+	Data    []byte // bloom.Filter 序列化后的数据
+	ETag    string // 带引号的强校验值，由内容计算
+	Count   int
+	BuiltAt time.Time
+}
+
+// Summary 缓存最近一次生成的摘要
+type Summary struct {
+	dbConn *sql.DB
+	fpRate float64
+
+	buildMu sync.Mutex // 同时只生成一次
+	mu      sync.RWMutex
+	current *Snapshot
+}
+
+// New 创建摘要，首次调用 Get 或 Rebuild 时生成
+func New(dbConn *sql.DB) *Summary {
+	return &Summary{dbConn: dbConn, fpRate: bloom.DefaultFalsePositiveRate}
+}
+
+// Get 返回当前摘要，尚未生成时立即生成
+func (s *Summary) Get() (*Snapshot, error) {
+	s.mu.RLock()
+	current := s.current
+	s.mu.RUnlock()
+	if current != nil {
+		return current, nil
+	}
+	return s.Rebuild()
+}
+
+// Rebuild 读取索引中的全部MD5重新生成摘要
+func (s *Summary) Rebuild() (*Snapshot, error) {
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+
+	var n int
+	if err := s.dbConn.QueryRow("SELECT COUNT(*) FROM files").Scan(&n); err != nil {
+		return nil, err
+	}
+	rows, err := s.dbConn.Query("SELECT md5 FROM files")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// 扫描期间文件数可能增加，多出的元素只会略微提高误判率
+	f := bloom.New(n, s.fpRate)
+	for rows.Next() {
+		var md5 string
+		if err := rows.Scan(&md5); err != nil {
+			return nil, err
+		}
+		f.Add(md5)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	data, err := f.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	snap := &Snapshot{
+		Data:    data,
+		ETag:    `"` + hex.EncodeToString(sum[:16]) + `"`,
+		Count:   f.Count(),
+		BuiltAt: time.Now(),
+	}
+	s.mu.Lock()
+	s.current = snap
+	s.mu.Unlock()
+	return snap, nil
+}
+
+// RebuildAsync 在后台重新生成摘要，失败时保留原有摘要
+func (s *Summary) RebuildAsync() {
+	go func() {
+		if _, err := s.Rebuild(); err != nil {
+			log.Printf("生成索引摘要失败: %v", err)
+		}
+	}()
+}
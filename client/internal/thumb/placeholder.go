@@ -0,0 +1,27 @@
+package thumb
+
+import (
+	"fmt"
+	"html"
+	"strings"
+)
+
+// PlaceholderContentType 占位图的类型
+const PlaceholderContentType = "image/svg+xml"
+
+const placeholderSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 64 64">` +
+	`<rect width="64" height="64" fill="#f1f3f5"/>` +
+	`<path d="M18 8h20l10 10v38H18z" fill="#fff" stroke="#adb5bd" stroke-width="2" stroke-linejoin="round"/>` +
+	`<path d="M38 8v10h10" fill="none" stroke="#adb5bd" stroke-width="2" stroke-linejoin="round"/>` +
+	`<text x="33" y="44" font-family="sans-serif" font-size="9" font-weight="bold" fill="#495057" text-anchor="middle">%s</text>` +
+	`</svg>`
+
+// Placeholder 返回不支持的文件使用的占位图：文档图标上标注 label（一般为扩展名），
+// 超过5个字符时截断
+func Placeholder(label string, size int) []byte {
+	label = strings.ToUpper(strings.TrimPrefix(label, "."))
+	if r := []rune(label); len(r) > 5 {
+		label = string(r[:5])
+	}
+	return []byte(fmt.Sprintf(placeholderSVG, size, size, html.EscapeString(label)))
+}
@@ -0,0 +1,93 @@
+package thumb
+
+import (
+	"image"
+	"image/draw"
+)
+
+// fit 返回长边不超过 size 的尺寸，保持宽高比，不放大
+func fit(w, h, size int) (int, int) {
+	if w <= size && h <= size {
+		return w, h
+	}
+	if w >= h {
+		return size, max(1, (h*size+w/2)/w)
+	}
+	return max(1, (w*size+h/2)/h), size
+}
+
+// scale 按面积平均把图片缩小到长边不超过 size
+//
+// 逐行把源图转换为 RGBA 后累加到目标像素，image/draw 对 YCbCr、Paletted
+// 等常见格式有快速路径，内存只需一行源图与目标大小的累加器。
+func scale(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dw, dh := fit(sw, sh, size)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	xmap := make([]int, sw)
+	for x := range xmap {
+		xmap[x] = x * dw / sw
+	}
+	sums := make([]uint64, dw*dh*4)
+	counts := make([]uint64, dw*dh)
+	row := image.NewRGBA(image.Rect(0, 0, sw, 1))
+	for y := 0; y < sh; y++ {
+		draw.Draw(row, row.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+y), draw.Src)
+		base := y * dh / sh * dw
+		for x := 0; x < sw; x++ {
+			i := base + xmap[x]
+			p := row.Pix[x*4 : x*4+4]
+			s := sums[i*4 : i*4+4]
+			s[0] += uint64(p[0])
+			s[1] += uint64(p[1])
+			s[2] += uint64(p[2])
+			s[3] += uint64(p[3])
+			counts[i]++
+		}
+	}
+	// 预乘 alpha 的分量直接平均，透明像素的颜色不会渗入
+	for i, n := range counts {
+		for c := 0; c < 4; c++ {
+			dst.Pix[i*4+c] = uint8((sums[i*4+c] + n/2) / n)
+		}
+	}
+	return dst
+}
+
+// orient 按 EXIF 方向（1-8）把图片转正，方向 5-8 时宽高互换
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		for dx := 0; dx < dw; dx++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // 水平翻转
+				sx, sy = w-1-dx, dy
+			case 3: // 旋转180度
+				sx, sy = w-1-dx, h-1-dy
+			case 4: // 垂直翻转
+				sx, sy = dx, h-1-dy
+			case 5: // 沿主对角线翻转
+				sx, sy = dy, dx
+			case 6: // 顺时针旋转90度
+				sx, sy = dy, h-1-dx
+			case 7: // 沿副对角线翻转
+				sx, sy = w-1-dy, h-1-dx
+			case 8: // 逆时针旋转90度
+				sx, sy = w-1-dy, dx
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,433 @@
+// Package thumb 生成并缓存图片缩略图
+//
+// 用纯 Go 解码 JPEG、PNG 与 GIF（第一帧），按面积平均缩小，JPEG 按 EXIF
+// 方向旋转。缩略图只取决于文件内容，以 <md5>-<边长> 为名缓存在数据目录
+// 下；总大小超过配额时按最近访问时间淘汰。
+package thumb
+
+import (
+	"bytes"
+	"container/list"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif" // 注册GIF解码器
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-finder/client/internal/db"
+	"smart-finder/client/internal/metadata"
+	"smart-finder/shared/types"
+)
+
+const (
+	// DefaultSize 未指定尺寸时的边长，也是索引时预生成的尺寸
+	DefaultSize = 256
+	// DefaultCacheMB 默认的缓存配额
+	DefaultCacheMB = 256
+
+	// maxPixels 像素更多的图片不生成缩略图，避免解码时占用过多内存
+	maxPixels   = 64 << 20
+	jpegQuality = 80
+)
+
+// Sizes 支持的边长，请求的尺寸向上取到其中之一，限制同一文件的缓存数量
+var Sizes = []int{64, 128, 256, 512}
+
+// ErrUnsupported 文件不是支持的图片格式、无法解码或过大，调用方应使用占位图
+var ErrUnsupported = errors.New("不支持生成缩略图的文件")
+
+// Thumbnail 编码后的缩略图
+type Thumbnail struct {
+	Data        []byte
+	ContentType string
+}
+
+// Cache 缩略图的磁盘缓存
+type Cache struct {
+	dbConn *sql.DB
+	dir    string
+
+	mu          sync.Mutex
+	quota       int64 // 字节，0 表示不缓存
+	pregenerate bool
+	used        int64
+	lru         *list.List // 最近访问的在前，元素为 *entry
+	entries     map[string]*list.Element
+	inflight    map[string]*call
+}
+
+type entry struct {
+	key  string // <md5>-<边长>
+	name string // 文件名，扩展名表示格式
+	size int64
+}
+
+// call 正在生成的缩略图，同一缩略图同时只生成一次
+type call struct {
+	done  chan struct{}
+	thumb *Thumbnail
+	err   error
+}
+
+// New 创建缓存，从设置表读取配额并载入 dir 中已有的缩略图
+func New(dbConn *sql.DB, dir string) *Cache {
+	c := &Cache{
+		dbConn:   dbConn,
+		dir:      dir,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		inflight: make(map[string]*call),
+	}
+	if err := c.load(); err != nil {
+		log.Printf("载入缩略图缓存失败: %v", err)
+	}
+	c.Reload()
+	return c
+}
+
+// ParseCacheMB 解析缓存配额，单位 MB
+func ParseCacheMB(s string) (int64, error) {
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的缩略图缓存大小: %s", s)
+	}
+	return n, nil
+}
+
+// ParsePregenerate 解析是否在索引时预生成缩略图
+func ParsePregenerate(s string) (bool, error) {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("无效的缩略图预生成设置: %s", s)
+	}
+	return v, nil
+}
+
+// Reload 重新读取设置，配额变小时立即淘汰
+func (c *Cache) Reload() {
+	quota := int64(DefaultCacheMB)
+	if v := db.GetSetting(c.dbConn, db.SettingThumbCacheMB, ""); v != "" {
+		if n, err := ParseCacheMB(v); err == nil {
+			quota = n
+		}
+	}
+	pregenerate := false
+	if v := db.GetSetting(c.dbConn, db.SettingThumbPregenerate, ""); v != "" {
+		pregenerate, _ = ParsePregenerate(v)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quota = quota << 20
+	c.pregenerate = pregenerate
+	c.evictLocked()
+}
+
+// NormalizeSize 返回不小于 n 的最小支持边长，n 超过最大边长时返回最大边长
+func NormalizeSize(n int) int {
+	for _, s := range Sizes {
+		if s >= n {
+			return s
+		}
+	}
+	return Sizes[len(Sizes)-1]
+}
+
+// Supported 判断该类型的文件能否生成缩略图
+func Supported(mimeType string) bool {
+	switch mimeType {
+	case "image/jpeg", "image/png", "image/gif":
+		return true
+	}
+	return false
+}
+
+// Get 返回 path 处文件的缩略图，hash 为文件的MD5，size 按 NormalizeSize 取整；
+// 不支持的文件返回 ErrUnsupported
+func (c *Cache) Get(hash string, size int, path string) (*Thumbnail, error) {
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("无效的MD5: %s", hash)
+	}
+	size = NormalizeSize(size)
+	key := fmt.Sprintf("%s-%d", strings.ToLower(hash), size)
+	if t := c.lookup(key); t != nil {
+		return t, nil
+	}
+
+	c.mu.Lock()
+	if cl, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		<-cl.done
+		return cl.thumb, cl.err
+	}
+	cl := &call{done: make(chan struct{})}
+	c.inflight[key] = cl
+	c.mu.Unlock()
+
+	cl.thumb, cl.err = generate(path, size)
+	if cl.err == nil {
+		c.store(key, cl.thumb)
+	}
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(cl.done)
+	return cl.thumb, cl.err
+}
+
+// Pregenerate 为索引到的图片生成默认尺寸的缩略图，供 indexer.OnFileIndexed 使用；
+// 未开启预生成或不缓存时不做任何事
+func (c *Cache) Pregenerate(md5sum, path string, m *types.FileMetadata) {
+	if m == nil || !Supported(m.MIME) {
+		return
+	}
+	c.mu.Lock()
+	_, cached := c.entries[fmt.Sprintf("%s-%d", strings.ToLower(md5sum), DefaultSize)]
+	enabled := c.pregenerate && c.quota > 0
+	c.mu.Unlock()
+	if !enabled || cached {
+		return
+	}
+	if _, err := c.Get(md5sum, DefaultSize, path); err != nil && !errors.Is(err, ErrUnsupported) {
+		log.Printf("生成缩略图失败 %s: %v", path, err)
+	}
+}
+
+// lookup 读取已缓存的缩略图并记录访问时间，未缓存时返回 nil
+func (c *Cache) lookup(key string) *Thumbnail {
+	c.mu.Lock()
+	el, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	e := el.Value.(*entry)
+	path := filepath.Join(c.dir, e.name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// 已被淘汰或在外部删除
+		c.mu.Lock()
+		if c.entries[key] == el {
+			c.removeLocked(el)
+		}
+		c.mu.Unlock()
+		return nil
+	}
+	// 修改时间即最近访问时间，重启后按此恢复淘汰顺序
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return &Thumbnail{Data: data, ContentType: contentType(e.name)}
+}
+
+// store 写入缩略图并按配额淘汰
+func (c *Cache) store(key string, t *Thumbnail) {
+	c.mu.Lock()
+	quota := c.quota
+	c.mu.Unlock()
+	if quota <= 0 {
+		return
+	}
+
+	name := key + ".jpg"
+	if t.ContentType == "image/png" {
+		name = key + ".png"
+	}
+	if err := writeFile(c.dir, name, t.Data); err != nil {
+		log.Printf("写入缩略图缓存失败: %v", err)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*entry)
+		c.used -= e.size
+		c.lru.Remove(el)
+	}
+	e := &entry{key: key, name: name, size: int64(len(t.Data))}
+	c.entries[key] = c.lru.PushFront(e)
+	c.used += e.size
+	c.evictLocked()
+}
+
+// evictLocked 从最久未访问的开始删除，直到总大小不超过配额
+func (c *Cache) evictLocked() {
+	for c.used > c.quota && c.lru.Len() > 0 {
+		el := c.lru.Back()
+		if err := os.Remove(filepath.Join(c.dir, el.Value.(*entry).name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("删除缩略图缓存失败: %v", err)
+		}
+		c.removeLocked(el)
+	}
+}
+
+func (c *Cache) removeLocked(el *list.Element) {
+	e := el.Value.(*entry)
+	c.used -= e.size
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+}
+
+// load 载入目录中已有的缩略图，按修改时间恢复访问顺序，并清理写入中断留下的临时文件
+func (c *Cache) load() error {
+	files, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		entry
+		modTime time.Time
+	}
+	var found []cached
+	for _, f := range files {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		if strings.HasSuffix(f.Name(), ".tmp") {
+			os.Remove(filepath.Join(c.dir, f.Name()))
+			continue
+		}
+		key, ok := parseName(f.Name())
+		if !ok {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, cached{entry{key: key, name: f.Name(), size: info.Size()}, info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range found {
+		e := found[i].entry
+		c.entries[e.key] = c.lru.PushFront(&e)
+		c.used += e.size
+	}
+	return nil
+}
+
+// parseName 解析缓存文件名 <md5>-<边长>.<jpg|png>，返回缓存键
+func parseName(name string) (string, bool) {
+	ext := filepath.Ext(name)
+	if ext != ".jpg" && ext != ".png" {
+		return "", false
+	}
+	key := strings.TrimSuffix(name, ext)
+	hash, size, ok := strings.Cut(key, "-")
+	if !ok || len(hash) != 32 {
+		return "", false
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return "", false
+	}
+	if n, err := strconv.Atoi(size); err != nil || NormalizeSize(n) != n {
+		return "", false
+	}
+	return key, true
+}
+
+func contentType(name string) string {
+	if filepath.Ext(name) == ".png" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// writeFile 先写入临时文件再重命名，读取方不会读到写了一半的缩略图
+func writeFile(dir, name string, data []byte) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "thumb-*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(dir, name))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// generate 解码图片并生成长边不超过 size 的缩略图；有透明像素时编码为PNG，否则为JPEG
+func generate(path string, size int) (*Thumbnail, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, format, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	if format != "jpeg" && format != "png" && format != "gif" {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupported, format)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: 图片尺寸 %dx%d", ErrUnsupported, cfg.Width, cfg.Height)
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		orientation = metadata.Orientation(f, info.Size())
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	src, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	img := orient(scale(src, size), orientation)
+
+	var buf bytes.Buffer
+	t := &Thumbnail{ContentType: "image/jpeg"}
+	if img.Opaque() {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		t.ContentType = "image/png"
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.Data = buf.Bytes()
+	return t, nil
+}
@@ -0,0 +1,277 @@
+package thumb
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"smart-finder/client/internal/db"
+)
+
+func openDB(t *testing.T) *sql.DB {
+	t.Helper()
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "md5fs.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// writePNG 写入 w x h 的不透明图片，返回路径
+func writePNG(t *testing.T, dir, name string, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func hashOf(i int) string {
+	return fmt.Sprintf("%032x", i)
+}
+
+// setQuota 以字节为单位设置配额，设置表只能以 MB 为单位
+func setQuota(c *Cache, quota int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.quota = quota
+	c.evictLocked()
+}
+
+func cachedKeys(c *Cache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*entry).key)
+	}
+	return keys
+}
+
+func TestEvictionOrder(t *testing.T) {
+	src := writePNG(t, t.TempDir(), "a.png", 100, 80)
+	one, err := generate(src, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	c := New(openDB(t), dir)
+	setQuota(c, 2*int64(len(one.Data)))
+
+	for _, i := range []int{1, 2, 1, 3} {
+		if _, err := c.Get(hashOf(i), 64, src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 2 最久未访问，写入 3 时被淘汰
+	want := fmt.Sprint([]string{hashOf(3) + "-64", hashOf(1) + "-64"})
+	if got := fmt.Sprint(cachedKeys(c)); got != want {
+		t.Errorf("缓存 = %s, want %s", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, hashOf(2)+"-64.jpg")); !os.IsNotExist(err) {
+		t.Errorf("被淘汰的缩略图应从磁盘删除: %v", err)
+	}
+
+	// 重启后按修改时间恢复访问顺序
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, hashOf(3)+"-64.jpg"), past, past)
+	reloaded := New(openDB(t), dir)
+	want = fmt.Sprint([]string{hashOf(1) + "-64", hashOf(3) + "-64"})
+	if got := fmt.Sprint(cachedKeys(reloaded)); got != want {
+		t.Errorf("重启后缓存 = %s, want %s", got, want)
+	}
+}
+
+func TestByteCap(t *testing.T) {
+	src := writePNG(t, t.TempDir(), "a.png", 100, 80)
+	conn := openDB(t)
+	dir := t.TempDir()
+	c := New(conn, dir)
+
+	var total int64
+	for i := 1; i <= 4; i++ {
+		thumb, err := c.Get(hashOf(i), 64, src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		total += int64(len(thumb.Data))
+	}
+	if c.used != total {
+		t.Fatalf("used = %d, want %d", c.used, total)
+	}
+
+	// 配额变小时立即淘汰到不超过配额
+	setQuota(c, total/2)
+	if c.used > total/2 || len(cachedKeys(c)) != 2 {
+		t.Errorf("used = %d, 缓存 = %v, 配额 %d", c.used, cachedKeys(c), total/2)
+	}
+
+	// 单个缩略图超过配额时返回结果但不缓存
+	thumb, err := c.Get(hashOf(9), 512, writePNG(t, t.TempDir(), "big.png", 600, 400))
+	if err != nil || len(thumb.Data) == 0 {
+		t.Fatalf("Get = %v", err)
+	}
+	if _, ok := c.entries[hashOf(9)+"-512"]; ok || c.used > total/2 {
+		t.Errorf("超过配额的缩略图不应留在缓存中, used = %d", c.used)
+	}
+
+	// 配额为 0 时不缓存，已有的缩略图全部删除
+	if err := db.SetSetting(conn, db.SettingThumbCacheMB, "0"); err != nil {
+		t.Fatal(err)
+	}
+	c.Reload()
+	if _, err := c.Get(hashOf(5), 64, src); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := os.ReadDir(dir)
+	if c.used != 0 || len(files) != 0 {
+		t.Errorf("used = %d, files = %d, 配额为 0 时不应缓存", c.used, len(files))
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	c := New(openDB(t), t.TempDir())
+
+	text := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(text, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	huge := filepath.Join(dir, "huge.png")
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1)))
+	header := buf.Bytes()
+	// 修改 IHDR 中的宽高，不解码像素即可判断尺寸过大
+	copy(header[16:24], []byte{0, 0, 0x40, 0, 0, 0, 0x40, 0})
+	if err := os.WriteFile(huge, header, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{text, huge} {
+		if _, err := c.Get(hashOf(1), 64, path); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Get(%s) = %v, want ErrUnsupported", filepath.Base(path), err)
+		}
+	}
+	if _, err := c.Get("not-a-md5", 64, text); err == nil || errors.Is(err, ErrUnsupported) {
+		t.Errorf("无效的MD5: %v", err)
+	}
+	if len(cachedKeys(c)) != 0 {
+		t.Errorf("失败的请求不应写入缓存: %v", cachedKeys(c))
+	}
+
+	for _, tc := range []struct {
+		mimeType string
+		want     bool
+	}{
+		{"image/jpeg", true},
+		{"image/gif", true},
+		{"image/tiff", false},
+		{"application/pdf", false},
+	} {
+		if got := Supported(tc.mimeType); got != tc.want {
+			t.Errorf("Supported(%s) = %v", tc.mimeType, got)
+		}
+	}
+
+	for _, tc := range []struct {
+		label string
+		want  string
+	}{
+		{".pdf", ">PDF</text>"},
+		{"markdown", ">MARKD</text>"},
+		{"<a>", ">&lt;A&gt;</text>"},
+	} {
+		svg := string(Placeholder(tc.label, 128))
+		if !strings.Contains(svg, tc.want) || !strings.Contains(svg, `width="128" height="128"`) {
+			t.Errorf("Placeholder(%q) = %s", tc.label, svg)
+		}
+	}
+}
+
+func TestConcurrentGet(t *testing.T) {
+	src := writePNG(t, t.TempDir(), "a.png", 100, 80)
+	dir := t.TempDir()
+	c := New(openDB(t), dir)
+
+	// 已有同一缩略图在生成时，其余请求等待并共享其结果
+	key := hashOf(1) + "-64"
+	pending := &call{done: make(chan struct{})}
+	c.mu.Lock()
+	c.inflight[key] = pending
+	c.mu.Unlock()
+
+	const n = 8
+	results := make(chan *Thumbnail, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			thumb, _ := c.Get(hashOf(1), 50, src)
+			results <- thumb
+		}()
+	}
+	select {
+	case <-results:
+		t.Fatal("生成完成前请求不应返回")
+	case <-time.After(50 * time.Millisecond):
+	}
+	pending.thumb = &Thumbnail{Data: []byte("shared"), ContentType: "image/jpeg"}
+	c.mu.Lock()
+	delete(c.inflight, key)
+	c.mu.Unlock()
+	close(pending.done)
+	for i := 0; i < n; i++ {
+		if thumb := <-results; thumb != pending.thumb {
+			t.Errorf("结果 = %+v, 应共享正在生成的缩略图", thumb)
+		}
+	}
+
+	// 没有预置的生成时并发请求也只写入一个缓存文件
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var data [][]byte
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			thumb, err := c.Get(hashOf(2), 64, src)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mu.Lock()
+			data = append(data, thumb.Data)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	for _, d := range data {
+		if !bytes.Equal(d, data[0]) {
+			t.Error("并发请求得到的缩略图不一致")
+		}
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 || len(c.inflight) != 0 {
+		t.Errorf("files = %d, inflight = %d", len(files), len(c.inflight))
+	}
+}
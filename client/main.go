@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"mime"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -19,10 +18,19 @@ import (
 
 	"embed"
 	"io/fs"
+	"smart-finder/client/internal/backup"
 	"smart-finder/client/internal/db"
 	"smart-finder/client/internal/indexer"
+	"smart-finder/client/internal/metrics"
+	"smart-finder/client/internal/registry"
+	"smart-finder/client/internal/summary"
+	"smart-finder/client/internal/thumb"
 	"smart-finder/client/internal/tray"
 	"smart-finder/client/internal/utils"
+	"smart-finder/shared/constants"
+	"smart-finder/shared/types"
+	sharedutils "smart-finder/shared/utils"
+	"smart-finder/shared/walk"
 )
 
 var (
@@ -32,6 +40,18 @@ var (
 	monitoredDirs   = make([]string, 0)
 	monitoredDirsMu sync.RWMutex
 	dbConn          *sql.DB
+
+	backupScheduler *backup.Scheduler
+	// registryPublisher 向网关登记本机，未配置网关地址时不发送请求
+	registryPublisher *registry.Publisher
+	// indexSummary 索引的布隆过滤器摘要，扫描、导入或恢复后重新生成
+	indexSummary *summary.Summary
+	// thumbCache 缩略图缓存，位于数据目录下的 thumbs
+	thumbCache *thumb.Cache
+	// dbProblems 启动时完整性检查发现的问题，非空时暂停扫描和备份，等待恢复或重建
+	dbProblems   []string
+	dbProblemsMu sync.RWMutex
+	servicesOnce sync.Once
 )
 
 // CORS中间件
@@ -40,7 +60,7 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Check-Request")
-		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition")
+		w.Header().Set("Access-Control-Expose-Headers", "Content-Disposition, ETag, X-SmartFinder-Thumbnail")
 
 		// 处理预检请求
 		if r.Method == "OPTIONS" {
@@ -55,42 +75,38 @@ func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
 // 手动触发扫描API
 func scanTriggerHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "只支持POST方法", 405)
+		methodNotAllowed(w, r, "POST")
 		return
 	}
 
 	scheduler := indexer.GetGlobalScheduler()
 	if scheduler == nil {
-		http.Error(w, "扫描器未初始化", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "扫描器未初始化")
 		return
 	}
 
 	scheduler.TriggerManualScan()
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "triggered",
-		"message": "手动扫描已触发",
+	respond(w, r, 200, types.ScanTriggerResponse{
+		Status:  "triggered",
+		Message: "手动扫描已触发",
 	})
 }
 
 // 扫描状态查询API
 func scanStatusHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		http.Error(w, "只支持GET方法", 405)
+		methodNotAllowed(w, r, "GET")
 		return
 	}
 
 	scheduler := indexer.GetGlobalScheduler()
 	if scheduler == nil {
-		http.Error(w, "扫描器未初始化", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "扫描器未初始化")
 		return
 	}
 
-	status := scheduler.GetStatus()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(status)
+	respond(w, r, 200, scheduler.GetStatus())
 }
 
 //go:embed web/*
@@ -113,6 +129,11 @@ func (sfs *spaFileSystem) Open(name string) (http.File, error) {
 }
 
 func main() {
+	// 带子命令运行时作为命令行工具，不启动托盘和HTTP服务；其他参数（如 macOS
+	// 传入的 -psn_*、登录项附加的参数）照常启动
+	if len(os.Args) > 1 && isCLICommand(os.Args[1]) {
+		os.Exit(runCLI(os.Args[1:]))
+	}
 	tray.Run(onReady, onExit)
 }
 
@@ -129,6 +150,12 @@ func onExit() {
 	if indexer.GetGlobalScheduler() != nil {
 		indexer.GetGlobalScheduler().Stop()
 	}
+	if backupScheduler != nil {
+		backupScheduler.Stop()
+	}
+	if registryPublisher != nil {
+		registryPublisher.Stop()
+	}
 }
 
 func getAppDataPath() (string, error) {
@@ -155,129 +182,153 @@ func getAppDataPath() (string, error) {
 	return appDataPath, nil
 }
 
+// openDatabase 打开应用数据目录下的索引数据库
+func openDatabase() (*sql.DB, error) {
+	appDataPath, err := getAppDataPath()
+	if err != nil {
+		return nil, fmt.Errorf("无法获取应用数据目录: %w", err)
+	}
+	return db.InitDB(filepath.Join(appDataPath, "md5fs.db"))
+}
+
+// defaultBackupDir 未配置备份目录时使用的目录
+func defaultBackupDir() string {
+	appDataPath, err := getAppDataPath()
+	if err != nil {
+		return "backups"
+	}
+	return filepath.Join(appDataPath, "backups")
+}
+
+// thumbCacheDir 缩略图缓存目录
+func thumbCacheDir() string {
+	appDataPath, err := getAppDataPath()
+	if err != nil {
+		return "thumbs"
+	}
+	return filepath.Join(appDataPath, "thumbs")
+}
+
+// loadMonitoredDirs 从数据库重新加载监控目录
+func loadMonitoredDirs() error {
+	dirs, err := db.GetMonitoredDirectories(dbConn)
+	if err != nil {
+		return err
+	}
+	monitoredDirsMu.Lock()
+	monitoredDirs = append(make([]string, 0, len(dirs)), dirs...)
+	monitoredDirsMu.Unlock()
+	return nil
+}
+
 // 批量根据MD5删除文件并移至回收站API
 func batchDeleteFilesByMD5Handler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "只支持POST方法", 405)
+		methodNotAllowed(w, r, "POST")
 		return
 	}
 
-	var requestBody struct {
-		MD5s []string `json:"md5s"`
-	}
-
+	var requestBody types.DeleteRequest
 	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
-		http.Error(w, "参数错误，无效的JSON格式", 400)
+		fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，无效的JSON格式")
 		return
 	}
 
 	if len(requestBody.MD5s) == 0 {
-		http.Error(w, "参数错误，MD5数组不能为空", 400)
+		fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，MD5数组不能为空")
 		return
 	}
 
 	// 验证所有MD5格式是否正确
 	for _, md5 := range requestBody.MD5s {
 		if len(md5) != 32 {
-			http.Error(w, fmt.Sprintf("参数错误，无效的MD5格式: %s", md5), 400)
+			fail(w, r, 400, types.ErrCodeInvalidHash, fmt.Sprintf("参数错误，无效的MD5格式: %s", md5))
 			return
 		}
 	}
 
 	// 处理每个MD5
-	results := make([]map[string]interface{}, 0)
+	results := make([]types.DeleteResult, 0, len(requestBody.MD5s))
 	for _, md5 := range requestBody.MD5s {
-		result := map[string]interface{}{
-			"md5": md5,
-		}
+		results = append(results, deleteFileByMD5(md5))
+	}
 
-		// 从数据库查询文件路径
-		var filePath, fileName string
-		err := dbConn.QueryRow("SELECT path, filename FROM files WHERE md5 = ?", md5).Scan(&filePath, &fileName)
-		if err == sql.ErrNoRows {
-			result["status"] = "failed"
-			result["message"] = "未找到对应文件"
-			results = append(results, result)
-			continue
-		} else if err != nil {
-			result["status"] = "failed"
-			result["message"] = "数据库查询错误"
-			results = append(results, result)
-			continue
-		}
+	respond(w, r, 200, types.DeleteResponse{
+		Total:   len(requestBody.MD5s),
+		Results: results,
+	})
+}
 
-		// 检查文件是否存在
-		if _, err := os.Stat(filePath); os.IsNotExist(err) {
-			// 文件不存在，但仍从数据库中删除记录
-			_, dbErr := dbConn.Exec("DELETE FROM files WHERE md5 = ?", md5)
-			if dbErr != nil {
-				result["status"] = "failed"
-				result["message"] = "文件不存在且数据库删除失败"
-				results = append(results, result)
-				continue
-			}
-			result["status"] = "warning"
-			result["message"] = "文件不存在但已从数据库中删除记录"
-			results = append(results, result)
-			continue
-		}
+// deleteFileByMD5 把文件移到所在目录的回收站并删除索引记录
+func deleteFileByMD5(md5 string) types.DeleteResult {
+	result := types.DeleteResult{MD5: md5}
+	done := func(status, message string) types.DeleteResult {
+		result.Status, result.Message = status, message
+		return result
+	}
 
-		// 在文件所在目录创建回收站
-		fileDir := filepath.Dir(filePath)
-		recycleBinPath := filepath.Join(fileDir, "回收站")
-		if err := os.MkdirAll(recycleBinPath, 0755); err != nil {
-			result["status"] = "failed"
-			result["message"] = "创建回收站目录失败"
-			results = append(results, result)
-			continue
-		}
+	// 从数据库查询文件路径
+	var filePath, fileName string
+	err := dbConn.QueryRow("SELECT path, filename FROM files WHERE md5 = ?", md5).Scan(&filePath, &fileName)
+	if err == sql.ErrNoRows {
+		return done(types.DeleteFailed, "未找到对应文件")
+	} else if err != nil {
+		return done(types.DeleteFailed, "数据库查询错误")
+	}
 
-		// 生成目标路径（在回收站中）
-		timestamp := time.Now().UnixNano() / int64(time.Millisecond)
-		targetFileName := fmt.Sprintf("%s_%d_%s", strings.TrimSuffix(fileName, filepath.Ext(fileName)), timestamp, filepath.Ext(fileName))
-		targetPath := filepath.Join(recycleBinPath, targetFileName)
-
-		// 移动文件到回收站
-		if err := os.Rename(filePath, targetPath); err != nil {
-			result["status"] = "failed"
-			result["message"] = fmt.Sprintf("移动文件到回收站失败: %v", err)
-			results = append(results, result)
-			continue
+	// 检查文件是否存在
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		// 文件不存在，但仍从数据库中删除记录
+		if _, err := dbConn.Exec("DELETE FROM files WHERE md5 = ?", md5); err != nil {
+			return done(types.DeleteFailed, "文件不存在且数据库删除失败")
 		}
+		return done(types.DeleteWarning, "文件不存在但已从数据库中删除记录")
+	}
 
-		// 从数据库中删除记录
-		_, err = dbConn.Exec("DELETE FROM files WHERE md5 = ?", md5)
-		if err != nil {
-			result["status"] = "partial_success"
-			result["message"] = "文件已移动到回收站，但数据库记录删除失败"
-			results = append(results, result)
-			continue
-		}
+	// 在文件所在目录创建回收站
+	fileDir := filepath.Dir(filePath)
+	recycleBinPath := filepath.Join(fileDir, "回收站")
+	if err := os.MkdirAll(recycleBinPath, 0755); err != nil {
+		return done(types.DeleteFailed, "创建回收站目录失败")
+	}
+
+	// 生成目标路径（在回收站中）
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	targetFileName := fmt.Sprintf("%s_%d_%s", strings.TrimSuffix(fileName, filepath.Ext(fileName)), timestamp, filepath.Ext(fileName))
+	targetPath := filepath.Join(recycleBinPath, targetFileName)
 
-		result["status"] = "success"
-		result["message"] = "文件已成功删除并移至回收站"
-		result["originalPath"] = filePath
-		result["recyclePath"] = targetPath
-		results = append(results, result)
+	// 移动文件到回收站
+	if err := os.Rename(filePath, targetPath); err != nil {
+		return done(types.DeleteFailed, fmt.Sprintf("移动文件到回收站失败: %v", err))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"total":   len(requestBody.MD5s),
-		"results": results,
-	})
+	// 从数据库中删除记录
+	if _, err := dbConn.Exec("DELETE FROM files WHERE md5 = ?", md5); err != nil {
+		return done(types.DeletePartialSuccess, "文件已移动到回收站，但数据库记录删除失败")
+	}
+
+	result.OriginalPath, result.RecyclePath = filePath, targetPath
+	return done(types.DeleteSuccess, "文件已成功删除并移至回收站")
 }
 
 func runApp() {
-	appDataPath, err := getAppDataPath()
+	var err error
+	dbConn, err = openDatabase()
 	if err != nil {
-		log.Fatalf("无法获取应用数据目录: %v", err)
+		log.Fatal("数据库初始化失败，可使用 restore 从最新的备份恢复（restore --name <备份名> 指定备份）或 rebuild 重建索引: ", err)
 	}
-	dbPath := filepath.Join(appDataPath, "md5fs.db")
+	backupScheduler = backup.NewScheduler(dbConn, defaultBackupDir())
+	registryPublisher = registry.NewPublisher(dbConn, Version)
 
-	dbConn, err = db.InitDB(dbPath)
+	// 完整性检查
+	problems, err := db.CheckIntegrity(dbConn)
 	if err != nil {
-		log.Fatal("数据库初始化失败:", err)
+		problems = []string{err.Error()}
+	}
+	setDBProblems(problems)
+	if len(problems) > 0 {
+		log.Printf("数据库完整性检查失败，请通过 /api/backups/restore 从备份恢复或 /api/backups/rebuild 重新扫描: %s",
+			strings.Join(problems, "; "))
 	}
 
 	// Start status updater
@@ -285,6 +336,10 @@ func runApp() {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 		for range ticker.C {
+			if len(getDBProblems()) > 0 {
+				tray.UpdateStatus("Database damaged, restore or rebuild required")
+				continue
+			}
 			var count int
 			dbConn.QueryRow("SELECT COUNT(*) FROM files").Scan(&count)
 			status := fmt.Sprintf("Indexed: %d files", count)
@@ -296,48 +351,32 @@ func runApp() {
 	}()
 
 	// 从数据库加载监控目录
-	rows, err := dbConn.Query("SELECT path FROM monitored_directories")
-	if err != nil {
+	if err := loadMonitoredDirs(); err != nil {
 		log.Fatal("加载监控目录失败:", err)
 	}
-	defer rows.Close()
-	for rows.Next() {
-		var path string
-		if err := rows.Scan(&path); err == nil {
-			monitoredDirsMu.Lock()
-			monitoredDirs = append(monitoredDirs, path)
-			monitoredDirsMu.Unlock()
-		}
-	}
 
 	// 初始化定时扫描器 (每30分钟扫描一次)
 	indexer.InitGlobalScheduler(dbConn, 30*time.Minute)
+	indexSummary = summary.New(dbConn)
+	indexer.GetGlobalScheduler().OnScanComplete(indexSummary.RebuildAsync)
+	thumbCache = thumb.New(dbConn, thumbCacheDir())
+	indexer.OnFileIndexed(thumbCache.Pregenerate)
 
-	// 启动定时扫描器
-	go indexer.GetGlobalScheduler().Start()
+	// 数据库完好时启动定时扫描和备份，否则等待恢复或重建后再启动
+	if len(problems) == 0 {
+		startBackgroundServices()
+	}
 
 	// 静态文件服务（使用 embed.FS）
 	webRoot, _ := fs.Sub(webFS, "web")
 	http.Handle("/", http.FileServer(&spaFileSystem{root: http.FS(webRoot)}))
 
-	// API 路由
-	http.HandleFunc("/api/directories", directoriesHandler)
-	http.HandleFunc("/api/status", statusHandler)
-	http.HandleFunc("/api/health", corsMiddleware(healthHandler))
-	http.HandleFunc("/api/path2url", path2urlHandler)
-	http.HandleFunc("/api/files", filesHandler)
-	http.HandleFunc("/api/md5", corsMiddleware(apiMD5FileHandler))
-	http.HandleFunc("/api/ignore-patterns", ignorePatternsHandler)
+	// API 路由，见 api.go
+	registerAPIRoutes()
 
-	// 扫描相关API
-	http.HandleFunc("/api/scan/trigger", corsMiddleware(scanTriggerHandler))
-	http.HandleFunc("/api/scan/status", corsMiddleware(scanStatusHandler))
-
-	// md5 文件定位路由
-	http.HandleFunc("/api/locate/md5", corsMiddleware(md5Handler))
-
-	// 新增：批量根据MD5删除文件并移至回收站API
-	http.HandleFunc("/api/files/delete", corsMiddleware(batchDeleteFilesByMD5Handler))
+	// Prometheus 指标
+	http.Handle("/metrics", metrics.Handler(metrics.NewCollector(
+		func() *sql.DB { return dbConn }, indexer.GetGlobalScheduler)))
 
 	port := 8964
 	log.Printf("服务启动: http://127.0.0.1:%d\n", port)
@@ -351,24 +390,28 @@ func md5Handler(w http.ResponseWriter, r *http.Request) {
 	// 期望路径格式 /md5?hash=xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx
 	hash := r.URL.Query().Get("hash")
 	if len(hash) != 32 {
-		http.Error(w, "参数错误，缺少或错误的md5", 400)
+		fail(w, r, 400, types.ErrCodeInvalidHash, "参数错误，缺少或错误的md5")
 		return
 	}
 
 	var filePath string
 	err := dbConn.QueryRow("SELECT path FROM files WHERE md5 = ?", hash).Scan(&filePath)
 	if err == sql.ErrNoRows {
-		http.NotFound(w, r)
+		fail(w, r, 404, types.ErrCodeNotFound, "未找到该md5对应的文件")
 		return
 	} else if err != nil {
-		http.Error(w, "数据库错误", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
 		return
 	}
 
 	// 正常处理：在文件管理器中定位文件
 	err = utils.RevealInExplorer(filePath)
 	if err != nil {
-		http.Error(w, "打开文件失败", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "打开文件失败")
+		return
+	}
+	if isV1(r) {
+		respond(w, r, 204, nil)
 		return
 	}
 	w.Write([]byte("已在文件管理器中定位文件"))
@@ -378,7 +421,7 @@ func md5Handler(w http.ResponseWriter, r *http.Request) {
 func apiMD5FileHandler(w http.ResponseWriter, r *http.Request) {
 	hash := r.URL.Query().Get("hash")
 	if len(hash) != 32 {
-		http.Error(w, "参数错误，缺少或错误的md5", 400)
+		fail(w, r, 400, types.ErrCodeInvalidHash, "参数错误，缺少或错误的md5")
 		return
 	}
 
@@ -388,28 +431,28 @@ func apiMD5FileHandler(w http.ResponseWriter, r *http.Request) {
 	var filePath, fileName string
 	err := dbConn.QueryRow("SELECT path, filename FROM files WHERE md5 = ?", hash).Scan(&filePath, &fileName)
 	if err == sql.ErrNoRows {
-		if isCheckRequest {
+		if isCheckRequest && !isV1(r) {
 			// 如果是检查请求，返回404状态但不显示错误页面
 			w.WriteHeader(http.StatusNotFound)
 			return
 		}
-		http.NotFound(w, r)
+		fail(w, r, 404, types.ErrCodeNotFound, "未找到该md5对应的文件")
 		return
 	} else if err != nil {
-		http.Error(w, "数据库错误", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
 		return
 	}
 
 	f, err := os.Open(filePath)
 	if err != nil {
-		http.Error(w, "文件无法打开", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "文件无法打开")
 		return
 	}
 	defer f.Close()
 
 	fi, err := f.Stat()
 	if err != nil {
-		http.Error(w, "文件信息获取失败", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "文件信息获取失败")
 		return
 	}
 
@@ -419,40 +462,94 @@ func apiMD5FileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 自动推断Content-Type
-	ext := filepath.Ext(fileName)
-	var contentType string
-	if ext == ".md" || ext == ".markdown" {
-		contentType = "text/markdown; charset=utf-8"
-	} else {
-		contentType = mime.TypeByExtension(ext)
-		if contentType == "" {
-			// 读一部分内容推断
-			buf := make([]byte, 512)
-			n, _ := f.Read(buf)
-			contentType = http.DetectContentType(buf[:n])
-			f.Seek(0, io.SeekStart)
-		}
-	}
-	w.Header().Set("Content-Type", contentType)
-	w.Header().Set("Content-Disposition", "inline; filename=\""+fileName+"\"")
+	w.Header().Set("Content-Type", fileContentType(hash, fileName, f))
+	w.Header().Set("Content-Disposition", sharedutils.ContentDisposition(sharedutils.DispositionInline, fileName))
 	w.Header().Set("Content-Length", strconv.FormatInt(fi.Size(), 10))
 
 	// 支持Range请求（视频/大文件友好）
 	http.ServeContent(w, r, fileName, fi.ModTime(), f)
 }
 
+// fileContentType 优先使用索引时按内容识别的类型，文本类型和尚未提取元数据的
+// 文件按扩展名或文件头推断，以便带上 charset
+func fileContentType(hash, fileName string, f io.ReadSeeker) string {
+	if m, err := db.GetMetadata(dbConn, hash); err == nil && m != nil &&
+		m.MIME != "" && m.MIME != "application/octet-stream" && !strings.HasPrefix(m.MIME, "text/") {
+		return m.MIME
+	}
+	return sharedutils.DetectContentType(fileName, f)
+}
+
+// 批量解析哈希API：一次查询返回每个哈希的状态和本地文件信息，
+// 代替逐个发送 X-Check-Request 探测请求
+func resolveHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+
+	var requestBody types.ResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，无效的JSON格式")
+		return
+	}
+	if len(requestBody.Hashes) == 0 {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，hashes 不能为空")
+		return
+	}
+	if len(requestBody.Hashes) > db.MaxResolveBatch {
+		fail(w, r, http.StatusRequestEntityTooLarge, types.ErrCodeTooLarge, fmt.Sprintf("单次最多解析 %d 个哈希", db.MaxResolveBatch))
+		return
+	}
+
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, hash := range requestBody.Hashes {
+		hash = strings.ToLower(hash)
+		if sharedutils.ValidateMD5(hash) && !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	found, err := db.ResolveHashes(dbConn, hashes)
+	if err != nil {
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
+		return
+	}
+
+	resp := types.ResolveResponse[types.FileInfo]{
+		Results: make([]types.ResolveItem[types.FileInfo], 0, len(requestBody.Hashes)),
+	}
+	for _, hash := range requestBody.Hashes {
+		item := types.ResolveItem[types.FileInfo]{Hash: hash}
+		if !sharedutils.ValidateMD5(hash) {
+			item.Status = types.ResolveInvalid
+			item.Error = "无效的MD5哈希格式"
+		} else if f, ok := found[strings.ToLower(hash)]; ok {
+			item.Status = types.ResolveFound
+			item.Locations = []types.FileInfo{f}
+			resp.Found++
+		} else {
+			item.Status = types.ResolveNotFound
+			resp.NotFound++
+		}
+		resp.Results = append(resp.Results, item)
+	}
+
+	respond(w, r, 200, resp)
+}
+
 // 监控目录API
 func directoriesHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case "GET":
 		monitoredDirsMu.RLock()
 		defer monitoredDirsMu.RUnlock()
-		json.NewEncoder(w).Encode(monitoredDirs)
+		respond(w, r, 200, monitoredDirs)
 	case "POST":
-		var req struct{ Path string }
+		var req types.DirectoryRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
-			http.Error(w, "参数错误", 400)
+			fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误")
 			return
 		}
 		monitoredDirsMu.Lock()
@@ -463,12 +560,15 @@ func directoriesHandler(w http.ResponseWriter, r *http.Request) {
 		db.UpdateMonitoredDir(dbConn, req.Path, "add")
 
 		// 触发立即扫描新目录
-		go indexer.Scanner(dbConn, req.Path)
-		w.WriteHeader(201)
+		go func() {
+			indexer.Scanner(dbConn, req.Path)
+			indexSummary.RebuildAsync()
+		}()
+		respond(w, r, 201, req)
 	case "DELETE":
-		var req struct{ Path string }
+		var req types.DirectoryRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
-			http.Error(w, "参数错误", 400)
+			fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误")
 			return
 		}
 		monitoredDirsMu.Lock()
@@ -484,7 +584,7 @@ func directoriesHandler(w http.ResponseWriter, r *http.Request) {
 		db.UpdateMonitoredDir(dbConn, req.Path, "remove")
 		w.WriteHeader(204)
 	default:
-		http.Error(w, "不支持的方法", 405)
+		methodNotAllowed(w, r, "GET", "POST", "DELETE")
 	}
 }
 
@@ -492,48 +592,45 @@ func directoriesHandler(w http.ResponseWriter, r *http.Request) {
 func statusHandler(w http.ResponseWriter, r *http.Request) {
 	var count int
 	dbConn.QueryRow("SELECT COUNT(*) FROM files").Scan(&count)
-	status := map[string]interface{}{
-		"indexing":      indexer.Indexing,
-		"fileCount":     count,
-		"indexingTotal": indexer.IndexingTotal,
-		"indexingDone":  indexer.IndexingDone,
-	}
-	json.NewEncoder(w).Encode(status)
+	respond(w, r, 200, types.ClientStatus{
+		Indexing:      indexer.Indexing,
+		FileCount:     count,
+		IndexingTotal: int64(indexer.IndexingTotal),
+		IndexingDone:  int64(indexer.IndexingDone),
+	})
 }
 
 // 健康检查API
 func healthHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	health := map[string]interface{}{
-		"status":    "ok",
-		"timestamp": time.Now().Unix(),
-		"version":   "1.0.0",
-	}
-	json.NewEncoder(w).Encode(health)
+	respond(w, r, 200, types.HealthStatus{
+		Status:    "ok",
+		Timestamp: time.Now().Unix(),
+		Version:   constants.Version,
+	})
 }
 
 // 路径转url API
 func path2urlHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "只支持POST", 405)
+		methodNotAllowed(w, r, "POST")
 		return
 	}
 	var req struct{ Path string }
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Path == "" {
-		http.Error(w, "参数错误", 400)
+		fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误")
 		return
 	}
 	var md5 string
 	err := dbConn.QueryRow("SELECT md5 FROM files WHERE path = ?", req.Path).Scan(&md5)
 	if err == sql.ErrNoRows {
-		http.Error(w, "路径未被索引", 404)
+		fail(w, r, 404, types.ErrCodeNotFound, "路径未被索引")
 		return
 	} else if err != nil {
-		http.Error(w, "数据库错误", 500)
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
 		return
 	}
-	url := "/md5?hash=" + md5
-	json.NewEncoder(w).Encode(map[string]string{
+	url := apiV1Prefix + "/locate/md5?hash=" + md5
+	respond(w, r, 200, map[string]string{
 		"md5": md5,
 		"url": url,
 	})
@@ -544,95 +641,173 @@ func ignorePatternsHandler(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		patterns, err := db.GetIgnoredPatterns(dbConn)
 		if err != nil {
-			http.Error(w, "Failed to get ignored patterns", 500)
+			fail(w, r, 500, types.ErrCodeInternal, "读取忽略规则失败")
 			return
 		}
-		w.Header().Set("Content-Type", "text/plain")
-		json.NewEncoder(w).Encode(patterns)
+		respond(w, r, 200, patterns)
 	case "POST":
 		body, err := io.ReadAll(r.Body)
 		if err != nil {
-			http.Error(w, "Failed to read request body", 400)
+			fail(w, r, 400, types.ErrCodeInvalidRequest, "读取请求体失败")
 			return
 		}
 		if err := db.UpdateIgnoredPatterns(dbConn, string(body)); err != nil {
-			http.Error(w, "Failed to update ignored patterns", 500)
+			fail(w, r, 500, types.ErrCodeInternal, "保存忽略规则失败")
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		respond(w, r, 204, nil)
 	default:
-		http.Error(w, "Unsupported method", 405)
+		methodNotAllowed(w, r, "GET", "POST")
 	}
 }
 
-// 获取所有已索引文件，支持分页
+// 获取已索引文件，支持按大小、修改时间、扩展名/MIME、监控目录、路径前缀和哈希前缀过滤，
+// 按任意字段排序，以及偏移分页（page）或游标分页（cursor）
 func filesHandler(w http.ResponseWriter, r *http.Request) {
-	// 解析分页参数
-	pageStr := r.URL.Query().Get("page")
-	pageSizeStr := r.URL.Query().Get("pageSize")
-	search := r.URL.Query().Get("search")
-	page := 1
-	pageSize := 20
-	var err error
-	if pageStr != "" {
-		page, err = strconv.Atoi(pageStr)
-		if err != nil || page < 1 {
-			page = 1
+	q, err := db.ParseFileQuery(r.URL.Query())
+	if err != nil {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if q.Root != "" && !isMonitoredDir(q.Root) {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，root 不是监控目录")
+		return
+	}
+
+	result, err := db.QueryFiles(dbConn, q)
+	if err != nil {
+		if q.Cursor != "" {
+			fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+			return
 		}
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
+		return
 	}
-	if pageSizeStr != "" {
-		pageSize, err = strconv.Atoi(pageSizeStr)
-		if err != nil || pageSize < 1 {
-			pageSize = 20
+	respond(w, r, 200, result)
+}
+
+// isMonitoredDir 判断路径是否为监控目录
+func isMonitoredDir(path string) bool {
+	monitoredDirsMu.RLock()
+	defer monitoredDirsMu.RUnlock()
+	for _, dir := range monitoredDirs {
+		if filepath.Clean(dir) == filepath.Clean(path) {
+			return true
 		}
 	}
-	offset := (page - 1) * pageSize
+	return false
+}
 
-	// 构造SQL和参数
-	var (
-		where string
-		args  []interface{}
-	)
-	if search != "" {
-		where = "WHERE filename LIKE ? OR path LIKE ?"
-		like := "%" + search + "%"
-		args = append(args, like, like)
+// 客户端设置API
+func settingsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		settings, err := db.GetSettings(dbConn)
+		if err != nil {
+			fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
+			return
+		}
+		if _, ok := settings[db.SettingSymlinkPolicy]; !ok {
+			settings[db.SettingSymlinkPolicy] = string(walk.DefaultSymlinkPolicy)
+		}
+		respond(w, r, 200, settings)
+	case "POST":
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			fail(w, r, 400, types.ErrCodeInvalidRequest, "参数错误，无效的JSON格式")
+			return
+		}
+		for key, value := range req {
+			switch key {
+			case db.SettingSymlinkPolicy:
+				if _, err := walk.ParseSymlinkPolicy(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingBackupDir:
+				if !filepath.IsAbs(value) {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, "备份目录必须是绝对路径")
+					return
+				}
+			case db.SettingBackupInterval:
+				if _, err := backup.ParseInterval(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingBackupKeep:
+				if _, err := backup.ParseKeep(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingRegistryURL:
+				if err := registry.ParseURL(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingRegistryPaths:
+				if err := registry.ParsePaths(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingRegistryRoots:
+				for _, root := range registry.SplitRoots(value) {
+					if !isMonitoredDir(root) {
+						fail(w, r, 400, types.ErrCodeInvalidRequest, fmt.Sprintf("发布的目录不是监控目录: %s", root))
+						return
+					}
+				}
+			case db.SettingThumbCacheMB:
+				if _, err := thumb.ParseCacheMB(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingThumbPregenerate:
+				if _, err := thumb.ParsePregenerate(value); err != nil {
+					fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+					return
+				}
+			case db.SettingRegistryToken, db.SettingRegistryName:
+			default:
+				fail(w, r, 400, types.ErrCodeInvalidRequest, fmt.Sprintf("未知的设置项: %s", key))
+				return
+			}
+		}
+		for key, value := range req {
+			if err := db.SetSetting(dbConn, key, value); err != nil {
+				fail(w, r, 500, types.ErrCodeInternal, "保存设置失败")
+				return
+			}
+		}
+		if backupScheduler != nil {
+			backupScheduler.Reload()
+		}
+		if registryPublisher != nil {
+			registryPublisher.Reload()
+		}
+		if thumbCache != nil {
+			thumbCache.Reload()
+		}
+		respond(w, r, 204, nil)
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
 	}
+}
 
-	// 查询总数
-	totalSql := "SELECT COUNT(*) FROM files " + where
-	var total int
-	err = dbConn.QueryRow(totalSql, args...).Scan(&total)
-	if err != nil {
-		http.Error(w, "数据库错误", 500)
+// 硬链接分组报告：同一inode只占用一份磁盘空间，重复统计时不应计为浪费
+func hardlinksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
 		return
 	}
 
-	// 查询分页数据
-	dataSql := "SELECT md5, path, filename, size, modified_at FROM files " + where + " ORDER BY modified_at DESC LIMIT ? OFFSET ?"
-	args = append(args, pageSize, offset)
-	rows, err := dbConn.Query(dataSql, args...)
+	groups, sharedBytes, err := db.GetHardlinkGroups(dbConn)
 	if err != nil {
-		http.Error(w, "数据库错误", 500)
-		return
-	}
-	defer rows.Close()
-	type FileInfo struct {
-		MD5        string `json:"md5"`
-		Path       string `json:"path"`
-		Filename   string `json:"filename"`
-		Size       int64  `json:"size"`
-		ModifiedAt string `json:"modified_at"`
-	}
-	var files []FileInfo
-	for rows.Next() {
-		var f FileInfo
-		if err := rows.Scan(&f.MD5, &f.Path, &f.Filename, &f.Size, &f.ModifiedAt); err == nil {
-			files = append(files, f)
-		}
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
+		return
 	}
-	json.NewEncoder(w).Encode(map[string]interface{}{
-		"files": files,
-		"total": total,
+	respond(w, r, 200, map[string]interface{}{
+		"groups": groups,
+		// 硬链接不额外占用空间，这部分大小不应计入重复文件的浪费空间
+		"sharedBytes": sharedBytes,
 	})
 }
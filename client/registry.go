@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"smart-finder/shared/types"
+)
+
+// 向网关登记的状态与立即发布API
+//
+// GET 返回登记配置与最近一次发布的结果；POST 立即发送心跳，索引有变化时
+// 重新发布。登记配置通过 /api/settings 的 registry_* 设置项修改。
+func registryHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+	case "POST":
+		if len(getDBProblems()) > 0 {
+			fail(w, r, 409, types.ErrCodeDatabaseDamaged, "数据库已损坏，不能发布索引")
+			return
+		}
+		if err := registryPublisher.RunNow(r.Context()); err != nil {
+			fail(w, r, 502, types.ErrCodeUpstream, fmt.Sprintf("发布失败: %v", err))
+			return
+		}
+	default:
+		methodNotAllowed(w, r, "GET", "POST")
+		return
+	}
+	respond(w, r, 200, registryPublisher.Status())
+}
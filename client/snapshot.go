@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"smart-finder/client/internal/snapshot"
+	"smart-finder/shared/types"
+)
+
+// 导出索引快照API
+// GET /api/export?format=ndjson|csv|sqlite
+func exportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+
+	formatStr := r.URL.Query().Get("format")
+	if formatStr == "" {
+		formatStr = string(snapshot.FormatNDJSON)
+	}
+	format, err := snapshot.ParseFormat(formatStr)
+	if err != nil {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	fileName := "smart-finder-" + time.Now().Format("20060102-150405") + format.Extension()
+	w.Header().Set("Content-Type", format.ContentType())
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+fileName+"\"")
+
+	if format == snapshot.FormatSQLite {
+		err = snapshot.ExportSQLite(r.Context(), w, dbConn)
+	} else {
+		err = snapshot.Export(r.Context(), w, dbConn, format, Version)
+	}
+	if err != nil {
+		// 响应头已发出，只能记录日志
+		log.Printf("导出索引失败: %v", err)
+	}
+}
+
+// 导入索引快照API
+// POST /api/import?format=ndjson|csv|sqlite&mode=merge|replace&rewrite=/Volumes/NAS=/mnt/nas
+//
+// 导入会修改甚至清空索引，拒绝其他网页发起的请求；请求体必须声明为快照格式
+// 的类型，浏览器跨域发送这类请求前需要预检，而本接口不允许跨域。
+func importHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		methodNotAllowed(w, r, "POST")
+		return
+	}
+	if !sameOrigin(r) {
+		fail(w, r, 403, types.ErrCodeForbidden, "不允许其他网页发起该请求")
+		return
+	}
+
+	query := r.URL.Query()
+	format, err := snapshot.ParseFormat(query.Get("format"))
+	if err != nil {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if !importContentType(r.Header.Get("Content-Type"), format) {
+		fail(w, r, 415, types.ErrCodeInvalidRequest,
+			fmt.Sprintf("Content-Type 必须为 %s 或 application/octet-stream", format.ContentType()))
+		return
+	}
+	mode, err := snapshot.ParseImportMode(query.Get("mode"))
+	if err != nil {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	opts := snapshot.ImportOptions{Mode: mode}
+	for _, s := range query["rewrite"] {
+		rw, err := snapshot.ParsePathRewrite(s)
+		if err != nil {
+			fail(w, r, 400, types.ErrCodeInvalidRequest, err.Error())
+			return
+		}
+		opts.Rewrites = append(opts.Rewrites, rw)
+	}
+
+	var stats snapshot.ImportStats
+	if format == snapshot.FormatSQLite {
+		stats, err = importSQLiteBody(r, opts)
+	} else {
+		stats, err = snapshot.Import(r.Context(), r.Body, dbConn, format, opts)
+	}
+	if err != nil {
+		fail(w, r, 400, types.ErrCodeInvalidRequest, fmt.Sprintf("导入失败: %v", err))
+		return
+	}
+
+	if err := loadMonitoredDirs(); err != nil {
+		log.Printf("重新加载监控目录失败: %v", err)
+	}
+
+	indexSummary.RebuildAsync()
+	respond(w, r, 200, stats)
+}
+
+// importContentType 判断请求体类型是否为快照格式的类型或 application/octet-stream
+func importContentType(contentType string, format snapshot.Format) bool {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	want, _, _ := mime.ParseMediaType(format.ContentType())
+	return typ == want || typ == "application/octet-stream"
+}
+
+// importSQLiteBody 将上传的SQLite快照保存为临时文件后导入
+func importSQLiteBody(r *http.Request, opts snapshot.ImportOptions) (snapshot.ImportStats, error) {
+	tmp, err := os.CreateTemp("", "smart-finder-upload-*.db")
+	if err != nil {
+		return snapshot.ImportStats{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, r.Body)
+	tmp.Close()
+	if err != nil {
+		return snapshot.ImportStats{}, err
+	}
+	return snapshot.ImportSQLite(r.Context(), tmp.Name(), dbConn, opts)
+}
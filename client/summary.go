@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+
+	"smart-finder/shared/bloom"
+	"smart-finder/shared/types"
+)
+
+// 索引摘要API
+//
+// 返回索引中全部MD5的布隆过滤器，格式见 shared/bloom。响应带 ETag，
+// 请求头 If-None-Match 与当前摘要相同时返回 304。
+func indexSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	snap, err := indexSummary.Get()
+	if err != nil {
+		log.Printf("生成索引摘要失败: %v", err)
+		fail(w, r, 500, types.ErrCodeInternal, "生成索引摘要失败")
+		return
+	}
+	w.Header().Set("Content-Type", bloom.ContentType)
+	w.Header().Set("ETag", snap.ETag)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-SmartFinder-Count", strconv.Itoa(snap.Count))
+	http.ServeContent(w, r, "", snap.BuiltAt, bytes.NewReader(snap.Data))
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"smart-finder/client/internal/thumb"
+	"smart-finder/shared/types"
+)
+
+// 缩略图API
+//
+// 返回长边不超过 size 的缩略图，size 向上取到 thumb.Sizes 之一，默认 256。
+// 缩略图只取决于文件内容，以MD5与边长为 ETag 并允许长期缓存；不支持的
+// 文件返回标注扩展名的SVG占位图，响应头 X-SmartFinder-Thumbnail 为 placeholder。
+func thumbHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		methodNotAllowed(w, r, "GET")
+		return
+	}
+	hash := r.URL.Query().Get("hash")
+	if len(hash) != 32 {
+		fail(w, r, 400, types.ErrCodeInvalidHash, "参数错误，缺少或错误的md5")
+		return
+	}
+	size := thumb.DefaultSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			fail(w, r, 400, types.ErrCodeInvalidRequest, fmt.Sprintf("参数错误，无效的尺寸: %s", v))
+			return
+		}
+		size = thumb.NormalizeSize(n)
+	}
+
+	var filePath, fileName string
+	err := dbConn.QueryRow("SELECT path, filename FROM files WHERE md5 = ?", hash).Scan(&filePath, &fileName)
+	if err == sql.ErrNoRows {
+		fail(w, r, 404, types.ErrCodeNotFound, "未找到该md5对应的文件")
+		return
+	} else if err != nil {
+		fail(w, r, 500, types.ErrCodeInternal, "数据库错误")
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s-%d"`, hash, size)
+	t, err := thumbCache.Get(hash, size, filePath)
+	switch {
+	case errors.Is(err, thumb.ErrUnsupported):
+		t = &thumb.Thumbnail{
+			Data:        thumb.Placeholder(placeholderLabel(fileName), size),
+			ContentType: thumb.PlaceholderContentType,
+		}
+		etag = fmt.Sprintf(`"%s-%d-placeholder"`, hash, size)
+		w.Header().Set("X-SmartFinder-Thumbnail", "placeholder")
+		// 以后可能支持该类型，不长期缓存
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	case err != nil:
+		log.Printf("生成缩略图失败 %s: %v", filePath, err)
+		fail(w, r, 500, types.ErrCodeInternal, "文件无法打开")
+		return
+	default:
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("Content-Type", t.ContentType)
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(t.Data))
+}
+
+// placeholderLabel 占位图上标注的文字，没有扩展名时为 FILE
+func placeholderLabel(fileName string) string {
+	if ext := filepath.Ext(fileName); len(ext) > 1 {
+		return ext
+	}
+	return "FILE"
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-finder/gateway/internal/analytics"
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/gateway/internal/routing"
+)
+
+// /api/stats 的默认统计天数与列表长度
+const (
+	defaultStatsDays  = 30
+	defaultStatsLimit = 20
+	maxStatsLimit     = 500
+)
+
+// recordResolution 把服务端的一次解析记入指标与解析记录，start 为开始处理请求的时间
+func (g *MD5Gateway) recordResolution(r *http.Request, source, hash string, res *backend.Result, err error, start time.Time) {
+	outcome := metrics.OutcomeOf(err)
+	g.metrics.Resolution(source, outcome)
+	e := analytics.Event{
+		Hash:     strings.ToLower(hash),
+		Source:   source,
+		Outcome:  outcome,
+		Path:     analytics.PathServer,
+		Referrer: routing.Referrer(r),
+		Latency:  time.Since(start),
+	}
+	if res != nil {
+		e.Backend = res.Backend
+	}
+	g.analytics.Record(e)
+}
+
+// 解析统计：次数最多的哈希、失效链接与每天的解析量
+//
+// 参数 days 为统计最近几天（默认 30），limit 为列表长度（默认 20）。
+func (g *MD5Gateway) handleStats(w http.ResponseWriter, r *http.Request) {
+	if g.analytics == nil {
+		http.Error(w, "未启用解析记录", http.StatusNotFound)
+		return
+	}
+	days, ok := positiveParam(r, "days", defaultStatsDays)
+	if !ok {
+		http.Error(w, "无效的days参数", http.StatusBadRequest)
+		return
+	}
+	limit, ok := positiveParam(r, "limit", defaultStatsLimit)
+	if !ok || limit > maxStatsLimit {
+		http.Error(w, "无效的limit参数", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	since := time.Date(now.Year(), now.Month(), now.Day()-days+1, 0, 0, 0, 0, now.Location())
+	stats, err := g.analytics.Stats(r.Context(), since, limit)
+	if err != nil {
+		log.Printf("查询解析统计失败: %v", err)
+		http.Error(w, "查询解析统计失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// positiveParam 读取正整数查询参数，未指定时返回 def
+func positiveParam(r *http.Request, name string, def int) (int, bool) {
+	s := r.URL.Query().Get(name)
+	if s == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil && n > 0
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+
+	"smart-finder/gateway/internal/analytics"
+	"smart-finder/gateway/internal/auth"
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/index"
+	"smart-finder/gateway/internal/registry"
+	"smart-finder/gateway/internal/share"
+	"smart-finder/gateway/internal/tlsserver"
+	"smart-finder/shared/utils"
+)
+
+// EnvPrefix 覆盖配置的环境变量前缀，如 SMARTFINDER_DATABASE_PASSWORD 对应 database.password
+const EnvPrefix = "SMARTFINDER"
+
+// secretFileSuffix 从文件读取配置值的键后缀，如 database.password_file 或
+// SMARTFINDER_DATABASE_PASSWORD_FILE，文件末尾的换行被去掉
+const secretFileSuffix = "_file"
+
+// 配置的默认值
+const (
+	DefaultPort          = 8080
+	DefaultDatabasePort  = 3306
+	DefaultDatabaseChars = "utf8mb4"
+	// MinRegistryTokenLength registry.token 的最小长度
+	MinRegistryTokenLength = 16
+)
+
+// loadConfig 依次读取配置文件、环境变量与密钥文件，补全默认值并校验
+//
+// path 为空时在 config/ 目录下查找 config.yaml，找不到时只使用环境变量；
+// 指定了 path 而文件不存在时返回错误。返回的 viper 实例用于监听配置文件，
+// 未读取配置文件时其 ConfigFileUsed 为空。
+func loadConfig(path string) (*Config, *viper.Viper, error) {
+	v := viper.New()
+	if path != "" {
+		v.SetConfigFile(path)
+	} else {
+		v.SetConfigName("config")
+		v.SetConfigType("yaml")
+		v.AddConfigPath("config")
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	stringKeys := bindEnv(v, reflect.TypeOf(Config{}), "")
+
+	if err := v.ReadInConfig(); err != nil {
+		var notFound viper.ConfigFileNotFoundError
+		if path != "" || !errors.As(err, &notFound) {
+			return nil, nil, fmt.Errorf("无法读取配置文件: %w", err)
+		}
+	}
+
+	for _, key := range stringKeys {
+		file := v.GetString(key + secretFileSuffix)
+		if file == "" {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无法读取 %s%s: %w", key, secretFileSuffix, err)
+		}
+		v.Set(key, strings.TrimRight(string(data), "\r\n"))
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config); err != nil {
+		return nil, nil, fmt.Errorf("无法解析配置: %w", err)
+	}
+	// databases 是映射，不经过上面的环境变量绑定，在此读取 password_file
+	for name, db := range config.Databases {
+		if db.PasswordFile == "" {
+			continue
+		}
+		data, err := os.ReadFile(db.PasswordFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("无法读取 databases.%s.password_file: %w", name, err)
+		}
+		db.Password = strings.TrimRight(string(data), "\r\n")
+		config.Databases[name] = db
+	}
+	config.applyDefaults()
+	if err := config.validate(); err != nil {
+		return nil, nil, fmt.Errorf("配置无效:\n%w", err)
+	}
+	return &config, v, nil
+}
+
+// bindEnv 为结构体中的每个配置项绑定环境变量，返回字符串类型的键
+//
+// viper 只在 Unmarshal 时查找已知键的环境变量，没有出现在配置文件中的键
+// 需要显式绑定。切片中的结构体（如 backends）与映射无法通过环境变量设置。
+func bindEnv(v *viper.Viper, t reflect.Type, prefix string) []string {
+	var stringKeys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("mapstructure"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+		key := prefix + tag
+		switch field.Type.Kind() {
+		case reflect.Struct:
+			stringKeys = append(stringKeys, bindEnv(v, field.Type, key+".")...)
+		case reflect.Map:
+		case reflect.Slice:
+			if field.Type.Elem().Kind() == reflect.String {
+				v.BindEnv(key) // 逗号分隔
+			}
+		case reflect.String:
+			v.BindEnv(key)
+			v.BindEnv(key + secretFileSuffix)
+			stringKeys = append(stringKeys, key)
+		default:
+			v.BindEnv(key)
+		}
+	}
+	return stringKeys
+}
+
+// applyDefaults 补全未配置的项
+func (c *Config) applyDefaults() {
+	if c.Server.Port == 0 {
+		c.Server.Port = DefaultPort
+	}
+	if c.Server.Delivery == "" {
+		c.Server.Delivery = DeliveryRedirect
+	}
+	if c.Server.Disposition == "" {
+		c.Server.Disposition = utils.DispositionInline
+	}
+	if c.Server.MaxBatchSize <= 0 {
+		c.Server.MaxBatchSize = DefaultMaxBatchSize
+	}
+	if c.Server.ShutdownTimeout <= 0 {
+		c.Server.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	c.Database.applyDefaults()
+	for name, db := range c.Databases {
+		db.applyDefaults()
+		c.Databases[name] = db
+	}
+
+	// 未配置后端时保持原有行为，只查询 Kodbox；只配置了网关索引时查询索引
+	if len(c.Backends) == 0 {
+		if len(c.Index.Roots) > 0 {
+			c.Backends = []backend.Config{{Type: backend.TypeIndex, Name: backend.TypeIndex}}
+		} else {
+			c.Backends = []backend.Config{{Type: backend.TypeKodbox, Name: backend.TypeKodbox}}
+		}
+	}
+	if c.Index.Driver == "" {
+		c.Index.Driver = index.DriverSQLite
+	}
+	if c.Share.Driver == "" {
+		c.Share.Driver = share.DriverSQLite
+	}
+	if c.Analytics.Driver == "" {
+		c.Analytics.Driver = analytics.DriverSQLite
+	}
+	if c.Analytics.Retention <= 0 {
+		c.Analytics.Retention = analytics.DefaultRetention
+	}
+	if c.Registry.Driver == "" {
+		c.Registry.Driver = registry.DriverSQLite
+	}
+}
+
+func (d *DatabaseConfig) applyDefaults() {
+	if d.Port == 0 {
+		d.Port = DefaultDatabasePort
+	}
+	if d.Charset == "" {
+		d.Charset = DefaultDatabaseChars
+	}
+}
+
+// validate 检查配置，返回所有问题而不只是第一个
+func (c *Config) validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("  "+format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port 应在 1-65535 之间: %d", c.Server.Port)
+	check(isHTTPURL(c.Server.Domain), "server.domain 应为 http(s) 地址: %q", c.Server.Domain)
+	check(c.Server.Delivery == DeliveryRedirect || c.Server.Delivery == DeliveryStream,
+		"无效的 server.delivery: %q，应为 redirect 或 stream", c.Server.Delivery)
+	check(c.Server.Disposition == utils.DispositionInline || c.Server.Disposition == utils.DispositionAttachment,
+		"无效的 server.disposition: %q，应为 inline 或 attachment", c.Server.Disposition)
+	if c.Server.TLS.Enabled() {
+		if err := c.Server.TLS.Validate(); err != nil {
+			check(false, "server.tls: %v", err)
+		}
+	}
+	for _, method := range c.Auth.Methods {
+		if method == auth.MethodClientCert {
+			check(c.Server.TLS.ClientAuth == tlsserver.ClientAuthOptional || c.Server.TLS.ClientAuth == tlsserver.ClientAuthRequire,
+				"auth.methods 包含 client_cert 时 server.tls.client_auth 应为 optional 或 require")
+		}
+	}
+
+	checkDatabase := func(key string, d DatabaseConfig) {
+		check(d.Host != "", "需要配置 %s.host", key)
+		check(d.Username != "", "需要配置 %s.username", key)
+		check(d.Database != "", "需要配置 %s.database", key)
+		check(d.Port > 0 && d.Port <= 65535, "%s.port 应在 1-65535 之间: %d", key, d.Port)
+	}
+	if needsMySQL(c) {
+		checkDatabase("database", c.Database)
+	}
+	for name, d := range c.Databases {
+		checkDatabase("databases."+name, d)
+	}
+	check(c.Index.Driver == index.DriverSQLite || c.Index.Driver == index.DriverMySQL,
+		"无效的 index.driver: %q，应为 sqlite 或 mysql", c.Index.Driver)
+	check(c.Share.Driver == share.DriverSQLite || c.Share.Driver == share.DriverMySQL,
+		"无效的 share.driver: %q，应为 sqlite 或 mysql", c.Share.Driver)
+	check(c.Analytics.Driver == analytics.DriverSQLite || c.Analytics.Driver == analytics.DriverMySQL,
+		"无效的 analytics.driver: %q，应为 sqlite 或 mysql", c.Analytics.Driver)
+	check(c.Registry.Driver == registry.DriverSQLite || c.Registry.Driver == registry.DriverMySQL,
+		"无效的 registry.driver: %q，应为 sqlite 或 mysql", c.Registry.Driver)
+	if c.Registry.Enabled {
+		check(len(c.Registry.Token) >= MinRegistryTokenLength, "启用 registry 时 registry.token 至少需要 %d 个字符", MinRegistryTokenLength)
+	}
+
+	var names []string
+	for i, b := range c.Backends {
+		names = append(names, b.DisplayName())
+		switch b.Type {
+		case backend.TypeKodbox:
+			if b.Domain != "" {
+				check(isHTTPURL(b.Domain), "backends[%d].domain 应为 http(s) 地址: %q", i, b.Domain)
+			} else {
+				check(isHTTPURL(c.Kodbox.Domain), "kodbox.domain 应为 http(s) 地址: %q", c.Kodbox.Domain)
+			}
+			if b.Database != "" {
+				_, ok := c.Databases[b.Database]
+				check(ok, "backends[%d]: databases 中没有 %s", i, b.Database)
+			}
+		case backend.TypeRegistry:
+			check(c.Registry.Enabled, "backends[%d]: registry 类型的后端需要启用 registry", i)
+		case backend.TypeS3:
+			// 缓存（含 Redis 共享缓存）中的预签名地址不能比地址本身活得更久
+			if b.AccessKey != "" && b.PresignExpiry > 0 && !c.Cache.Disabled && c.Cache.TTL > 0 {
+				check(c.Cache.TTL < b.PresignExpiry, "cache.ttl (%s) 应小于 backends[%d].presign_expiry (%s)",
+					c.Cache.TTL, i, b.PresignExpiry)
+			}
+		case backend.TypeLocal, backend.TypeIndex:
+		default:
+			check(false, "backends[%d]: 未知的后端类型 %q", i, b.Type)
+		}
+	}
+	if err := c.Routing.Validate(names); err != nil {
+		check(false, "routing: %v", err)
+	}
+	return errors.Join(errs...)
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// configReloader 配置文件修改后重新加载可在运行中生效的配置
+//
+// 可热加载的配置：server.domain、server.disposition、server.max_batch_size、
+// server.shutdown_timeout、kodbox.domain、error、admin、registry.token 以及
+// cache.ttl 与 cache.negative_ttl。数据库、端口、后端、索引、分享、认证等需要重新建立
+// 连接的配置修改后只记录日志，重启后生效。
+type configReloader struct {
+	gateway *MD5Gateway
+	path    string
+
+	mu     sync.Mutex
+	loaded Config // 最近一次从文件加载的配置，用于判断哪些项发生了变化
+}
+
+// watchConfig 监听 v 读取的配置文件，未读取配置文件时不监听
+func (g *MD5Gateway) watchConfig(v *viper.Viper, loaded Config) {
+	path := v.ConfigFileUsed()
+	if path == "" {
+		return
+	}
+	r := &configReloader{gateway: g, path: path, loaded: loaded}
+	v.OnConfigChange(func(fsnotify.Event) { r.reload() })
+	v.WatchConfig()
+	log.Printf("监听配置文件 %s", path)
+}
+
+func (r *configReloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, _, err := loadConfig(r.path)
+	if err != nil {
+		log.Printf("重新加载配置失败，继续使用原有配置: %v", err)
+		return
+	}
+	if changed := restartRequired(&r.loaded, next); len(changed) > 0 {
+		log.Printf("以下配置的修改需要重启才能生效: %s", strings.Join(changed, ", "))
+	}
+	r.loaded = *next
+	r.gateway.applyConfig(next)
+	log.Printf("已重新加载配置 %s", r.path)
+}
+
+// applyConfig 把 next 中可热加载的配置应用到运行中的网关
+func (g *MD5Gateway) applyConfig(next *Config) {
+	cur := g.conf()
+	updated := *cur
+	updated.Server.Domain = next.Server.Domain
+	updated.Server.Disposition = next.Server.Disposition
+	updated.Server.MaxBatchSize = next.Server.MaxBatchSize
+	updated.Server.ShutdownTimeout = next.Server.ShutdownTimeout
+	updated.Kodbox.Domain = next.Kodbox.Domain
+	updated.Error = next.Error
+	updated.Admin = next.Admin
+	updated.Cache.TTL = next.Cache.TTL
+	updated.Cache.NegativeTTL = next.Cache.NegativeTTL
+	// 客户端登记接口每次请求时读取当前配置中的令牌
+	updated.Registry.Token = next.Registry.Token
+	g.config.Store(&updated)
+
+	if g.cache != nil {
+		g.cache.SetTTL(updated.Cache.TTL, updated.Cache.NegativeTTL)
+	}
+	if updated.Kodbox.Domain != cur.Kodbox.Domain {
+		// 单独配置了 domain 的 Kodbox 后端不受影响
+		inherits := make(map[string]bool)
+		for _, cfg := range updated.Backends {
+			if cfg.Type == backend.TypeKodbox && cfg.Domain == "" {
+				inherits[cfg.DisplayName()] = true
+			}
+		}
+		for _, b := range g.backends.Backends() {
+			if k, ok := b.(*backend.Kodbox); ok && inherits[k.Name()] {
+				k.SetDomain(updated.Kodbox.Domain)
+			}
+		}
+		// 缓存的结果中包含原有的 Kodbox 地址
+		if g.cache != nil {
+			g.cache.PurgeAll()
+		}
+	}
+}
+
+// restartRequired 返回两份配置中发生了变化、但不能热加载的配置段
+func restartRequired(prev, next *Config) []string {
+	strip := func(c Config) Config {
+		c.Server.Domain, c.Server.Disposition = "", ""
+		c.Server.MaxBatchSize, c.Server.ShutdownTimeout = 0, 0
+		c.Kodbox.Domain = ""
+		c.Error, c.Admin = ErrorConfig{}, AdminConfig{}
+		c.Cache.TTL, c.Cache.NegativeTTL = 0, 0
+		c.Registry.Token = ""
+		return c
+	}
+	a, b := reflect.ValueOf(strip(*prev)), reflect.ValueOf(strip(*next))
+	var changed []string
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, a.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return changed
+}
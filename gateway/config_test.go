@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/analytics"
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/index"
+	"smart-finder/gateway/internal/registry"
+	"smart-finder/gateway/internal/share"
+	"smart-finder/gateway/internal/sqlitedb"
+	"smart-finder/shared/utils"
+)
+
+// validConfig 返回能通过校验的最小配置
+func validConfig() *Config {
+	c := &Config{}
+	c.Server.Port = 8080
+	c.Server.Domain = "http://localhost:8080"
+	c.Server.Delivery = DeliveryRedirect
+	c.Server.Disposition = utils.DispositionInline
+	c.Index.Driver = index.DriverSQLite
+	c.Share.Driver = share.DriverSQLite
+	c.Analytics.Driver = analytics.DriverSQLite
+	c.Registry.Driver = registry.DriverSQLite
+	return c
+}
+
+func TestValidateCacheTTLAgainstPresignExpiry(t *testing.T) {
+	s3 := backend.Config{Type: backend.TypeS3, Endpoint: "http://minio:9000", Bucket: "files", AccessKey: "minio", SecretKey: "minio123"}
+
+	c := validConfig()
+	if err := c.validate(); err != nil {
+		t.Fatalf("最小配置应通过校验: %v", err)
+	}
+
+	s3.PresignExpiry = 10 * time.Minute
+	c.Backends = []backend.Config{s3}
+	c.Cache.TTL = 10 * time.Minute
+	if err := c.validate(); err == nil || !strings.Contains(err.Error(), "presign_expiry") {
+		t.Fatalf("cache.ttl 不小于 presign_expiry 时应返回错误, err = %v", err)
+	}
+
+	c.Cache.TTL = 5 * time.Minute
+	if err := c.validate(); err != nil {
+		t.Fatalf("cache.ttl 小于 presign_expiry: %v", err)
+	}
+
+	// 未配置密钥时地址不会过期，禁用缓存时不缓存地址
+	c.Cache.TTL = time.Hour
+	c.Backends[0].AccessKey = ""
+	if err := c.validate(); err != nil {
+		t.Fatalf("未签名的地址: %v", err)
+	}
+	c.Backends[0].AccessKey = "minio"
+	c.Cache.Disabled = true
+	if err := c.validate(); err != nil {
+		t.Fatalf("禁用缓存: %v", err)
+	}
+}
+
+func TestApplyConfigRegistryToken(t *testing.T) {
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	hosts, err := registry.New(db, registry.Config{Driver: registry.DriverSQLite})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := validConfig()
+	c.Registry.Enabled = true
+	c.Registry.Token = "old-token-0123456789"
+	g := &MD5Gateway{registry: hosts}
+	g.config.Store(c)
+	h := g.requireRegistryToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func(token string) int {
+		r := httptest.NewRequest("POST", "/api/registry/heartbeat", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := status("old-token-0123456789"); code != http.StatusOK {
+		t.Fatalf("old token before reload: %d", code)
+	}
+
+	// 修改令牌不需要重启，重新加载后立即生效
+	next := *c
+	next.Registry.Token = "new-token-0123456789"
+	if changed := restartRequired(c, &next); len(changed) != 0 {
+		t.Fatalf("restartRequired = %v", changed)
+	}
+	g.applyConfig(&next)
+	if code := status("new-token-0123456789"); code != http.StatusOK {
+		t.Errorf("new token after reload: %d, want 200", code)
+	}
+	if code := status("old-token-0123456789"); code != http.StatusUnauthorized {
+		t.Errorf("old token after reload: %d, want 401", code)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+// readinessTimeout 就绪检查中所有依赖检查的总时长
+const readinessTimeout = 5 * time.Second
+
+// readinessResponse 就绪检查结果，checks 的值为 ok 或错误说明
+type readinessResponse struct {
+	Status string            `json:"status"` // ok、unavailable 或 shutting_down
+	Checks map[string]string `json:"checks"`
+}
+
+// 存活检查：进程能处理请求即返回 200，不检查依赖
+func (g *MD5Gateway) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+// 就绪检查：并行检查各后端及索引、分享链接数据库的连接，任一失败或正在
+// 关闭时返回 503，供负载均衡摘除实例
+func (g *MD5Gateway) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	if g.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readinessResponse{Status: "shutting_down", Checks: map[string]string{}})
+		return
+	}
+
+	checks := make(map[string]func(context.Context) error)
+	for _, b := range g.backends.Backends() {
+		if p, ok := b.(backend.Pinger); ok {
+			checks["backend:"+b.Name()] = p.Ping
+		}
+	}
+	if g.indexer != nil {
+		checks["index"] = g.indexer.Store().Ping
+	}
+	if g.shares != nil {
+		checks["share"] = g.shares.Ping
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	resp := readinessResponse{Status: "ok", Checks: make(map[string]string, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := "ok"
+			if err := check(ctx); err != nil {
+				result = err.Error()
+			}
+			mu.Lock()
+			resp.Checks[name] = result
+			if result != "ok" {
+				resp.Status = "unavailable"
+			}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
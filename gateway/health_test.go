@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+// downBackend 就绪检查总是失败的后端
+type downBackend struct{}
+
+func (downBackend) Name() string { return "nas" }
+func (downBackend) Type() string { return backend.TypeLocal }
+func (downBackend) Lookup(context.Context, string) (*backend.Result, error) {
+	return nil, backend.ErrNotFound
+}
+func (downBackend) Ping(context.Context) error { return errors.New("目录无法访问") }
+
+func TestReadyz(t *testing.T) {
+	g := newShareGateway(t)
+
+	get := func(path string) (*httptest.ResponseRecorder, readinessResponse) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		g.routes().ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("%s: Cache-Control = %q", path, rec.Header().Get("Cache-Control"))
+		}
+		var resp readinessResponse
+		if path == "/readyz" {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("%s: %v %q", path, err, rec.Body.String())
+			}
+		}
+		return rec, resp
+	}
+
+	// 所有依赖可用
+	rec, resp := get("/readyz")
+	if rec.Code != http.StatusOK || resp.Status != "ok" || resp.Checks["backend:files"] != "ok" || resp.Checks["share"] != "ok" {
+		t.Errorf("all ok: %d %+v", rec.Code, resp)
+	}
+
+	// 某个后端不可用时返回 503，错误在该后端的检查项中
+	g.backends = backend.NewChain(append(g.backends.Backends(), downBackend{})...)
+	rec, resp = get("/readyz")
+	if rec.Code != http.StatusServiceUnavailable || resp.Status != "unavailable" {
+		t.Errorf("failing backend: %d %+v", rec.Code, resp)
+	}
+	if resp.Checks["backend:nas"] != "目录无法访问" || resp.Checks["backend:files"] != "ok" {
+		t.Errorf("failing backend checks = %+v", resp.Checks)
+	}
+
+	// 正在关闭时不再检查依赖，存活检查仍然成功
+	g.backends = backend.NewChain(g.backends.Backends()[0])
+	g.draining.Store(true)
+	rec, resp = get("/readyz")
+	if rec.Code != http.StatusServiceUnavailable || resp.Status != "shutting_down" || len(resp.Checks) != 0 {
+		t.Errorf("draining: %d %+v", rec.Code, resp)
+	}
+	if rec, _ := get("/healthz"); rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("healthz while draining: %d %q", rec.Code, rec.Body.String())
+	}
+}
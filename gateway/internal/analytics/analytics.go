@@ -0,0 +1,282 @@
+// Package analytics 记录网关的每次哈希解析，用于统计常用链接、失效链接
+// 以及本地客户端与服务端各自处理的比例
+//
+// 解析记录先写入内存队列，由后台协程批量写入数据库，不阻塞请求；队列
+// 已满时丢弃记录并计数。超过保留期的记录定期删除。
+package analytics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 数据库类型
+const (
+	DriverSQLite = "sqlite"
+	DriverMySQL  = "mysql"
+)
+
+// 默认配置
+const (
+	DefaultSQLitePath = "data/analytics.db"
+	DefaultRetention  = 90 * 24 * time.Hour
+	DefaultBufferSize = 4096
+)
+
+// 解析途径：md5.html 页面最终由本地客户端还是服务端打开文件
+const (
+	PathClient = "client"
+	PathServer = "server"
+)
+
+// 写入与清理的节奏
+const (
+	flushInterval = 2 * time.Second
+	maxBatch      = 500
+	purgeInterval = time.Hour
+)
+
+// maxReferrerLength 保存的来源页面地址的最大长度
+const maxReferrerLength = 512
+
+var schemas = map[string][]string{
+	DriverSQLite: {
+		`CREATE TABLE IF NOT EXISTS smartfinder_resolutions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at BIGINT NOT NULL,
+			day CHAR(10) NOT NULL,
+			hash CHAR(32) NOT NULL,
+			source VARCHAR(16) NOT NULL,
+			outcome VARCHAR(16) NOT NULL,
+			backend VARCHAR(64) NOT NULL DEFAULT '',
+			path VARCHAR(8) NOT NULL DEFAULT '',
+			referrer VARCHAR(512) NOT NULL DEFAULT '',
+			latency_ms INTEGER NOT NULL DEFAULT 0
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_smartfinder_resolutions_created ON smartfinder_resolutions (created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_smartfinder_resolutions_hash ON smartfinder_resolutions (hash)`,
+	},
+	DriverMySQL: {
+		`CREATE TABLE IF NOT EXISTS smartfinder_resolutions (
+			id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			created_at BIGINT NOT NULL,
+			day CHAR(10) NOT NULL,
+			hash CHAR(32) NOT NULL,
+			source VARCHAR(16) NOT NULL,
+			outcome VARCHAR(16) NOT NULL,
+			backend VARCHAR(64) NOT NULL DEFAULT '',
+			path VARCHAR(8) NOT NULL DEFAULT '',
+			referrer VARCHAR(512) NOT NULL DEFAULT '',
+			latency_ms INT NOT NULL DEFAULT 0,
+			INDEX idx_smartfinder_resolutions_created (created_at),
+			INDEX idx_smartfinder_resolutions_hash (hash)
+		)`,
+	},
+}
+
+// Config 解析记录配置
+type Config struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	Driver     string        `mapstructure:"driver"` // sqlite 或 mysql
+	SQLitePath string        `mapstructure:"sqlite_path"`
+	Retention  time.Duration `mapstructure:"retention"`   // 记录的保留时间
+	BufferSize int           `mapstructure:"buffer_size"` // 等待写入的最大记录数
+}
+
+// Event 一次解析
+type Event struct {
+	Time     time.Time
+	Hash     string
+	Source   string // 解析来源：server、batch、share 或 client，与指标的 source 相同
+	Outcome  string // found、not_found、error 或 unavailable
+	Backend  string // 找到文件的后端
+	Path     string // client 或 server
+	Referrer string
+	Latency  time.Duration
+}
+
+// Recorder 记录解析并提供统计
+type Recorder struct {
+	db        *sql.DB
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.RWMutex // 保护 closed 与向 events 发送
+	closed  bool
+	events  chan Event
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// New 在 db 上创建解析记录表（已存在时跳过），调用 Start 后开始写入
+func New(db *sql.DB, cfg Config) (*Recorder, error) {
+	schema, ok := schemas[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的解析记录数据库: %q", cfg.Driver)
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("创建解析记录表失败: %w", err)
+		}
+	}
+	r := &Recorder{
+		db:        db,
+		retention: cfg.Retention,
+		now:       time.Now,
+		events:    make(chan Event, cfg.BufferSize),
+		done:      make(chan struct{}),
+	}
+	if r.retention <= 0 {
+		r.retention = DefaultRetention
+	}
+	if cfg.BufferSize <= 0 {
+		r.events = make(chan Event, DefaultBufferSize)
+	}
+	return r, nil
+}
+
+// Record 把解析加入写入队列，不阻塞；r 为 nil 时不记录
+func (r *Recorder) Record(e Event) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = r.now()
+	}
+	e.Referrer = cleanReferrer(e.Referrer)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.closed {
+		return
+	}
+	select {
+	case r.events <- e:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Dropped 返回因队列已满而丢弃的记录数
+func (r *Recorder) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+// Start 启动后台写入与过期清理
+func (r *Recorder) Start() {
+	go r.run()
+}
+
+// Close 停止接收记录，写入队列中剩余的记录后返回
+func (r *Recorder) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	close(r.events)
+	r.mu.Unlock()
+	<-r.done
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	flush := time.NewTicker(flushInterval)
+	defer flush.Stop()
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+	r.purgeExpired()
+
+	var batch []Event
+	write := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.insert(context.Background(), batch); err != nil {
+			log.Printf("写入解析记录失败，丢弃 %d 条: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case e, ok := <-r.events:
+			if !ok {
+				write()
+				return
+			}
+			batch = append(batch, e)
+			if len(batch) >= maxBatch {
+				write()
+			}
+		case <-flush.C:
+			write()
+		case <-purge.C:
+			r.purgeExpired()
+		}
+	}
+}
+
+func (r *Recorder) insert(ctx context.Context, events []Event) error {
+	var b strings.Builder
+	b.WriteString(`INSERT INTO smartfinder_resolutions
+		(created_at, day, hash, source, outcome, backend, path, referrer, latency_ms) VALUES `)
+	args := make([]any, 0, len(events)*9)
+	for i, e := range events {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("(?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, e.Time.UnixMilli(), e.Time.Format(time.DateOnly), e.Hash, e.Source, e.Outcome,
+			e.Backend, e.Path, e.Referrer, e.Latency.Milliseconds())
+	}
+	_, err := r.db.ExecContext(ctx, b.String(), args...)
+	return err
+}
+
+func (r *Recorder) purgeExpired() {
+	n, err := r.Purge(context.Background(), r.now().Add(-r.retention))
+	if err != nil {
+		log.Printf("清理过期解析记录失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已清理 %d 条过期解析记录", n)
+	}
+}
+
+// Purge 删除 before 之前的记录，返回删除的条数
+func (r *Recorder) Purge(ctx context.Context, before time.Time) (int64, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM smartfinder_resolutions WHERE created_at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Ping 检查数据库连接
+func (r *Recorder) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// cleanReferrer 去掉来源地址中的查询参数与片段（可能包含令牌等敏感信息）
+func cleanReferrer(ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	u.RawQuery, u.Fragment, u.User = "", "", nil
+	s := u.String()
+	if len(s) > maxReferrerLength {
+		s = s[:maxReferrerLength]
+	}
+	return s
+}
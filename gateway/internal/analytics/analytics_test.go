@@ -0,0 +1,155 @@
+package analytics
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/sqlitedb"
+)
+
+const (
+	helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+	worldMD5 = "7d793037a0760186574b0282f2f435e7"
+	deadMD5  = "00000000000000000000000000000000"
+)
+
+func newTestRecorder(t *testing.T, cfg Config) *Recorder {
+	t.Helper()
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "analytics.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg.Driver = DriverSQLite
+	r, err := New(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestStats(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRecorder(t, Config{})
+	r.Start()
+
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.Local)
+	day2 := day1.AddDate(0, 0, 1)
+	events := []Event{
+		{Time: day1, Hash: helloMD5, Source: "server", Outcome: "found", Path: PathServer, Latency: 10 * time.Millisecond},
+		{Time: day1, Hash: helloMD5, Source: "batch", Outcome: "found", Path: PathServer, Latency: 30 * time.Millisecond},
+		{Time: day1, Hash: deadMD5, Source: "server", Outcome: "not_found", Path: PathServer,
+			Referrer: "https://wiki.example.com/page?token=secret#top"},
+		{Time: day2, Hash: deadMD5, Source: "server", Outcome: "not_found", Path: PathServer,
+			Referrer: "https://intranet.example.com/news"},
+		{Time: day2, Hash: worldMD5, Source: "server", Outcome: "not_found", Path: PathServer},
+		{Time: day2, Hash: worldMD5, Source: "server", Outcome: "found", Path: PathServer},
+		// 页面上报的本地客户端检查结果不计入解析次数
+		{Time: day2, Hash: helloMD5, Source: "client", Outcome: "found", Path: PathClient},
+		{Time: day2, Hash: worldMD5, Source: "client", Outcome: "unavailable", Path: PathServer},
+	}
+	for _, e := range events {
+		r.Record(e)
+	}
+	r.Close()
+	r.Record(events[0]) // 关闭后不再记录
+
+	stats, err := r.Stats(ctx, day1.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 6 {
+		t.Errorf("total = %d, want 6", stats.Total)
+	}
+
+	if len(stats.TopHashes) != 3 || stats.TopHashes[0].Hash != deadMD5 || stats.TopHashes[0].Count != 2 {
+		t.Errorf("top_hashes = %+v", stats.TopHashes)
+	}
+	for _, h := range stats.TopHashes {
+		if h.Hash == helloMD5 && (h.Count != 2 || h.Found != 2) {
+			t.Errorf("hello = %+v, want count 2 found 2", h)
+		}
+	}
+
+	// worldMD5 后来找到了，不是失效链接
+	if len(stats.DeadLinks) != 1 {
+		t.Fatalf("dead_links = %+v", stats.DeadLinks)
+	}
+	dead := stats.DeadLinks[0]
+	if dead.Hash != deadMD5 || dead.Count != 2 || dead.Referrer != "https://intranet.example.com/news" {
+		t.Errorf("dead link = %+v", dead)
+	}
+
+	if len(stats.Daily) != 2 {
+		t.Fatalf("daily = %+v", stats.Daily)
+	}
+	d1, d2 := stats.Daily[0], stats.Daily[1]
+	if d1.Date != "2026-03-01" || d1.Total != 3 || d1.Found != 2 || d1.NotFound != 1 || d1.AvgLatencyMs != 13 {
+		t.Errorf("day 1 = %+v", d1)
+	}
+	if d2.Date != "2026-03-02" || d2.Total != 3 || d2.Client != 1 || d2.Server != 1 {
+		t.Errorf("day 2 = %+v", d2)
+	}
+
+	// 统计期间只包含第二天
+	stats, err = r.Stats(ctx, day2.Add(-time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 3 || len(stats.Daily) != 1 {
+		t.Errorf("since day 2: total = %d, daily = %d", stats.Total, len(stats.Daily))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRecorder(t, Config{Retention: 24 * time.Hour})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	r.Start()
+	r.Record(Event{Time: now.Add(-48 * time.Hour), Hash: helloMD5, Source: "server", Outcome: "found"})
+	r.Record(Event{Hash: worldMD5, Source: "server", Outcome: "found"})
+	r.Close()
+
+	n, err := r.Purge(ctx, now.Add(-r.retention))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("purged %d, want 1", n)
+	}
+	stats, err := r.Stats(ctx, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Total != 1 || stats.TopHashes[0].Hash != worldMD5 {
+		t.Errorf("after purge: %+v", stats)
+	}
+}
+
+func TestRecordDropsWhenFull(t *testing.T) {
+	r := newTestRecorder(t, Config{BufferSize: 1})
+	// 未启动写入，队列满后丢弃
+	r.Record(Event{Hash: helloMD5, Source: "server", Outcome: "found"})
+	r.Record(Event{Hash: worldMD5, Source: "server", Outcome: "found"})
+	if got := r.Dropped(); got != 1 {
+		t.Fatalf("dropped = %d, want 1", got)
+	}
+	var nilRecorder *Recorder
+	nilRecorder.Record(Event{Hash: helloMD5})
+}
+
+func TestCleanReferrer(t *testing.T) {
+	for in, want := range map[string]string{
+		"":                                       "",
+		"not a url":                              "",
+		"https://user:pw@wiki.example.com/a?b#c": "https://wiki.example.com/a",
+		"http://intranet/page":                   "http://intranet/page",
+	} {
+		if got := cleanReferrer(in); got != want {
+			t.Errorf("cleanReferrer(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package analytics
+
+import (
+	"context"
+	"time"
+)
+
+// Stats 一段时间内的解析统计
+type Stats struct {
+	Since     time.Time     `json:"since"`
+	Total     int64         `json:"total"`
+	TopHashes []HashCount   `json:"top_hashes"`
+	DeadLinks []DeadLink    `json:"dead_links"`
+	Daily     []DailyVolume `json:"daily"`
+	// Dropped 网关启动以来因队列已满而未记录的解析数
+	Dropped int64 `json:"dropped"`
+}
+
+// HashCount 解析次数最多的哈希
+type HashCount struct {
+	Hash     string    `json:"hash"`
+	Count    int64     `json:"count"`
+	Found    int64     `json:"found"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// DeadLink 统计期间从未找到的哈希，Referrer 为最近一次解析的来源页面
+type DeadLink struct {
+	Hash     string    `json:"hash"`
+	Count    int64     `json:"count"`
+	LastSeen time.Time `json:"last_seen"`
+	Referrer string    `json:"referrer,omitempty"`
+}
+
+// DailyVolume 每天的解析量
+//
+// Client 与 Server 为 md5.html 页面最终由本地客户端或服务端打开文件的次数，
+// Total 等按服务端的解析计数，不含页面上报的本地客户端检查结果。
+type DailyVolume struct {
+	Date         string `json:"date"`
+	Total        int64  `json:"total"`
+	Found        int64  `json:"found"`
+	NotFound     int64  `json:"not_found"`
+	Errors       int64  `json:"errors"`
+	Client       int64  `json:"client"`
+	Server       int64  `json:"server"`
+	AvgLatencyMs int64  `json:"avg_latency_ms"`
+}
+
+// sourceClient 页面上报的本地客户端检查结果，与 metrics.SourceClient 相同
+const sourceClient = "client"
+
+// Stats 统计 since 之后的解析，top_hashes 与 dead_links 最多返回 limit 项
+func (r *Recorder) Stats(ctx context.Context, since time.Time, limit int) (*Stats, error) {
+	from := since.UnixMilli()
+	stats := &Stats{
+		Since:     since,
+		TopHashes: []HashCount{},
+		DeadLinks: []DeadLink{},
+		Daily:     []DailyVolume{},
+		Dropped:   r.Dropped(),
+	}
+
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT hash, COUNT(*), SUM(CASE WHEN outcome = 'found' THEN 1 ELSE 0 END), MAX(created_at)
+		FROM smartfinder_resolutions
+		WHERE created_at >= ? AND source <> ?
+		GROUP BY hash
+		ORDER BY COUNT(*) DESC, hash
+		LIMIT ?`, from, sourceClient, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var h HashCount
+		var last int64
+		if err := rows.Scan(&h.Hash, &h.Count, &h.Found, &last); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		h.LastSeen = time.UnixMilli(last)
+		stats.TopHashes = append(stats.TopHashes, h)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT d.hash, d.n, d.last, (
+			SELECT referrer FROM smartfinder_resolutions l
+			WHERE l.hash = d.hash AND l.created_at = d.last AND l.source <> ?
+			ORDER BY l.id DESC LIMIT 1)
+		FROM (
+			SELECT hash, COUNT(*) AS n, MAX(created_at) AS last
+			FROM smartfinder_resolutions
+			WHERE created_at >= ? AND source <> ?
+			GROUP BY hash
+			HAVING SUM(CASE WHEN outcome = 'not_found' THEN 1 ELSE 0 END) = COUNT(*)
+		) d
+		ORDER BY d.n DESC, d.hash
+		LIMIT ?`, sourceClient, from, sourceClient, limit)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var d DeadLink
+		var last int64
+		if err := rows.Scan(&d.Hash, &d.Count, &last, &d.Referrer); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		d.LastSeen = time.UnixMilli(last)
+		stats.DeadLinks = append(stats.DeadLinks, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = r.db.QueryContext(ctx, `
+		SELECT day,
+			SUM(CASE WHEN source <> ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN source <> ? AND outcome = 'found' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN source <> ? AND outcome = 'not_found' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN source <> ? AND outcome = 'error' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN path = 'client' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN path = 'server' AND source = ? THEN 1 ELSE 0 END),
+			COALESCE(AVG(CASE WHEN source <> ? THEN latency_ms END), 0)
+		FROM smartfinder_resolutions
+		WHERE created_at >= ?
+		GROUP BY day
+		ORDER BY day`,
+		sourceClient, sourceClient, sourceClient, sourceClient, sourceClient, sourceClient, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d DailyVolume
+		var avg float64
+		if err := rows.Scan(&d.Date, &d.Total, &d.Found, &d.NotFound, &d.Errors, &d.Client, &d.Server, &avg); err != nil {
+			return nil, err
+		}
+		d.AvgLatencyMs = int64(avg + 0.5)
+		stats.Total += d.Total
+		stats.Daily = append(stats.Daily, d)
+	}
+	return stats, rows.Err()
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// APIKeyHeader 携带API密钥的请求头，也可以使用 api_key 查询参数
+const APIKeyHeader = "X-API-Key"
+
+// APIKey 静态API密钥
+type APIKey struct {
+	Name   string   `mapstructure:"name"`
+	Key    string   `mapstructure:"key"`
+	Groups []string `mapstructure:"groups"`
+}
+
+// APIKeys 静态API密钥认证
+type APIKeys struct {
+	// 以密钥的 SHA-256 为键，查找耗时与密钥内容无关
+	keys map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeys 创建API密钥认证
+func NewAPIKeys(keys []APIKey) (*APIKeys, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("需要配置 api_keys")
+	}
+	a := &APIKeys{keys: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for i, k := range keys {
+		if k.Key == "" || k.Name == "" {
+			return nil, fmt.Errorf("api_keys 第 %d 项需要配置 name 和 key", i+1)
+		}
+		sum := sha256.Sum256([]byte(k.Key))
+		if _, dup := a.keys[sum]; dup {
+			return nil, fmt.Errorf("api_keys 中的密钥重复: %s", k.Name)
+		}
+		a.keys[sum] = &Principal{Name: k.Name, Groups: k.Groups, Method: MethodAPIKey}
+	}
+	return a, nil
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return nil, nil
+	}
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return p, nil
+}
+
+func (a *APIKeys) Challenge(w http.ResponseWriter) {}
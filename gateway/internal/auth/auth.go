@@ -0,0 +1,270 @@
+// Package auth 网关的认证与授权
+//
+// 认证方式以 Authenticator 的形式插入中间件，按配置顺序尝试：静态API密钥、
+// 基于用户文件的 HTTP Basic 认证、受信任反向代理传入的用户头、TLS 客户端证书。认证得到的
+// 身份按授权规则换算成 backend.Scope，限制调用方可以解析到的后端和
+// Kodbox 目录。
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+// 认证方式
+const (
+	MethodAPIKey     = "api_key"
+	MethodBasic      = "basic"
+	MethodProxy      = "proxy"
+	MethodClientCert = "client_cert"
+)
+
+// AnonymousUser 允许匿名访问时未携带凭据的请求使用的用户名
+const AnonymousUser = "anonymous"
+
+// ErrInvalidCredentials 请求携带了凭据但校验失败
+var ErrInvalidCredentials = errors.New("认证失败")
+
+// Principal 认证得到的调用方身份
+type Principal struct {
+	Name   string
+	Groups []string
+	Method string
+}
+
+// Authenticator 一种认证方式
+type Authenticator interface {
+	// Authenticate 返回请求的身份；请求未携带该方式的凭据时返回 nil, nil，
+	// 凭据错误时返回 ErrInvalidCredentials
+	Authenticate(r *http.Request) (*Principal, error)
+	// Challenge 在返回 401 前写入该方式的响应头，如 WWW-Authenticate
+	Challenge(w http.ResponseWriter)
+}
+
+// Config 认证配置
+type Config struct {
+	// Methods 启用的认证方式，按顺序尝试；为空时不启用认证
+	Methods        []string    `mapstructure:"methods"`
+	AllowAnonymous bool        `mapstructure:"allow_anonymous"`
+	APIKeys        []APIKey    `mapstructure:"api_keys"`
+	UsersFile      string      `mapstructure:"users_file"`
+	Realm          string      `mapstructure:"realm"`
+	Proxy          ProxyConfig `mapstructure:"proxy"`
+	Rules          []Rule      `mapstructure:"rules"`
+}
+
+// Rule 授权规则
+//
+// Users 与 Groups 任一匹配即适用；两者都为空时适用于所有已认证的调用方
+// （不含匿名）。调用方的范围为所有适用规则按后端取的并集；配置了规则但没有
+// 适用的规则时拒绝访问，未配置规则时不限制。
+type Rule struct {
+	Users         []string `mapstructure:"users"`
+	Groups        []string `mapstructure:"groups"`
+	Backends      []string `mapstructure:"backends"`       // 为空表示全部后端
+	KodboxSources []int    `mapstructure:"kodbox_sources"` // 为空表示全部目录
+}
+
+func (r Rule) matches(p *Principal) bool {
+	if len(r.Users) == 0 && len(r.Groups) == 0 {
+		return p.Name != AnonymousUser
+	}
+	for _, u := range r.Users {
+		if u == p.Name {
+			return true
+		}
+	}
+	for _, g := range r.Groups {
+		for _, pg := range p.Groups {
+			if g == pg {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Auth 认证中间件及授权规则
+type Auth struct {
+	authenticators []Authenticator
+	anonymous      bool
+	rules          []Rule
+}
+
+// New 根据配置创建认证中间件
+func New(cfg Config) (*Auth, error) {
+	a := &Auth{anonymous: cfg.AllowAnonymous, rules: cfg.Rules}
+	for _, method := range cfg.Methods {
+		var authn Authenticator
+		var err error
+		switch method {
+		case MethodAPIKey:
+			authn, err = NewAPIKeys(cfg.APIKeys)
+		case MethodBasic:
+			authn, err = NewBasic(cfg.UsersFile, cfg.Realm)
+		case MethodProxy:
+			authn, err = NewProxy(cfg.Proxy)
+		case MethodClientCert:
+			authn = ClientCert{}
+		default:
+			err = errors.New("未知的认证方式")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", method, err)
+		}
+		a.authenticators = append(a.authenticators, authn)
+	}
+	return a, nil
+}
+
+// sourceSet 一个后端允许的 Kodbox 目录，all 表示全部目录
+type sourceSet struct {
+	all bool
+	ids []int
+}
+
+func (s *sourceSet) add(ids []int) {
+	if s.all {
+		return
+	}
+	if len(ids) == 0 {
+		s.all, s.ids = true, nil
+		return
+	}
+	for _, id := range ids {
+		if !slices.Contains(s.ids, id) {
+			s.ids = append(s.ids, id)
+		}
+	}
+}
+
+// Scope 按授权规则计算调用方的解析范围，没有适用的规则时返回 false
+//
+// 每条规则的目录只作用于该规则的后端，并集按后端分别计算：规则 A 允许
+// kodbox-a 的目录 5、规则 B 允许 kodbox-b 的全部目录时，kodbox-a 仍只
+// 允许目录 5。不限后端的规则的目录并入每个后端。
+func (a *Auth) Scope(p *Principal) (backend.Scope, bool) {
+	if len(a.rules) == 0 {
+		return backend.Scope{}, true
+	}
+	var (
+		matched  bool
+		wildcard *sourceSet // 不限后端的规则的目录，没有这类规则时为 nil
+		names    []string   // 规则列出的后端，按出现顺序
+	)
+	perBackend := make(map[string]*sourceSet)
+	for _, rule := range a.rules {
+		if !rule.matches(p) {
+			continue
+		}
+		matched = true
+		if len(rule.Backends) == 0 {
+			if wildcard == nil {
+				wildcard = &sourceSet{}
+			}
+			wildcard.add(rule.KodboxSources)
+			continue
+		}
+		for _, b := range rule.Backends {
+			set, ok := perBackend[b]
+			if !ok {
+				set = &sourceSet{}
+				perBackend[b] = set
+				names = append(names, b)
+			}
+			set.add(rule.KodboxSources)
+		}
+	}
+
+	var scope backend.Scope
+	if wildcard == nil {
+		scope.Backends = names
+	} else {
+		if wildcard.all {
+			// 所有后端的全部目录
+			return scope, matched
+		}
+		scope.KodboxSources = wildcard.ids
+	}
+	for _, b := range names {
+		set := perBackend[b]
+		if wildcard != nil {
+			set.add(wildcard.ids)
+		}
+		if wildcard == nil && set.all {
+			continue // 不在表中时使用 KodboxSources，即全部目录
+		}
+		if scope.BackendSources == nil {
+			scope.BackendSources = make(map[string][]int)
+		}
+		scope.BackendSources[b] = set.ids
+	}
+	return scope, matched
+}
+
+// Middleware 认证请求并把身份和解析范围写入请求的 ctx
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(r)
+		if err != nil {
+			if !errors.Is(err, ErrInvalidCredentials) {
+				log.Printf("认证出错: %v", err)
+			}
+			a.challenge(w)
+			return
+		}
+		if p == nil {
+			if !a.anonymous {
+				a.challenge(w)
+				return
+			}
+			p = &Principal{Name: AnonymousUser}
+		}
+
+		scope, ok := a.Scope(p)
+		if !ok {
+			http.Error(w, "禁止访问", http.StatusForbidden)
+			return
+		}
+		ctx := WithPrincipal(r.Context(), p)
+		ctx = backend.WithScope(ctx, scope)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate 依次尝试各认证方式，返回第一个携带了凭据的方式的结果
+func (a *Auth) authenticate(r *http.Request) (*Principal, error) {
+	for _, authn := range a.authenticators {
+		p, err := authn.Authenticate(r)
+		if err != nil || p != nil {
+			return p, err
+		}
+	}
+	return nil, nil
+}
+
+func (a *Auth) challenge(w http.ResponseWriter) {
+	for _, authn := range a.authenticators {
+		authn.Challenge(w)
+	}
+	http.Error(w, "未授权", http.StatusUnauthorized)
+}
+
+type principalKey struct{}
+
+// WithPrincipal 返回携带调用方身份的 ctx
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom 返回 ctx 中的调用方身份，未认证时为 nil
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
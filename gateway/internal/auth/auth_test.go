@@ -0,0 +1,250 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+func writeUsersFile(t *testing.T) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "users")
+	content := "# 测试用户\n\nalice:" + string(hash) + ":staff, ops\nbob:" + string(hash) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// serve 通过中间件处理请求，返回状态码和处理器看到的身份与范围
+func serve(a *Auth, r *http.Request) (int, *Principal, backend.Scope) {
+	var p *Principal
+	var scope backend.Scope
+	h := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p = PrincipalFrom(r.Context())
+		scope = backend.ScopeFrom(r.Context())
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, p, scope
+}
+
+func TestMiddleware(t *testing.T) {
+	a, err := New(Config{
+		Methods:   []string{MethodAPIKey, MethodBasic, MethodProxy},
+		APIKeys:   []APIKey{{Name: "ci", Key: "k-123", Groups: []string{"ops"}}},
+		UsersFile: writeUsersFile(t),
+		Proxy:     ProxyConfig{TrustedProxies: []string{"10.0.0.0/8", "127.0.0.1"}},
+		Rules: []Rule{
+			{Groups: []string{"ops"}, Backends: []string{"kodbox"}, KodboxSources: []int{5}},
+			{Users: []string{"alice"}, KodboxSources: []int{9}},
+			{Users: []string{"carol"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 无凭据
+	r := httptest.NewRequest("GET", "/api/md5", nil)
+	w := httptest.NewRecorder()
+	a.Middleware(http.NotFoundHandler()).ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Fatalf("no credentials: code = %d, header = %v", w.Code, w.Header())
+	}
+
+	// API 密钥：请求头与查询参数
+	r = httptest.NewRequest("GET", "/api/md5", nil)
+	r.Header.Set(APIKeyHeader, "k-123")
+	code, p, scope := serve(a, r)
+	if code != http.StatusOK || p.Name != "ci" || p.Method != MethodAPIKey {
+		t.Fatalf("api key: code = %d, principal = %+v", code, p)
+	}
+	if !reflect.DeepEqual(scope, backend.Scope{Backends: []string{"kodbox"}, BackendSources: map[string][]int{"kodbox": {5}}}) {
+		t.Fatalf("api key scope = %+v", scope)
+	}
+	if code, _, _ := serve(a, httptest.NewRequest("GET", "/api/md5?api_key=wrong", nil)); code != http.StatusUnauthorized {
+		t.Fatalf("wrong api key: code = %d", code)
+	}
+
+	// Basic：alice 同时适用两条规则，范围按后端取并集
+	r = httptest.NewRequest("GET", "/md5", nil)
+	r.SetBasicAuth("alice", "secret")
+	code, p, scope = serve(a, r)
+	if code != http.StatusOK || p.Name != "alice" || !reflect.DeepEqual(p.Groups, []string{"staff", "ops"}) {
+		t.Fatalf("basic: code = %d, principal = %+v", code, p)
+	}
+	if !reflect.DeepEqual(scope, backend.Scope{KodboxSources: []int{9}, BackendSources: map[string][]int{"kodbox": {5, 9}}}) {
+		t.Fatalf("basic scope = %+v", scope)
+	}
+	r = httptest.NewRequest("GET", "/md5", nil)
+	r.SetBasicAuth("alice", "wrong")
+	if code, _, _ := serve(a, r); code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: code = %d", code)
+	}
+
+	// bob 认证成功但没有适用的规则
+	r = httptest.NewRequest("GET", "/md5", nil)
+	r.SetBasicAuth("bob", "secret")
+	if code, _, _ := serve(a, r); code != http.StatusForbidden {
+		t.Fatalf("no rule: code = %d, want 403", code)
+	}
+
+	// 反向代理：只采信受信任地址传入的用户头
+	r = httptest.NewRequest("GET", "/md5", nil)
+	r.RemoteAddr = "10.1.2.3:5555"
+	r.Header.Set(DefaultUserHeader, "carol")
+	code, p, scope = serve(a, r)
+	if code != http.StatusOK || p.Name != "carol" || p.Method != MethodProxy || !reflect.DeepEqual(scope, backend.Scope{}) {
+		t.Fatalf("proxy: code = %d, principal = %+v, scope = %+v", code, p, scope)
+	}
+	r.RemoteAddr = "192.168.1.2:5555"
+	if code, _, _ := serve(a, r); code != http.StatusUnauthorized {
+		t.Fatalf("untrusted proxy: code = %d", code)
+	}
+}
+
+func TestAnonymous(t *testing.T) {
+	a, err := New(Config{
+		Methods:        []string{MethodAPIKey},
+		AllowAnonymous: true,
+		APIKeys:        []APIKey{{Name: "ci", Key: "k-123"}},
+		Rules: []Rule{
+			{Users: []string{AnonymousUser}, Backends: []string{"index"}},
+			{},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, p, scope := serve(a, httptest.NewRequest("GET", "/md5", nil))
+	if code != http.StatusOK || p.Name != AnonymousUser || !reflect.DeepEqual(scope.Backends, []string{"index"}) {
+		t.Fatalf("anonymous: code = %d, principal = %+v, scope = %+v", code, p, scope)
+	}
+
+	// 空规则适用于所有已认证的调用方，不限制范围
+	r := httptest.NewRequest("GET", "/md5", nil)
+	r.Header.Set(APIKeyHeader, "k-123")
+	if code, _, scope := serve(a, r); code != http.StatusOK || !reflect.DeepEqual(scope, backend.Scope{}) {
+		t.Fatalf("authenticated: code = %d, scope = %+v", code, scope)
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	a, err := New(Config{
+		Methods: []string{MethodClientCert},
+		Rules:   []Rule{{Groups: []string{"ops"}, Backends: []string{"index"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 未启用 TLS 或未携带证书
+	if code, _, _ := serve(a, httptest.NewRequest("GET", "/md5", nil)); code != http.StatusUnauthorized {
+		t.Fatalf("no certificate: code = %d", code)
+	}
+
+	r := httptest.NewRequest("GET", "/md5", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{
+		Subject: pkix.Name{CommonName: "indexer", OrganizationalUnit: []string{"ops"}},
+	}}}}
+	code, p, scope := serve(a, r)
+	if code != http.StatusOK || p.Name != "indexer" || p.Method != MethodClientCert || !reflect.DeepEqual(scope.Backends, []string{"index"}) {
+		t.Fatalf("client cert: code = %d, principal = %+v, scope = %+v", code, p, scope)
+	}
+}
+
+func TestScopeMixedRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+		want  backend.Scope
+	}{
+		{
+			// 规则 B 不限目录只作用于 kodbox-b，kodbox-a 仍只允许目录 5
+			name: "per backend",
+			rules: []Rule{
+				{Backends: []string{"kodbox-a"}, KodboxSources: []int{5}},
+				{Backends: []string{"kodbox-b"}},
+			},
+			want: backend.Scope{Backends: []string{"kodbox-a", "kodbox-b"}, BackendSources: map[string][]int{"kodbox-a": {5}}},
+		},
+		{
+			name: "different sources",
+			rules: []Rule{
+				{Backends: []string{"kodbox-a"}, KodboxSources: []int{5}},
+				{Backends: []string{"kodbox-b", "kodbox-a"}, KodboxSources: []int{9}},
+			},
+			want: backend.Scope{Backends: []string{"kodbox-a", "kodbox-b"}, BackendSources: map[string][]int{"kodbox-a": {5, 9}, "kodbox-b": {9}}},
+		},
+		{
+			// 不限后端的规则并入每个后端，列出的后端不限目录时覆盖默认值
+			name: "wildcard",
+			rules: []Rule{
+				{KodboxSources: []int{1}},
+				{Backends: []string{"kodbox-a"}, KodboxSources: []int{5}},
+				{Backends: []string{"kodbox-b"}},
+			},
+			want: backend.Scope{KodboxSources: []int{1}, BackendSources: map[string][]int{"kodbox-a": {5, 1}, "kodbox-b": nil}},
+		},
+		{
+			name: "unrestricted",
+			rules: []Rule{
+				{Backends: []string{"kodbox-a"}, KodboxSources: []int{5}},
+				{},
+			},
+			want: backend.Scope{},
+		},
+	}
+	for _, tt := range tests {
+		a, err := New(Config{Rules: tt.rules})
+		if err != nil {
+			t.Fatal(err)
+		}
+		scope, ok := a.Scope(&Principal{Name: "alice"})
+		if !ok || !reflect.DeepEqual(scope, tt.want) {
+			t.Errorf("%s: scope = %+v, want %+v", tt.name, scope, tt.want)
+		}
+		// 按后端取得的目录
+		for name, want := range tt.want.BackendSources {
+			if got := scope.SourcesFor(name); !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: SourcesFor(%s) = %v, want %v", tt.name, name, got, want)
+			}
+		}
+	}
+	a, _ := New(Config{Rules: []Rule{{Backends: []string{"kodbox-a"}, KodboxSources: []int{5}}, {Backends: []string{"kodbox-b"}}}})
+	scope, _ := a.Scope(&Principal{Name: "alice"})
+	if got := scope.SourcesFor("kodbox-b"); got != nil {
+		t.Errorf("SourcesFor(kodbox-b) = %v, want all", got)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"unknown method": {Methods: []string{"ldap"}},
+		"no api keys":    {Methods: []string{MethodAPIKey}},
+		"no users file":  {Methods: []string{MethodBasic}},
+		"no proxies":     {Methods: []string{MethodProxy}},
+		"invalid proxy":  {Methods: []string{MethodProxy}, Proxy: ProxyConfig{TrustedProxies: []string{"example.com"}}},
+		"duplicate key":  {Methods: []string{MethodAPIKey}, APIKeys: []APIKey{{Name: "a", Key: "k"}, {Name: "b", Key: "k"}}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultRealm Basic 认证的默认 realm
+const DefaultRealm = "smart-finder"
+
+// reloadCheckInterval 检查用户文件是否变化的最短间隔
+const reloadCheckInterval = 5 * time.Second
+
+type basicUser struct {
+	hash   []byte
+	groups []string
+}
+
+// Basic 基于用户文件的 HTTP Basic 认证
+//
+// 用户文件每行一个用户，格式为 "用户名:bcrypt哈希[:组1,组2]"，可用
+// htpasswd -nbB 生成前两段；空行和 # 开头的行被忽略。文件修改后自动重新加载。
+type Basic struct {
+	path  string
+	realm string
+
+	mu        sync.RWMutex
+	users     map[string]basicUser
+	modTime   time.Time
+	checkedAt time.Time
+	// verified 校验通过的密码的 SHA-256，避免每个请求都计算 bcrypt
+	verified map[string][sha256.Size]byte
+}
+
+// NewBasic 加载用户文件并创建 Basic 认证
+func NewBasic(path, realm string) (*Basic, error) {
+	if path == "" {
+		return nil, errors.New("需要配置 users_file")
+	}
+	if realm == "" {
+		realm = DefaultRealm
+	}
+	b := &Basic{path: path, realm: realm}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *Basic) Authenticate(r *http.Request) (*Principal, error) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	b.reloadIfChanged()
+
+	b.mu.RLock()
+	user, exists := b.users[name]
+	cached, isCached := b.verified[name]
+	b.mu.RUnlock()
+	if !exists {
+		return nil, ErrInvalidCredentials
+	}
+
+	sum := sha256.Sum256([]byte(password))
+	if !isCached || subtle.ConstantTimeCompare(sum[:], cached[:]) != 1 {
+		if bcrypt.CompareHashAndPassword(user.hash, []byte(password)) != nil {
+			return nil, ErrInvalidCredentials
+		}
+		b.mu.Lock()
+		b.verified[name] = sum
+		b.mu.Unlock()
+	}
+	return &Principal{Name: name, Groups: user.groups, Method: MethodBasic}, nil
+}
+
+func (b *Basic) Challenge(w http.ResponseWriter) {
+	w.Header().Add("WWW-Authenticate", `Basic realm="`+b.realm+`", charset="UTF-8"`)
+}
+
+// reloadIfChanged 用户文件修改后重新加载，加载失败时保留原有用户
+func (b *Basic) reloadIfChanged() {
+	b.mu.RLock()
+	recent := time.Since(b.checkedAt) < reloadCheckInterval
+	b.mu.RUnlock()
+	if recent {
+		return
+	}
+
+	info, err := os.Stat(b.path)
+	b.mu.Lock()
+	b.checkedAt = time.Now()
+	changed := err == nil && !info.ModTime().Equal(b.modTime)
+	b.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := b.load(); err != nil {
+		log.Printf("重新加载用户文件失败: %v", err)
+		return
+	}
+	log.Printf("已重新加载用户文件 %s", b.path)
+}
+
+func (b *Basic) load() error {
+	f, err := os.Open(b.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	users := make(map[string]basicUser)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 3)
+		if len(parts) < 2 || parts[0] == "" {
+			return fmt.Errorf("%s 第 %d 行格式错误", b.path, line)
+		}
+		if _, err := bcrypt.Cost([]byte(parts[1])); err != nil {
+			return fmt.Errorf("%s 第 %d 行: 只支持 bcrypt 哈希", b.path, line)
+		}
+		user := basicUser{hash: []byte(parts[1])}
+		if len(parts) == 3 && parts[2] != "" {
+			for _, g := range strings.Split(parts[2], ",") {
+				if g = strings.TrimSpace(g); g != "" {
+					user.groups = append(user.groups, g)
+				}
+			}
+		}
+		users[parts[0]] = user
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.users = users
+	b.modTime = info.ModTime()
+	b.checkedAt = time.Now()
+	b.verified = make(map[string][sha256.Size]byte)
+	b.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,25 @@
+package auth
+
+import (
+	"net/http"
+)
+
+// ClientCert 使用 TLS 握手时已校验的客户端证书（mTLS）认证
+//
+// 证书由 server.tls.client_ca_file 签发并在握手时校验，用户名取证书的
+// Common Name，组取 Organizational Unit。未启用 TLS 或客户端未携带证书时
+// 视为未携带凭据。
+type ClientCert struct{}
+
+func (ClientCert) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	if subject.CommonName == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return &Principal{Name: subject.CommonName, Groups: subject.OrganizationalUnit, Method: MethodClientCert}, nil
+}
+
+func (ClientCert) Challenge(w http.ResponseWriter) {}
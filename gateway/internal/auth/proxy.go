@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// 反向代理传入身份的默认请求头
+const (
+	DefaultUserHeader   = "X-Forwarded-User"
+	DefaultGroupsHeader = "X-Forwarded-Groups"
+)
+
+// ProxyConfig 受信任反向代理的配置
+type ProxyConfig struct {
+	UserHeader     string   `mapstructure:"user_header"`
+	GroupsHeader   string   `mapstructure:"groups_header"`   // 逗号分隔的组名
+	TrustedProxies []string `mapstructure:"trusted_proxies"` // IP 或 CIDR
+}
+
+// Proxy 信任反向代理（如 oauth2-proxy、Authelia）传入的用户头
+//
+// 只有来自 trusted_proxies 的连接携带的用户头才会被采信，其他来源的
+// 同名请求头被忽略，视为未携带凭据。
+type Proxy struct {
+	userHeader   string
+	groupsHeader string
+	trusted      []netip.Prefix
+}
+
+// NewProxy 创建反向代理认证
+func NewProxy(cfg ProxyConfig) (*Proxy, error) {
+	if len(cfg.TrustedProxies) == 0 {
+		return nil, errors.New("需要配置 proxy.trusted_proxies")
+	}
+	p := &Proxy{userHeader: cfg.UserHeader, groupsHeader: cfg.GroupsHeader}
+	if p.userHeader == "" {
+		p.userHeader = DefaultUserHeader
+	}
+	if p.groupsHeader == "" {
+		p.groupsHeader = DefaultGroupsHeader
+	}
+	for _, s := range cfg.TrustedProxies {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(s)
+			if addrErr != nil {
+				return nil, fmt.Errorf("无效的 trusted_proxies: %s", s)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		p.trusted = append(p.trusted, prefix.Masked())
+	}
+	return p, nil
+}
+
+func (p *Proxy) Authenticate(r *http.Request) (*Principal, error) {
+	user := strings.TrimSpace(r.Header.Get(p.userHeader))
+	if user == "" || !p.isTrusted(r.RemoteAddr) {
+		return nil, nil
+	}
+	principal := &Principal{Name: user, Method: MethodProxy}
+	for _, g := range strings.Split(r.Header.Get(p.groupsHeader), ",") {
+		if g = strings.TrimSpace(g); g != "" {
+			principal.Groups = append(principal.Groups, g)
+		}
+	}
+	return principal, nil
+}
+
+func (p *Proxy) Challenge(w http.ResponseWriter) {}
+
+func (p *Proxy) isTrusted(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range p.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+// Package backend 定义网关的哈希解析后端
+//
+// 每个后端根据MD5哈希查找文件并给出重定向地址，网关按配置的顺序依次
+// 查询，第一个找到文件的后端给出结果。实现了 Opener 的后端还可以直接
+// 读取文件内容，供网关以流式模式提供文件。
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"smart-finder/shared/types"
+)
+
+var (
+	// ErrNotFound 后端中不存在该哈希对应的文件
+	ErrNotFound = errors.New("文件不存在")
+	// ErrNotSupported 后端不支持直接读取文件内容
+	ErrNotSupported = errors.New("后端不支持直接读取文件内容")
+)
+
+// 后端类型
+const (
+	TypeKodbox   = "kodbox"
+	TypeLocal    = "local"
+	TypeS3       = "s3"
+	TypeIndex    = "index"
+	TypeRegistry = "registry"
+)
+
+// Result 哈希解析结果，与 /api/resolve 返回的位置结构相同
+type Result = types.Location
+
+// Backend 哈希解析后端
+type Backend interface {
+	// Name 配置中的后端名称
+	Name() string
+	// Type 后端类型
+	Type() string
+	// Lookup 查找哈希对应的文件，不存在时返回 ErrNotFound
+	Lookup(ctx context.Context, hash string) (*Result, error)
+}
+
+// BatchLookuper 可以一次查询多个哈希的后端
+type BatchLookuper interface {
+	// LookupMany 查找多个哈希对应的所有文件，hashes 为小写且不重复，
+	// 未找到的哈希不出现在结果中
+	LookupMany(ctx context.Context, hashes []string) (map[string][]*Result, error)
+}
+
+// URLExpirer 结果中的地址有有效期的后端（如 S3 预签名地址），
+// 缓存结果的时间不能超过该有效期
+type URLExpirer interface {
+	// URLExpiry 返回结果地址的有效期，0 表示不过期
+	URLExpiry() time.Duration
+}
+
+// Pinger 可以检查连接状态的后端，用于就绪检查
+type Pinger interface {
+	// Ping 检查后端当前是否可用
+	Ping(ctx context.Context) error
+}
+
+// Content 可直接读取的文件内容
+type Content struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time // 未知时为零值
+}
+
+// Opener 可以直接读取文件内容的后端
+type Opener interface {
+	// Open 打开 Lookup 返回的文件
+	Open(ctx context.Context, res *Result) (*Content, error)
+}
+
+// Config 单个后端的配置
+type Config struct {
+	Type string `mapstructure:"type"`
+	Name string `mapstructure:"name"`
+
+	// local、s3：重新建立索引的间隔
+	RescanInterval time.Duration `mapstructure:"rescan_interval"`
+
+	// local
+	Root    string `mapstructure:"root"`
+	BaseURL string `mapstructure:"base_url"`
+
+	// kodbox：各项省略时使用顶层的 database 连接与 kodbox 配置，用于
+	// 各部门分别部署 Kodbox 的情况
+	Database string            `mapstructure:"database"` // 顶层 databases 中的连接名称
+	Domain   string            `mapstructure:"domain"`
+	DataPath string            `mapstructure:"data_path"`
+	IOPaths  map[string]string `mapstructure:"io_paths"`
+
+	// s3
+	Endpoint      string        `mapstructure:"endpoint"`
+	Region        string        `mapstructure:"region"`
+	Bucket        string        `mapstructure:"bucket"`
+	AccessKey     string        `mapstructure:"access_key"`
+	SecretKey     string        `mapstructure:"secret_key"`
+	Prefix        string        `mapstructure:"prefix"`
+	KeyTemplate   string        `mapstructure:"key_template"`
+	PresignExpiry time.Duration `mapstructure:"presign_expiry"`
+}
+
+// DisplayName 返回后端名称，未配置时使用类型名
+func (c Config) DisplayName() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return c.Type
+}
+
+// 查询操作，用于 Observer
+const (
+	OpLookup     = "lookup"
+	OpLookupMany = "lookup_many"
+)
+
+// Observer 每次查询后端后调用，用于记录耗时
+type Observer func(name, op string, d time.Duration, err error)
+
+// Chain 按顺序查询的后端列表
+type Chain struct {
+	backends []Backend
+	observe  Observer
+	parallel bool
+}
+
+// NewChain 创建后端链，查询顺序即参数顺序
+func NewChain(backends ...Backend) *Chain {
+	return &Chain{backends: backends}
+}
+
+// SetObserver 设置查询观察函数，需在开始查询前调用
+func (c *Chain) SetObserver(fn Observer) {
+	c.observe = fn
+}
+
+// SetParallel 设置为同时查询所有后端，需在开始查询前调用
+//
+// 并行查询只降低延迟，不改变结果：仍使用顺序最靠前的找到文件的后端，
+// 排在前面的后端都返回后才采用后面的结果。
+func (c *Chain) SetParallel(parallel bool) {
+	c.parallel = parallel
+}
+
+// lookup 查询单个后端并通知观察函数
+func (c *Chain) lookup(ctx context.Context, b Backend, hash string) (*Result, error) {
+	start := time.Now()
+	res, err := b.Lookup(ctx, hash)
+	if c.observe != nil {
+		c.observe(b.Name(), OpLookup, time.Since(start), err)
+	}
+	return res, err
+}
+
+// Backends 返回链中的后端
+func (c *Chain) Backends() []Backend {
+	return c.backends
+}
+
+// allowed 返回 scope 允许查询的后端，保持原有顺序
+func (c *Chain) allowed(scope Scope) []Backend {
+	var backends []Backend
+	for _, b := range c.backends {
+		if scope.AllowsBackend(b.Name()) {
+			backends = append(backends, b)
+		}
+	}
+	return backends
+}
+
+type lookupOutcome struct {
+	res *Result
+	err error
+}
+
+// Lookup 依次查询各后端，返回第一个找到的结果
+//
+// 某个后端出错时记录日志并继续查询下一个；所有后端都未找到时返回
+// ErrNotFound，有后端出错且其余都未找到时返回错误，避免把故障当作不存在。
+// ctx 中的 Scope 不允许的后端会被跳过。
+func (c *Chain) Lookup(ctx context.Context, hash string) (*Result, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // 并行查询时取消已不需要的查询
+
+	backends := c.allowed(ScopeFrom(ctx))
+	results := make([]func() (*Result, error), len(backends))
+	for i, b := range backends {
+		if c.parallel {
+			ch := make(chan lookupOutcome, 1)
+			go func() {
+				res, err := c.lookup(ctx, b, hash)
+				ch <- lookupOutcome{res, err}
+			}()
+			results[i] = func() (*Result, error) {
+				o := <-ch
+				return o.res, o.err
+			}
+		} else {
+			results[i] = func() (*Result, error) { return c.lookup(ctx, b, hash) }
+		}
+	}
+
+	var errs []string
+	for i, b := range backends {
+		res, err := results[i]()
+		if err == nil {
+			return res, nil
+		}
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		log.Printf("后端 %s 查询失败: %v", b.Name(), err)
+		errs = append(errs, b.Name()+": "+err.Error())
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("后端查询失败: %s", strings.Join(errs, "; "))
+	}
+	return nil, ErrNotFound
+}
+
+// Open 通过给出结果的后端读取文件内容，后端未实现 Opener 时返回 ErrNotSupported
+func (c *Chain) Open(ctx context.Context, res *Result) (*Content, error) {
+	for _, b := range c.backends {
+		if b.Name() != res.Backend {
+			continue
+		}
+		if opener, ok := b.(Opener); ok {
+			return opener.Open(ctx, res)
+		}
+		break
+	}
+	return nil, ErrNotSupported
+}
+
+// LookupMany 依次查询各后端，每个哈希使用第一个找到它的后端的结果
+//
+// 实现了 BatchLookuper 的后端一次查询所有尚未找到的哈希，其他后端逐个
+// 查询。与 Lookup 相同，后端出错时继续查询下一个；最终仍未找到且有后端
+// 出错的哈希出现在 failed 中，其余未找到的哈希两个结果中都没有。并行
+// 查询时每个后端查询全部哈希。
+func (c *Chain) LookupMany(ctx context.Context, hashes []string) (found map[string][]*Result, failed map[string]error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	found = make(map[string][]*Result)
+	failed = make(map[string]error)
+	backends := c.allowed(ScopeFrom(ctx))
+
+	var outcomes []chan batchOutcome
+	if c.parallel {
+		for _, b := range backends {
+			ch := make(chan batchOutcome, 1)
+			go func() { ch <- c.lookupAll(ctx, b, hashes) }()
+			outcomes = append(outcomes, ch)
+		}
+	}
+
+	pending := hashes
+	for i, b := range backends {
+		if len(pending) == 0 {
+			break
+		}
+		var o batchOutcome
+		if c.parallel {
+			o = <-outcomes[i]
+		} else {
+			o = c.lookupAll(ctx, b, pending)
+		}
+
+		next := pending[:0:0]
+		for _, hash := range pending {
+			if res, ok := o.found[hash]; ok {
+				found[hash] = res
+				delete(failed, hash)
+			} else {
+				if err, ok := o.failed[hash]; ok {
+					failed[hash] = err
+				}
+				next = append(next, hash)
+			}
+		}
+		pending = next
+	}
+	return found, failed
+}
+
+type batchOutcome struct {
+	found  map[string][]*Result
+	failed map[string]error
+}
+
+// lookupAll 在单个后端中查询 hashes
+func (c *Chain) lookupAll(ctx context.Context, b Backend, hashes []string) batchOutcome {
+	o := batchOutcome{found: make(map[string][]*Result), failed: make(map[string]error)}
+	if batch, ok := b.(BatchLookuper); ok {
+		start := time.Now()
+		results, err := batch.LookupMany(ctx, hashes)
+		if c.observe != nil {
+			c.observe(b.Name(), OpLookupMany, time.Since(start), err)
+		}
+		if err != nil {
+			log.Printf("后端 %s 批量查询失败: %v", b.Name(), err)
+			for _, hash := range hashes {
+				o.failed[hash] = fmt.Errorf("%s: %w", b.Name(), err)
+			}
+			return o
+		}
+		o.found = results
+		return o
+	}
+	for _, hash := range hashes {
+		res, err := c.lookup(ctx, b, hash)
+		if err == nil {
+			o.found[hash] = []*Result{res}
+		} else if !errors.Is(err, ErrNotFound) {
+			log.Printf("后端 %s 查询失败: %v", b.Name(), err)
+			o.failed[hash] = fmt.Errorf("%s: %w", b.Name(), err)
+		}
+	}
+	return o
+}
@@ -0,0 +1,330 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592" // md5("hello")
+
+type stubBackend struct {
+	name string
+	res  *Result
+	err  error
+}
+
+func (s stubBackend) Name() string { return s.name }
+
+func (s stubBackend) Type() string { return "stub" }
+
+func (s stubBackend) Lookup(ctx context.Context, hash string) (*Result, error) {
+	return s.res, s.err
+}
+
+func TestChainFallback(t *testing.T) {
+	found := &Result{Backend: "b", URL: "http://b/file"}
+	chain := NewChain(
+		stubBackend{name: "a", err: ErrNotFound},
+		stubBackend{name: "broken", err: errors.New("connection refused")},
+		stubBackend{name: "b", res: found},
+	)
+	res, err := chain.Lookup(context.Background(), helloMD5)
+	if err != nil || res != found {
+		t.Fatalf("Lookup = %v, %v; want result from b", res, err)
+	}
+
+	chain = NewChain(stubBackend{name: "a", err: ErrNotFound})
+	if _, err := chain.Lookup(context.Background(), helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("all not found: err = %v, want ErrNotFound", err)
+	}
+
+	chain = NewChain(stubBackend{name: "a", err: ErrNotFound}, stubBackend{name: "broken", err: errors.New("boom")})
+	if _, err := chain.Lookup(context.Background(), helloMD5); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("backend failure: err = %v, want non-NotFound error", err)
+	}
+
+	chain = NewChain(stubBackend{name: "a", res: &Result{Backend: "a"}}, stubBackend{name: "b", res: found})
+	ctx := WithScope(context.Background(), Scope{Backends: []string{"b"}})
+	if res, err := chain.Lookup(ctx, helloMD5); err != nil || res != found {
+		t.Fatalf("scoped Lookup = %v, %v; want result from b", res, err)
+	}
+}
+
+// slowBackend 延迟返回结果的测试后端，delay 为 0 时一直等到 ctx 取消
+type slowBackend struct {
+	stubBackend
+	delay time.Duration
+}
+
+func (s slowBackend) Lookup(ctx context.Context, hash string) (*Result, error) {
+	var wait <-chan time.Time
+	if s.delay > 0 {
+		wait = time.After(s.delay)
+	}
+	select {
+	case <-wait:
+		return s.res, s.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestChainParallel(t *testing.T) {
+	first := &Result{Backend: "a"}
+	second := &Result{Backend: "b"}
+
+	// 排在前面的后端较慢时仍使用它的结果；之后的后端不再等待
+	chain := NewChain(
+		slowBackend{stubBackend{name: "a", res: first}, 20 * time.Millisecond},
+		stubBackend{name: "b", res: second},
+		slowBackend{stubBackend: stubBackend{name: "hang"}},
+	)
+	chain.SetParallel(true)
+	if res, err := chain.Lookup(context.Background(), helloMD5); err != nil || res != first {
+		t.Fatalf("parallel Lookup = %v, %v; want result from a", res, err)
+	}
+
+	chain = NewChain(
+		slowBackend{stubBackend{name: "a", err: ErrNotFound}, 20 * time.Millisecond},
+		stubBackend{name: "b", res: second},
+	)
+	chain.SetParallel(true)
+	if res, err := chain.Lookup(context.Background(), helloMD5); err != nil || res != second {
+		t.Fatalf("parallel fallback = %v, %v; want result from b", res, err)
+	}
+
+	// 批量查询
+	const h1, h2 = "11111111111111111111111111111111", "22222222222222222222222222222222"
+	calls1, calls2 := 0, 0
+	chain = NewChain(
+		batchBackend{stubBackend: stubBackend{name: "a"}, calls: &calls1, found: map[string][]*Result{h1: {first}}},
+		batchBackend{stubBackend: stubBackend{name: "b"}, calls: &calls2, found: map[string][]*Result{h1: {second}, h2: {second}}},
+	)
+	chain.SetParallel(true)
+	found, failed := chain.LookupMany(context.Background(), []string{h1, h2})
+	if len(failed) != 0 || found[h1][0] != first || found[h2][0] != second {
+		t.Fatalf("parallel LookupMany = %v, %v", found, failed)
+	}
+}
+
+func TestScopeRoute(t *testing.T) {
+	chain := NewChain(stubBackend{name: "a", res: &Result{Backend: "a"}}, stubBackend{name: "b", res: &Result{Backend: "b"}})
+	ctx := WithScope(context.Background(), Scope{Route: []string{"b"}})
+	if res, err := chain.Lookup(ctx, helloMD5); err != nil || res.Backend != "b" {
+		t.Fatalf("routed Lookup = %v, %v; want result from b", res, err)
+	}
+
+	// 路由与授权范围没有交集时不查询任何后端
+	ctx = WithScope(context.Background(), Scope{Backends: []string{"a"}, Route: []string{"b"}})
+	if _, err := chain.Lookup(ctx, helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("disjoint route: err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestKodbox 使用 SQLite 代替 Kodbox 的 MySQL 数据库
+// batchBackend 实现了 BatchLookuper 的测试后端
+type batchBackend struct {
+	stubBackend
+	found map[string][]*Result
+	calls *int
+}
+
+func (b batchBackend) LookupMany(ctx context.Context, hashes []string) (map[string][]*Result, error) {
+	*b.calls++
+	if b.err != nil {
+		return nil, b.err
+	}
+	found := make(map[string][]*Result)
+	for _, hash := range hashes {
+		if res, ok := b.found[hash]; ok {
+			found[hash] = res
+		}
+	}
+	return found, nil
+}
+
+func TestChainLookupMany(t *testing.T) {
+	const (
+		h1 = "11111111111111111111111111111111"
+		h2 = "22222222222222222222222222222222"
+		h3 = "33333333333333333333333333333333"
+	)
+	calls := 0
+	first := batchBackend{stubBackend: stubBackend{name: "a"}, calls: &calls,
+		found: map[string][]*Result{h1: {{Backend: "a"}}}}
+	broken := batchBackend{stubBackend: stubBackend{name: "broken", err: errors.New("boom")}, calls: &calls}
+	single := stubBackend{name: "b", res: &Result{Backend: "b"}}
+
+	// h1 由 a 找到；broken 出错后 h2、h3 由逐个查询的 b 找到
+	found, failed := NewChain(first, broken, single).LookupMany(context.Background(), []string{h1, h2, h3})
+	if len(failed) != 0 || found[h1][0].Backend != "a" || found[h2][0].Backend != "b" || found[h3][0].Backend != "b" {
+		t.Fatalf("LookupMany = %v, %v", found, failed)
+	}
+	if calls != 2 {
+		t.Fatalf("batch calls = %d, want 2", calls)
+	}
+
+	// 最终未找到且有后端出错的哈希为失败
+	found, failed = NewChain(first, broken).LookupMany(context.Background(), []string{h1, h2})
+	if len(found) != 1 || failed[h2] == nil || failed[h1] != nil {
+		t.Fatalf("with failure: found = %v, failed = %v", found, failed)
+	}
+
+	// 限制后端
+	ctx := WithScope(context.Background(), Scope{Backends: []string{"b"}})
+	found, _ = NewChain(first, single).LookupMany(ctx, []string{h1})
+	if found[h1][0].Backend != "b" {
+		t.Fatalf("scoped LookupMany = %v", found)
+	}
+}
+
+func TestKodbox(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "kodbox.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE io_file (fileID INTEGER PRIMARY KEY, size INTEGER, hashMD5 TEXT, path TEXT);
+		CREATE TABLE io_source (sourceID INTEGER PRIMARY KEY, fileID INTEGER, name TEXT, parentLevel TEXT,
+			isDelete INTEGER DEFAULT 0, modifyTime INTEGER DEFAULT 0);
+		INSERT INTO io_file VALUES (7, 5, '` + helloMD5 + `', '/data/files/hello');
+		INSERT INTO io_source (sourceID, fileID, name, parentLevel, modifyTime) VALUES (42, 7, 'hello.txt', ',0,1,5,', 100);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := NewKodbox("kodbox", db, "http://kodbox.test", KodboxStorage{})
+	res, err := k.Lookup(context.Background(), helloMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != "http://kodbox.test/#explorer&sidf=42" || res.FileID != 7 || res.SourceID != 42 || res.Name != "hello.txt" {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if _, err := k.Lookup(context.Background(), "00000000000000000000000000000000"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing hash: err = %v, want ErrNotFound", err)
+	}
+
+	// 限制目录：文件位于目录 5 下，不在目录 9 下
+	ctx := WithScope(context.Background(), Scope{KodboxSources: []int{9, 5}})
+	if res, err := k.Lookup(ctx, helloMD5); err != nil || res.SourceID != 42 {
+		t.Fatalf("scoped lookup = %+v, %v; want source 42", res, err)
+	}
+	ctx = WithScope(context.Background(), Scope{KodboxSources: []int{9}})
+	if _, err := k.Lookup(ctx, helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("out of scope: err = %v, want ErrNotFound", err)
+	}
+	// 按后端单独限制的目录优先于默认目录
+	ctx = WithScope(context.Background(), Scope{KodboxSources: []int{9}, BackendSources: map[string][]int{"kodbox": {5}}})
+	if res, err := k.Lookup(ctx, helloMD5); err != nil || res.SourceID != 42 {
+		t.Fatalf("backend scoped lookup = %+v, %v; want source 42", res, err)
+	}
+	ctx = WithScope(context.Background(), Scope{KodboxSources: []int{5}, BackendSources: map[string][]int{"kodbox": {9}}})
+	if _, err := k.Lookup(ctx, helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("out of backend scope: err = %v, want ErrNotFound", err)
+	}
+
+	// 批量查询：同一文件的多个源都是位置
+	if _, err := db.Exec(`INSERT INTO io_source (sourceID, fileID, name, parentLevel, modifyTime) VALUES (43, 7, 'hello-copy.txt', ',0,9,', 200)`); err != nil {
+		t.Fatal(err)
+	}
+	found, err := k.LookupMany(context.Background(), []string{helloMD5, "00000000000000000000000000000000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || len(found[helloMD5]) != 2 || found[helloMD5][1].Name != "hello-copy.txt" || found[helloMD5][1].Size != 5 {
+		t.Fatalf("LookupMany = %+v", found)
+	}
+	found, err = k.LookupMany(ctx, []string{helloMD5})
+	if err != nil || len(found[helloMD5]) != 1 || found[helloMD5][0].SourceID != 43 {
+		t.Fatalf("scoped LookupMany = %+v, %v", found, err)
+	}
+
+	// 移入回收站的源视为不存在，并作为变化被报告
+	latest, err := k.LatestChange(context.Background())
+	if err != nil || latest != 200 {
+		t.Fatalf("LatestChange = %d, %v; want 200", latest, err)
+	}
+	if _, err := db.Exec(`UPDATE io_source SET isDelete = 1, modifyTime = 300 WHERE sourceID IN (42, 43)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Lookup(context.Background(), helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted source: err = %v, want ErrNotFound", err)
+	}
+	hashes, latest, err := k.ChangedSince(context.Background(), latest)
+	if err != nil || len(hashes) != 1 || hashes[0] != helloMD5 || latest != 300 {
+		t.Fatalf("ChangedSince = %v, %d, %v", hashes, latest, err)
+	}
+}
+
+func TestKodboxStorage(t *testing.T) {
+	storage := KodboxStorage{
+		DataPath: "/srv/kodbox/data/files",
+		IOPaths:  map[string]string{"1": "/mnt/disk1"},
+	}
+	tests := []struct {
+		path, want string
+	}{
+		{"{io:1}/202401/01/abc", "/mnt/disk1/202401/01/abc"},
+		{"202401/01/abc", "/srv/kodbox/data/files/202401/01/abc"},
+	}
+	for _, tt := range tests {
+		got, err := storage.resolve(tt.path)
+		if err != nil || got != filepath.FromSlash(tt.want) {
+			t.Errorf("resolve(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+		}
+	}
+	if _, err := storage.resolve("{io:2}/abc"); err == nil {
+		t.Error("resolve with unknown storage id: want error")
+	}
+}
+
+func TestLocal(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "docs", "hello world.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := NewLocal("nas", root, "http://files.test/share/", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Lookup(context.Background(), helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("before scan: err = %v, want ErrNotFound", err)
+	}
+	if err := l.Rescan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := l.Lookup(context.Background(), helloMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != "http://files.test/share/docs/hello%20world.txt" || res.Size != 5 {
+		t.Fatalf("unexpected result: %+v", res)
+	}
+
+	if err := os.Remove(filepath.Join(root, "docs", "hello world.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Rescan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := l.Lookup(context.Background(), helloMD5); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("after removal: err = %v, want ErrNotFound", err)
+	}
+}
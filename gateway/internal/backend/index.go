@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"smart-finder/gateway/internal/index"
+)
+
+// Index 查询网关自建索引的后端
+type Index struct {
+	name    string
+	indexer *index.Indexer
+}
+
+// NewIndex 创建基于网关索引的后端
+func NewIndex(name string, indexer *index.Indexer) *Index {
+	return &Index{name: name, indexer: indexer}
+}
+
+func (x *Index) Name() string { return x.name }
+
+func (x *Index) Type() string { return TypeIndex }
+
+// Lookup 在索引数据库中查找哈希，所属目录已不在配置中的记录视为不存在
+func (x *Index) Lookup(ctx context.Context, hash string) (*Result, error) {
+	f, err := x.indexer.Store().Lookup(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	res, ok := x.result(f)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return res, nil
+}
+
+// LookupMany 一次查询索引中的多个哈希
+func (x *Index) LookupMany(ctx context.Context, hashes []string) (map[string][]*Result, error) {
+	files, err := x.indexer.Store().LookupMany(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string][]*Result)
+	for i := range files {
+		if res, ok := x.result(&files[i]); ok {
+			found[files[i].MD5] = append(found[files[i].MD5], res)
+		}
+	}
+	return found, nil
+}
+
+// result 把索引记录转换为解析结果，所属目录已不在配置中时返回 false
+func (x *Index) result(f *index.File) (*Result, bool) {
+	root, ok := x.indexer.Root(f.Root)
+	if !ok {
+		return nil, false
+	}
+
+	res := &Result{
+		Backend: x.name,
+		Type:    TypeIndex,
+		Name:    path.Base(f.Path),
+		Size:    f.Size,
+		Path:    filepath.Join(root.Path, filepath.FromSlash(f.Path)),
+	}
+	if root.BaseURL != "" {
+		res.URL = strings.TrimRight(root.BaseURL, "/") + "/" + escapePath(f.Path)
+	}
+	return res, true
+}
+
+// Ping 检查索引数据库连接
+func (x *Index) Ping(ctx context.Context) error {
+	return x.indexer.Store().Ping(ctx)
+}
+
+// Open 打开索引中的本地文件
+func (x *Index) Open(ctx context.Context, res *Result) (*Content, error) {
+	return openFile(res.Path)
+}
@@ -0,0 +1,241 @@
+package backend
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// KodboxStorage Kodbox 文件在本机上的存储位置，用于直接读取文件内容
+//
+// io_file.path 形如 "{io:1}/202401/01/xxx"，其中 {io:N} 指向 Kodbox 的
+// 存储ID；也可能是绝对路径或相对 Kodbox 数据目录的路径。
+type KodboxStorage struct {
+	DataPath string            // 相对路径的根目录，一般为 Kodbox 的 data/files
+	IOPaths  map[string]string // 存储ID -> 本地目录
+}
+
+var kodboxIOPrefix = regexp.MustCompile(`^\{io:(\d+)\}[/\\]?`)
+
+// resolve 把 io_file.path 转换为本地路径
+func (s KodboxStorage) resolve(p string) (string, error) {
+	if m := kodboxIOPrefix.FindStringSubmatch(p); m != nil {
+		dir, ok := s.IOPaths[m[1]]
+		if !ok {
+			return "", fmt.Errorf("未配置存储 io:%s 的本地目录", m[1])
+		}
+		return filepath.Join(dir, filepath.FromSlash(p[len(m[0]):])), nil
+	}
+	if filepath.IsAbs(p) {
+		return p, nil
+	}
+	if s.DataPath == "" {
+		return "", fmt.Errorf("未配置 Kodbox 数据目录，无法定位 %s", p)
+	}
+	return filepath.Join(s.DataPath, filepath.FromSlash(p)), nil
+}
+
+// Kodbox 基于 Kodbox MySQL 数据库的后端
+type Kodbox struct {
+	name    string
+	db      *sql.DB
+	domain  atomic.Pointer[string]
+	storage KodboxStorage
+}
+
+// NewKodbox 创建 Kodbox 后端，domain 为 Kodbox 的访问地址
+func NewKodbox(name string, db *sql.DB, domain string, storage KodboxStorage) *Kodbox {
+	k := &Kodbox{name: name, db: db, storage: storage}
+	k.SetDomain(domain)
+	return k
+}
+
+// SetDomain 修改 Kodbox 的访问地址，用于配置热加载
+func (k *Kodbox) SetDomain(domain string) {
+	k.domain.Store(&domain)
+}
+
+func (k *Kodbox) Name() string { return k.name }
+
+func (k *Kodbox) Type() string { return TypeKodbox }
+
+// Lookup 先通过 io_file.hashMD5 查询文件ID，再通过 io_source 查询源ID
+//
+// 已移入回收站（isDelete = 1）的源视为不存在。ctx 中的 Scope 限制了 Kodbox 目录时，文件不在这些目录中视为不存在。
+func (k *Kodbox) Lookup(ctx context.Context, hash string) (*Result, error) {
+	res := &Result{Backend: k.name, Type: TypeKodbox}
+
+	query := "SELECT fileID, size, path FROM io_file WHERE hashMD5 = ? LIMIT 1"
+	err := k.db.QueryRowContext(ctx, query, hash).Scan(&res.FileID, &res.Size, &res.Path)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	cond, args := k.sourceScope(ctx)
+	query = "SELECT sourceID, name FROM io_source WHERE fileId = ? AND isDelete = 0" + cond + " LIMIT 1"
+	args = append([]any{res.FileID}, args...)
+	err = k.db.QueryRowContext(ctx, query, args...).Scan(&res.SourceID, &res.Name)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	res.URL = k.sourceURL(res.SourceID)
+	return res, nil
+}
+
+// LookupMany 用两条集合查询解析多个哈希：先按 hashMD5 IN (...) 查询
+// io_file，再按 fileID IN (...) 查询 io_source，每个源都是一个位置
+func (k *Kodbox) LookupMany(ctx context.Context, hashes []string) (map[string][]*Result, error) {
+	found := make(map[string][]*Result)
+	if len(hashes) == 0 {
+		return found, nil
+	}
+
+	type file struct {
+		hash string
+		size int64
+		path string
+	}
+	files := make(map[int]file)
+	args := make([]any, len(hashes))
+	for i, hash := range hashes {
+		args[i] = hash
+	}
+	rows, err := k.db.QueryContext(ctx,
+		"SELECT fileID, size, path, hashMD5 FROM io_file WHERE hashMD5 IN ("+placeholders(len(hashes))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id int
+		var f file
+		if err := rows.Scan(&id, &f.size, &f.path, &f.hash); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		f.hash = strings.ToLower(f.hash)
+		files[id] = f
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return found, nil
+	}
+
+	args = args[:0]
+	for id := range files {
+		args = append(args, id)
+	}
+	cond, scopeArgs := k.sourceScope(ctx)
+	query := "SELECT sourceID, name, fileID FROM io_source WHERE fileID IN (" + placeholders(len(files)) + ") AND isDelete = 0" +
+		cond + " ORDER BY sourceID"
+	rows, err = k.db.QueryContext(ctx, query, append(args, scopeArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		res := &Result{Backend: k.name, Type: TypeKodbox}
+		if err := rows.Scan(&res.SourceID, &res.Name, &res.FileID); err != nil {
+			return nil, err
+		}
+		f := files[res.FileID]
+		res.Size, res.Path = f.size, f.path
+		res.URL = k.sourceURL(res.SourceID)
+		found[f.hash] = append(found[f.hash], res)
+	}
+	return found, rows.Err()
+}
+
+// LatestChange 返回 io_source 中最大的 modifyTime，作为 ChangedSince 的起点
+func (k *Kodbox) LatestChange(ctx context.Context) (int64, error) {
+	var latest int64
+	err := k.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(modifyTime), 0) FROM io_source").Scan(&latest)
+	return latest, err
+}
+
+// ChangedSince 返回 modifyTime 不早于 since 的源对应文件的哈希，以及其中最大的 modifyTime
+//
+// Kodbox 上传、移动、重命名文件或将其移入回收站时都会更新 io_source.modifyTime。
+// modifyTime 精确到秒，同一秒内的变化可能分两次读到，因此包含等于 since 的记录。
+func (k *Kodbox) ChangedSince(ctx context.Context, since int64) ([]string, int64, error) {
+	rows, err := k.db.QueryContext(ctx,
+		"SELECT s.modifyTime, f.hashMD5 FROM io_source s JOIN io_file f ON f.fileID = s.fileID WHERE s.modifyTime >= ?", since)
+	if err != nil {
+		return nil, since, err
+	}
+	defer rows.Close()
+
+	latest := since
+	seen := make(map[string]bool)
+	var hashes []string
+	for rows.Next() {
+		var modified int64
+		var hash string
+		if err := rows.Scan(&modified, &hash); err != nil {
+			return nil, since, err
+		}
+		if modified > latest {
+			latest = modified
+		}
+		if hash = strings.ToLower(hash); hash != "" && !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, since, err
+	}
+	return hashes, latest, nil
+}
+
+func (k *Kodbox) sourceURL(sourceID int) string {
+	return *k.domain.Load() + "/#explorer&sidf=" + strconv.Itoa(sourceID)
+}
+
+// sourceScope 返回 ctx 中 Scope 对本后端 io_source 的过滤条件
+//
+// 限制了目录时只查找位于这些目录（含子目录）中的源，parentLevel 形如 ",0,1,5,"。
+func (k *Kodbox) sourceScope(ctx context.Context) (string, []any) {
+	sources := ScopeFrom(ctx).SourcesFor(k.name)
+	if len(sources) == 0 {
+		return "", nil
+	}
+	var conds []string
+	var args []any
+	for _, id := range sources {
+		conds = append(conds, "sourceID = ? OR parentLevel LIKE ?")
+		args = append(args, id, "%,"+strconv.Itoa(id)+",%")
+	}
+	return " AND (" + strings.Join(conds, " OR ") + ")", args
+}
+
+// placeholders 返回 n 个以逗号分隔的 ?
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// Ping 检查 Kodbox 数据库连接
+func (k *Kodbox) Ping(ctx context.Context) error {
+	return k.db.PingContext(ctx)
+}
+
+// Open 从 Kodbox 的存储目录直接读取文件
+func (k *Kodbox) Open(ctx context.Context, res *Result) (*Content, error) {
+	path, err := k.storage.resolve(res.Path)
+	if err != nil {
+		return nil, err
+	}
+	return openFile(path)
+}
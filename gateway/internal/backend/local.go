@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRescanInterval 默认的重新索引间隔
+const DefaultRescanInterval = 30 * time.Minute
+
+// localEntry 本地目录索引中的文件
+type localEntry struct {
+	rel     string
+	size    int64
+	modTime time.Time
+}
+
+// Local 由网关自行索引的本地目录后端
+//
+// 网关启动后在后台遍历目录计算MD5，之后按间隔增量重新索引，
+// 大小和修改时间未变化的文件不会重新计算哈希。
+type Local struct {
+	name     string
+	root     string
+	baseURL  string
+	interval time.Duration
+
+	mu     sync.RWMutex
+	byHash map[string]localEntry
+	byPath map[string]string // 相对路径 -> 哈希，用于增量索引
+}
+
+// NewLocal 创建本地目录后端，baseURL 为对外提供该目录文件的HTTP地址
+func NewLocal(name, root, baseURL string, interval time.Duration) (*Local, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s 不是目录", root)
+	}
+	if interval <= 0 {
+		interval = DefaultRescanInterval
+	}
+	return &Local{
+		name:     name,
+		root:     root,
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		interval: interval,
+		byHash:   make(map[string]localEntry),
+		byPath:   make(map[string]string),
+	}, nil
+}
+
+func (l *Local) Name() string { return l.name }
+
+func (l *Local) Type() string { return TypeLocal }
+
+// Run 立即建立索引，之后按间隔重新索引，直到 ctx 取消
+func (l *Local) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		if err := l.Rescan(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("后端 %s 索引失败: %v", l.name, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Rescan 重新遍历目录并更新索引
+func (l *Local) Rescan(ctx context.Context) error {
+	start := time.Now()
+	l.mu.RLock()
+	old := make(map[string]localEntry, len(l.byPath))
+	oldHash := make(map[string]string, len(l.byPath))
+	for rel, hash := range l.byPath {
+		old[rel] = l.byHash[hash]
+		oldHash[rel] = hash
+	}
+	l.mu.RUnlock()
+
+	byHash := make(map[string]localEntry)
+	byPath := make(map[string]string)
+	err := filepath.WalkDir(l.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(l.root, path)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		entry := localEntry{rel: rel, size: info.Size(), modTime: info.ModTime()}
+		hash, ok := oldHash[rel]
+		if prev := old[rel]; !ok || prev.size != entry.size || !prev.modTime.Equal(entry.modTime) {
+			hash, err = md5File(path)
+			if err != nil {
+				log.Printf("计算MD5失败 %s: %v", path, err)
+				return nil
+			}
+		}
+		byHash[hash] = entry
+		byPath[rel] = hash
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.byHash, l.byPath = byHash, byPath
+	l.mu.Unlock()
+	log.Printf("后端 %s 索引完成: %d 个文件，耗时 %v", l.name, len(byPath), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// Lookup 在内存索引中查找哈希
+func (l *Local) Lookup(ctx context.Context, hash string) (*Result, error) {
+	l.mu.RLock()
+	entry, ok := l.byHash[strings.ToLower(hash)]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	res := &Result{
+		Backend: l.name,
+		Type:    TypeLocal,
+		Name:    filepath.Base(entry.rel),
+		Size:    entry.size,
+		Path:    filepath.Join(l.root, filepath.FromSlash(entry.rel)),
+	}
+	if l.baseURL != "" {
+		res.URL = l.baseURL + "/" + escapePath(entry.rel)
+	}
+	return res, nil
+}
+
+// Ping 检查目录是否可以访问
+func (l *Local) Ping(ctx context.Context) error {
+	_, err := os.Stat(l.root)
+	return err
+}
+
+// Open 打开索引中的本地文件
+func (l *Local) Open(ctx context.Context, res *Result) (*Content, error) {
+	return openFile(res.Path)
+}
+
+// openFile 打开本地普通文件
+func openFile(path string) (*Content, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("%s 不是普通文件", path)
+	}
+	return &Content{ReadSeekCloser: f, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+// escapePath 逐段转义相对路径
+func escapePath(rel string) string {
+	parts := strings.Split(rel, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
+
+func md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
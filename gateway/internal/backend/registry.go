@@ -0,0 +1,73 @@
+package backend
+
+import (
+	"context"
+	"path"
+	"strings"
+
+	"smart-finder/gateway/internal/registry"
+)
+
+// Registry 查询已登记客户端发布的文件
+//
+// 文件在其他用户的电脑上，网关无法读取，结果只有主机名与路径。
+type Registry struct {
+	name     string
+	registry *registry.Registry
+}
+
+// NewRegistry 创建基于客户端登记的后端
+func NewRegistry(name string, reg *registry.Registry) *Registry {
+	return &Registry{name: name, registry: reg}
+}
+
+func (x *Registry) Name() string { return x.name }
+
+func (x *Registry) Type() string { return TypeRegistry }
+
+// Lookup 返回最近有心跳的主机上的文件
+func (x *Registry) Lookup(ctx context.Context, hash string) (*Result, error) {
+	locations, err := x.registry.Lookup(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, ErrNotFound
+	}
+	return x.result(locations[0]), nil
+}
+
+// LookupMany 一次查询多个哈希在各主机上的文件
+func (x *Registry) LookupMany(ctx context.Context, hashes []string) (map[string][]*Result, error) {
+	locations, err := x.registry.LookupMany(ctx, hashes)
+	if err != nil {
+		return nil, err
+	}
+	found := make(map[string][]*Result, len(locations))
+	for hash, locs := range locations {
+		for _, loc := range locs {
+			found[hash] = append(found[hash], x.result(loc))
+		}
+	}
+	return found, nil
+}
+
+func (x *Registry) result(loc registry.Location) *Result {
+	res := &Result{
+		Backend: x.name,
+		Type:    TypeRegistry,
+		Size:    loc.Size,
+		Path:    loc.Path,
+		Host:    loc.Host,
+	}
+	if loc.Path != "" {
+		// 客户端可能运行在 Windows 上
+		res.Name = path.Base(strings.ReplaceAll(loc.Path, `\`, "/"))
+	}
+	return res
+}
+
+// Ping 检查登记数据库连接
+func (x *Registry) Ping(ctx context.Context) error {
+	return x.registry.Ping(ctx)
+}
@@ -0,0 +1,331 @@
+package backend
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPresignExpiry 预签名链接的默认有效期
+const DefaultPresignExpiry = 15 * time.Minute
+
+// S3 兼容 S3 协议的对象存储后端（如 MinIO）
+//
+// 查找顺序：配置了 key_template 时先按模板直接 HEAD 对象；否则或未找到时，
+// 查询按间隔通过 ListObjectsV2 建立的 ETag 索引。单段上传对象的 ETag 即
+// 内容的MD5，分段上传的对象无法通过 ETag 识别，需要使用 key_template。
+type S3 struct {
+	name          string
+	endpoint      *url.URL
+	bucket        string
+	prefix        string
+	keyTemplate   string
+	presignExpiry time.Duration
+	interval      time.Duration
+	signer        *sigv4Signer
+	client        *http.Client
+	streamClient  *http.Client // 读取对象内容，不设整体超时
+
+	mu     sync.RWMutex
+	byETag map[string]s3Object
+}
+
+type s3Object struct {
+	Key  string `xml:"Key"`
+	ETag string `xml:"ETag"`
+	Size int64  `xml:"Size"`
+}
+
+type listBucketResult struct {
+	Contents              []s3Object `xml:"Contents"`
+	IsTruncated           bool       `xml:"IsTruncated"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+// NewS3 根据配置创建 S3 后端
+func NewS3(cfg Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("s3 后端需要配置 endpoint 和 bucket")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("无效的 s3 endpoint: %s", cfg.Endpoint)
+	}
+	s := &S3{
+		name:          cfg.DisplayName(),
+		endpoint:      endpoint,
+		bucket:        cfg.Bucket,
+		prefix:        cfg.Prefix,
+		keyTemplate:   cfg.KeyTemplate,
+		presignExpiry: cfg.PresignExpiry,
+		interval:      cfg.RescanInterval,
+		client:        &http.Client{Timeout: 30 * time.Second},
+		streamClient:  &http.Client{},
+		byETag:        make(map[string]s3Object),
+	}
+	if s.presignExpiry <= 0 {
+		s.presignExpiry = DefaultPresignExpiry
+	}
+	if s.interval <= 0 {
+		s.interval = DefaultRescanInterval
+	}
+	if cfg.AccessKey != "" {
+		region := cfg.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		s.signer = &sigv4Signer{accessKey: cfg.AccessKey, secretKey: cfg.SecretKey, region: region, service: "s3"}
+	}
+	return s, nil
+}
+
+func (s *S3) Name() string { return s.name }
+
+func (s *S3) Type() string { return TypeS3 }
+
+// Run 立即建立 ETag 索引，之后按间隔刷新，直到 ctx 取消
+func (s *S3) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Rescan(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("后端 %s 索引失败: %v", s.name, err)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Rescan 通过 ListObjectsV2 列出存储桶并按 ETag 建立索引
+func (s *S3) Rescan(ctx context.Context) error {
+	byETag := make(map[string]s3Object)
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}}
+		if s.prefix != "" {
+			q.Set("prefix", s.prefix)
+		}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u := s.objectURL("")
+		u.RawQuery = q.Encode()
+
+		resp, err := s.do(ctx, http.MethodGet, u)
+		if err != nil {
+			return err
+		}
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("ListObjectsV2 返回 %s", resp.Status)
+		}
+		if err != nil {
+			return fmt.Errorf("解析 ListObjectsV2 响应失败: %w", err)
+		}
+
+		for _, obj := range result.Contents {
+			etag := strings.ToLower(strings.Trim(obj.ETag, `"`))
+			// 分段上传的 ETag 形如 "<hash>-<parts>"，不是内容的MD5
+			if len(etag) == 32 && !strings.Contains(etag, "-") {
+				byETag[etag] = obj
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	s.mu.Lock()
+	s.byETag = byETag
+	s.mu.Unlock()
+	log.Printf("后端 %s 索引完成: %d 个对象", s.name, len(byETag))
+	return nil
+}
+
+// Lookup 查找哈希对应的对象
+func (s *S3) Lookup(ctx context.Context, hash string) (*Result, error) {
+	hash = strings.ToLower(hash)
+
+	if s.keyTemplate != "" {
+		key := strings.ReplaceAll(s.keyTemplate, "{hash}", hash)
+		resp, err := s.do(ctx, http.MethodHead, s.objectURL(key))
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+			size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+			return s.result(key, size), nil
+		case http.StatusNotFound:
+		default:
+			return nil, fmt.Errorf("HEAD %s 返回 %s", key, resp.Status)
+		}
+	}
+
+	s.mu.RLock()
+	obj, ok := s.byETag[hash]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.result(obj.Key, obj.Size), nil
+}
+
+func (s *S3) result(key string, size int64) *Result {
+	return &Result{
+		Backend: s.name,
+		Type:    TypeS3,
+		Name:    path.Base(key),
+		Size:    size,
+		Path:    key,
+		URL:     s.DownloadURL(key),
+	}
+}
+
+// Ping 通过 HeadBucket 检查存储桶是否可以访问
+func (s *S3) Ping(ctx context.Context) error {
+	resp, err := s.do(ctx, http.MethodHead, s.objectURL(""))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HeadBucket 返回 %s", resp.Status)
+	}
+	return nil
+}
+
+// URLExpiry 配置了密钥时结果为预签名地址，有效期为 presign_expiry
+func (s *S3) URLExpiry() time.Duration {
+	if s.signer == nil {
+		return 0
+	}
+	return s.presignExpiry
+}
+
+// DownloadURL 返回对象的访问地址，配置了密钥时为预签名地址
+func (s *S3) DownloadURL(key string) string {
+	u := s.objectURL(key)
+	if s.signer == nil {
+		return u.String()
+	}
+	return s.signer.presign(http.MethodGet, u, s.presignExpiry, time.Now())
+}
+
+// objectURL 使用 path-style 地址：endpoint/bucket/key
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawPath = ""
+	return &u
+}
+
+func (s *S3) do(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := s.newRequest(ctx, method, u)
+	if err != nil {
+		return nil, err
+	}
+	return s.client.Do(req)
+}
+
+func (s *S3) newRequest(ctx context.Context, method string, u *url.URL) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.signer != nil {
+		s.signer.sign(req, emptyPayloadHash, time.Now())
+	}
+	return req, nil
+}
+
+// Open 返回按需发起 Range 请求的对象读取器，支持 Seek
+func (s *S3) Open(ctx context.Context, res *Result) (*Content, error) {
+	return &Content{
+		ReadSeekCloser: &s3Reader{ctx: ctx, s: s, key: res.Path, size: res.Size},
+		Size:           res.Size,
+	}, nil
+}
+
+// s3Reader 从当前偏移量开始以 Range 请求读取对象，Seek 后重新请求
+type s3Reader struct {
+	ctx    context.Context
+	s      *S3
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func (r *s3Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		req, err := r.s.newRequest(r.ctx, http.MethodGet, r.s.objectURL(r.key))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(r.offset, 10)+"-")
+		resp, err := r.s.streamClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusPartialContent && !(resp.StatusCode == http.StatusOK && r.offset == 0) {
+			resp.Body.Close()
+			return 0, fmt.Errorf("GET %s 返回 %s", r.key, resp.Status)
+		}
+		r.body = resp.Body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *s3Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("无效的偏移量: %d", offset)
+	}
+	if offset != r.offset {
+		r.closeBody()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *s3Reader) Close() error {
+	r.closeBody()
+	return nil
+}
+
+func (r *s3Reader) closeBody() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+}
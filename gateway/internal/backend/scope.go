@@ -0,0 +1,54 @@
+package backend
+
+import "context"
+
+// Scope 调用方可以解析到的范围，零值表示不限制
+type Scope struct {
+	Backends      []string // 允许的后端名称，为空表示全部
+	KodboxSources []int    // 允许的 Kodbox 目录 sourceID（含子目录），为空表示全部
+	// BackendSources 按后端名称单独限制的 Kodbox 目录，值为空表示该后端的
+	// 全部目录；不在表中的后端使用 KodboxSources
+	BackendSources map[string][]int
+	// Route 路由规则为请求固定的后端，为空表示不限制；与 Backends 同时
+	// 配置时只查询两者都包含的后端
+	Route []string
+}
+
+// AllowsBackend 判断是否允许查询该后端
+func (s Scope) AllowsBackend(name string) bool {
+	return contains(s.Backends, name) && contains(s.Route, name)
+}
+
+// SourcesFor 返回后端 name 允许的 Kodbox 目录，为空表示全部
+func (s Scope) SourcesFor(name string) []int {
+	if ids, ok := s.BackendSources[name]; ok {
+		return ids
+	}
+	return s.KodboxSources
+}
+
+// contains 判断 names 是否包含 name，names 为空表示全部
+func contains(names []string, name string) bool {
+	if len(names) == 0 {
+		return true
+	}
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+type scopeKey struct{}
+
+// WithScope 返回携带解析范围的 ctx，Chain 与各后端查询时据此过滤
+func WithScope(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, scopeKey{}, s)
+}
+
+// ScopeFrom 返回 ctx 中的解析范围，未设置时不限制
+func ScopeFrom(ctx context.Context) Scope {
+	s, _ := ctx.Value(scopeKey{}).(Scope)
+	return s
+}
@@ -0,0 +1,336 @@
+// Package cache 网关哈希查询结果的缓存
+//
+// 进程内使用带 TTL 的 LRU，未找到的结果以较短的 TTL 缓存；可选的共享
+// 缓存（如 Redis）让多个网关实例复用查询结果。Kodbox 中文件被删除、
+// 移动或新上传时，由 WatchKodbox 按 io_source.modifyTime 清除对应哈希。
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+// 默认配置
+const (
+	DefaultSize         = 10000
+	DefaultTTL          = 5 * time.Minute
+	DefaultNegativeTTL  = 30 * time.Second
+	DefaultPollInterval = 30 * time.Second
+)
+
+// Config 缓存配置
+type Config struct {
+	Disabled     bool          `mapstructure:"disabled"`
+	Size         int           `mapstructure:"size"`          // 进程内最多缓存的结果数
+	TTL          time.Duration `mapstructure:"ttl"`           // 找到文件的结果
+	NegativeTTL  time.Duration `mapstructure:"negative_ttl"`  // 未找到文件的结果
+	PollInterval time.Duration `mapstructure:"poll_interval"` // 检查 Kodbox 文件变化的间隔
+	Redis        RedisConfig   `mapstructure:"redis"`
+}
+
+// Shared 多个网关实例共享的缓存
+//
+// 只有不受授权范围限制的查询结果写入共享缓存。
+type Shared interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// Stats 缓存统计
+type Stats struct {
+	Size         int   `json:"size"`
+	Capacity     int   `json:"capacity"`
+	Hits         int64 `json:"hits"`          // 含 negative_hits 与 shared_hits
+	NegativeHits int64 `json:"negative_hits"` // 命中未找到的结果
+	SharedHits   int64 `json:"shared_hits"`   // 进程内未命中、共享缓存命中
+	Misses       int64 `json:"misses"`
+	Evictions    int64 `json:"evictions"`
+	Purges       int64 `json:"purges"` // 因文件变化或管理接口清除的结果数
+}
+
+type key struct {
+	hash  string
+	scope string
+}
+
+type entry struct {
+	key     key
+	res     *backend.Result // nil 表示未找到
+	expires time.Time
+}
+
+// sharedEntry 写入共享缓存的内容
+type sharedEntry struct {
+	Result *backend.Result `json:"r"`
+	// Expires 结果的过期时间，其他实例读到后在进程内缓存的时间不超过它
+	Expires time.Time `json:"e"`
+}
+
+// Cache 哈希查询结果缓存，键为哈希与授权范围
+type Cache struct {
+	capacity int
+	ttl      atomic.Int64 // time.Duration，可通过 SetTTL 修改
+	negTTL   atomic.Int64
+	shared   Shared
+	now      func() time.Time
+
+	// urlExpiry 结果地址有有效期的后端，键为后端名称，见 LimitTTL
+	urlExpiry map[string]time.Duration
+
+	mu     sync.Mutex
+	ll     *list.List
+	items  map[key]*list.Element
+	byHash map[string][]key
+
+	hits, negativeHits, sharedHits, misses, evictions, purges atomic.Int64
+}
+
+// New 创建缓存，shared 为 nil 时只使用进程内缓存
+func New(cfg Config, shared Shared) *Cache {
+	c := &Cache{
+		capacity: cfg.Size,
+		shared:   shared,
+		now:      time.Now,
+		ll:       list.New(),
+		items:    make(map[key]*list.Element),
+		byHash:   make(map[string][]key),
+	}
+	if c.capacity <= 0 {
+		c.capacity = DefaultSize
+	}
+	c.SetTTL(cfg.TTL, cfg.NegativeTTL)
+	return c
+}
+
+// SetTTL 修改之后写入的结果的过期时间，已缓存的结果保持原有过期时间；
+// 不大于 0 时使用默认值
+func (c *Cache) SetTTL(ttl, negativeTTL time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultNegativeTTL
+	}
+	c.ttl.Store(int64(ttl))
+	c.negTTL.Store(int64(negativeTTL))
+}
+
+// LimitTTL 限制后端 name 的结果的缓存时间，使缓存中的地址（如 S3 预签名
+// 地址）在返回给调用方时至少还有 urlMargin 的有效期；需在开始使用前调用
+func (c *Cache) LimitTTL(name string, urlExpiry time.Duration) {
+	if urlExpiry <= 0 {
+		return
+	}
+	if c.urlExpiry == nil {
+		c.urlExpiry = make(map[string]time.Duration)
+	}
+	c.urlExpiry[name] = urlExpiry
+}
+
+// urlMargin 缓存的地址返回时至少还有的有效期：有效期的五分之一，最多一分钟
+func urlMargin(urlExpiry time.Duration) time.Duration {
+	return min(urlExpiry/5, time.Minute)
+}
+
+// Get 返回缓存的查询结果，ok 为 false 表示未缓存；res 为 nil 表示缓存了未找到
+func (c *Cache) Get(ctx context.Context, hash string, scope backend.Scope) (res *backend.Result, ok bool) {
+	k := key{hash: hash, scope: scopeKey(scope)}
+	c.mu.Lock()
+	if el, found := c.items[k]; found {
+		e := el.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.ll.MoveToFront(el)
+			c.mu.Unlock()
+			c.hit(e.res)
+			return e.res, true
+		}
+		c.removeElement(el)
+	}
+	c.mu.Unlock()
+
+	if c.shared != nil && k.scope == "" {
+		data, found, err := c.shared.Get(ctx, hash)
+		if err != nil {
+			log.Printf("读取共享缓存失败: %v", err)
+		} else if found {
+			var se sharedEntry
+			if err := json.Unmarshal(data, &se); err == nil && c.now().Before(se.Expires) {
+				c.sharedHits.Add(1)
+				c.hit(se.Result)
+				c.store(k, se.Result, se.Expires)
+				return se.Result, true
+			}
+		}
+	}
+	c.misses.Add(1)
+	return nil, false
+}
+
+// Set 缓存查询结果，res 为 nil 表示未找到
+func (c *Cache) Set(ctx context.Context, hash string, scope backend.Scope, res *backend.Result) {
+	k := key{hash: hash, scope: scopeKey(scope)}
+	ttl := c.entryTTL(res)
+	expires := c.now().Add(ttl)
+	c.store(k, res, expires)
+	if c.shared != nil && k.scope == "" {
+		data, _ := json.Marshal(sharedEntry{Result: res, Expires: expires})
+		if err := c.shared.Set(ctx, hash, data, ttl); err != nil {
+			log.Printf("写入共享缓存失败: %v", err)
+		}
+	}
+}
+
+// Purge 清除哈希在所有授权范围下的缓存结果
+func (c *Cache) Purge(ctx context.Context, hashes ...string) {
+	if len(hashes) == 0 {
+		return
+	}
+	c.mu.Lock()
+	for _, hash := range hashes {
+		for _, k := range c.byHash[hash] {
+			if el, ok := c.items[k]; ok {
+				c.removeElement(el)
+				c.purges.Add(1)
+			}
+		}
+	}
+	c.mu.Unlock()
+	if c.shared != nil {
+		if err := c.shared.Delete(ctx, hashes...); err != nil {
+			log.Printf("清除共享缓存失败: %v", err)
+		}
+	}
+}
+
+// PurgeAll 清空进程内缓存，共享缓存中的结果按 TTL 过期
+func (c *Cache) PurgeAll() {
+	c.mu.Lock()
+	c.purges.Add(int64(c.ll.Len()))
+	c.ll.Init()
+	c.items = make(map[key]*list.Element)
+	c.byHash = make(map[string][]key)
+	c.mu.Unlock()
+}
+
+// Stats 返回缓存统计
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+	return Stats{
+		Size:         size,
+		Capacity:     c.capacity,
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		SharedHits:   c.sharedHits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.evictions.Load(),
+		Purges:       c.purges.Load(),
+	}
+}
+
+func (c *Cache) hit(res *backend.Result) {
+	c.hits.Add(1)
+	if res == nil {
+		c.negativeHits.Add(1)
+	}
+}
+
+func (c *Cache) entryTTL(res *backend.Result) time.Duration {
+	if res == nil {
+		return time.Duration(c.negTTL.Load())
+	}
+	ttl := time.Duration(c.ttl.Load())
+	if exp := c.urlExpiry[res.Backend]; exp > 0 {
+		ttl = min(ttl, exp-urlMargin(exp))
+	}
+	return ttl
+}
+
+// store 写入进程内缓存，expires 不晚于 entryTTL 对应的时间；
+// 超出容量时淘汰最久未使用的结果
+func (c *Cache) store(k key, res *backend.Result, expires time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if local := c.now().Add(c.entryTTL(res)); local.Before(expires) {
+		expires = local
+	}
+	e := &entry{key: k, res: res, expires: expires}
+	if el, ok := c.items[k]; ok {
+		el.Value = e
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.items[k] = c.ll.PushFront(e)
+	c.byHash[k.hash] = append(c.byHash[k.hash], k)
+	for c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+		c.evictions.Add(1)
+	}
+}
+
+// removeElement 删除进程内缓存的一项，调用方需持有 c.mu
+func (c *Cache) removeElement(el *list.Element) {
+	k := el.Value.(*entry).key
+	c.ll.Remove(el)
+	delete(c.items, k)
+	keys := c.byHash[k.hash]
+	for i, other := range keys {
+		if other == k {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	if len(keys) == 0 {
+		delete(c.byHash, k.hash)
+	} else {
+		c.byHash[k.hash] = keys
+	}
+}
+
+// scopeKey 把授权范围转换为缓存键的一部分，不限制时为空
+func scopeKey(s backend.Scope) string {
+	if len(s.Backends) == 0 && len(s.KodboxSources) == 0 && len(s.BackendSources) == 0 && len(s.Route) == 0 {
+		return ""
+	}
+	backends := append([]string(nil), s.Backends...)
+	sort.Strings(backends)
+	key := strings.Join(backends, ",") + "|" + sourcesKey(s.KodboxSources)
+	if len(s.Route) > 0 {
+		route := append([]string(nil), s.Route...)
+		sort.Strings(route)
+		key += "|" + strings.Join(route, ",")
+	}
+	if len(s.BackendSources) > 0 {
+		names := make([]string, 0, len(s.BackendSources))
+		for name := range s.BackendSources {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			key += "|" + name + "=" + sourcesKey(s.BackendSources[name])
+		}
+	}
+	return key
+}
+
+// sourcesKey 把目录列表转换为与顺序无关的文本
+func sourcesKey(ids []int) string {
+	sources := make([]string, len(ids))
+	for i, id := range ids {
+		sources[i] = strconv.Itoa(id)
+	}
+	sort.Strings(sources)
+	return strings.Join(sources, ",")
+}
@@ -0,0 +1,265 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+const (
+	h1 = "11111111111111111111111111111111"
+	h2 = "22222222222222222222222222222222"
+	h3 = "33333333333333333333333333333333"
+)
+
+// memShared 测试用的共享缓存
+type memShared struct {
+	mu   sync.Mutex
+	data map[string][]byte
+}
+
+func (m *memShared) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.data[key]
+	return v, ok, nil
+}
+
+func (m *memShared) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = value
+	return nil
+}
+
+func (m *memShared) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.data, k)
+	}
+	return nil
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	c := New(Config{Size: 2, TTL: time.Minute, NegativeTTL: 10 * time.Second}, nil)
+	c.now = func() time.Time { return now }
+	found := &backend.Result{Backend: "kodbox", SourceID: 42}
+
+	if _, ok := c.Get(ctx, h1, backend.Scope{}); ok {
+		t.Fatal("empty cache hit")
+	}
+	c.Set(ctx, h1, backend.Scope{}, found)
+	c.Set(ctx, h2, backend.Scope{}, nil)
+	if res, ok := c.Get(ctx, h1, backend.Scope{}); !ok || res != found {
+		t.Fatalf("Get(h1) = %v, %v", res, ok)
+	}
+	if res, ok := c.Get(ctx, h2, backend.Scope{}); !ok || res != nil {
+		t.Fatalf("negative Get(h2) = %v, %v", res, ok)
+	}
+
+	// 不同授权范围分别缓存
+	if _, ok := c.Get(ctx, h1, backend.Scope{KodboxSources: []int{5}}); ok {
+		t.Fatal("scoped lookup hit unscoped entry")
+	}
+
+	// 未找到的结果先过期
+	now = now.Add(30 * time.Second)
+	if _, ok := c.Get(ctx, h2, backend.Scope{}); ok {
+		t.Fatal("negative entry not expired")
+	}
+	if _, ok := c.Get(ctx, h1, backend.Scope{}); !ok {
+		t.Fatal("positive entry expired early")
+	}
+
+	// 超出容量淘汰最久未使用的结果
+	c.Set(ctx, h2, backend.Scope{}, found)
+	c.Get(ctx, h1, backend.Scope{})
+	c.Set(ctx, h3, backend.Scope{}, found)
+	if _, ok := c.Get(ctx, h2, backend.Scope{}); ok {
+		t.Fatal("least recently used entry not evicted")
+	}
+
+	// 清除哈希的所有范围
+	c.Set(ctx, h1, backend.Scope{Backends: []string{"kodbox"}}, found)
+	c.Set(ctx, h1, backend.Scope{}, found)
+	c.Purge(ctx, h1)
+	if _, ok := c.Get(ctx, h1, backend.Scope{}); ok {
+		t.Fatal("purged entry hit")
+	}
+	if _, ok := c.Get(ctx, h1, backend.Scope{Backends: []string{"kodbox"}}); ok {
+		t.Fatal("purged scoped entry hit")
+	}
+
+	s := c.Stats()
+	if s.Hits != 4 || s.NegativeHits != 1 || s.Misses != 6 || s.Evictions != 3 || s.Purges != 2 || s.Size != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestSetTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	c := New(Config{TTL: time.Minute}, nil)
+	c.now = func() time.Time { return now }
+	found := &backend.Result{Backend: "kodbox", SourceID: 42}
+
+	c.Set(ctx, h1, backend.Scope{}, found)
+	c.SetTTL(10*time.Minute, 0)
+	c.Set(ctx, h2, backend.Scope{}, found)
+
+	// 已缓存的结果保持原有过期时间，之后写入的使用新的 TTL
+	now = now.Add(2 * time.Minute)
+	if _, ok := c.Get(ctx, h1, backend.Scope{}); ok {
+		t.Fatal("entry stored before SetTTL not expired")
+	}
+	if _, ok := c.Get(ctx, h2, backend.Scope{}); !ok {
+		t.Fatal("entry stored after SetTTL expired early")
+	}
+}
+
+func TestSharedCache(t *testing.T) {
+	ctx := context.Background()
+	shared := &memShared{data: make(map[string][]byte)}
+	a := New(Config{}, shared)
+	b := New(Config{}, shared)
+
+	a.Set(ctx, h1, backend.Scope{}, &backend.Result{Backend: "kodbox", SourceID: 42, Path: "{io:1}/a"})
+	a.Set(ctx, h2, backend.Scope{KodboxSources: []int{5}}, &backend.Result{Backend: "kodbox"})
+	res, ok := b.Get(ctx, h1, backend.Scope{})
+	if !ok || res.SourceID != 42 || res.Path != "{io:1}/a" {
+		t.Fatalf("shared Get = %+v, %v", res, ok)
+	}
+	if b.Stats().SharedHits != 1 {
+		t.Fatalf("shared hits = %d", b.Stats().SharedHits)
+	}
+	// 受范围限制的结果不写入共享缓存
+	if _, ok := b.Get(ctx, h2, backend.Scope{KodboxSources: []int{5}}); ok {
+		t.Fatal("scoped entry shared")
+	}
+
+	b.Purge(ctx, h1)
+	a.PurgeAll()
+	if _, ok := a.Get(ctx, h1, backend.Scope{}); ok {
+		t.Fatal("purge did not reach shared cache")
+	}
+}
+
+func TestLimitTTL(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	shared := &memShared{data: make(map[string][]byte)}
+	a := New(Config{TTL: 30 * time.Minute}, shared)
+	b := New(Config{TTL: 30 * time.Minute}, shared)
+	for _, c := range []*Cache{a, b} {
+		c.now = func() time.Time { return now }
+		c.LimitTTL("s3", 15*time.Minute)
+	}
+
+	// 预签名地址有效期 15 分钟，结果只缓存到到期前一分钟
+	a.Set(ctx, h1, backend.Scope{}, &backend.Result{Backend: "s3", URL: "https://s3.test/a?X-Amz-Expires=900"})
+	a.Set(ctx, h2, backend.Scope{}, &backend.Result{Backend: "kodbox"})
+	now = now.Add(13 * time.Minute)
+	if _, ok := a.Get(ctx, h1, backend.Scope{}); !ok {
+		t.Fatal("s3 entry expired early")
+	}
+
+	// 其他实例从共享缓存读到的结果按原过期时间过期，不重新计时
+	if _, ok := b.Get(ctx, h1, backend.Scope{}); !ok {
+		t.Fatal("shared s3 entry missing")
+	}
+	now = now.Add(time.Minute + time.Second)
+	if _, ok := a.Get(ctx, h1, backend.Scope{}); ok {
+		t.Fatal("s3 entry outlived presigned url margin")
+	}
+	if _, ok := b.Get(ctx, h1, backend.Scope{}); ok {
+		t.Fatal("s3 entry from shared cache outlived presigned url margin")
+	}
+	// 其他后端的结果不受限制
+	if _, ok := a.Get(ctx, h2, backend.Scope{}); !ok {
+		t.Fatal("kodbox entry expired early")
+	}
+
+	// 有效期很短时保留五分之一的余量
+	c := New(Config{TTL: time.Hour}, nil)
+	c.LimitTTL("s3", time.Minute)
+	if ttl := c.entryTTL(&backend.Result{Backend: "s3"}); ttl != 48*time.Second {
+		t.Fatalf("entryTTL = %s, want 48s", ttl)
+	}
+}
+
+// fakeSource 测试用的变化来源
+type fakeSource struct {
+	mu      sync.Mutex
+	pos     int64
+	changes map[int64][]string
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) LatestChange(ctx context.Context) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.pos, nil
+}
+
+func (f *fakeSource) ChangedSince(ctx context.Context, since int64) ([]string, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var hashes []string
+	for pos := since + 1; pos <= f.pos; pos++ {
+		hashes = append(hashes, f.changes[pos]...)
+	}
+	return hashes, f.pos, nil
+}
+
+func TestWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := New(Config{}, nil)
+	c.Set(ctx, h1, backend.Scope{}, &backend.Result{Backend: "kodbox"})
+	c.Set(ctx, h2, backend.Scope{}, nil)
+
+	src := &fakeSource{pos: 1, changes: map[int64][]string{1: {h1}}}
+	go c.Watch(ctx, src, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := c.Get(ctx, h1, backend.Scope{}); !ok {
+		t.Fatal("change before watch started purged entry")
+	}
+
+	src.mu.Lock()
+	src.pos, src.changes[2] = 2, []string{h2}
+	src.mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := c.Get(ctx, h2, backend.Scope{}); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("changed hash not purged")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestScopeKey(t *testing.T) {
+	if scopeKey(backend.Scope{}) != "" {
+		t.Fatal("不限制的范围应为空键")
+	}
+	// 目录相同但属于不同后端的范围不能共用缓存
+	a := backend.Scope{Backends: []string{"kodbox-a", "kodbox-b"}, BackendSources: map[string][]int{"kodbox-a": {5}}}
+	b := backend.Scope{Backends: []string{"kodbox-a", "kodbox-b"}, BackendSources: map[string][]int{"kodbox-b": {5}}}
+	if scopeKey(a) == scopeKey(b) {
+		t.Errorf("scopeKey(%+v) == scopeKey(%+v)", a, b)
+	}
+	// 与顺序无关
+	c := backend.Scope{Backends: []string{"kodbox-b", "kodbox-a"}, BackendSources: map[string][]int{"kodbox-a": {5}}}
+	if scopeKey(a) != scopeKey(c) {
+		t.Errorf("scopeKey(%+v) != scopeKey(%+v)", a, c)
+	}
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// ChangeSource 能够报告文件变化的后端，如 Kodbox
+type ChangeSource interface {
+	Name() string
+	// LatestChange 返回当前的变化位置
+	LatestChange(ctx context.Context) (int64, error)
+	// ChangedSince 返回位置 since 之后变化的文件哈希及新的位置
+	ChangedSince(ctx context.Context, since int64) ([]string, int64, error)
+}
+
+// Watch 按间隔检查后端的文件变化并清除对应哈希的缓存，直到 ctx 取消
+//
+// 删除、移动的文件清除其缓存的位置，新上传的文件清除其未找到的结果。
+func (c *Cache) Watch(ctx context.Context, src ChangeSource, interval time.Duration) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	// 读取起始位置失败时在下一次检查前重试，避免把全部文件当作变化
+	since, err := src.LatestChange(ctx)
+	if err != nil {
+		log.Printf("读取后端 %s 的变化位置失败: %v", src.Name(), err)
+		since = -1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if since < 0 {
+			if since, err = src.LatestChange(ctx); err != nil {
+				log.Printf("读取后端 %s 的变化位置失败: %v", src.Name(), err)
+				since = -1
+			}
+			continue
+		}
+		hashes, next, err := src.ChangedSince(ctx, since)
+		if err != nil {
+			log.Printf("检查后端 %s 的文件变化失败: %v", src.Name(), err)
+			continue
+		}
+		since = next
+		c.Purge(ctx, hashes...)
+	}
+}
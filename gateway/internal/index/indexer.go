@@ -0,0 +1,400 @@
+package index
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"smart-finder/shared/utils"
+	"smart-finder/shared/walk"
+)
+
+// 默认配置
+const (
+	DefaultInterval   = time.Hour
+	DefaultSQLitePath = "data/index.db"
+	DefaultWorkers    = 4
+)
+
+// ErrRunning 已有索引任务在进行
+var ErrRunning = errors.New("索引正在进行中")
+
+// Root 需要索引的服务器目录
+type Root struct {
+	Name    string `mapstructure:"name"`
+	Path    string `mapstructure:"path"`
+	BaseURL string `mapstructure:"base_url"` // 对外提供该目录的HTTP地址，可选
+}
+
+// Config 索引配置
+type Config struct {
+	Driver        string        `mapstructure:"driver"` // sqlite 或 mysql
+	SQLitePath    string        `mapstructure:"sqlite_path"`
+	Interval      time.Duration `mapstructure:"interval"`
+	SymlinkPolicy string        `mapstructure:"symlink_policy"`
+	Workers       int           `mapstructure:"workers"` // 并行计算哈希的数量
+	Roots         []Root        `mapstructure:"roots"`
+}
+
+// Status 索引状态，计数为最近一次（或正在进行的）索引的统计
+type Status struct {
+	Running     bool             `json:"running"`
+	LastStart   time.Time        `json:"last_start"`
+	LastEnd     time.Time        `json:"last_end"`
+	NextScan    time.Time        `json:"next_scan"`
+	LastError   string           `json:"last_error,omitempty"`
+	Scanned     int64            `json:"scanned"` // 遍历到的文件数
+	Hashed      int64            `json:"hashed"`  // 新增或变化后重新计算哈希的文件数
+	Removed     int64            `json:"removed"` // 已删除而移出索引的文件数
+	Errors      int64            `json:"errors"`
+	SkipReasons map[string]int64 `json:"skip_reasons,omitempty"`
+	Roots       []RootStatus     `json:"roots"`
+}
+
+// RootStatus 单个目录的索引状态
+type RootStatus struct {
+	Name  string `json:"name"`
+	Path  string `json:"path"`
+	Files int64  `json:"files"`
+	Error string `json:"error,omitempty"`
+}
+
+// Indexer 按间隔遍历配置的目录并更新索引
+//
+// 大小和修改时间未变化的文件不会重新计算哈希；遍历完成后删除目录中
+// 已不存在的文件。目录无法访问时保留其原有索引；变化后无法计算哈希的
+// 文件移出索引，不再按变化前的哈希返回。
+type Indexer struct {
+	store    *Store
+	roots    []Root
+	interval time.Duration
+	policy   walk.SymlinkPolicy
+	workers  int
+	trigger  chan struct{}
+
+	mu      sync.RWMutex
+	status  Status
+	rootErr map[string]string
+}
+
+// New 根据配置创建索引器
+func New(store *Store, cfg Config) (*Indexer, error) {
+	policy, err := walk.ParseSymlinkPolicy(cfg.SymlinkPolicy)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool)
+	roots := make([]Root, len(cfg.Roots))
+	for i, r := range cfg.Roots {
+		if r.Path == "" {
+			return nil, fmt.Errorf("索引目录 %d: 需要配置 path", i+1)
+		}
+		if r.Name == "" {
+			r.Name = filepath.Base(r.Path)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("索引目录名称重复: %s", r.Name)
+		}
+		names[r.Name] = true
+		roots[i] = r
+	}
+
+	ix := &Indexer{
+		store:    store,
+		roots:    roots,
+		interval: cfg.Interval,
+		policy:   policy,
+		workers:  cfg.Workers,
+		trigger:  make(chan struct{}, 1),
+		rootErr:  make(map[string]string),
+	}
+	if ix.interval <= 0 {
+		ix.interval = DefaultInterval
+	}
+	if ix.workers <= 0 {
+		ix.workers = DefaultWorkers
+	}
+	return ix, nil
+}
+
+// Store 返回索引数据的存储
+func (ix *Indexer) Store() *Store { return ix.store }
+
+// Root 按名称返回配置的目录
+func (ix *Indexer) Root(name string) (Root, bool) {
+	for _, r := range ix.roots {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return Root{}, false
+}
+
+// Run 立即建立索引，之后按间隔或在 Trigger 时重新索引，直到 ctx 取消
+func (ix *Indexer) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-ix.trigger:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-ctx.Done():
+			return
+		}
+		if err := ix.Rescan(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("索引失败: %v", err)
+		}
+		ix.mu.Lock()
+		ix.status.NextScan = time.Now().Add(ix.interval)
+		ix.mu.Unlock()
+		timer.Reset(ix.interval)
+	}
+}
+
+// Trigger 请求 Run 尽快重新索引，正在索引或已有待处理的请求时返回 false
+func (ix *Indexer) Trigger() bool {
+	ix.mu.RLock()
+	running := ix.status.Running
+	ix.mu.RUnlock()
+	if running {
+		return false
+	}
+	select {
+	case ix.trigger <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Status 返回索引状态及各目录的文件数
+func (ix *Indexer) Status(ctx context.Context) (Status, error) {
+	ix.mu.RLock()
+	status := ix.status
+	status.SkipReasons = make(map[string]int64, len(ix.status.SkipReasons))
+	for reason, n := range ix.status.SkipReasons {
+		status.SkipReasons[reason] = n
+	}
+	rootErr := make(map[string]string, len(ix.rootErr))
+	for name, e := range ix.rootErr {
+		rootErr[name] = e
+	}
+	ix.mu.RUnlock()
+
+	counts, err := ix.store.Count(ctx)
+	if err != nil {
+		return status, err
+	}
+	status.Roots = make([]RootStatus, len(ix.roots))
+	for i, r := range ix.roots {
+		status.Roots[i] = RootStatus{Name: r.Name, Path: r.Path, Files: counts[r.Name], Error: rootErr[r.Name]}
+	}
+	return status, nil
+}
+
+// Rescan 遍历所有目录并更新索引，已有索引在进行时返回 ErrRunning
+func (ix *Indexer) Rescan(ctx context.Context) error {
+	ix.mu.Lock()
+	if ix.status.Running {
+		ix.mu.Unlock()
+		return ErrRunning
+	}
+	ix.status = Status{Running: true, LastStart: time.Now(), NextScan: ix.status.NextScan}
+	ix.mu.Unlock()
+
+	var errs []error
+	names := make([]string, len(ix.roots))
+	for i, r := range ix.roots {
+		names[i] = r.Name
+		err := ix.scanRoot(ctx, r)
+		ix.mu.Lock()
+		if err != nil {
+			ix.rootErr[r.Name] = err.Error()
+		} else {
+			delete(ix.rootErr, r.Name)
+		}
+		ix.mu.Unlock()
+		if err != nil {
+			if ctx.Err() != nil {
+				errs = append(errs, ctx.Err())
+				break
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", r.Name, err))
+		}
+	}
+	if ctx.Err() == nil {
+		removed, err := ix.store.removeRootsExcept(ctx, names)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		ix.update(func(s *Status) { s.Removed += removed })
+	}
+
+	err := errors.Join(errs...)
+	ix.update(func(s *Status) {
+		s.Running = false
+		s.LastEnd = time.Now()
+		if err != nil {
+			s.LastError = err.Error()
+		}
+	})
+	status, _ := ix.Status(ctx)
+	log.Printf("索引完成: 遍历 %d 个文件，计算哈希 %d 个，移除 %d 个，错误 %d 个，耗时 %v",
+		status.Scanned, status.Hashed, status.Removed, status.Errors,
+		status.LastEnd.Sub(status.LastStart).Round(time.Millisecond))
+	return err
+}
+
+// scanRoot 遍历单个目录，新文件和变化的文件交给工作协程计算哈希
+func (ix *Indexer) scanRoot(ctx context.Context, root Root) error {
+	existing, err := ix.store.existing(ctx, root.Name)
+	if err != nil {
+		return err
+	}
+
+	type job struct {
+		path  string
+		file  File
+		stale bool // 索引中有该文件变化前的记录
+	}
+	jobs := make(chan job)
+	results := make(chan File)
+
+	var workers sync.WaitGroup
+	for i := 0; i < ix.workers; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for j := range jobs {
+				hash, err := utils.CalculateMD5(j.path)
+				if err != nil {
+					log.Printf("计算MD5失败 %s: %v", j.path, err)
+					ix.update(func(s *Status) { s.Errors++ })
+					// 原有记录的哈希对应的内容已不存在，删除后由下次索引重新计算
+					if j.stale {
+						if err := ix.store.remove(ctx, root.Name, []string{j.file.Path}); err != nil {
+							log.Printf("删除索引失败 %s: %v", j.path, err)
+						} else {
+							ix.update(func(s *Status) { s.Removed++ })
+						}
+					}
+					continue
+				}
+				j.file.MD5 = hash
+				results <- j.file
+			}
+		}()
+	}
+
+	// 收集结果并分批写入数据库
+	saveErr := make(chan error, 1)
+	go func() {
+		var batch []File
+		var firstErr error
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			if err := ix.store.save(ctx, batch); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			ix.update(func(s *Status) { s.Hashed += int64(len(batch)) })
+			batch = batch[:0]
+		}
+		for f := range results {
+			batch = append(batch, f)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		}
+		flush()
+		saveErr <- firstErr
+	}()
+
+	seen := make(map[string]bool, len(existing))
+	var failed []string // 访问失败的文件或目录，其下原有的索引保留
+	walkErr := walk.Tree(root.Path, walk.Options{
+		Policy: ix.policy,
+		Ignore: func(string, os.FileInfo) bool { return ctx.Err() != nil },
+		OnFile: func(e walk.Entry) {
+			rel, err := filepath.Rel(root.Path, e.Path)
+			if err != nil {
+				return
+			}
+			rel = filepath.ToSlash(rel)
+			seen[rel] = true
+			ix.update(func(s *Status) { s.Scanned++ })
+
+			f := File{Root: root.Name, Path: rel, Size: e.Info.Size(), ModTime: e.Info.ModTime()}
+			old, ok := existing[rel]
+			if ok && old.Size == f.Size && old.ModTime.Equal(f.ModTime) {
+				return
+			}
+			jobs <- job{path: e.Path, file: f, stale: ok}
+		},
+		OnSkip: func(path, reason string) {
+			ix.update(func(s *Status) {
+				if s.SkipReasons == nil {
+					s.SkipReasons = make(map[string]int64)
+				}
+				s.SkipReasons[reason]++
+			})
+		},
+		OnError: func(path string, err error) {
+			log.Printf("访问失败 %s: %v", path, err)
+			ix.update(func(s *Status) { s.Errors++ })
+			if rel, err := filepath.Rel(root.Path, path); err == nil {
+				failed = append(failed, filepath.ToSlash(rel))
+			}
+		},
+	})
+	close(jobs)
+	workers.Wait()
+	close(results)
+	if err := <-saveErr; err != nil {
+		return err
+	}
+	if walkErr != nil {
+		return walkErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var removed []string
+	for rel := range existing {
+		if !seen[rel] && !underAny(rel, failed) {
+			removed = append(removed, rel)
+		}
+	}
+	if err := ix.store.remove(ctx, root.Name, removed); err != nil {
+		return err
+	}
+	ix.update(func(s *Status) { s.Removed += int64(len(removed)) })
+	return nil
+}
+
+// underAny 判断相对路径 rel 是否等于 dirs 中的某一项或位于其下，"." 表示整个目录
+func underAny(rel string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "." || rel == dir || strings.HasPrefix(rel, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (ix *Indexer) update(fn func(*Status)) {
+	ix.mu.Lock()
+	fn(&ix.status)
+	ix.mu.Unlock()
+}
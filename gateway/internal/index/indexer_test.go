@@ -0,0 +1,245 @@
+package index
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/sqlitedb"
+)
+
+const (
+	helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+	worldMD5 = "7d793037a0760186574b0282f2f435e7"
+)
+
+func TestIndexer(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	hello := filepath.Join(root, "docs", "hello.txt")
+	if err := os.WriteFile(hello, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := NewStore(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := New(store, Config{Roots: []Root{{Name: "share", Path: root}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	f, err := store.Lookup(ctx, helloMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Root != "share" || f.Path != "docs/hello.txt" || f.Size != 5 {
+		t.Fatalf("unexpected file: %+v", f)
+	}
+
+	// 未变化的文件不重新计算哈希
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	status, err := ix.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Scanned != 1 || status.Hashed != 0 || status.Roots[0].Files != 1 {
+		t.Fatalf("unexpected status after unchanged rescan: %+v", status)
+	}
+
+	// 内容变化后更新哈希
+	if err := os.WriteFile(hello, []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(hello, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, helloMD5); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("old hash: err = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := store.Lookup(ctx, worldMD5); err != nil {
+		t.Fatal(err)
+	}
+	files, err := store.LookupMany(ctx, []string{helloMD5, worldMD5})
+	if err != nil || len(files) != 1 || files[0].MD5 != worldMD5 || files[0].Path != "docs/hello.txt" {
+		t.Fatalf("LookupMany = %+v, %v", files, err)
+	}
+
+	// 删除的文件移出索引
+	if err := os.Remove(hello); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, worldMD5); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("removed file: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestIndexerMissingRoot(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := NewStore(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := New(store, Config{Roots: []Root{{Path: root}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目录暂时无法访问时保留原有索引
+	moved := root + ".moved"
+	if err := os.Rename(root, moved); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(moved, root)
+	if err := ix.Rescan(ctx); err == nil {
+		t.Fatal("rescan of missing root: want error")
+	}
+	if _, err := store.Lookup(ctx, helloMD5); err != nil {
+		t.Fatalf("index of missing root was dropped: %v", err)
+	}
+
+	// 从配置中移除的目录清除索引
+	ix, err = New(store, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, helloMD5); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("removed root: err = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestIndexerUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root 不受文件权限限制")
+	}
+	ctx := context.Background()
+	root := t.TempDir()
+	docs, pics := filepath.Join(root, "docs"), filepath.Join(root, "pics")
+	for _, dir := range []string{docs, pics} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hello := filepath.Join(docs, "hello.txt")
+	if err := os.WriteFile(hello, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(pics, "world.txt"), []byte("world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	store, err := NewStore(db, DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := New(store, Config{Roots: []Root{{Name: "share", Path: root}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 子目录暂时无法读取时保留其下的索引
+	if err := os.Chmod(pics, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(pics, 0755)
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, worldMD5); err != nil {
+		t.Fatalf("index of unreadable directory was dropped: %v", err)
+	}
+	status, err := ix.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Errors == 0 || status.Removed != 0 {
+		t.Fatalf("unexpected status with unreadable directory: %+v", status)
+	}
+	if err := os.Chmod(pics, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// 变化后无法计算哈希的文件移出索引，不再按原有的哈希返回
+	if err := os.WriteFile(hello, []byte("hullo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(hello, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(hello, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Lookup(ctx, helloMD5); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("stale hash: err = %v, want sql.ErrNoRows", err)
+	}
+
+	// 恢复读取后重新计算哈希
+	if err := os.Chmod(hello, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum([]byte("hullo"))
+	if f, err := store.Lookup(ctx, hex.EncodeToString(sum[:])); err != nil || f.Path != "docs/hello.txt" {
+		t.Fatalf("rehashed file = %+v, %v", f, err)
+	}
+	if _, err := store.Lookup(ctx, worldMD5); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,249 @@
+// Package index 网关自建的文件哈希索引
+//
+// 索引器按间隔遍历服务器上配置的目录，计算文件MD5并保存到网关的数据库
+// （MySQL 或内嵌的 SQLite），供 index 后端回答 /api/md5 查询。
+package index
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 数据库类型
+const (
+	DriverSQLite = "sqlite"
+	DriverMySQL  = "mysql"
+)
+
+// batchSize 单个事务写入或删除的行数
+const batchSize = 500
+
+// 表名带前缀，避免与共用 MySQL 数据库中的 Kodbox 表冲突。path_key 为
+// root 与 path 的MD5，长路径在 MySQL 中无法直接作为唯一索引。
+var schemas = map[string][]string{
+	DriverSQLite: {
+		`CREATE TABLE IF NOT EXISTS smartfinder_files (
+			path_key CHAR(32) PRIMARY KEY,
+			root VARCHAR(255) NOT NULL,
+			path TEXT NOT NULL,
+			md5 CHAR(32) NOT NULL,
+			size BIGINT NOT NULL,
+			mod_time BIGINT NOT NULL,
+			indexed_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_smartfinder_files_md5 ON smartfinder_files(md5)`,
+		`CREATE INDEX IF NOT EXISTS idx_smartfinder_files_root ON smartfinder_files(root)`,
+	},
+	DriverMySQL: {
+		`CREATE TABLE IF NOT EXISTS smartfinder_files (
+			path_key CHAR(32) NOT NULL PRIMARY KEY,
+			root VARCHAR(255) NOT NULL,
+			path TEXT NOT NULL,
+			md5 CHAR(32) NOT NULL,
+			size BIGINT NOT NULL,
+			mod_time BIGINT NOT NULL,
+			indexed_at BIGINT NOT NULL,
+			INDEX idx_smartfinder_files_md5 (md5),
+			INDEX idx_smartfinder_files_root (root)
+		)`,
+	},
+}
+
+var upsertSQL = map[string]string{
+	DriverSQLite: `INSERT INTO smartfinder_files (path_key, root, path, md5, size, mod_time, indexed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path_key) DO UPDATE SET md5 = excluded.md5, size = excluded.size,
+			mod_time = excluded.mod_time, indexed_at = excluded.indexed_at`,
+	DriverMySQL: `INSERT INTO smartfinder_files (path_key, root, path, md5, size, mod_time, indexed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE md5 = VALUES(md5), size = VALUES(size),
+			mod_time = VALUES(mod_time), indexed_at = VALUES(indexed_at)`,
+}
+
+// File 索引中的文件，Path 为相对所属目录的路径，使用 / 分隔
+type File struct {
+	Root    string
+	Path    string
+	MD5     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store 索引数据的存储
+type Store struct {
+	db     *sql.DB
+	driver string
+}
+
+// NewStore 在 db 上创建索引表（已存在时跳过）
+func NewStore(db *sql.DB, driver string) (*Store, error) {
+	schema, ok := schemas[driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的索引数据库: %q", driver)
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("创建索引表失败: %w", err)
+		}
+	}
+	return &Store{db: db, driver: driver}, nil
+}
+
+// Lookup 按哈希查找文件，不存在时返回 sql.ErrNoRows
+func (s *Store) Lookup(ctx context.Context, hash string) (*File, error) {
+	f := &File{MD5: strings.ToLower(hash)}
+	var modTime int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT root, path, size, mod_time FROM smartfinder_files WHERE md5 = ? LIMIT 1", f.MD5,
+	).Scan(&f.Root, &f.Path, &f.Size, &modTime)
+	if err != nil {
+		return nil, err
+	}
+	f.ModTime = time.Unix(0, modTime)
+	return f, nil
+}
+
+// LookupMany 查找多个哈希对应的所有文件，hashes 需为小写
+func (s *Store) LookupMany(ctx context.Context, hashes []string) ([]File, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	args := make([]any, len(hashes))
+	for i, hash := range hashes {
+		args[i] = hash
+	}
+	query := "SELECT md5, root, path, size, mod_time FROM smartfinder_files WHERE md5 IN (" +
+		strings.TrimSuffix(strings.Repeat("?,", len(hashes)), ",") + ") ORDER BY root, path"
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []File
+	for rows.Next() {
+		var f File
+		var modTime int64
+		if err := rows.Scan(&f.MD5, &f.Root, &f.Path, &f.Size, &modTime); err != nil {
+			return nil, err
+		}
+		f.ModTime = time.Unix(0, modTime)
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+// Ping 检查索引数据库连接
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Count 返回各目录的文件数
+func (s *Store) Count(ctx context.Context) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT root, COUNT(*) FROM smartfinder_files GROUP BY root")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var root string
+		var n int64
+		if err := rows.Scan(&root, &n); err != nil {
+			return nil, err
+		}
+		counts[root] = n
+	}
+	return counts, rows.Err()
+}
+
+// existing 返回目录下已索引的文件，用于增量索引
+func (s *Store) existing(ctx context.Context, root string) (map[string]File, error) {
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT path, md5, size, mod_time FROM smartfinder_files WHERE root = ?", root)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	files := make(map[string]File)
+	for rows.Next() {
+		f := File{Root: root}
+		var modTime int64
+		if err := rows.Scan(&f.Path, &f.MD5, &f.Size, &modTime); err != nil {
+			return nil, err
+		}
+		f.ModTime = time.Unix(0, modTime)
+		files[f.Path] = f
+	}
+	return files, rows.Err()
+}
+
+// save 写入或更新一批文件
+func (s *Store) save(ctx context.Context, files []File) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, upsertSQL[s.driver])
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	now := time.Now().UnixNano()
+	for _, f := range files {
+		_, err := stmt.ExecContext(ctx, pathKey(f.Root, f.Path), f.Root, f.Path, f.MD5, f.Size, f.ModTime.UnixNano(), now)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// remove 删除目录下的一批文件
+func (s *Store) remove(ctx context.Context, root string, paths []string) error {
+	for len(paths) > 0 {
+		n := min(len(paths), batchSize)
+		args := make([]any, n)
+		for i, p := range paths[:n] {
+			args[i] = pathKey(root, p)
+		}
+		query := "DELETE FROM smartfinder_files WHERE path_key IN (?" + strings.Repeat(", ?", n-1) + ")"
+		if _, err := s.db.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+		paths = paths[n:]
+	}
+	return nil
+}
+
+// removeRootsExcept 删除已不在配置中的目录的索引
+func (s *Store) removeRootsExcept(ctx context.Context, roots []string) (int64, error) {
+	query := "DELETE FROM smartfinder_files"
+	args := make([]any, len(roots))
+	for i, r := range roots {
+		args[i] = r
+	}
+	if len(roots) > 0 {
+		query += " WHERE root NOT IN (?" + strings.Repeat(", ?", len(roots)-1) + ")"
+	}
+	res, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func pathKey(root, path string) string {
+	sum := md5.Sum([]byte(root + "\x00" + path))
+	return hex.EncodeToString(sum[:])
+}
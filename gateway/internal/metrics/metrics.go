@@ -0,0 +1,206 @@
+// Package metrics 网关的 Prometheus 指标
+//
+// 所有方法在接收者为 nil 时不做任何事，未启用指标的网关（如测试中构造的
+// 实例）无需逐处判断。
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/cache"
+)
+
+// 解析途径
+const (
+	SourceServer = "server" // /api/md5 及其 JSON 响应
+	SourceBatch  = "batch"  // POST /api/resolve
+	SourceShare  = "share"  // 分享链接
+	SourceView   = "view"   // /view 预览页
+	SourceClient = "client" // md5.html 报告的本地客户端检查结果
+)
+
+// 解析结果
+const (
+	OutcomeFound       = "found"
+	OutcomeNotFound    = "not_found"
+	OutcomeError       = "error"
+	OutcomeUnavailable = "unavailable" // 仅 client：本地客户端未运行
+)
+
+const namespace = "smartfinder_gateway"
+
+// Metrics 网关指标
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	duration        *prometheus.HistogramVec
+	resolutions     *prometheus.CounterVec
+	backendDuration *prometheus.HistogramVec
+}
+
+// New 创建指标并注册 Go 运行时与进程指标
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "按路由、方法和状态码统计的请求数",
+		}, []string{"route", "method", "code"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "按路由和方法统计的请求耗时",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		resolutions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "resolutions_total",
+			Help:      "按解析途径和结果统计的哈希解析数",
+		}, []string{"source", "outcome"}),
+		backendDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "backend_query_duration_seconds",
+			Help:      "各后端查询（Kodbox、网关索引等数据库查询）的耗时",
+			Buckets:   []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"backend", "op", "result"}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.duration, m.resolutions, m.backendDuration,
+	)
+	return m
+}
+
+// Handler 返回 Prometheus 文本格式的 /metrics 处理器
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Middleware 统计请求数与耗时，路由取 mux 的路由模板，避免哈希等参数使标签无限增长
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		start := time.Now()
+		rw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rw, r)
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rw.status)).Inc()
+		m.duration.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
+
+// Resolution 记录一次哈希解析的结果
+func (m *Metrics) Resolution(source, outcome string) {
+	if m == nil {
+		return
+	}
+	m.resolutions.WithLabelValues(source, outcome).Inc()
+}
+
+// ResolutionErr 按后端链返回的错误记录解析结果
+func (m *Metrics) ResolutionErr(source string, err error) {
+	m.Resolution(source, OutcomeOf(err))
+}
+
+// OutcomeOf 返回后端链的错误对应的解析结果
+func OutcomeOf(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeFound
+	case errors.Is(err, backend.ErrNotFound):
+		return OutcomeNotFound
+	default:
+		return OutcomeError
+	}
+}
+
+// ObserveBackend 记录后端查询耗时，作为 backend.Chain 的观察函数
+func (m *Metrics) ObserveBackend(name, op string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	result := "ok"
+	switch {
+	case errors.Is(err, context.Canceled):
+		result = "canceled" // 并行查询时已由其他后端给出结果
+	case err != nil && !errors.Is(err, backend.ErrNotFound):
+		result = "error"
+	}
+	m.backendDuration.WithLabelValues(name, op, result).Observe(d.Seconds())
+}
+
+// RegisterDB 导出数据库连接池的统计，name 区分不同的数据库
+func (m *Metrics) RegisterDB(name string, db *sql.DB) {
+	if m == nil || db == nil {
+		return
+	}
+	m.registry.MustRegister(collectors.NewDBStatsCollector(db, name))
+}
+
+// RegisterCache 导出查询结果缓存的统计
+func (m *Metrics) RegisterCache(c *cache.Cache) {
+	if m == nil || c == nil {
+		return
+	}
+	counter := func(name, help string, value func(cache.Stats) int64) prometheus.Collector {
+		return prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "cache", Name: name, Help: help,
+		}, func() float64 { return float64(value(c.Stats())) })
+	}
+	m.registry.MustRegister(
+		counter("hits_total", "缓存命中数，含未找到结果的命中", func(s cache.Stats) int64 { return s.Hits }),
+		counter("negative_hits_total", "命中未找到结果的次数", func(s cache.Stats) int64 { return s.NegativeHits }),
+		counter("shared_hits_total", "共享缓存命中数", func(s cache.Stats) int64 { return s.SharedHits }),
+		counter("misses_total", "缓存未命中数", func(s cache.Stats) int64 { return s.Misses }),
+		counter("evictions_total", "因容量淘汰的结果数", func(s cache.Stats) int64 { return s.Evictions }),
+		counter("purges_total", "因文件变化或管理接口清除的结果数", func(s cache.Stats) int64 { return s.Purges }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace, Subsystem: "cache", Name: "entries", Help: "进程内缓存的结果数",
+		}, func() float64 { return float64(c.Stats().Size) }),
+	)
+}
+
+// statusWriter 记录响应状态码
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap 供 http.ResponseController 访问底层连接
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"smart-finder/gateway/internal/backend"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+	router := mux.NewRouter()
+	router.Use(m.Middleware)
+	router.HandleFunc("/api/md5", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	router.Handle("/metrics", m.Handler())
+
+	for _, hash := range []string{"a", "b"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/api/md5?hash="+hash, nil))
+	}
+	m.ResolutionErr(SourceServer, nil)
+	m.ResolutionErr(SourceServer, backend.ErrNotFound)
+	m.Resolution(SourceClient, OutcomeUnavailable)
+	m.ObserveBackend("kodbox", backend.OpLookup, 3*time.Millisecond, errors.New("boom"))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(w.Body)
+	for _, want := range []string{
+		`smartfinder_gateway_http_requests_total{code="404",method="GET",route="/api/md5"} 2`,
+		`smartfinder_gateway_resolutions_total{outcome="found",source="server"} 1`,
+		`smartfinder_gateway_resolutions_total{outcome="not_found",source="server"} 1`,
+		`smartfinder_gateway_resolutions_total{outcome="unavailable",source="client"} 1`,
+		`smartfinder_gateway_backend_query_duration_seconds_count{backend="kodbox",op="lookup",result="error"} 1`,
+		`go_goroutines`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics output missing %q", want)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.Resolution(SourceServer, OutcomeFound)
+	m.ObserveBackend("kodbox", backend.OpLookup, time.Millisecond, nil)
+	h := m.Middleware(http.NotFoundHandler())
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
@@ -0,0 +1,593 @@
+package preview
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Field front matter 中的一项
+type Field struct {
+	Key   string
+	Value string
+}
+
+// FrontMatter 拆分 markdown 开头以 --- 包围的 front matter，返回其中的
+// "key: value" 项与正文；"- item" 形式的列表以逗号连接
+func FrontMatter(text string) ([]Field, string) {
+	if !strings.HasPrefix(text, "---\n") {
+		return nil, text
+	}
+	end := strings.Index(text[4:], "\n---")
+	if end < 0 {
+		return nil, text
+	}
+	head, body := text[4:4+end], text[4+end+4:]
+	if i := strings.IndexByte(body, '\n'); i >= 0 && strings.TrimSpace(body[:i]) == "" {
+		body = body[i+1:]
+	} else if strings.TrimSpace(body) == "" {
+		body = ""
+	} else {
+		return nil, text // 结束行后还有其他字符，不是 front matter
+	}
+
+	var fields []Field
+	for _, line := range strings.Split(head, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && len(fields) > 0 {
+			last := &fields[len(fields)-1]
+			if last.Value != "" {
+				last.Value += ", "
+			}
+			last.Value += unquote(item)
+			continue
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			items := strings.Split(value[1:len(value)-1], ",")
+			for i, item := range items {
+				items[i] = unquote(strings.TrimSpace(item))
+			}
+			value = strings.Join(items, ", ")
+		}
+		fields = append(fields, Field{Key: strings.TrimSpace(key), Value: unquote(value)})
+	}
+	return fields, body
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Markdown 把 markdown 渲染为 HTML
+//
+// 支持 CommonMark 的常用语法与 GFM 的表格、任务列表和删除线。原始 HTML
+// 按文本转义输出，链接只允许 http、https、mailto 与相对地址，因此结果
+// 可以直接嵌入页面。
+func Markdown(text string) template.HTML {
+	r := &renderer{ids: make(map[string]int)}
+	r.blocks(strings.Split(strings.ReplaceAll(text, "\t", "    "), "\n"), false)
+	return template.HTML(r.out.String())
+}
+
+type renderer struct {
+	out strings.Builder
+	ids map[string]int // 已使用的标题 id
+}
+
+var (
+	headingRe   = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ ]+(.*?))?(?:[ ]+#+)?[ ]*$`)
+	hrRe        = regexp.MustCompile(`^ {0,3}(?:(?:\*[ ]*){3,}|(?:-[ ]*){3,}|(?:_[ ]*){3,})$`)
+	fenceRe     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ ]*([^`\\s]*)")
+	listRe      = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])(?:[ ]+|$)`)
+	tableSepRe  = regexp.MustCompile(`^[ ]*\|?[ ]*:?-+:?[ ]*(?:\|[ ]*:?-+:?[ ]*)*\|?[ ]*$`)
+	setextH1Re  = regexp.MustCompile(`^ {0,3}=+[ ]*$`)
+	setextH2Re  = regexp.MustCompile(`^ {0,3}-+[ ]*$`)
+	taskRe      = regexp.MustCompile(`^\[([ xX])\][ ]+`)
+	autolinkRe  = regexp.MustCompile(`^<((?:https?|mailto):[^\s<>]+)>`)
+	blankRe     = regexp.MustCompile(`^[ ]*$`)
+	quoteRe     = regexp.MustCompile(`^ {0,3}>[ ]?`)
+	indentRe    = regexp.MustCompile(`^[ ]*`)
+	slugStripRe = regexp.MustCompile(`[^\p{L}\p{N}\- ]+`)
+)
+
+func isBlank(line string) bool { return blankRe.MatchString(line) }
+
+// startsBlock 该行是否开始一个新的块，用于结束段落
+func startsBlock(line string) bool {
+	return headingRe.MatchString(line) || hrRe.MatchString(line) || fenceRe.MatchString(line) ||
+		quoteRe.MatchString(line) || listRe.MatchString(line)
+}
+
+// blocks 渲染块级元素，tight 为紧凑列表项，段落不包裹 <p>
+func (r *renderer) blocks(lines []string, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+		case fenceRe.MatchString(line):
+			i = r.fence(lines, i)
+		case headingRe.MatchString(line):
+			m := headingRe.FindStringSubmatch(line)
+			r.heading(len(m[1]), m[2])
+			i++
+		case hrRe.MatchString(line):
+			r.out.WriteString("<hr>\n")
+			i++
+		case quoteRe.MatchString(line):
+			var inner []string
+			for ; i < len(lines) && quoteRe.MatchString(lines[i]); i++ {
+				inner = append(inner, quoteRe.ReplaceAllString(lines[i], ""))
+			}
+			r.out.WriteString("<blockquote>\n")
+			r.blocks(inner, false)
+			r.out.WriteString("</blockquote>\n")
+		case listRe.MatchString(line):
+			i = r.list(lines, i)
+		case i+1 < len(lines) && strings.Contains(line, "|") && tableSepRe.MatchString(lines[i+1]) &&
+			strings.Contains(lines[i+1], "-"):
+			i = r.table(lines, i)
+		default:
+			i = r.paragraph(lines, i, tight)
+		}
+	}
+}
+
+func (r *renderer) fence(lines []string, i int) int {
+	m := fenceRe.FindStringSubmatch(lines[i])
+	indent, marker, lang := len(m[1]), m[2], m[3]
+	var code []string
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, marker) && strings.Trim(trimmed, marker[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		for n := 0; n < indent && strings.HasPrefix(line, " "); n++ {
+			line = line[1:]
+		}
+		code = append(code, line)
+	}
+	r.out.WriteString("<pre><code")
+	if lang != "" {
+		fmt.Fprintf(&r.out, ` class="language-%s"`, html.EscapeString(lang))
+	}
+	r.out.WriteString(">")
+	for _, line := range code {
+		r.out.WriteString(html.EscapeString(line))
+		r.out.WriteString("\n")
+	}
+	r.out.WriteString("</code></pre>\n")
+	return i
+}
+
+func (r *renderer) heading(level int, text string) {
+	text = strings.TrimSpace(text)
+	id := r.slug(text)
+	fmt.Fprintf(&r.out, "<h%d id=\"%s\">%s</h%d>\n", level, html.EscapeString(id), inline(text), level)
+}
+
+// slug 生成标题的 id，重复时加上序号
+func (r *renderer) slug(text string) string {
+	s := strings.ToLower(slugStripRe.ReplaceAllString(text, ""))
+	s = strings.ReplaceAll(strings.TrimSpace(s), " ", "-")
+	if s == "" {
+		s = "section"
+	}
+	n := r.ids[s]
+	r.ids[s] = n + 1
+	if n > 0 {
+		s += "-" + strconv.Itoa(n)
+	}
+	return s
+}
+
+func (r *renderer) paragraph(lines []string, i int, tight bool) int {
+	var para []string
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if isBlank(line) || (len(para) > 0 && startsBlock(line) && !setextH2Re.MatchString(line)) {
+			break
+		}
+		if len(para) > 0 && setextH1Re.MatchString(line) {
+			r.heading(1, strings.Join(para, " "))
+			return i + 1
+		}
+		if len(para) > 0 && setextH2Re.MatchString(line) {
+			r.heading(2, strings.Join(para, " "))
+			return i + 1
+		}
+		para = append(para, strings.TrimLeft(line, " "))
+	}
+	text := inline(strings.Join(para, "\n"))
+	if tight {
+		r.out.WriteString(text)
+		r.out.WriteString("\n")
+	} else {
+		r.out.WriteString("<p>" + text + "</p>\n")
+	}
+	return i
+}
+
+// listItem 列表项的内容行，已去掉标记与缩进
+type listItem struct {
+	lines []string
+}
+
+func (r *renderer) list(lines []string, i int) int {
+	m := listRe.FindStringSubmatch(lines[i])
+	marker := m[2]
+	ordered := marker[len(marker)-1] == '.' || marker[len(marker)-1] == ')'
+	delim := marker[len(marker)-1]
+
+	var items []listItem
+	tight := true
+	pendingBlank := false
+	contentIndent := 0
+	for i < len(lines) {
+		line := lines[i]
+		if isBlank(line) {
+			pendingBlank = true
+			i++
+			continue
+		}
+		indent := len(indentRe.FindString(line))
+		if lm := listRe.FindStringSubmatch(line); lm != nil && (len(items) == 0 || indent < contentIndent) {
+			if mk := lm[2]; mk[len(mk)-1] != delim {
+				break // 不同的标记开始新的列表
+			}
+			if pendingBlank && len(items) > 0 {
+				tight = false
+			}
+			pendingBlank = false
+			contentIndent = len(lm[0])
+			if len(lm[0]) == len(line) { // 空的列表项
+				contentIndent = len(lm[1]) + len(lm[2]) + 1
+			}
+			items = append(items, listItem{lines: []string{line[len(lm[0]):]}})
+			i++
+			continue
+		}
+		if indent >= contentIndent {
+			if pendingBlank {
+				items[len(items)-1].lines = append(items[len(items)-1].lines, "")
+				tight = false
+			}
+			pendingBlank = false
+			items[len(items)-1].lines = append(items[len(items)-1].lines, line[contentIndent:])
+			i++
+			continue
+		}
+		if pendingBlank || startsBlock(line) {
+			break
+		}
+		// 段落的延续行
+		items[len(items)-1].lines = append(items[len(items)-1].lines, line)
+		i++
+	}
+
+	tag := "ul"
+	if ordered {
+		tag = "ol"
+		if start, _ := strconv.Atoi(strings.TrimRight(marker, ".)")); start != 1 {
+			fmt.Fprintf(&r.out, "<ol start=\"%d\">\n", start)
+		} else {
+			r.out.WriteString("<ol>\n")
+		}
+	} else {
+		r.out.WriteString("<ul>\n")
+	}
+	for _, item := range items {
+		r.out.WriteString("<li>")
+		if tm := taskRe.FindStringSubmatch(item.lines[0]); tm != nil {
+			checked := ""
+			if tm[1] != " " {
+				checked = " checked"
+			}
+			fmt.Fprintf(&r.out, `<input type="checkbox" disabled%s> `, checked)
+			item.lines[0] = item.lines[0][len(tm[0]):]
+		}
+		r.blocks(item.lines, tight)
+		r.out.WriteString("</li>\n")
+	}
+	r.out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+func (r *renderer) table(lines []string, i int) int {
+	header := splitRow(lines[i])
+	var aligns []string
+	for _, cell := range splitRow(lines[i+1]) {
+		switch left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":"); {
+		case left && right:
+			aligns = append(aligns, "center")
+		case right:
+			aligns = append(aligns, "right")
+		case left:
+			aligns = append(aligns, "left")
+		default:
+			aligns = append(aligns, "")
+		}
+	}
+	cell := func(tag string, col int, text string) {
+		if col < len(aligns) && aligns[col] != "" {
+			fmt.Fprintf(&r.out, "<%s style=\"text-align: %s\">%s</%s>", tag, aligns[col], inline(text), tag)
+		} else {
+			fmt.Fprintf(&r.out, "<%s>%s</%s>", tag, inline(text), tag)
+		}
+	}
+
+	r.out.WriteString("<table>\n<thead>\n<tr>")
+	for col, text := range header {
+		cell("th", col, text)
+	}
+	r.out.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for i += 2; i < len(lines) && !isBlank(lines[i]) && strings.Contains(lines[i], "|"); i++ {
+		row := splitRow(lines[i])
+		r.out.WriteString("<tr>")
+		for col := range header {
+			text := ""
+			if col < len(row) {
+				text = row[col]
+			}
+			cell("td", col, text)
+		}
+		r.out.WriteString("</tr>\n")
+	}
+	r.out.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// splitRow 拆分表格行，\| 不作为分隔符
+func splitRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+// inline 渲染行内元素：代码、链接、图片、自动链接、强调、删除线与换行
+func inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_{}[]()#+-.!|~<>\"'", s[i+1]) >= 0:
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			b.WriteString("<br>\n")
+			i += 2
+		case c == '`':
+			n := runLength(s, i, '`')
+			end := codeSpanEnd(s, i+n, n)
+			if end < 0 {
+				b.WriteString(s[i : i+n])
+				i += n
+				break
+			}
+			code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			i = end + n
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if text, dest, n, ok := parseLink(s, i+1); ok {
+				fmt.Fprintf(&b, `<img src="%s" alt="%s">`, html.EscapeString(safeURL(dest)), html.EscapeString(plain(text)))
+				i += 1 + n
+			} else {
+				b.WriteString("!")
+				i++
+			}
+		case c == '[':
+			if text, dest, n, ok := parseLink(s, i); ok {
+				fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(safeURL(dest)), inline(text))
+				i += n
+			} else {
+				b.WriteString("[")
+				i++
+			}
+		case c == '<':
+			if m := autolinkRe.FindStringSubmatch(s[i:]); m != nil {
+				url := html.EscapeString(m[1])
+				fmt.Fprintf(&b, `<a href="%s">%s</a>`, url, url)
+				i += len(m[0])
+			} else {
+				b.WriteString("&lt;")
+				i++
+			}
+		case c == '*' || c == '_' || c == '~':
+			n, out, ok := emphasis(s, i)
+			if ok {
+				b.WriteString(out)
+			} else {
+				b.WriteString(html.EscapeString(s[i : i+n]))
+			}
+			i += n
+		case c == '\n':
+			if strings.HasSuffix(b.String(), "  ") {
+				trimmed := strings.TrimRight(b.String(), " ")
+				b.Reset()
+				b.WriteString(trimmed + "<br>")
+			}
+			b.WriteString("\n")
+			i++
+		default:
+			b.WriteString(html.EscapeString(s[i : i+1]))
+			i++
+		}
+	}
+	return b.String()
+}
+
+// codeSpanEnd 返回从 start 开始长度恰好为 n 的反引号串的位置，没有时返回 -1
+func codeSpanEnd(s string, start, n int) int {
+	for j := start; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j, '`')
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// emphasis 处理 *、_ 与 ~ 的分隔符，返回消耗的字节数与渲染结果
+func emphasis(s string, i int) (int, string, bool) {
+	c := s[i]
+	run := runLength(s, i, c)
+	if c == '~' && run != 2 {
+		return run, "", false
+	}
+	n := min(run, 2)
+	// 分隔符后不能是空白；_ 在单词内部时不作为强调（如 snake_case）
+	if i+n >= len(s) || unicode.IsSpace(rune(s[i+n])) {
+		return run, "", false
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return run, "", false
+	}
+	delim := s[i : i+n]
+	for j := i + n; j < len(s); j++ {
+		if s[j] == '`' { // 不跨越代码
+			if end := strings.IndexByte(s[j+1:], '`'); end >= 0 {
+				j += end + 1
+				continue
+			}
+		}
+		if j == i+n || !strings.HasPrefix(s[j:], delim) || unicode.IsSpace(rune(s[j-1])) {
+			continue
+		}
+		if n == 1 && j+1 < len(s) && s[j+1] == c { // 跳过 ** 等更长的分隔符
+			j += runLength(s, j, c) - 1
+			continue
+		}
+		if c == '_' && j+n < len(s) && isWordByte(s[j+n]) {
+			continue
+		}
+		inner := inline(s[i+n : j])
+		tag := "em"
+		switch {
+		case c == '~':
+			tag = "del"
+		case n == 2:
+			tag = "strong"
+		}
+		return j + n - i, "<" + tag + ">" + inner + "</" + tag + ">", true
+	}
+	return run, "", false
+}
+
+func isWordByte(b byte) bool {
+	return b >= 0x80 || b == '_' || unicode.IsLetter(rune(b)) || unicode.IsDigit(rune(b))
+}
+
+// parseLink 解析从 s[i]（'['）开始的 [text](dest "title")，返回消耗的字节数
+func parseLink(s string, i int) (text, dest string, n int, ok bool) {
+	depth := 0
+	j := i
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j >= len(s) || j+1 >= len(s) || s[j+1] != '(' {
+		return "", "", 0, false
+	}
+	text = s[i+1 : j]
+	k := j + 2
+	depth = 1
+	for ; k < len(s); k++ {
+		if s[k] == '(' {
+			depth++
+		} else if s[k] == ')' {
+			depth--
+			if depth == 0 {
+				break
+			}
+		} else if s[k] == '\n' {
+			return "", "", 0, false
+		}
+	}
+	if k >= len(s) {
+		return "", "", 0, false
+	}
+	dest = strings.TrimSpace(s[j+2 : k])
+	if sp := strings.IndexAny(dest, " \t"); sp >= 0 { // 去掉标题
+		dest = dest[:sp]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return text, dest, k + 1 - i, true
+}
+
+// safeURL 只保留 http、https、mailto 与相对地址，其余（如 javascript:）替换为 #
+func safeURL(u string) string {
+	scheme, _, found := strings.Cut(u, ":")
+	if !found || strings.ContainsAny(scheme, "/?#") {
+		return u
+	}
+	switch strings.ToLower(scheme) {
+	case "http", "https", "mailto":
+		return u
+	}
+	return "#"
+}
+
+// plain 去掉行内标记，用于图片的 alt
+func plain(s string) string {
+	return strings.NewReplacer("*", "", "_", "", "`", "", "~", "").Replace(s)
+}
@@ -0,0 +1,100 @@
+// Package preview 为 /view 页面判断文件的预览方式，并在服务端把 markdown
+// 渲染为 HTML、把代码拆分为带行号的行
+//
+// 与 client-front 的 /view 页面支持的类型相同：图片、视频（及音频）、PDF、
+// markdown 与代码（其他文本文件）。
+package preview
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// 预览方式
+const (
+	KindImage    = "image"
+	KindVideo    = "video"
+	KindAudio    = "audio"
+	KindPDF      = "pdf"
+	KindMarkdown = "markdown"
+	KindCode     = "code"
+	KindOther    = "other" // 不能预览，按普通查询处理
+)
+
+// MaxTextSize 服务端渲染的 markdown 与代码的最大字节数，超出部分不显示
+const MaxTextSize = 1 << 20
+
+// languages 代码文件扩展名对应的语言，用于 language-* 类名；不在表中的
+// text/* 文件同样按代码显示
+var languages = map[string]string{
+	".c": "c", ".h": "c", ".cc": "cpp", ".cpp": "cpp", ".hpp": "cpp",
+	".cs": "csharp", ".css": "css", ".go": "go", ".html": "html", ".htm": "html",
+	".java": "java", ".js": "javascript", ".mjs": "javascript", ".json": "json",
+	".jsx": "jsx", ".kt": "kotlin", ".lua": "lua", ".php": "php", ".py": "python",
+	".rb": "ruby", ".rs": "rust", ".scss": "scss", ".sh": "bash", ".bash": "bash",
+	".sql": "sql", ".swift": "swift", ".toml": "toml", ".ts": "typescript",
+	".tsx": "tsx", ".vue": "markup", ".xml": "xml", ".yaml": "yaml", ".yml": "yaml",
+	".ini": "ini", ".conf": "ini", ".bat": "batch", ".ps1": "powershell",
+	".dockerfile": "docker", ".proto": "protobuf", ".txt": "text", ".log": "text",
+	".csv": "text",
+}
+
+// Kind 按文件名与 Content-Type 判断预览方式
+func Kind(name, contentType string) string {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	ext := strings.ToLower(path.Ext(name))
+	switch {
+	case ext == ".ts" && mediaType == "video/mp2t":
+		// .ts 的系统类型为 MPEG-TS 视频，链接到的通常是 TypeScript 源码
+		return KindCode
+	case mediaType == "text/markdown":
+		return KindMarkdown
+	case strings.HasPrefix(mediaType, "image/"):
+		return KindImage
+	case strings.HasPrefix(mediaType, "video/"):
+		return KindVideo
+	case strings.HasPrefix(mediaType, "audio/"):
+		return KindAudio
+	case mediaType == "application/pdf":
+		return KindPDF
+	case strings.HasPrefix(mediaType, "text/"):
+		return KindCode
+	}
+	if _, ok := languages[ext]; ok {
+		return KindCode
+	}
+	return KindOther
+}
+
+// Language 返回代码文件的语言，未知时为 text
+func Language(name string) string {
+	if lang, ok := languages[strings.ToLower(path.Ext(name))]; ok {
+		return lang
+	}
+	if strings.EqualFold(name, "Dockerfile") {
+		return "docker"
+	}
+	if strings.EqualFold(name, "Makefile") {
+		return "makefile"
+	}
+	return "text"
+}
+
+// Text 把文件内容转换为有效的 UTF-8，去掉 BOM 并统一换行符
+func Text(data []byte) string {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	s := string(data)
+	if !utf8.ValidString(s) {
+		s = strings.ToValidUTF8(s, "�")
+	}
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// Lines 把代码拆分为行，忽略末尾的换行
+func Lines(text string) []string {
+	text = strings.TrimSuffix(text, "\n")
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,88 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	for _, tc := range []struct {
+		name, contentType, want string
+	}{
+		{"a.png", "image/png", KindImage},
+		{"a.mp4", "video/mp4", KindVideo},
+		{"a.mp3", "audio/mpeg", KindAudio},
+		{"a.pdf", "application/pdf", KindPDF},
+		{"README.md", "text/markdown; charset=utf-8", KindMarkdown},
+		{"main.go", "text/plain; charset=utf-8", KindCode},
+		{"app.ts", "video/mp2t", KindCode},
+		{"data.json", "application/json", KindCode},
+		{"a.zip", "application/zip", KindOther},
+	} {
+		if got := Kind(tc.name, tc.contentType); got != tc.want {
+			t.Errorf("Kind(%q, %q) = %s, want %s", tc.name, tc.contentType, got, tc.want)
+		}
+	}
+}
+
+func TestFrontMatter(t *testing.T) {
+	fields, body := FrontMatter("---\ntitle: \"周报\"\ntags: [a, b]\nauthors:\n  - 张三\n  - 李四\n---\n# 正文\n")
+	want := []Field{{"title", "周报"}, {"tags", "a, b"}, {"authors", "张三, 李四"}}
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %+v", fields)
+	}
+	for i := range want {
+		if fields[i] != want[i] {
+			t.Errorf("fields[%d] = %+v, want %+v", i, fields[i], want[i])
+		}
+	}
+	if body != "# 正文\n" {
+		t.Errorf("body = %q", body)
+	}
+
+	if fields, body := FrontMatter("---\n\ntext"); fields != nil || body != "---\n\ntext" {
+		t.Errorf("unterminated front matter: %+v %q", fields, body)
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{"heading", "# Hello *World*", `<h1 id="hello-world">Hello <em>World</em></h1>`},
+		{"duplicate ids", "## A\n## A", `<h2 id="a">A</h2>` + "\n" + `<h2 id="a-1">A</h2>`},
+		{"setext", "Title\n=====", `<h1 id="title">Title</h1>`},
+		{"paragraph", "one\ntwo", "<p>one\ntwo</p>"},
+		{"emphasis", "**bold** _em_ ~~del~~ snake_case_name", "<p><strong>bold</strong> <em>em</em> <del>del</del> snake_case_name</p>"},
+		{"code span", "use `a < b` here", "<p>use <code>a &lt; b</code> here</p>"},
+		{"raw html escaped", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"link", "[docs](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2">docs</a></p>`},
+		{"unsafe link", "[x](javascript:alert(1))", `<p><a href="#">x</a></p>`},
+		{"image", "![logo *1*](img/logo.png \"title\")", `<p><img src="img/logo.png" alt="logo 1"></p>`},
+		{"autolink", "<https://example.com>", `<p><a href="https://example.com">https://example.com</a></p>`},
+		{"fence", "```go\nfunc main() {}\n  x < y\n```", `<pre><code class="language-go">func main() {}` + "\n  x &lt; y\n</code></pre>"},
+		{"quote", "> quoted\n> more", "<blockquote>\n<p>quoted\nmore</p>\n</blockquote>"},
+		{"hr", "a\n\n---\n\nb", "<p>a</p>\n<hr>\n<p>b</p>"},
+		{"tight list", "- a\n- b", "<ul>\n<li>a\n</li>\n<li>b\n</li>\n</ul>"},
+		{"ordered start", "3. c\n4. d", "<ol start=\"3\">\n<li>c\n</li>\n<li>d\n</li>\n</ol>"},
+		{"loose list", "- a\n\n- b", "<ul>\n<li><p>a</p>\n</li>\n<li><p>b</p>\n</li>\n</ul>"},
+		{"nested list", "- a\n  - b", "<ul>\n<li>a\n<ul>\n<li>b\n</li>\n</ul>\n</li>\n</ul>"},
+		{"task list", "- [x] done\n- [ ] todo", "<ul>\n<li><input type=\"checkbox\" disabled checked> done\n</li>\n<li><input type=\"checkbox\" disabled> todo\n</li>\n</ul>"},
+		{"table", "| a | b |\n|:--|--:|\n| 1 | 2 \\| 3 |",
+			"<table>\n<thead>\n<tr><th style=\"text-align: left\">a</th><th style=\"text-align: right\">b</th></tr>\n</thead>\n" +
+				"<tbody>\n<tr><td style=\"text-align: left\">1</td><td style=\"text-align: right\">2 | 3</td></tr>\n</tbody>\n</table>"},
+		{"hard break", "a  \nb", "<p>a<br>\nb</p>"},
+	} {
+		got := strings.TrimSpace(string(Markdown(tc.in)))
+		if got != tc.want {
+			t.Errorf("%s:\ngot  %q\nwant %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := Lines(Text([]byte("\xef\xbb\xbfa\r\nb\n")))
+	if len(lines) != 2 || lines[0] != "a" || lines[1] != "b" {
+		t.Errorf("lines = %q", lines)
+	}
+}
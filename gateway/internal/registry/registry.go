@@ -0,0 +1,336 @@
+// Package registry 登记客户端及其发布的文件
+//
+// 启用登记的客户端定期向网关发布索引摘要（所选监控目录中文件的哈希，
+// 按客户端设置附带路径），网关据此回答“文件在哪台主机的哪个路径”。
+// 客户端在两次发布之间发送心跳，索引摘要未变化时不需要重新发布；超过
+// offline_after 没有心跳的主机不参与查询。
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"smart-finder/shared/types"
+	"smart-finder/shared/utils"
+)
+
+// 数据库类型
+const (
+	DriverSQLite = "sqlite"
+	DriverMySQL  = "mysql"
+)
+
+// 默认配置
+const (
+	DefaultSQLitePath   = "data/registry.db"
+	DefaultOfflineAfter = time.Hour
+	DefaultMaxFiles     = 1000000
+)
+
+// batchSize 单条 INSERT 写入的文件数
+const batchSize = 500
+
+var (
+	// ErrNotFound 主机未登记
+	ErrNotFound = errors.New("主机未登记")
+	// ErrInvalid 发布的内容无效，如 client_id 格式错误
+	ErrInvalid = errors.New("无效的发布内容")
+	// ErrTooManyFiles 发布的文件数超过 max_files
+	ErrTooManyFiles = errors.New("发布的文件数超过上限")
+)
+
+// clientIDPattern 客户端自行生成的标识
+var clientIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+var schemas = map[string][]string{
+	DriverSQLite: {
+		`CREATE TABLE IF NOT EXISTS smartfinder_hosts (
+			id VARCHAR(64) PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			version VARCHAR(64) NOT NULL DEFAULT '',
+			digest VARCHAR(64) NOT NULL DEFAULT '',
+			files BIGINT NOT NULL DEFAULT 0,
+			registered_at BIGINT NOT NULL,
+			published_at BIGINT NOT NULL,
+			last_seen BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS smartfinder_host_files (
+			host_id VARCHAR(64) NOT NULL,
+			md5 CHAR(32) NOT NULL,
+			path TEXT NOT NULL,
+			size BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS idx_smartfinder_host_files_md5 ON smartfinder_host_files(md5)`,
+		`CREATE INDEX IF NOT EXISTS idx_smartfinder_host_files_host ON smartfinder_host_files(host_id)`,
+	},
+	DriverMySQL: {
+		`CREATE TABLE IF NOT EXISTS smartfinder_hosts (
+			id VARCHAR(64) NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			version VARCHAR(64) NOT NULL DEFAULT '',
+			digest VARCHAR(64) NOT NULL DEFAULT '',
+			files BIGINT NOT NULL DEFAULT 0,
+			registered_at BIGINT NOT NULL,
+			published_at BIGINT NOT NULL,
+			last_seen BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS smartfinder_host_files (
+			host_id VARCHAR(64) NOT NULL,
+			md5 CHAR(32) NOT NULL,
+			path TEXT NOT NULL,
+			size BIGINT NOT NULL,
+			INDEX idx_smartfinder_host_files_md5 (md5),
+			INDEX idx_smartfinder_host_files_host (host_id)
+		)`,
+	},
+}
+
+var upsertHostSQL = map[string]string{
+	DriverSQLite: `INSERT INTO smartfinder_hosts (id, name, version, digest, files, registered_at, published_at, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET name = excluded.name, version = excluded.version, digest = excluded.digest,
+			files = excluded.files, published_at = excluded.published_at, last_seen = excluded.last_seen`,
+	DriverMySQL: `INSERT INTO smartfinder_hosts (id, name, version, digest, files, registered_at, published_at, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE name = VALUES(name), version = VALUES(version), digest = VALUES(digest),
+			files = VALUES(files), published_at = VALUES(published_at), last_seen = VALUES(last_seen)`,
+}
+
+// Config 客户端登记配置
+type Config struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Token 客户端发布与心跳时携带的令牌（Authorization: Bearer），启用时必须配置
+	Token        string        `mapstructure:"token"`
+	Driver       string        `mapstructure:"driver"` // sqlite 或 mysql
+	SQLitePath   string        `mapstructure:"sqlite_path"`
+	OfflineAfter time.Duration `mapstructure:"offline_after"` // 超过该时间没有心跳的主机不参与查询
+	MaxFiles     int           `mapstructure:"max_files"`     // 单个客户端最多发布的文件数
+}
+
+// Host 已登记的主机
+type Host struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Version      string    `json:"version,omitempty"`
+	Files        int64     `json:"files"`
+	RegisteredAt time.Time `json:"registered_at"`
+	PublishedAt  time.Time `json:"published_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	Online       bool      `json:"online"`
+}
+
+// Location 文件在某台主机上的位置，客户端未发布路径时 Path 为空
+type Location struct {
+	MD5      string
+	HostID   string
+	Host     string
+	Path     string
+	Size     int64
+	LastSeen time.Time
+}
+
+// Registry 主机登记与文件查询
+type Registry struct {
+	db           *sql.DB
+	driver       string
+	offlineAfter time.Duration
+	maxFiles     int
+	now          func() time.Time
+}
+
+// New 在 db 上创建登记表（已存在时跳过）
+func New(db *sql.DB, cfg Config) (*Registry, error) {
+	schema, ok := schemas[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的登记数据库: %q", cfg.Driver)
+	}
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("创建登记表失败: %w", err)
+		}
+	}
+	r := &Registry{
+		db:           db,
+		driver:       cfg.Driver,
+		offlineAfter: cfg.OfflineAfter,
+		maxFiles:     cfg.MaxFiles,
+		now:          time.Now,
+	}
+	if r.offlineAfter <= 0 {
+		r.offlineAfter = DefaultOfflineAfter
+	}
+	if r.maxFiles <= 0 {
+		r.maxFiles = DefaultMaxFiles
+	}
+	return r, nil
+}
+
+// MaxFiles 单个客户端最多发布的文件数
+func (r *Registry) MaxFiles() int {
+	return r.maxFiles
+}
+
+// Publish 登记主机并以 p.Files 替换其之前发布的文件
+func (r *Registry) Publish(ctx context.Context, p *types.RegistryPublish) error {
+	if !clientIDPattern.MatchString(p.ClientID) {
+		return fmt.Errorf("%w: client_id 应为 16-64 位字母、数字、- 或 _", ErrInvalid)
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" || len(p.Name) > 255 {
+		return fmt.Errorf("%w: 主机名为空或过长", ErrInvalid)
+	}
+	if len(p.Version) > 64 || len(p.Digest) > 64 {
+		return fmt.Errorf("%w: version 或 digest 过长", ErrInvalid)
+	}
+	if len(p.Files) > r.maxFiles {
+		return ErrTooManyFiles
+	}
+	for i := range p.Files {
+		if !utils.ValidateMD5(p.Files[i].MD5) {
+			return fmt.Errorf("%w: 无效的MD5哈希 %q", ErrInvalid, p.Files[i].MD5)
+		}
+		p.Files[i].MD5 = strings.ToLower(p.Files[i].MD5)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := r.now().UnixMilli()
+	if _, err := tx.ExecContext(ctx, upsertHostSQL[r.driver],
+		p.ClientID, p.Name, p.Version, p.Digest, len(p.Files), now, now, now); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM smartfinder_host_files WHERE host_id = ?", p.ClientID); err != nil {
+		return err
+	}
+	for start := 0; start < len(p.Files); start += batchSize {
+		batch := p.Files[start:min(start+batchSize, len(p.Files))]
+		args := make([]any, 0, len(batch)*4)
+		for _, f := range batch {
+			args = append(args, p.ClientID, f.MD5, f.Path, f.Size)
+		}
+		query := "INSERT INTO smartfinder_host_files (host_id, md5, path, size) VALUES " +
+			strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?),", len(batch)), ",")
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Heartbeat 记录主机在线，返回网关保存的摘要是否与 digest 一致；主机未
+// 登记时返回 false，客户端随后重新发布
+func (r *Registry) Heartbeat(ctx context.Context, clientID, digest string) (bool, error) {
+	if _, err := r.db.ExecContext(ctx, "UPDATE smartfinder_hosts SET last_seen = ? WHERE id = ?",
+		r.now().UnixMilli(), clientID); err != nil {
+		return false, err
+	}
+	var current string
+	err := r.db.QueryRowContext(ctx, "SELECT digest FROM smartfinder_hosts WHERE id = ?", clientID).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil && current == digest, err
+}
+
+// Lookup 查找在线主机上哈希对应的文件，最近有心跳的主机在前
+func (r *Registry) Lookup(ctx context.Context, hash string) ([]Location, error) {
+	found, err := r.LookupMany(ctx, []string{strings.ToLower(hash)})
+	if err != nil {
+		return nil, err
+	}
+	return found[strings.ToLower(hash)], nil
+}
+
+// LookupMany 查找在线主机上多个哈希对应的文件，hashes 需为小写
+func (r *Registry) LookupMany(ctx context.Context, hashes []string) (map[string][]Location, error) {
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+	args := make([]any, 0, len(hashes)+1)
+	for _, hash := range hashes {
+		args = append(args, hash)
+	}
+	args = append(args, r.now().Add(-r.offlineAfter).UnixMilli())
+	query := `SELECT f.md5, h.id, h.name, f.path, f.size, h.last_seen
+		FROM smartfinder_host_files f JOIN smartfinder_hosts h ON h.id = f.host_id
+		WHERE f.md5 IN (` + strings.TrimSuffix(strings.Repeat("?,", len(hashes)), ",") + `) AND h.last_seen >= ?
+		ORDER BY h.last_seen DESC, f.path`
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[string][]Location)
+	for rows.Next() {
+		var loc Location
+		var lastSeen int64
+		if err := rows.Scan(&loc.MD5, &loc.HostID, &loc.Host, &loc.Path, &loc.Size, &lastSeen); err != nil {
+			return nil, err
+		}
+		loc.LastSeen = time.UnixMilli(lastSeen)
+		found[loc.MD5] = append(found[loc.MD5], loc)
+	}
+	return found, rows.Err()
+}
+
+// Hosts 列出已登记的主机，最近有心跳的在前
+func (r *Registry) Hosts(ctx context.Context) ([]Host, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id, name, version, files, registered_at, published_at, last_seen
+		FROM smartfinder_hosts ORDER BY last_seen DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cutoff := r.now().Add(-r.offlineAfter)
+	hosts := make([]Host, 0)
+	for rows.Next() {
+		var h Host
+		var registered, published, lastSeen int64
+		if err := rows.Scan(&h.ID, &h.Name, &h.Version, &h.Files, &registered, &published, &lastSeen); err != nil {
+			return nil, err
+		}
+		h.RegisteredAt = time.UnixMilli(registered)
+		h.PublishedAt = time.UnixMilli(published)
+		h.LastSeen = time.UnixMilli(lastSeen)
+		h.Online = !h.LastSeen.Before(cutoff)
+		hosts = append(hosts, h)
+	}
+	return hosts, rows.Err()
+}
+
+// Remove 删除主机及其发布的文件；客户端仍在运行时会在下次心跳后重新登记
+func (r *Registry) Remove(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, "DELETE FROM smartfinder_hosts WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM smartfinder_host_files WHERE host_id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Ping 检查登记数据库连接
+func (r *Registry) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
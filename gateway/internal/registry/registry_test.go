@@ -0,0 +1,146 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/sqlitedb"
+	"smart-finder/shared/types"
+)
+
+const (
+	helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+	worldMD5 = "7d793037a0760186574b0282f2f435e7"
+)
+
+func newTestRegistry(t *testing.T, cfg Config) *Registry {
+	t.Helper()
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "registry.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg.Driver = DriverSQLite
+	r, err := New(db, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPublishAndLookup(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t, Config{OfflineAfter: time.Hour})
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	if err := r.Publish(ctx, &types.RegistryPublish{
+		ClientID: "alice-0123456789abcdef",
+		Name:     "alice-pc",
+		Digest:   "d1",
+		Files: []types.RegistryFile{
+			{MD5: helloMD5, Path: `D:\共享\hello.txt`, Size: 5},
+			{MD5: worldMD5, Size: 5},
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Minute)
+	if err := r.Publish(ctx, &types.RegistryPublish{
+		ClientID: "bob-0123456789abcdef00",
+		Name:     "bob-mac",
+		Digest:   "d2",
+		Files:    []types.RegistryFile{{MD5: "5D41402ABC4B2A76B9719D911017C592", Path: "/Users/bob/hello.txt", Size: 5}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	locs, err := r.Lookup(ctx, helloMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locs) != 2 || locs[0].Host != "bob-mac" || locs[1].Path != `D:\共享\hello.txt` {
+		t.Fatalf("locations = %+v", locs)
+	}
+	if locs, _ := r.Lookup(ctx, worldMD5); len(locs) != 1 || locs[0].Path != "" {
+		t.Errorf("hash without path: %+v", locs)
+	}
+
+	// 重新发布替换之前的文件
+	if err := r.Publish(ctx, &types.RegistryPublish{ClientID: "bob-0123456789abcdef00", Name: "bob-mac", Digest: "d3"}); err != nil {
+		t.Fatal(err)
+	}
+	if locs, _ := r.Lookup(ctx, helloMD5); len(locs) != 1 || locs[0].Host != "alice-pc" {
+		t.Errorf("after republish: %+v", locs)
+	}
+
+	// 超过 offline_after 没有心跳的主机不参与查询
+	now = now.Add(time.Hour + 30*time.Second)
+	if current, err := r.Heartbeat(ctx, "bob-0123456789abcdef00", "d3"); err != nil || !current {
+		t.Errorf("heartbeat = %v, %v", current, err)
+	}
+	if locs, _ := r.Lookup(ctx, helloMD5); len(locs) != 0 {
+		t.Errorf("offline host should be skipped: %+v", locs)
+	}
+	hosts, err := r.Hosts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hosts) != 2 || hosts[0].Name != "bob-mac" || !hosts[0].Online || hosts[1].Online || hosts[1].Files != 2 {
+		t.Errorf("hosts = %+v", hosts)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t, Config{})
+	const id = "carol-0123456789abcdef"
+
+	if current, err := r.Heartbeat(ctx, id, "d1"); err != nil || current {
+		t.Errorf("unknown host: %v, %v", current, err)
+	}
+	if err := r.Publish(ctx, &types.RegistryPublish{ClientID: id, Name: "carol", Digest: "d1"}); err != nil {
+		t.Fatal(err)
+	}
+	if current, err := r.Heartbeat(ctx, id, "d1"); err != nil || !current {
+		t.Errorf("same digest: %v, %v", current, err)
+	}
+	if current, err := r.Heartbeat(ctx, id, "d2"); err != nil || current {
+		t.Errorf("changed digest: %v, %v", current, err)
+	}
+
+	if err := r.Remove(ctx, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Remove(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("remove twice: %v", err)
+	}
+	if current, _ := r.Heartbeat(ctx, id, "d1"); current {
+		t.Error("removed host should republish")
+	}
+}
+
+func TestPublishInvalid(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRegistry(t, Config{MaxFiles: 1})
+	for _, p := range []types.RegistryPublish{
+		{ClientID: "short", Name: "x"},
+		{ClientID: "dave-0123456789abcdef", Name: " "},
+		{ClientID: "dave-0123456789abcdef", Name: "dave", Files: []types.RegistryFile{{MD5: "xyz"}}},
+	} {
+		if err := r.Publish(ctx, &p); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Publish(%+v) = %v, want ErrInvalid", p, err)
+		}
+	}
+	err := r.Publish(ctx, &types.RegistryPublish{
+		ClientID: "dave-0123456789abcdef",
+		Name:     "dave",
+		Files:    []types.RegistryFile{{MD5: helloMD5}, {MD5: worldMD5}},
+	})
+	if !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("too many files: %v", err)
+	}
+}
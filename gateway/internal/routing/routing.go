@@ -0,0 +1,169 @@
+// Package routing 按请求来源把哈希查询固定到指定的后端
+//
+// 如各部门分别部署了 Kodbox 时，可以让来自某个部门站点（Referer）或
+// 某些用户、组的查询只查询该部门的实例。路由只影响查询哪些后端，不做
+// 访问控制，访问控制见 auth 包的授权规则。
+package routing
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"smart-finder/gateway/internal/auth"
+	"smart-finder/gateway/internal/backend"
+)
+
+// 后端的查询方式
+const (
+	ModePriority = "priority" // 按 backends 顺序依次查询
+	ModeParallel = "parallel" // 同时查询，仍按顺序选用结果
+)
+
+// RefParam 携带原始来源页面的查询参数
+//
+// md5.html 跳转到 /api/md5 时，浏览器发送的 Referer 是网关自身的页面，
+// 因此由页面把 document.referrer 通过该参数传递。
+const RefParam = "ref"
+
+// Config 路由配置
+type Config struct {
+	Mode  string `mapstructure:"mode"`
+	Rules []Rule `mapstructure:"rules"`
+}
+
+// Rule 路由规则
+//
+// Referrers、Users、Groups 中配置了的条件都满足时适用，同一条件内任一
+// 匹配即可；三者都为空的规则适用于所有请求。按顺序使用第一条适用的规则。
+type Rule struct {
+	// Referrers 来源页面的主机名，支持通配符，如 "*.hr.example.com"
+	Referrers []string `mapstructure:"referrers"`
+	Users     []string `mapstructure:"users"`
+	Groups    []string `mapstructure:"groups"`
+	// Backends 适用时只查询这些后端
+	Backends []string `mapstructure:"backends"`
+}
+
+// Validate 检查配置，backends 为已配置的后端名称
+func (c Config) Validate(backends []string) error {
+	switch c.Mode {
+	case "", ModePriority, ModeParallel:
+	default:
+		return fmt.Errorf("无效的 mode: %q，应为 priority 或 parallel", c.Mode)
+	}
+	known := make(map[string]bool)
+	for _, name := range backends {
+		known[name] = true
+	}
+	for i, rule := range c.Rules {
+		if len(rule.Backends) == 0 {
+			return fmt.Errorf("rules 第 %d 项需要配置 backends", i+1)
+		}
+		for _, name := range rule.Backends {
+			if !known[name] {
+				return fmt.Errorf("rules 第 %d 项: 未知的后端 %s", i+1, name)
+			}
+		}
+		for _, pattern := range rule.Referrers {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rules 第 %d 项: 无效的 referrers %q", i+1, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Router 路由中间件
+type Router struct {
+	rules []Rule
+}
+
+// New 创建路由中间件，没有规则时返回 nil
+func New(cfg Config) *Router {
+	if len(cfg.Rules) == 0 {
+		return nil
+	}
+	return &Router{rules: cfg.Rules}
+}
+
+// Middleware 把适用规则的后端写入请求 ctx 中 Scope 的 Route，需在认证之后
+func (rt *Router) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := rt.Match(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		scope := backend.ScopeFrom(r.Context())
+		scope.Route = rule.Backends
+		next.ServeHTTP(w, r.WithContext(backend.WithScope(r.Context(), scope)))
+	})
+}
+
+// Match 返回第一条适用于请求的规则
+func (rt *Router) Match(r *http.Request) (Rule, bool) {
+	host := referrerHost(r)
+	p := auth.PrincipalFrom(r.Context())
+	for _, rule := range rt.rules {
+		if rule.matches(host, p) {
+			return rule, true
+		}
+	}
+	return Rule{}, false
+}
+
+func (rule Rule) matches(host string, p *auth.Principal) bool {
+	if len(rule.Referrers) > 0 && !matchHost(rule.Referrers, host) {
+		return false
+	}
+	if len(rule.Users) > 0 && (p == nil || !containsAny(rule.Users, []string{p.Name})) {
+		return false
+	}
+	if len(rule.Groups) > 0 && (p == nil || !containsAny(rule.Groups, p.Groups)) {
+		return false
+	}
+	return true
+}
+
+// Referrer 返回请求的来源页面地址，优先使用 ref 参数
+func Referrer(r *http.Request) string {
+	if ref := r.URL.Query().Get(RefParam); ref != "" {
+		return ref
+	}
+	return r.Referer()
+}
+
+// referrerHost 返回来源页面的主机名（不含端口）
+func referrerHost(r *http.Request) string {
+	u, err := url.Parse(Referrer(r))
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func matchHost(patterns []string, host string) bool {
+	if host == "" {
+		return false
+	}
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(list, values []string) bool {
+	for _, a := range list {
+		for _, b := range values {
+			if a == b {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package routing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"smart-finder/gateway/internal/auth"
+	"smart-finder/gateway/internal/backend"
+)
+
+// route 通过中间件处理请求，返回处理器看到的范围
+func route(rt *Router, r *http.Request) backend.Scope {
+	var scope backend.Scope
+	rt.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scope = backend.ScopeFrom(r.Context())
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return scope
+}
+
+func TestRouter(t *testing.T) {
+	rt := New(Config{Rules: []Rule{
+		{Referrers: []string{"hr.example.com", "*.hr.example.com"}, Backends: []string{"kodbox-hr"}},
+		{Groups: []string{"rd"}, Backends: []string{"kodbox-rd", "index"}},
+	}})
+
+	// Referer 头与 ref 参数
+	r := httptest.NewRequest("GET", "/md5?hash=x", nil)
+	r.Header.Set("Referer", "https://Wiki.HR.example.com:8443/page")
+	if scope := route(rt, r); !reflect.DeepEqual(scope.Route, []string{"kodbox-hr"}) {
+		t.Fatalf("referer: scope = %+v", scope)
+	}
+	r = httptest.NewRequest("GET", "/api/md5?hash=x&ref=https%3A%2F%2Fhr.example.com%2F", nil)
+	r.Header.Set("Referer", "https://gateway.example.com/md5?hash=x")
+	if scope := route(rt, r); !reflect.DeepEqual(scope.Route, []string{"kodbox-hr"}) {
+		t.Fatalf("ref param: scope = %+v", scope)
+	}
+
+	// 按组路由，保留认证得到的范围
+	r = httptest.NewRequest("GET", "/md5?hash=x", nil)
+	ctx := auth.WithPrincipal(r.Context(), &auth.Principal{Name: "bob", Groups: []string{"rd"}})
+	ctx = backend.WithScope(ctx, backend.Scope{KodboxSources: []int{5}})
+	scope := route(rt, r.WithContext(ctx))
+	if !reflect.DeepEqual(scope, backend.Scope{KodboxSources: []int{5}, Route: []string{"kodbox-rd", "index"}}) {
+		t.Fatalf("group: scope = %+v", scope)
+	}
+
+	// 没有适用的规则时不限制
+	r = httptest.NewRequest("GET", "/md5?hash=x", nil)
+	r.Header.Set("Referer", "https://example.com/")
+	if scope := route(rt, r); scope.Route != nil {
+		t.Fatalf("no rule: scope = %+v", scope)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	backends := []string{"kodbox-hr", "index"}
+	if err := (Config{Mode: ModeParallel, Rules: []Rule{{Users: []string{"a"}, Backends: []string{"index"}}}}).Validate(backends); err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]Config{
+		"unknown mode":    {Mode: "random"},
+		"no backends":     {Rules: []Rule{{Users: []string{"a"}}}},
+		"unknown backend": {Rules: []Rule{{Backends: []string{"kodbox-rd"}}}},
+		"bad pattern":     {Rules: []Rule{{Referrers: []string{"["}, Backends: []string{"index"}}}},
+	} {
+		if err := cfg.Validate(backends); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
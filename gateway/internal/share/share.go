@@ -0,0 +1,443 @@
+// Package share 网关的限时分享链接
+//
+// 分享链接的令牌形如 "<id>.<过期时间>.<签名>"，签名为服务端密钥对 id 与
+// 过期时间的 HMAC-SHA256，伪造或篡改的令牌无需查询数据库即可拒绝。
+// 使用次数、密码和撤销状态保存在数据库中。
+package share
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-finder/shared/utils"
+)
+
+// 数据库类型
+const (
+	DriverSQLite = "sqlite"
+	DriverMySQL  = "mysql"
+)
+
+// 默认配置
+const (
+	DefaultTTL        = 7 * 24 * time.Hour
+	DefaultSQLitePath = "data/share.db"
+	// MinSecretLength 签名密钥的最小长度
+	MinSecretLength = 16
+	// RangeWindow 计次打开链接后，续传和拖动请求不再计次的时长
+	RangeWindow = 30 * time.Minute
+)
+
+// DispositionAny 不限制展示方式，由请求参数决定
+const DispositionAny = ""
+
+const pbkdf2Iterations = 100000
+
+var (
+	// ErrInvalidToken 令牌格式错误或签名不匹配
+	ErrInvalidToken = errors.New("无效的分享链接")
+	// ErrNotFound 分享链接不存在
+	ErrNotFound = errors.New("分享链接不存在")
+	// ErrExpired 分享链接已过期
+	ErrExpired = errors.New("分享链接已过期")
+	// ErrRevoked 分享链接已撤销
+	ErrRevoked = errors.New("分享链接已撤销")
+	// ErrExhausted 分享链接的使用次数已用完
+	ErrExhausted = errors.New("分享链接的使用次数已用完")
+)
+
+var schemas = map[string]string{
+	DriverSQLite: `CREATE TABLE IF NOT EXISTS smartfinder_share_links (
+		id CHAR(32) PRIMARY KEY,
+		hash CHAR(32) NOT NULL,
+		created_at BIGINT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		max_uses BIGINT NOT NULL DEFAULT 0,
+		uses BIGINT NOT NULL DEFAULT 0,
+		disposition VARCHAR(16) NOT NULL DEFAULT '',
+		password VARCHAR(255) NOT NULL DEFAULT '',
+		note VARCHAR(255) NOT NULL DEFAULT '',
+		revoked_at BIGINT
+	)`,
+	DriverMySQL: `CREATE TABLE IF NOT EXISTS smartfinder_share_links (
+		id CHAR(32) NOT NULL PRIMARY KEY,
+		hash CHAR(32) NOT NULL,
+		created_at BIGINT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		max_uses BIGINT NOT NULL DEFAULT 0,
+		uses BIGINT NOT NULL DEFAULT 0,
+		disposition VARCHAR(16) NOT NULL DEFAULT '',
+		password VARCHAR(255) NOT NULL DEFAULT '',
+		note VARCHAR(255) NOT NULL DEFAULT '',
+		revoked_at BIGINT NULL
+	)`,
+}
+
+const linkColumns = "id, hash, created_at, expires_at, max_uses, uses, disposition, password, note, revoked_at"
+
+// Config 分享链接配置
+type Config struct {
+	Secret     string        `mapstructure:"secret"` // 签名密钥，未配置时不启用分享链接
+	Driver     string        `mapstructure:"driver"` // sqlite 或 mysql
+	SQLitePath string        `mapstructure:"sqlite_path"`
+	DefaultTTL time.Duration `mapstructure:"default_ttl"`
+	MaxTTL     time.Duration `mapstructure:"max_ttl"` // 0 表示不限制
+}
+
+// Link 分享链接
+type Link struct {
+	ID          string     `json:"id"`
+	Hash        string     `json:"hash"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	MaxUses     int64      `json:"max_uses"` // 0 表示不限次数
+	Uses        int64      `json:"uses"`
+	Disposition string     `json:"disposition,omitempty"` // 为空时由请求决定
+	HasPassword bool       `json:"has_password"`
+	Note        string     `json:"note,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+
+	password string // "<salt>$<hash>"，十六进制
+}
+
+// Active 判断链接在 now 时是否仍可使用
+func (l *Link) Active(now time.Time) bool {
+	return l.check(now) == nil && (l.MaxUses == 0 || l.Uses < l.MaxUses)
+}
+
+// check 检查撤销与过期状态，不检查使用次数
+func (l *Link) check(now time.Time) error {
+	if l.RevokedAt != nil {
+		return ErrRevoked
+	}
+	if !now.Before(l.ExpiresAt) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// CreateOptions 创建分享链接的参数
+type CreateOptions struct {
+	Hash        string
+	TTL         time.Duration // 0 使用默认有效期
+	MaxUses     int64
+	Password    string
+	Disposition string
+	Note        string
+}
+
+// Manager 管理分享链接
+type Manager struct {
+	db         *sql.DB
+	secret     []byte
+	defaultTTL time.Duration
+	maxTTL     time.Duration
+	now        func() time.Time
+}
+
+// NewManager 在 db 上创建分享链接表（已存在时跳过）
+func NewManager(db *sql.DB, cfg Config) (*Manager, error) {
+	if len(cfg.Secret) < MinSecretLength {
+		return nil, fmt.Errorf("分享链接密钥至少需要 %d 个字符", MinSecretLength)
+	}
+	schema, ok := schemas[cfg.Driver]
+	if !ok {
+		return nil, fmt.Errorf("不支持的分享链接数据库: %q", cfg.Driver)
+	}
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("创建分享链接表失败: %w", err)
+	}
+	m := &Manager{
+		db:         db,
+		secret:     []byte(cfg.Secret),
+		defaultTTL: cfg.DefaultTTL,
+		maxTTL:     cfg.MaxTTL,
+		now:        time.Now,
+	}
+	if m.defaultTTL <= 0 {
+		m.defaultTTL = DefaultTTL
+	}
+	if m.maxTTL > 0 && m.defaultTTL > m.maxTTL {
+		m.defaultTTL = m.maxTTL
+	}
+	return m, nil
+}
+
+// Create 创建分享链接
+func (m *Manager) Create(ctx context.Context, opts CreateOptions) (*Link, error) {
+	if len(opts.Hash) != 32 {
+		return nil, errors.New("无效的MD5哈希格式")
+	}
+	if _, err := hex.DecodeString(opts.Hash); err != nil {
+		return nil, errors.New("无效的MD5哈希格式")
+	}
+	switch opts.Disposition {
+	case DispositionAny, utils.DispositionInline, utils.DispositionAttachment:
+	default:
+		return nil, fmt.Errorf("无效的展示方式: %q", opts.Disposition)
+	}
+	if opts.MaxUses < 0 {
+		return nil, errors.New("使用次数不能为负数")
+	}
+	ttl := opts.TTL
+	if ttl == 0 {
+		ttl = m.defaultTTL
+	}
+	if ttl < 0 {
+		return nil, errors.New("有效期不能为负数")
+	}
+	if m.maxTTL > 0 && ttl > m.maxTTL {
+		return nil, fmt.Errorf("有效期不能超过 %v", m.maxTTL)
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	now := m.now().Truncate(time.Second)
+	link := &Link{
+		ID:          hex.EncodeToString(id),
+		Hash:        strings.ToLower(opts.Hash),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl).Truncate(time.Second),
+		MaxUses:     opts.MaxUses,
+		Disposition: opts.Disposition,
+		Note:        opts.Note,
+	}
+	if opts.Password != "" {
+		hashed, err := hashPassword(opts.Password)
+		if err != nil {
+			return nil, err
+		}
+		link.password = hashed
+		link.HasPassword = true
+	}
+
+	_, err := m.db.ExecContext(ctx,
+		`INSERT INTO smartfinder_share_links (id, hash, created_at, expires_at, max_uses, disposition, password, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.ID, link.Hash, link.CreatedAt.Unix(), link.ExpiresAt.Unix(), link.MaxUses,
+		link.Disposition, link.password, link.Note)
+	if err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// Ping 检查分享链接数据库连接
+func (m *Manager) Ping(ctx context.Context) error {
+	return m.db.PingContext(ctx)
+}
+
+// Token 返回链接的签名令牌
+func (m *Manager) Token(l *Link) string {
+	payload := l.ID + "." + strconv.FormatInt(l.ExpiresAt.Unix(), 10)
+	return payload + "." + m.sign(payload)
+}
+
+// Resolve 校验令牌并返回仍在有效期内、未撤销的链接，不检查使用次数和密码
+func (m *Manager) Resolve(ctx context.Context, token string) (*Link, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(m.sign(payload))) {
+		return nil, ErrInvalidToken
+	}
+	exp, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !m.now().Before(time.Unix(exp, 0)) {
+		return nil, ErrExpired
+	}
+
+	link, err := m.Get(ctx, parts[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := link.check(m.now()); err != nil {
+		return nil, err
+	}
+	return link, nil
+}
+
+// Use 记录一次使用，次数已用完、已过期或已撤销时返回相应错误
+func (m *Manager) Use(ctx context.Context, l *Link) error {
+	res, err := m.db.ExecContext(ctx,
+		`UPDATE smartfinder_share_links SET uses = uses + 1
+		WHERE id = ? AND revoked_at IS NULL AND expires_at > ? AND (max_uses = 0 OR uses < max_uses)`,
+		l.ID, m.now().Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 1 {
+		l.Uses++
+		return nil
+	}
+
+	// 未更新时重新读取以给出具体原因
+	current, err := m.Get(ctx, l.ID)
+	if err != nil {
+		return err
+	}
+	if err := current.check(m.now()); err != nil {
+		return err
+	}
+	return ErrExhausted
+}
+
+// Get 按ID查询链接
+func (m *Manager) Get(ctx context.Context, id string) (*Link, error) {
+	row := m.db.QueryRowContext(ctx, "SELECT "+linkColumns+" FROM smartfinder_share_links WHERE id = ?", id)
+	link, err := scanLink(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return link, err
+}
+
+// List 返回链接列表，按创建时间倒序；all 为 false 时只返回仍可使用的链接
+func (m *Manager) List(ctx context.Context, all bool) ([]*Link, error) {
+	rows, err := m.db.QueryContext(ctx, "SELECT "+linkColumns+" FROM smartfinder_share_links ORDER BY created_at DESC, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]*Link, 0)
+	now := m.now()
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		if all || link.Active(now) {
+			links = append(links, link)
+		}
+	}
+	return links, rows.Err()
+}
+
+// Revoke 撤销链接，已撤销的链接保持原撤销时间
+func (m *Manager) Revoke(ctx context.Context, id string) error {
+	res, err := m.db.ExecContext(ctx,
+		"UPDATE smartfinder_share_links SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL", m.now().Unix(), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if _, err := m.Get(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckPassword 校验链接密码，未设置密码的链接总是通过
+func (m *Manager) CheckPassword(l *Link, password string) bool {
+	if l.password == "" {
+		return true
+	}
+	salt, want, ok := strings.Cut(l.password, "$")
+	if !ok {
+		return false
+	}
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		return false
+	}
+	got, err := pbkdf2.Key(sha256.New, password, saltBytes, pbkdf2Iterations, 32)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(got)), []byte(want)) == 1
+}
+
+// UnlockValue 输入密码后写入 Cookie 的值，修改密码或更换密钥后失效
+func (m *Manager) UnlockValue(l *Link) string {
+	return m.sign("unlock." + l.ID + "." + l.password)
+}
+
+// CheckUnlock 校验 UnlockValue 生成的值
+func (m *Manager) CheckUnlock(l *Link, value string) bool {
+	return hmac.Equal([]byte(value), []byte(m.UnlockValue(l)))
+}
+
+// RangeValue 计次打开链接后写入 Cookie 的值，RangeWindow 内带此值的
+// Range 请求不再计次
+func (m *Manager) RangeValue(l *Link) string {
+	exp := strconv.FormatInt(m.now().Add(RangeWindow).Unix(), 10)
+	return exp + "." + m.sign("range."+l.ID+"."+exp)
+}
+
+// CheckRange 校验 RangeValue 生成的值属于该链接且未过期
+func (m *Manager) CheckRange(l *Link, value string) bool {
+	exp, sig, ok := strings.Cut(value, ".")
+	if !ok {
+		return false
+	}
+	n, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !m.now().Before(time.Unix(n, 0)) {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(m.sign("range."+l.ID+"."+exp)))
+}
+
+func (m *Manager) sign(payload string) string {
+	mac := hmac.New(sha256.New, m.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key, err := pbkdf2.Key(sha256.New, password, salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(salt) + "$" + hex.EncodeToString(key), nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanLink(row scanner) (*Link, error) {
+	var l Link
+	var created, expires int64
+	var revoked sql.NullInt64
+	err := row.Scan(&l.ID, &l.Hash, &created, &expires, &l.MaxUses, &l.Uses,
+		&l.Disposition, &l.password, &l.Note, &revoked)
+	if err != nil {
+		return nil, err
+	}
+	l.CreatedAt = time.Unix(created, 0)
+	l.ExpiresAt = time.Unix(expires, 0)
+	l.HasPassword = l.password != ""
+	if revoked.Valid {
+		t := time.Unix(revoked.Int64, 0)
+		l.RevokedAt = &t
+	}
+	return &l, nil
+}
@@ -0,0 +1,182 @@
+package share
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/sqlitedb"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "share.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	m, err := NewManager(db, Config{Secret: "0123456789abcdef", Driver: DriverSQLite, MaxTTL: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestShareLink(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	link, err := m.Create(ctx, CreateOptions{Hash: helloMD5, TTL: time.Hour, MaxUses: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := m.Token(link)
+
+	// 篡改过期时间或签名的令牌无效
+	parts := strings.Split(token, ".")
+	for _, bad := range []string{
+		parts[0] + "." + "9999999999" + "." + parts[2],
+		parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])),
+		"garbage",
+	} {
+		if _, err := m.Resolve(ctx, bad); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("Resolve(%q) err = %v, want ErrInvalidToken", bad, err)
+		}
+	}
+
+	// 使用次数
+	for i := 0; i < 2; i++ {
+		got, err := m.Resolve(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash != helloMD5 {
+			t.Fatalf("hash = %s", got.Hash)
+		}
+		if err := m.Use(ctx, got); err != nil {
+			t.Fatalf("use %d: %v", i+1, err)
+		}
+	}
+	got, err := m.Resolve(ctx, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Use(ctx, got); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("third use: err = %v, want ErrExhausted", err)
+	}
+
+	// 过期
+	m.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if _, err := m.Resolve(ctx, token); !errors.Is(err, ErrExpired) {
+		t.Fatalf("after expiry: err = %v, want ErrExpired", err)
+	}
+	m.now = time.Now
+
+	// 超过最长有效期
+	if _, err := m.Create(ctx, CreateOptions{Hash: helloMD5, TTL: 48 * time.Hour}); err == nil {
+		t.Fatal("ttl above max_ttl: want error")
+	}
+}
+
+func TestShareRevokeAndList(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	a, err := m.Create(ctx, CreateOptions{Hash: helloMD5, Note: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := m.Create(ctx, CreateOptions{Hash: helloMD5, Note: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Revoke(ctx, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Resolve(ctx, m.Token(a)); !errors.Is(err, ErrRevoked) {
+		t.Fatalf("revoked link: err = %v, want ErrRevoked", err)
+	}
+	if err := m.Revoke(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revoke missing: err = %v, want ErrNotFound", err)
+	}
+
+	active, err := m.List(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 1 || active[0].ID != b.ID {
+		t.Fatalf("active links = %+v, want only %s", active, b.ID)
+	}
+	all, err := m.List(ctx, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 {
+		t.Fatalf("all links = %d, want 2", len(all))
+	}
+}
+
+func TestSharePassword(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+
+	link, err := m.Create(ctx, CreateOptions{Hash: helloMD5, Password: "secret", Disposition: "attachment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Resolve(ctx, m.Token(link))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.HasPassword || got.Disposition != "attachment" {
+		t.Fatalf("unexpected link: %+v", got)
+	}
+	if m.CheckPassword(got, "wrong") || !m.CheckPassword(got, "secret") {
+		t.Fatal("password check mismatch")
+	}
+	if !m.CheckUnlock(got, m.UnlockValue(got)) || m.CheckUnlock(got, "forged") {
+		t.Fatal("unlock check mismatch")
+	}
+
+	if _, err := m.Create(ctx, CreateOptions{Hash: helloMD5, Disposition: "download"}); err == nil {
+		t.Fatal("invalid disposition: want error")
+	}
+}
+
+func TestShareRangeValue(t *testing.T) {
+	ctx := context.Background()
+	m := newTestManager(t)
+	link, err := m.Create(ctx, CreateOptions{Hash: helloMD5, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := m.Create(ctx, CreateOptions{Hash: helloMD5, TTL: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value := m.RangeValue(link)
+	if !m.CheckRange(link, value) {
+		t.Fatal("刚写入的值应通过校验")
+	}
+	// 只对签发的链接有效
+	if m.CheckRange(other, value) {
+		t.Error("其他链接的值不应通过校验")
+	}
+	// 篡改有效期
+	exp, sig, _ := strings.Cut(value, ".")
+	if m.CheckRange(link, "9999999999."+sig) || m.CheckRange(link, exp) || m.CheckRange(link, "") {
+		t.Error("篡改的值不应通过校验")
+	}
+
+	// 超过 RangeWindow 后失效
+	m.now = func() time.Time { return time.Now().Add(RangeWindow + time.Minute) }
+	if m.CheckRange(link, value) {
+		t.Error("过期的值不应通过校验")
+	}
+}
@@ -0,0 +1,30 @@
+// Package sqlitedb 打开网关内嵌的 SQLite 数据库
+package sqlitedb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// Open 打开（必要时创建）SQLite 数据库
+//
+// SQLite 只允许一个写入者，WAL 模式下查询不会被写入阻塞。
+func Open(path string) (*sql.DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	for _, pragma := range []string{"PRAGMA journal_mode=WAL", "PRAGMA busy_timeout=5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	return db, nil
+}
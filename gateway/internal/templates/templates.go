@@ -1,44 +1,358 @@
+// Package templates 网关的页面模板与多语言文案
+//
+// 模板与 locales/ 下的文案内置在程序中，可以通过 templates.dir 覆盖：目录
+// 中与内置模板同名的 *.html 替换内置模板，locales/<语言>.json 补充或覆盖
+// 同名语言的文案，也可以增加新的语言。模板中用 {{T "key"}} 取当前语言的
+// 文案（缺少时使用默认语言），{{lang}} 为当前语言。
 package templates
 
 import (
 	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
 )
 
-//go:embed *.html
+//go:embed *.html locales/*.json
 var templateFS embed.FS
 
+// DefaultLang 未配置 default_lang 时的默认语言
+const DefaultLang = "zh-CN"
+
+// 页面模板的文件名
+const (
+	PageMD5           = "md5.html"
+	PageSharePassword = "share_password.html"
+	PageView          = "view.html"
+	PageNotFound      = "not_found.html"
+	PageError         = "error.html"
+	PageExpired       = "expired.html"
+	PageRemote        = "remote.html"
+)
+
+var pages = []string{PageMD5, PageSharePassword, PageView, PageNotFound, PageError, PageExpired, PageRemote}
+
+// Config 模板配置
+type Config struct {
+	// Dir 覆盖内置模板与文案的目录，为空时只使用内置模板
+	Dir string `mapstructure:"dir"`
+	// DefaultLang 请求的 Accept-Language 没有匹配的语言时使用
+	DefaultLang string `mapstructure:"default_lang"`
+	// Dev 开发模式：每次渲染前重新读取模板与文案，修改后刷新页面即可生效
+	Dev bool `mapstructure:"dev"`
+}
+
 // TemplateData 模板数据结构
 type TemplateData struct {
 	Hash         string
 	ServerDomain string
 }
 
+// SharePasswordData 分享链接密码页的数据
+type SharePasswordData struct {
+	WrongPassword bool
+}
+
+// ViewData 文件预览页的数据
+type ViewData struct {
+	Hash        string
+	Name        string
+	Kind        string // image、video、audio、pdf、markdown 或 code
+	RawURL      string // 在线输出文件内容的地址
+	DownloadURL string
+	Truncated   bool // 文本超过预览的大小上限，只显示了开头部分
+
+	// markdown
+	Meta     []ViewField
+	Markdown template.HTML
+
+	// 代码
+	Language string
+	Lines    []ViewLine
+}
+
+// ViewField markdown front matter 中的一项
+type ViewField struct {
+	Key   string
+	Value string
+}
+
+// ViewLine 代码的一行，Number 从 1 开始
+type ViewLine struct {
+	Number int
+	Text   string
+}
+
+// NotFoundData 文件不存在页面的数据，分享链接无效时 Hash 为空
+type NotFoundData struct {
+	Hash string
+}
+
+// ErrorData 错误页面的数据
+type ErrorData struct {
+	Status int
+	Reason string // 文案的键，如 error.backend
+}
+
+// ExpiredData 分享链接失效页面的数据
+type ExpiredData struct {
+	Reason string // expired、revoked 或 exhausted
+}
+
+// RemoteData 文件在已登记客户端上时的页面数据，客户端未公开路径时 Path 为空
+type RemoteData struct {
+	Host string
+	Path string
+}
+
 // Templates 模板管理器
 type Templates struct {
-	md5Template *template.Template
+	cfg Config
+
+	mu  sync.RWMutex
+	set *set
+}
+
+// set 一次加载的全部模板与文案
+type set struct {
+	langs   []string // 支持的语言，第一个为默认语言
+	matcher language.Matcher
+	pages   map[string]map[string]*template.Template // 语言 -> 文件名 -> 模板
 }
 
-// New 创建新的模板管理器
-func New() (*Templates, error) {
-	// 解析MD5模板
-	md5Template, err := template.ParseFS(templateFS, "md5.html")
+// New 加载模板与文案，覆盖目录中的模板有错误时返回错误
+func New(cfg Config) (*Templates, error) {
+	if cfg.DefaultLang == "" {
+		cfg.DefaultLang = DefaultLang
+	}
+	s, err := load(cfg)
 	if err != nil {
 		return nil, err
 	}
+	return &Templates{cfg: cfg, set: s}, nil
+}
 
-	return &Templates{
-		md5Template: md5Template,
-	}, nil
+// current 返回当前的模板，开发模式下先重新加载
+func (t *Templates) current() (*set, error) {
+	if t.cfg.Dev {
+		s, err := load(t.cfg)
+		if err != nil {
+			return nil, err
+		}
+		t.mu.Lock()
+		t.set = s
+		t.mu.Unlock()
+		return s, nil
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.set, nil
+}
+
+// Match 按 Accept-Language 请求头选择语言，没有匹配时返回默认语言
+func (t *Templates) Match(acceptLanguage string) string {
+	t.mu.RLock()
+	s := t.set
+	t.mu.RUnlock()
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return s.langs[0]
+	}
+	_, i, confidence := s.matcher.Match(tags...)
+	if confidence == language.No || i >= len(s.langs) {
+		return s.langs[0]
+	}
+	return s.langs[i]
+}
+
+func (t *Templates) render(w io.Writer, page, lang string, data any) error {
+	s, err := t.current()
+	if err != nil {
+		return err
+	}
+	byPage, ok := s.pages[lang]
+	if !ok {
+		byPage = s.pages[s.langs[0]]
+	}
+	return byPage[page].Execute(w, data)
 }
 
 // RenderMD5Page 渲染MD5页面
-func (t *Templates) RenderMD5Page(w io.Writer, data TemplateData) error {
-	return t.md5Template.Execute(w, data)
+func (t *Templates) RenderMD5Page(w io.Writer, lang string, data TemplateData) error {
+	return t.render(w, PageMD5, lang, data)
+}
+
+// RenderSharePasswordPage 渲染分享链接的密码输入页
+func (t *Templates) RenderSharePasswordPage(w io.Writer, lang string, data SharePasswordData) error {
+	return t.render(w, PageSharePassword, lang, data)
+}
+
+// RenderViewPage 渲染文件预览页
+func (t *Templates) RenderViewPage(w io.Writer, lang string, data ViewData) error {
+	return t.render(w, PageView, lang, data)
+}
+
+// RenderNotFoundPage 渲染文件不存在页面
+func (t *Templates) RenderNotFoundPage(w io.Writer, lang string, data NotFoundData) error {
+	return t.render(w, PageNotFound, lang, data)
+}
+
+// RenderErrorPage 渲染错误页面
+func (t *Templates) RenderErrorPage(w io.Writer, lang string, data ErrorData) error {
+	return t.render(w, PageError, lang, data)
+}
+
+// RenderExpiredPage 渲染分享链接失效页面
+func (t *Templates) RenderExpiredPage(w io.Writer, lang string, data ExpiredData) error {
+	return t.render(w, PageExpired, lang, data)
+}
+
+// RenderRemotePage 渲染文件在其他电脑上的页面
+func (t *Templates) RenderRemotePage(w io.Writer, lang string, data RemoteData) error {
+	return t.render(w, PageRemote, lang, data)
 }
 
 // GetTemplateFS 获取模板文件系统
 func GetTemplateFS() embed.FS {
 	return templateFS
 }
+
+// load 读取内置与覆盖目录中的模板和文案，按语言分别解析模板
+func load(cfg Config) (*set, error) {
+	var dir fs.FS
+	if cfg.Dir != "" {
+		if _, err := os.Stat(cfg.Dir); err != nil {
+			return nil, fmt.Errorf("模板目录不可用: %w", err)
+		}
+		dir = os.DirFS(cfg.Dir)
+	}
+
+	catalogs, err := loadCatalogs(dir)
+	if err != nil {
+		return nil, err
+	}
+	def, ok := catalogs[cfg.DefaultLang]
+	if !ok {
+		return nil, fmt.Errorf("没有默认语言 %s 的文案", cfg.DefaultLang)
+	}
+	langs := []string{cfg.DefaultLang}
+	for lang := range catalogs {
+		if lang != cfg.DefaultLang {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs[1:])
+	tags := make([]language.Tag, len(langs))
+	for i, lang := range langs {
+		if tags[i], err = language.Parse(lang); err != nil {
+			return nil, fmt.Errorf("无效的语言 %q: %w", lang, err)
+		}
+	}
+
+	sources := make(map[string]string, len(pages))
+	for _, page := range pages {
+		src, err := readOverride(dir, page)
+		if err != nil {
+			return nil, err
+		}
+		sources[page] = src
+	}
+
+	s := &set{langs: langs, matcher: language.NewMatcher(tags), pages: make(map[string]map[string]*template.Template)}
+	for _, lang := range langs {
+		funcs := template.FuncMap{
+			"T":    translator(catalogs[lang], def),
+			"lang": func() string { return lang },
+		}
+		s.pages[lang] = make(map[string]*template.Template, len(pages))
+		for _, page := range pages {
+			tmpl, err := template.New(page).Funcs(funcs).Parse(sources[page])
+			if err != nil {
+				return nil, fmt.Errorf("解析模板 %s 失败: %w", page, err)
+			}
+			s.pages[lang][page] = tmpl
+		}
+	}
+	return s, nil
+}
+
+// readOverride 优先读取覆盖目录中的文件，不存在时读取内置文件
+func readOverride(dir fs.FS, name string) (string, error) {
+	if dir != nil {
+		data, err := fs.ReadFile(dir, name)
+		if err == nil {
+			return string(data), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	data, err := templateFS.ReadFile(name)
+	return string(data), err
+}
+
+// loadCatalogs 读取内置文案，再合并覆盖目录 locales/ 中的文案
+func loadCatalogs(dir fs.FS) (map[string]map[string]string, error) {
+	catalogs := make(map[string]map[string]string)
+	merge := func(fsys fs.FS) error {
+		files, err := fs.Glob(fsys, "locales/*.json")
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			data, err := fs.ReadFile(fsys, file)
+			if err != nil {
+				return err
+			}
+			var messages map[string]string
+			if err := json.Unmarshal(data, &messages); err != nil {
+				return fmt.Errorf("解析文案 %s 失败: %w", file, err)
+			}
+			lang := strings.TrimSuffix(path.Base(file), ".json")
+			if catalogs[lang] == nil {
+				catalogs[lang] = make(map[string]string)
+			}
+			for key, msg := range messages {
+				catalogs[lang][key] = msg
+			}
+		}
+		return nil
+	}
+	if err := merge(templateFS); err != nil {
+		return nil, err
+	}
+	if dir != nil {
+		if err := merge(dir); err != nil {
+			return nil, err
+		}
+	}
+	return catalogs, nil
+}
+
+// translator 返回模板函数 T：取 catalog 中的文案，缺少时依次使用默认语言
+// 的文案与键本身；有参数时按 fmt.Sprintf 格式化
+func translator(catalog, def map[string]string) func(string, ...any) string {
+	return func(key string, args ...any) string {
+		msg, ok := catalog[key]
+		if !ok {
+			msg, ok = def[key]
+		}
+		if !ok {
+			return key
+		}
+		if len(args) > 0 {
+			return fmt.Sprintf(msg, args...)
+		}
+		return msg
+	}
+}
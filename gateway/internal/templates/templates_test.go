@@ -0,0 +1,142 @@
+package templates
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func render(t *testing.T, tmpl *Templates, lang string) string {
+	t.Helper()
+	var out strings.Builder
+	if err := tmpl.RenderNotFoundPage(&out, lang, NotFoundData{Hash: "d41d8cd98f00b204e9800998ecf8427e"}); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tmpl, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct{ header, want string }{
+		{"", "zh-CN"},
+		{"en-US,en;q=0.9", "en"},
+		{"zh-TW,zh;q=0.9", "zh-CN"},
+		{"fr-FR", "zh-CN"},
+		{"fr;q=0.9,en;q=0.8", "en"},
+		{"invalid;;", "zh-CN"},
+	} {
+		if got := tmpl.Match(tc.header); got != tc.want {
+			t.Errorf("Match(%q) = %s, want %s", tc.header, got, tc.want)
+		}
+	}
+
+	if out := render(t, tmpl, "en"); !strings.Contains(out, "File not found") || !strings.Contains(out, `lang="en"`) {
+		t.Errorf("en page: %s", out)
+	}
+	if out := render(t, tmpl, "de"); !strings.Contains(out, "文件不存在") {
+		t.Errorf("unknown language should use default: %s", out)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, PageNotFound), `<p>{{T "not_found.title"}} {{T "custom"}} {{lang}}</p>`)
+	writeFile(t, filepath.Join(dir, "locales", "en.json"), `{"not_found.title": "Gone"}`)
+	writeFile(t, filepath.Join(dir, "locales", "zh-CN.json"), `{"custom": "自定义"}`)
+	writeFile(t, filepath.Join(dir, "locales", "fr.json"), `{"not_found.title": "Introuvable"}`)
+
+	tmpl, err := New(Config{Dir: dir, DefaultLang: "en"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tmpl.Match("fr-CA"); got != "fr" {
+		t.Errorf("Match(fr-CA) = %s, want fr", got)
+	}
+	if got := tmpl.Match("ja"); got != "en" {
+		t.Errorf("Match(ja) = %s, want en", got)
+	}
+	for lang, want := range map[string]string{
+		"en":    "<p>Gone custom en</p>",
+		"fr":    "<p>Introuvable custom fr</p>",
+		"zh-CN": "<p>文件不存在 自定义 zh-CN</p>",
+	} {
+		if got := render(t, tmpl, lang); got != want {
+			t.Errorf("%s: got %q, want %q", lang, got, want)
+		}
+	}
+
+	// 未覆盖的模板使用内置模板
+	var out strings.Builder
+	if err := tmpl.RenderErrorPage(&out, "fr", ErrorData{Status: 502, Reason: "error.open"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "Error 502") {
+		t.Errorf("error page should fall back to en messages: %s", out.String())
+	}
+}
+
+func TestInvalidOverride(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, PageError), `{{if}}`)
+	if _, err := New(Config{Dir: dir}); err == nil {
+		t.Error("invalid template should fail")
+	}
+	if _, err := New(Config{Dir: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("missing directory should fail")
+	}
+	if _, err := New(Config{DefaultLang: "fr"}); err == nil {
+		t.Error("default language without messages should fail")
+	}
+}
+
+func TestDevReload(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, PageNotFound), `v1`)
+	tmpl, err := New(Config{Dir: dir, Dev: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := render(t, tmpl, "zh-CN"); got != "v1" {
+		t.Fatalf("got %q", got)
+	}
+	writeFile(t, filepath.Join(dir, PageNotFound), `v2`)
+	if got := render(t, tmpl, "zh-CN"); got != "v2" {
+		t.Errorf("dev mode should reload, got %q", got)
+	}
+}
+
+// md5 页面探测客户端时使用新旧客户端都支持的路径，未升级的客户端对 /api/v1/ 返回前端页面；
+// 先读取索引摘要，不提供摘要的客户端按健康检查与文件检查处理
+func TestMD5PageClientPaths(t *testing.T) {
+	tmpl, err := New(Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := tmpl.RenderMD5Page(&out, "zh-CN", TemplateData{Hash: "d41d8cd98f00b204e9800998ecf8427e"}); err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+	for _, want := range []string{"clientUrl + '/api/health'", "clientUrl + '/api/md5?hash='", "clientUrl + '/api/index/summary'"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("md5 页面应包含 %s", want)
+		}
+	}
+	if strings.Contains(page, "clientUrl + '/api/v1/") {
+		t.Error("md5 页面不应请求客户端的 /api/v1/ 接口")
+	}
+}
@@ -0,0 +1,224 @@
+// Package tlsserver 网关的 TLS 配置：证书文件修改后自动重新加载，可选的
+// 客户端证书校验（mTLS），以及把 HTTP 请求重定向到 HTTPS 的处理器
+package tlsserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 客户端证书的校验方式
+const (
+	ClientAuthNone     = "none"     // 不要求客户端证书
+	ClientAuthOptional = "optional" // 携带证书时必须由 client_ca_file 签发
+	ClientAuthRequire  = "require"  // 必须携带由 client_ca_file 签发的证书
+)
+
+// reloadCheckInterval 握手时检查证书文件是否变化的最短间隔
+const reloadCheckInterval = 5 * time.Second
+
+// Config TLS 配置，cert_file 与 key_file 都为空时不启用 TLS
+type Config struct {
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+	ClientAuth   string `mapstructure:"client_auth"` // none、optional 或 require
+	// MinVersion 最低 TLS 版本：1.2 或 1.3，默认 1.2
+	MinVersion string `mapstructure:"min_version"`
+	// RedirectAddr 监听 HTTP 并重定向到 HTTPS 的地址，如 ":80"；为空时不监听
+	RedirectAddr string `mapstructure:"redirect_addr"`
+}
+
+// Enabled 是否配置了证书
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// Validate 检查配置项的组合是否有效，不读取文件
+func (c Config) Validate() error {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return errors.New("cert_file 与 key_file 需要同时配置")
+	}
+	switch c.ClientAuth {
+	case "", ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if c.ClientCAFile == "" {
+			return fmt.Errorf("client_auth 为 %s 时需要配置 client_ca_file", c.ClientAuth)
+		}
+	default:
+		return fmt.Errorf("无效的 client_auth: %q，应为 none、optional 或 require", c.ClientAuth)
+	}
+	if _, err := minVersion(c.MinVersion); err != nil {
+		return err
+	}
+	return nil
+}
+
+func minVersion(s string) (uint16, error) {
+	switch s {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("无效的 min_version: %q，应为 1.2 或 1.3", s)
+	}
+}
+
+// Loader 按需重新加载证书与客户端 CA
+//
+// 每次握手时最多每 5 秒检查一次文件的修改时间，文件变化后重新加载；加载
+// 失败（如证书与私钥只替换了一个）时继续使用原有证书，下次检查时重试。
+type Loader struct {
+	cfg        Config
+	clientAuth tls.ClientAuthType
+	minVersion uint16
+	interval   time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  [3]time.Time // cert_file、key_file、client_ca_file
+	checkedAt time.Time
+}
+
+// NewLoader 校验配置并加载证书
+func NewLoader(cfg Config) (*Loader, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	l := &Loader{cfg: cfg, interval: reloadCheckInterval}
+	l.minVersion, _ = minVersion(cfg.MinVersion)
+	switch cfg.ClientAuth {
+	case ClientAuthOptional:
+		l.clientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		l.clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		l.clientAuth = tls.NoClientCert
+	}
+	if err := l.load(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// TLSConfig 返回用于 http.Server 的配置，每个连接使用当前的证书与客户端 CA
+func (l *Loader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: l.minVersion,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			l.reloadIfChanged()
+			l.mu.RLock()
+			defer l.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   l.minVersion,
+				NextProtos:   []string{"h2", "http/1.1"},
+				Certificates: []tls.Certificate{*l.cert},
+				ClientAuth:   l.clientAuth,
+				ClientCAs:    l.clientCAs,
+			}, nil
+		},
+	}
+}
+
+func (l *Loader) files() [3]string {
+	return [3]string{l.cfg.CertFile, l.cfg.KeyFile, l.cfg.ClientCAFile}
+}
+
+func (l *Loader) statFiles() ([3]time.Time, error) {
+	var modTimes [3]time.Time
+	for i, name := range l.files() {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return modTimes, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// reloadIfChanged 证书文件修改后重新加载，加载失败时保留原有证书
+func (l *Loader) reloadIfChanged() {
+	l.mu.RLock()
+	recent := time.Since(l.checkedAt) < l.interval
+	l.mu.RUnlock()
+	if recent {
+		return
+	}
+
+	modTimes, err := l.statFiles()
+	l.mu.Lock()
+	l.checkedAt = time.Now()
+	changed := err == nil && modTimes != l.modTimes
+	l.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := l.load(); err != nil {
+		log.Printf("重新加载TLS证书失败: %v", err)
+		return
+	}
+	log.Printf("已重新加载TLS证书 %s", l.cfg.CertFile)
+}
+
+func (l *Loader) load() error {
+	modTimes, err := l.statFiles()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(l.cfg.CertFile, l.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("加载证书失败: %w", err)
+	}
+	var pool *x509.CertPool
+	if l.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(l.cfg.ClientCAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s 中没有有效的证书", l.cfg.ClientCAFile)
+		}
+	}
+
+	l.mu.Lock()
+	l.cert = &cert
+	l.clientCAs = pool
+	l.modTimes = modTimes
+	l.checkedAt = time.Now()
+	l.mu.Unlock()
+	return nil
+}
+
+// RedirectHandler 把请求以 308 重定向到 HTTPS 的同一地址，httpsPort 为 443 时省略端口
+func RedirectHandler(httpsPort int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(httpsPort))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]" // IPv6
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,235 @@
+package tlsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的自签名 CA
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue 签发证书，返回 PEM 格式的证书与私钥
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{"ops"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveTLS 在随机端口启动 HTTPS 服务器，处理器返回客户端证书的 CN
+func serveTLS(t *testing.T, l *Loader) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{
+		TLSConfig: l.TLSConfig(),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(r.TLS.PeerCertificates) > 0 {
+				w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+			}
+		}),
+	}
+	go srv.ServeTLS(ln, "", "")
+	t.Cleanup(func() { srv.Close() })
+	return "https://" + ln.Addr().String()
+}
+
+// get 使用新的连接请求 url，返回响应与服务器证书的序列号
+func get(ca *testCA, url string, clientCert *tls.Certificate) (*http.Response, int64, error) {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca.pem)
+	cfg := &tls.Config{RootCAs: pool}
+	if clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*clientCert}
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg, ForceAttemptHTTP2: true}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp.Body.Close()
+	return resp, resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func TestServeAndReload(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := Config{CertFile: filepath.Join(dir, "cert.pem"), KeyFile: filepath.Join(dir, "key.pem")}
+	certPEM, keyPEM := ca.issue(t, 100, "gateway", x509.ExtKeyUsageServerAuth)
+	past := time.Now().Add(-time.Minute)
+	writeFile(t, cfg.CertFile, certPEM, past)
+	writeFile(t, cfg.KeyFile, keyPEM, past)
+
+	l, err := NewLoader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.interval = 0
+	url := serveTLS(t, l)
+
+	resp, serial, err := get(ca, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ProtoMajor != 2 || serial != 100 {
+		t.Fatalf("proto = %s, serial = %d", resp.Proto, serial)
+	}
+
+	// 只替换了证书、私钥不匹配时继续使用原有证书
+	certPEM, keyPEM = ca.issue(t, 200, "gateway", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM, time.Now())
+	if _, serial, err := get(ca, url, nil); err != nil || serial != 100 {
+		t.Fatalf("mismatched key pair: serial = %d, err = %v", serial, err)
+	}
+
+	writeFile(t, cfg.KeyFile, keyPEM, time.Now())
+	if _, serial, err := get(ca, url, nil); err != nil || serial != 200 {
+		t.Fatalf("after reload: serial = %d, err = %v", serial, err)
+	}
+}
+
+func TestClientAuth(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+	cfg := Config{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+		ClientAuth:   ClientAuthRequire,
+	}
+	certPEM, keyPEM := ca.issue(t, 100, "gateway", x509.ExtKeyUsageServerAuth)
+	writeFile(t, cfg.CertFile, certPEM, time.Now())
+	writeFile(t, cfg.KeyFile, keyPEM, time.Now())
+	writeFile(t, cfg.ClientCAFile, ca.pem, time.Now())
+
+	l, err := NewLoader(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := serveTLS(t, l)
+
+	if _, _, err := get(ca, url, nil); err == nil {
+		t.Fatal("request without client certificate succeeded")
+	}
+
+	clientPEM, clientKey := ca.issue(t, 300, "indexer", x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientPEM, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := get(ca, url, &clientCert); err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他 CA 签发的客户端证书
+	otherPEM, otherKey := newCA(t).issue(t, 400, "intruder", x509.ExtKeyUsageClientAuth)
+	other, _ := tls.X509KeyPair(otherPEM, otherKey)
+	if _, _, err := get(ca, url, &other); err == nil {
+		t.Fatal("certificate from unknown CA accepted")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	for _, tc := range []struct {
+		port       int
+		host, want string
+	}{
+		{443, "files.example.com", "https://files.example.com/md5?hash=abc"},
+		{443, "files.example.com:80", "https://files.example.com/md5?hash=abc"},
+		{8443, "files.example.com:8080", "https://files.example.com:8443/md5?hash=abc"},
+		{443, "[::1]:80", "https://[::1]/md5?hash=abc"},
+	} {
+		r := httptest.NewRequest("GET", "http://"+tc.host+"/md5?hash=abc", nil)
+		w := httptest.NewRecorder()
+		RedirectHandler(tc.port).ServeHTTP(w, r)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tc.want {
+			t.Errorf("%s -> %d %s, want %s", tc.host, w.Code, w.Header().Get("Location"), tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, cfg := range map[string]Config{
+		"missing key":       {CertFile: "cert.pem"},
+		"unknown auth":      {CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: "always"},
+		"missing client ca": {CertFile: "cert.pem", KeyFile: "key.pem", ClientAuth: ClientAuthRequire},
+		"bad version":       {CertFile: "cert.pem", KeyFile: "key.pem", MinVersion: "1.1"},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/shared/utils"
+)
+
+// lookup 按配置顺序查询哈希，启用缓存时先查缓存
+//
+// 找到和未找到的结果都会缓存，后端出错时不缓存。
+func (g *MD5Gateway) lookup(ctx context.Context, hash string) (*backend.Result, error) {
+	hash = strings.ToLower(hash)
+	if g.cache == nil {
+		return g.backends.Lookup(ctx, hash)
+	}
+	scope := backend.ScopeFrom(ctx)
+	if res, ok := g.cache.Get(ctx, hash, scope); ok {
+		if res == nil {
+			return nil, backend.ErrNotFound
+		}
+		return res, nil
+	}
+
+	res, err := g.backends.Lookup(ctx, hash)
+	if err == nil {
+		g.cache.Set(ctx, hash, scope, res)
+	} else if errors.Is(err, backend.ErrNotFound) {
+		g.cache.Set(ctx, hash, scope, nil)
+	}
+	return res, err
+}
+
+// lookupMany 批量查询哈希，缓存未命中的哈希一次交给后端链
+//
+// 缓存中只保存每个哈希的第一个位置，命中缓存的哈希只返回该位置。
+func (g *MD5Gateway) lookupMany(ctx context.Context, hashes []string) (map[string][]*backend.Result, map[string]error) {
+	if g.cache == nil {
+		return g.backends.LookupMany(ctx, hashes)
+	}
+	scope := backend.ScopeFrom(ctx)
+	cached := make(map[string][]*backend.Result)
+	var misses []string
+	for _, hash := range hashes {
+		res, ok := g.cache.Get(ctx, hash, scope)
+		if !ok {
+			misses = append(misses, hash)
+		} else if res != nil {
+			cached[hash] = []*backend.Result{res}
+		}
+	}
+
+	found, failed := g.backends.LookupMany(ctx, misses)
+	for _, hash := range misses {
+		if res := found[hash]; res != nil {
+			g.cache.Set(ctx, hash, scope, res[0])
+		} else if failed[hash] == nil {
+			g.cache.Set(ctx, hash, scope, nil)
+		}
+	}
+	for hash, res := range cached {
+		found[hash] = res
+	}
+	return found, failed
+}
+
+// 缓存统计
+func (g *MD5Gateway) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	if g.cache == nil {
+		http.Error(w, "未启用缓存", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, g.cache.Stats())
+}
+
+// 清除单个哈希的缓存，包括共享缓存
+func (g *MD5Gateway) handlePurgeCache(w http.ResponseWriter, r *http.Request) {
+	if g.cache == nil {
+		http.Error(w, "未启用缓存", http.StatusNotFound)
+		return
+	}
+	hash := strings.ToLower(mux.Vars(r)["hash"])
+	if !utils.ValidateMD5(hash) {
+		http.Error(w, "无效的MD5哈希格式", http.StatusBadRequest)
+		return
+	}
+	g.cache.Purge(r.Context(), hash)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 清空进程内缓存
+func (g *MD5Gateway) handlePurgeAllCache(w http.ResponseWriter, r *http.Request) {
+	if g.cache == nil {
+		http.Error(w, "未启用缓存", http.StatusNotFound)
+		return
+	}
+	g.cache.PurgeAll()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -1,16 +1,42 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
-	"github.com/spf13/viper"
 
+	"smart-finder/gateway/internal/analytics"
+	"smart-finder/gateway/internal/auth"
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/cache"
+	"smart-finder/gateway/internal/index"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/gateway/internal/registry"
+	"smart-finder/gateway/internal/routing"
+	"smart-finder/gateway/internal/share"
+	"smart-finder/gateway/internal/sqlitedb"
 	"smart-finder/gateway/internal/templates"
+	"smart-finder/gateway/internal/tlsserver"
+	"smart-finder/shared/utils"
 )
 
 var (
@@ -19,10 +45,22 @@ var (
 )
 
 type Config struct {
-	Database DatabaseConfig `mapstructure:"database"`
-	Server   ServerConfig   `mapstructure:"server"`
-	Kodbox   KodboxConfig   `mapstructure:"kodbox"`
-	Error    ErrorConfig    `mapstructure:"error"`
+	Database DatabaseConfig   `mapstructure:"database"`
+	Server   ServerConfig     `mapstructure:"server"`
+	Kodbox   KodboxConfig     `mapstructure:"kodbox"`
+	Error    ErrorConfig      `mapstructure:"error"`
+	Backends []backend.Config `mapstructure:"backends"`
+	Index    index.Config     `mapstructure:"index"`
+	Share    share.Config     `mapstructure:"share"`
+	Admin    AdminConfig      `mapstructure:"admin"`
+	Auth     auth.Config      `mapstructure:"auth"`
+	Cache    cache.Config     `mapstructure:"cache"`
+	// Databases 各 Kodbox 实例单独使用的数据库连接，由 backends 的 database 引用
+	Databases map[string]DatabaseConfig `mapstructure:"databases"`
+	Routing   routing.Config            `mapstructure:"routing"`
+	Analytics analytics.Config          `mapstructure:"analytics"`
+	Templates templates.Config          `mapstructure:"templates"`
+	Registry  registry.Config           `mapstructure:"registry"`
 }
 
 type DatabaseConfig struct {
@@ -30,80 +68,554 @@ type DatabaseConfig struct {
 	Port     int    `mapstructure:"port"`
 	Username string `mapstructure:"username"`
 	Password string `mapstructure:"password"`
-	Database string `mapstructure:"database"`
-	Charset  string `mapstructure:"charset"`
+	// PasswordFile 从文件读取密码，用于 databases 中的连接
+	PasswordFile string `mapstructure:"password_file"`
+	Database     string `mapstructure:"database"`
+	Charset      string `mapstructure:"charset"`
+
+	// 连接池
+	MaxOpenConns    int           `mapstructure:"max_open_conns"`
+	MaxIdleConns    int           `mapstructure:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `mapstructure:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `mapstructure:"conn_max_idle_time"`
+	// ConnectTimeout 启动时重试连接的总时长，超过后退出
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
 }
 
+// 数据库连接的默认配置
+const (
+	DefaultMaxOpenConns    = 20
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 5 * time.Minute // 小于 MySQL 的 wait_timeout，避免使用已被服务端关闭的连接
+	DefaultConnectTimeout  = time.Minute
+	maxConnectBackoff      = 10 * time.Second
+)
+
 type ServerConfig struct {
 	Port   int    `mapstructure:"port"`
 	Domain string `mapstructure:"domain"`
+	// Delivery 为 redirect 时重定向到后端地址，为 stream 时由网关直接输出文件内容
+	Delivery string `mapstructure:"delivery"`
+	// Disposition 直接输出文件时的默认展示方式：inline 或 attachment
+	Disposition string `mapstructure:"disposition"`
+	// MaxBatchSize POST /api/resolve 单次允许的最大哈希数
+	MaxBatchSize int `mapstructure:"max_batch_size"`
+	// ShutdownTimeout 收到 SIGTERM 后等待处理中请求完成的最长时间
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	// TLS 配置了证书时在 port 上提供 HTTPS（含 HTTP/2）
+	TLS tlsserver.Config `mapstructure:"tls"`
 }
 
+// DefaultShutdownTimeout 默认的关闭等待时间
+const DefaultShutdownTimeout = 30 * time.Second
+
 type KodboxConfig struct {
-	Domain string `mapstructure:"domain"`
+	Domain   string            `mapstructure:"domain"`
+	DataPath string            `mapstructure:"data_path"`
+	IOPaths  map[string]string `mapstructure:"io_paths"`
+}
+
+// BackendHeader 重定向或直接输出文件时，给出找到文件的后端（Kodbox 实例）名称
+const BackendHeader = "X-SmartFinder-Backend"
+
+// 文件的提供方式
+const (
+	DeliveryRedirect = "redirect"
+	DeliveryStream   = "stream"
+)
+
+// AdminConfig 管理接口（/api/admin/）的访问令牌，未配置时管理接口不可用
+type AdminConfig struct {
+	Token string `mapstructure:"token"`
 }
 
 type ErrorConfig struct {
+	// NotFoundPage 文件不存在时重定向到的地址，为空时显示内置的 not_found.html 模板
 	NotFoundPage string `mapstructure:"not_found_page"`
 }
 
 type MD5Gateway struct {
-	config    *Config
+	config    atomic.Pointer[Config] // 配置文件修改后整体替换，见 applyConfig
 	db        *sql.DB
 	templates *templates.Templates
+	backends  *backend.Chain
+	indexer   *index.Indexer      // 未配置网关索引时为 nil
+	shares    *share.Manager      // 未配置分享密钥时为 nil
+	auth      *auth.Auth          // 未配置认证方式时为 nil
+	routing   *routing.Router     // 未配置路由规则时为 nil
+	cache     *cache.Cache        // 禁用缓存时为 nil
+	analytics *analytics.Recorder // 未启用解析记录时为 nil
+	registry  *registry.Registry  // 未启用客户端登记时为 nil
+	metrics   *metrics.Metrics
+	draining  atomic.Bool // 正在关闭，就绪检查返回 503
+}
+
+// conf 返回当前配置，调用方不应修改
+func (g *MD5Gateway) conf() *Config {
+	return g.config.Load()
 }
 
 func main() {
+	configPath := flag.String("config", os.Getenv(EnvPrefix+"_CONFIG"), "配置文件路径，默认读取 config/config.yaml")
+	flag.Parse()
+
 	// 加载配置
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath("config")
+	loaded, v, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	config := *loaded
+
+	// 收到 SIGINT 或 SIGTERM 时取消 ctx：停止后台任务并开始关闭服务器
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 连接数据库（仅在启用 Kodbox 后端或索引使用 MySQL 时需要）
+	var db *sql.DB
+	if needsMySQL(&config) {
+		var err error
+		db, err = connectDatabase(ctx, &config.Database)
+		if err != nil {
+			log.Fatalf("数据库连接失败: %v", err)
+		}
+		defer db.Close()
+	}
+	kodboxDBs, err := connectKodboxDatabases(ctx, &config)
+	if err != nil {
+		log.Fatalf("数据库连接失败: %v", err)
+	}
+	for _, kdb := range kodboxDBs {
+		defer kdb.Close()
+	}
+
+	// 网关索引
+	var indexer *index.Indexer
+	if len(config.Index.Roots) > 0 {
+		var err error
+		indexer, err = openIndexer(&config.Index, db)
+		if err != nil {
+			log.Fatalf("索引初始化失败: %v", err)
+		}
+		go indexer.Run(ctx)
+	}
+
+	// 分享链接
+	var shares *share.Manager
+	if config.Share.Secret != "" {
+		var err error
+		shares, err = openShares(&config.Share, db)
+		if err != nil {
+			log.Fatalf("分享链接初始化失败: %v", err)
+		}
+	}
 
-	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("无法读取配置文件: %v", err)
+	// 解析记录
+	var recorder *analytics.Recorder
+	if config.Analytics.Enabled {
+		var err error
+		recorder, err = openAnalytics(&config.Analytics, db)
+		if err != nil {
+			log.Fatalf("解析记录初始化失败: %v", err)
+		}
+		recorder.Start()
 	}
 
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		log.Fatalf("无法解析配置: %v", err)
+	// 客户端登记
+	var hosts *registry.Registry
+	if config.Registry.Enabled {
+		var err error
+		hosts, err = openRegistry(&config.Registry, db)
+		if err != nil {
+			log.Fatalf("客户端登记初始化失败: %v", err)
+		}
 	}
 
-	// 连接数据库
-	db, err := connectDatabase(&config.Database)
+	// 认证
+	var authn *auth.Auth
+	if len(config.Auth.Methods) > 0 {
+		var err error
+		authn, err = auth.New(config.Auth)
+		if err != nil {
+			log.Fatalf("认证初始化失败: %v", err)
+		}
+	}
+
+	backends, err := buildBackends(ctx, &config, db, kodboxDBs, indexer, hosts)
 	if err != nil {
-		log.Fatalf("数据库连接失败: %v", err)
+		log.Fatalf("后端初始化失败: %v", err)
+	}
+	backends.SetParallel(config.Routing.Mode == routing.ModeParallel)
+
+	// 查询结果缓存
+	var lookupCache *cache.Cache
+	if !config.Cache.Disabled {
+		lookupCache, err = openCache(ctx, &config.Cache, backends)
+		if err != nil {
+			log.Fatalf("缓存初始化失败: %v", err)
+		}
 	}
-	defer db.Close()
+
+	// Prometheus 指标
+	gatewayMetrics := metrics.New()
+	backends.SetObserver(gatewayMetrics.ObserveBackend)
+	gatewayMetrics.RegisterDB("mysql", db)
+	for name, kdb := range kodboxDBs {
+		gatewayMetrics.RegisterDB("mysql-"+name, kdb)
+	}
+	gatewayMetrics.RegisterCache(lookupCache)
 
 	// 初始化模板
-	tmpl, err := templates.New()
+	tmpl, err := templates.New(config.Templates)
 	if err != nil {
 		log.Fatalf("模板初始化失败: %v", err)
 	}
 
 	// 创建网关实例
 	gateway := &MD5Gateway{
-		config:    &config,
 		db:        db,
 		templates: tmpl,
+		backends:  backends,
+		indexer:   indexer,
+		shares:    shares,
+		auth:      authn,
+		routing:   routing.New(config.Routing),
+		cache:     lookupCache,
+		analytics: recorder,
+		registry:  hosts,
+		metrics:   gatewayMetrics,
 	}
+	gateway.config.Store(&config)
+	gateway.watchConfig(v, *loaded)
 
 	// 设置路由
+	router := gateway.routes()
+
+	// 启动服务器
+	server := &http.Server{
+		Addr:              ":" + strconv.Itoa(config.Server.Port),
+		Handler:           router,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	serverErr := make(chan error, 2)
+	if config.Server.TLS.Enabled() {
+		certs, err := tlsserver.NewLoader(config.Server.TLS)
+		if err != nil {
+			log.Fatalf("TLS初始化失败: %v", err)
+		}
+		server.TLSConfig = certs.TLSConfig()
+		go func() {
+			log.Printf("MD5网关服务器启动在端口 %s (HTTPS)", server.Addr)
+			serverErr <- server.ListenAndServeTLS("", "")
+		}()
+	} else {
+		go func() {
+			log.Printf("MD5网关服务器启动在端口 %s", server.Addr)
+			serverErr <- server.ListenAndServe()
+		}()
+	}
+
+	// HTTP 重定向到 HTTPS
+	var redirectServer *http.Server
+	if config.Server.TLS.Enabled() && config.Server.TLS.RedirectAddr != "" {
+		redirectServer = &http.Server{
+			Addr:              config.Server.TLS.RedirectAddr,
+			Handler:           tlsserver.RedirectHandler(config.Server.Port),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		go func() {
+			log.Printf("HTTP重定向到HTTPS，监听 %s", redirectServer.Addr)
+			serverErr <- redirectServer.ListenAndServe()
+		}()
+	}
+
+	select {
+	case err := <-serverErr:
+		log.Fatalf("服务器启动失败: %v", err)
+	case <-ctx.Done():
+	}
+
+	// 停止接收新连接，等待处理中的请求完成
+	shutdownTimeout := gateway.conf().Server.ShutdownTimeout
+	log.Printf("正在关闭服务器，最长等待 %s", shutdownTimeout)
+	gateway.draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("关闭服务器超时，仍有请求未完成: %v", err)
+	}
+	if recorder != nil {
+		recorder.Close()
+	}
+	log.Printf("服务器已关闭")
+}
+
+// routes 注册网关的所有路由
+func (g *MD5Gateway) routes() *mux.Router {
 	router := mux.NewRouter()
+	router.Use(g.metrics.Middleware)
 
 	// 静态文件服务 - 使用embed.FS
 	router.PathPrefix("/public/").Handler(http.StripPrefix("/public/", getPublicFileServer()))
 
-	router.HandleFunc("/md5", gateway.handleMD5Query).Methods("GET")
-	router.HandleFunc("/api/md5", gateway.handleMD5API).Methods("GET")
+	// 存活与就绪检查，不经过认证
+	router.HandleFunc("/healthz", g.handleHealthz).Methods("GET", "HEAD")
+	router.HandleFunc("/readyz", g.handleReadyz).Methods("GET", "HEAD")
+	if g.metrics != nil {
+		router.Handle("/metrics", g.metrics.Handler()).Methods("GET")
+	}
 
-	// 启动服务器
-	serverAddr := ":" + strconv.Itoa(config.Server.Port)
-	log.Printf("MD5网关服务器启动在端口 %s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, router))
+	// 分享链接自带签名，不经过认证
+	router.HandleFunc("/s/{token}", g.handleShare).Methods("GET", "POST")
+
+	// 管理接口
+	admin := router.PathPrefix("/api/admin").Subrouter()
+	admin.Use(g.requireAdmin)
+	admin.HandleFunc("/shares", g.handleListShares).Methods("GET")
+	admin.HandleFunc("/shares", g.handleCreateShare).Methods("POST")
+	admin.HandleFunc("/shares/{id}", g.handleRevokeShare).Methods("DELETE")
+	admin.HandleFunc("/cache", g.handleCacheStats).Methods("GET")
+	admin.HandleFunc("/cache", g.handlePurgeAllCache).Methods("DELETE")
+	admin.HandleFunc("/cache/{hash}", g.handlePurgeCache).Methods("DELETE")
+
+	admin.HandleFunc("/hosts", g.handleListHosts).Methods("GET")
+	admin.HandleFunc("/hosts/{id}", g.handleRemoveHost).Methods("DELETE")
+
+	// 索引状态包含服务器目录，重新索引会占用磁盘和CPU，都只对管理员开放
+	admin.HandleFunc("/index/status", g.handleIndexStatus).Methods("GET")
+	admin.HandleFunc("/index/rescan", g.handleIndexRescan).Methods("POST")
+
+	// 客户端登记，使用 registry.token 认证
+	registryAPI := router.PathPrefix("/api/registry").Subrouter()
+	registryAPI.Use(g.requireRegistryToken)
+	registryAPI.HandleFunc("/publish", g.handleRegistryPublish).Methods("POST")
+	registryAPI.HandleFunc("/heartbeat", g.handleRegistryHeartbeat).Methods("POST")
+
+	// 解析统计包含来源页面等访问记录，只对管理员开放
+	router.Handle("/api/stats", g.requireAdmin(http.HandlerFunc(g.handleStats))).Methods("GET")
+
+	// 查询接口，配置了认证时需要认证并按授权规则限制解析范围
+	protected := router.PathPrefix("/").Subrouter()
+	if g.auth != nil {
+		protected.Use(g.auth.Middleware)
+	}
+	if g.routing != nil {
+		protected.Use(g.routing.Middleware)
+	}
+	protected.HandleFunc("/md5", g.handleMD5Query).Methods("GET")
+	protected.HandleFunc("/api/md5", g.handleMD5API).Methods("GET")
+	protected.HandleFunc("/view", g.handleView).Methods("GET")
+	protected.HandleFunc("/view/raw", g.handleViewRaw).Methods("GET", "HEAD")
+	protected.HandleFunc("/api/md5/outcome", g.handleClientOutcome).Methods("POST")
+	protected.HandleFunc("/api/resolve", g.handleResolve).Methods("POST")
+
+	return router
+}
+
+func needsMySQL(config *Config) bool {
+	if len(config.Index.Roots) > 0 && config.Index.Driver == index.DriverMySQL {
+		return true
+	}
+	if config.Share.Secret != "" && config.Share.Driver == share.DriverMySQL {
+		return true
+	}
+	if config.Analytics.Enabled && config.Analytics.Driver == analytics.DriverMySQL {
+		return true
+	}
+	if config.Registry.Enabled && config.Registry.Driver == registry.DriverMySQL {
+		return true
+	}
+	for _, cfg := range config.Backends {
+		if cfg.Type == backend.TypeKodbox && cfg.Database == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// connectKodboxDatabases 连接 Kodbox 后端引用的 databases 中的数据库，以名称为键
+func connectKodboxDatabases(ctx context.Context, config *Config) (map[string]*sql.DB, error) {
+	dbs := make(map[string]*sql.DB)
+	for _, cfg := range config.Backends {
+		if cfg.Type != backend.TypeKodbox || cfg.Database == "" || dbs[cfg.Database] != nil {
+			continue
+		}
+		dbConfig := config.Databases[cfg.Database]
+		db, err := connectDatabase(ctx, &dbConfig)
+		if err != nil {
+			for _, opened := range dbs {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("databases.%s: %w", cfg.Database, err)
+		}
+		dbs[cfg.Database] = db
+	}
+	return dbs, nil
+}
+
+// openIndexer 打开索引数据库并创建索引器，MySQL 索引与 Kodbox 共用 database 配置的连接
+func openIndexer(cfg *index.Config, db *sql.DB) (*index.Indexer, error) {
+	indexDB := db
+	if cfg.Driver == index.DriverSQLite {
+		if cfg.SQLitePath == "" {
+			cfg.SQLitePath = index.DefaultSQLitePath
+		}
+		var err error
+		indexDB, err = sqlitedb.Open(cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	store, err := index.NewStore(indexDB, cfg.Driver)
+	if err != nil {
+		return nil, err
+	}
+	return index.New(store, *cfg)
+}
+
+// openAnalytics 打开解析记录数据库，MySQL 与 Kodbox 共用 database 配置的连接
+func openAnalytics(cfg *analytics.Config, db *sql.DB) (*analytics.Recorder, error) {
+	analyticsDB := db
+	if cfg.Driver == analytics.DriverSQLite {
+		if cfg.SQLitePath == "" {
+			cfg.SQLitePath = analytics.DefaultSQLitePath
+		}
+		var err error
+		analyticsDB, err = sqlitedb.Open(cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return analytics.New(analyticsDB, *cfg)
+}
+
+// openRegistry 打开客户端登记数据库，MySQL 与 Kodbox 共用 database 配置的连接
+func openRegistry(cfg *registry.Config, db *sql.DB) (*registry.Registry, error) {
+	registryDB := db
+	if cfg.Driver == registry.DriverSQLite {
+		if cfg.SQLitePath == "" {
+			cfg.SQLitePath = registry.DefaultSQLitePath
+		}
+		var err error
+		registryDB, err = sqlitedb.Open(cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return registry.New(registryDB, *cfg)
+}
+
+// openShares 打开分享链接数据库，MySQL 与 Kodbox 共用 database 配置的连接
+func openShares(cfg *share.Config, db *sql.DB) (*share.Manager, error) {
+	shareDB := db
+	if cfg.Driver == share.DriverSQLite {
+		if cfg.SQLitePath == "" {
+			cfg.SQLitePath = share.DefaultSQLitePath
+		}
+		var err error
+		shareDB, err = sqlitedb.Open(cfg.SQLitePath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return share.NewManager(shareDB, *cfg)
+}
+
+// openCache 创建查询结果缓存，并为能报告文件变化的后端（Kodbox）启动失效检查
+func openCache(ctx context.Context, cfg *cache.Config, backends *backend.Chain) (*cache.Cache, error) {
+	var shared cache.Shared
+	if cfg.Redis.Addr != "" {
+		redis, err := cache.NewRedis(ctx, cfg.Redis)
+		if err != nil {
+			return nil, fmt.Errorf("连接 Redis 失败: %w", err)
+		}
+		shared = redis
+	}
+	c := cache.New(*cfg, shared)
+	for _, b := range backends.Backends() {
+		if u, ok := b.(backend.URLExpirer); ok {
+			c.LimitTTL(b.Name(), u.URLExpiry())
+		}
+		if src, ok := b.(cache.ChangeSource); ok {
+			go c.Watch(ctx, src, cfg.PollInterval)
+		}
+	}
+	return c, nil
+}
+
+// buildBackends 按配置顺序创建后端，需要后台索引的后端在 ctx 取消前持续运行
+//
+// Kodbox 后端配置了 database 时使用 kodboxDBs 中的连接，否则使用 db。
+func buildBackends(ctx context.Context, config *Config, db *sql.DB, kodboxDBs map[string]*sql.DB, indexer *index.Indexer, hosts *registry.Registry) (*backend.Chain, error) {
+	var backends []backend.Backend
+	names := make(map[string]bool)
+	for _, cfg := range config.Backends {
+		name := cfg.DisplayName()
+		if names[name] {
+			return nil, fmt.Errorf("后端名称重复: %s", name)
+		}
+		names[name] = true
+
+		var b backend.Backend
+		switch cfg.Type {
+		case backend.TypeKodbox:
+			kdb, domain := db, config.Kodbox.Domain
+			storage := backend.KodboxStorage{DataPath: config.Kodbox.DataPath, IOPaths: config.Kodbox.IOPaths}
+			if cfg.Database != "" {
+				kdb = kodboxDBs[cfg.Database]
+			}
+			if cfg.Domain != "" {
+				domain = cfg.Domain
+			}
+			if cfg.DataPath != "" || len(cfg.IOPaths) > 0 {
+				storage = backend.KodboxStorage{DataPath: cfg.DataPath, IOPaths: cfg.IOPaths}
+			}
+			b = backend.NewKodbox(name, kdb, domain, storage)
+		case backend.TypeLocal:
+			// 直接输出文件内容时不需要对外地址
+			if cfg.BaseURL == "" && config.Server.Delivery != DeliveryStream {
+				return nil, fmt.Errorf("后端 %s: 需要配置 base_url", name)
+			}
+			local, err := backend.NewLocal(name, cfg.Root, cfg.BaseURL, cfg.RescanInterval)
+			if err != nil {
+				return nil, fmt.Errorf("后端 %s: %w", name, err)
+			}
+			go local.Run(ctx)
+			b = local
+		case backend.TypeIndex:
+			if indexer == nil {
+				return nil, fmt.Errorf("后端 %s: 需要配置 index.roots", name)
+			}
+			b = backend.NewIndex(name, indexer)
+		case backend.TypeRegistry:
+			if hosts == nil {
+				return nil, fmt.Errorf("后端 %s: 需要启用 registry", name)
+			}
+			b = backend.NewRegistry(name, hosts)
+		case backend.TypeS3:
+			s3, err := backend.NewS3(cfg)
+			if err != nil {
+				return nil, fmt.Errorf("后端 %s: %w", name, err)
+			}
+			go s3.Run(ctx)
+			b = s3
+		default:
+			return nil, fmt.Errorf("未知的后端类型: %q", cfg.Type)
+		}
+		backends = append(backends, b)
+		log.Printf("启用后端: %s (%s)", name, cfg.Type)
+	}
+	return backend.NewChain(backends...), nil
 }
 
-func connectDatabase(dbConfig *DatabaseConfig) (*sql.DB, error) {
+// connectDatabase 打开连接池并等待数据库可用
+//
+// 启动时数据库可能尚未就绪（如与网关同时启动的容器），连接失败时按指数
+// 退避重试，直到 connect_timeout 或 ctx 取消。启动后的断线由连接池在
+// 下次查询时自动重连，/readyz 反映当前的连接状态。
+func connectDatabase(ctx context.Context, dbConfig *DatabaseConfig) (*sql.DB, error) {
 	dsn := dbConfig.Username + ":" + dbConfig.Password + "@tcp(" +
 		dbConfig.Host + ":" + strconv.Itoa(dbConfig.Port) + ")/" +
 		dbConfig.Database + "?charset=" + dbConfig.Charset + "&parseTime=True&loc=Local"
@@ -112,113 +624,224 @@ func connectDatabase(dbConfig *DatabaseConfig) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
+	configurePool(db, dbConfig)
 
-	// 测试连接
-	if err := db.Ping(); err != nil {
-		return nil, err
+	timeout := dbConfig.ConnectTimeout
+	if timeout <= 0 {
+		timeout = DefaultConnectTimeout
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := time.Second
+	for {
+		pingCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return db, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			db.Close()
+			return nil, err
+		}
+		log.Printf("数据库暂不可用，%s 后重试: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
 	}
+}
 
-	return db, nil
+// configurePool 设置连接池参数，未配置的项使用默认值
+func configurePool(db *sql.DB, cfg *DatabaseConfig) {
+	maxOpen := cfg.MaxOpenConns
+	if maxOpen <= 0 {
+		maxOpen = DefaultMaxOpenConns
+	}
+	maxIdle := cfg.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = DefaultMaxIdleConns
+	}
+	lifetime := cfg.ConnMaxLifetime
+	if lifetime <= 0 {
+		lifetime = DefaultConnMaxLifetime
+	}
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(min(maxIdle, maxOpen))
+	db.SetConnMaxLifetime(lifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+// requireAdmin 校验 Authorization: Bearer <admin.token>
+func (g *MD5Gateway) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := g.conf().Admin.Token
+		if token == "" {
+			http.Error(w, "未配置管理令牌", http.StatusForbidden)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="smart-finder"`)
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (g *MD5Gateway) handleMD5Query(w http.ResponseWriter, r *http.Request) {
-	// 获取MD5哈希值
-	hash := r.URL.Query().Get("hash")
-	if hash == "" {
-		http.Error(w, "缺少MD5哈希参数", http.StatusBadRequest)
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		g.handleLookupJSON(w, r)
 		return
 	}
 
-	// 验证MD5格式（32位十六进制字符）
+	// 获取MD5哈希值并验证格式（32位十六进制字符）
+	hash := r.URL.Query().Get("hash")
 	if len(hash) != 32 {
-		http.Error(w, "无效的MD5哈希格式", http.StatusBadRequest)
+		g.errorPage(w, r, http.StatusBadRequest, reasonBadRequest)
 		return
 	}
 
 	// 使用模板渲染页面
 	data := templates.TemplateData{
 		Hash:         hash,
-		ServerDomain: g.config.Server.Domain,
+		ServerDomain: g.conf().Server.Domain,
 	}
 
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := g.templates.RenderMD5Page(w, data); err != nil {
-		log.Printf("模板渲染失败: %v", err)
-		http.Error(w, "内部服务器错误", http.StatusInternalServerError)
-		return
-	}
+	g.renderPage(w, http.StatusOK, func(out io.Writer) error {
+		return g.templates.RenderMD5Page(out, g.lang(r), data)
+	})
 }
 
-// 处理API MD5查询（服务端处理）
+// 处理API MD5查询（服务端处理），Accept: application/json 时返回查询结果
 func (g *MD5Gateway) handleMD5API(w http.ResponseWriter, r *http.Request) {
-	// 获取MD5哈希值
-	hash := r.URL.Query().Get("hash")
-	if hash == "" {
-		http.Error(w, "缺少MD5哈希参数", http.StatusBadRequest)
+	start := time.Now()
+	w.Header().Add("Vary", "Accept")
+	if wantsJSON(r) {
+		g.handleLookupJSON(w, r)
 		return
 	}
 
-	// 验证MD5格式（32位十六进制字符）
+	// 获取MD5哈希值并验证格式（32位十六进制字符）
+	hash := r.URL.Query().Get("hash")
 	if len(hash) != 32 {
-		http.Error(w, "无效的MD5哈希格式", http.StatusBadRequest)
+		g.errorPage(w, r, http.StatusBadRequest, reasonBadRequest)
 		return
 	}
 
-	// 查询文件ID
-	fileID, err := g.getFileIDByMD5(hash)
+	// 按配置顺序查询各后端
+	res, err := g.lookup(r.Context(), hash)
+	g.recordResolution(r, metrics.SourceServer, hash, res, err, start)
+	if errors.Is(err, backend.ErrNotFound) {
+		g.notFoundPage(w, r, hash)
+		return
+	}
 	if err != nil {
-		log.Printf("查询文件ID失败: %v", err)
-		http.Error(w, "数据库查询错误", http.StatusInternalServerError)
+		log.Printf("查询文件失败: %v", err)
+		g.errorPage(w, r, http.StatusInternalServerError, reasonBackend)
 		return
 	}
 
-	if fileID == 0 {
-		// 未找到文件，重定向到错误页面
-		http.Redirect(w, r, g.config.Error.NotFoundPage, http.StatusFound)
+	w.Header().Set(BackendHeader, res.Backend)
+
+	// 后端没有对外地址时（如未配置 base_url 的索引目录）同样直接输出文件
+	if g.conf().Server.Delivery == DeliveryStream || res.URL == "" {
+		disposition, ok := requestDisposition(r, g.conf().Server.Disposition)
+		if !ok {
+			http.Error(w, "无效的disposition参数", http.StatusBadRequest)
+			return
+		}
+		g.serveContent(w, r, res, disposition)
 		return
 	}
 
-	// 查询源ID
-	sourceID, err := g.getSourceIDByFileID(fileID)
-	if err != nil {
-		log.Printf("查询源ID失败: %v", err)
-		http.Error(w, "数据库查询错误", http.StatusInternalServerError)
-		return
+	// 重定向到后端给出的地址
+	http.Redirect(w, r, res.URL, http.StatusFound)
+}
+
+// requestDisposition 读取请求参数 disposition=inline|attachment，未指定时使用 def
+func requestDisposition(r *http.Request, def string) (string, bool) {
+	switch d := r.URL.Query().Get("disposition"); d {
+	case "":
+		return def, true
+	case utils.DispositionInline, utils.DispositionAttachment:
+		return d, true
+	default:
+		return "", false
 	}
+}
 
-	if sourceID == 0 {
-		// 未找到源，重定向到错误页面
-		http.Redirect(w, r, g.config.Error.NotFoundPage, http.StatusFound)
+// resultName 返回文件名，后端没有给出时取路径的最后一部分
+func resultName(res *backend.Result) string {
+	if res.Name != "" {
+		return res.Name
+	}
+	return path.Base(filepath.ToSlash(res.Path))
+}
+
+// serveContent 由网关直接输出文件内容，支持 Range 请求
+//
+// 后端不支持直接读取时退回到重定向。文件内容与网关同源，响应禁止浏览器猜测
+// 类型并放入沙箱，HTML、SVG 等会执行脚本的类型总是作为附件下载，避免文件中的
+// 脚本借用访问者的认证调用网关接口。
+func (g *MD5Gateway) serveContent(w http.ResponseWriter, r *http.Request, res *backend.Result, disposition string) {
+	if res.Host != "" {
+		g.remotePage(w, r, res)
+		return
+	}
+	content, err := g.backends.Open(r.Context(), res)
+	if errors.Is(err, backend.ErrNotSupported) && res.URL != "" {
+		http.Redirect(w, r, res.URL, http.StatusFound)
 		return
 	}
+	if err != nil {
+		log.Printf("读取文件失败 %s: %v", res.Backend, err)
+		g.errorPage(w, r, http.StatusBadGateway, reasonOpen)
+		return
+	}
+	defer content.Close()
 
-	// 重定向到客户端
-	redirectURL := g.config.Kodbox.Domain + "/#explorer&sidf=" + strconv.Itoa(sourceID)
-	http.Redirect(w, r, redirectURL, http.StatusFound)
+	name := resultName(res)
+	contentType := utils.DetectContentType(name, content)
+	if utils.ActiveContentType(contentType) {
+		disposition = utils.DispositionAttachment
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", utils.ContentDisposition(disposition, name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	http.ServeContent(w, r, name, content.ModTime, content)
 }
 
-func (g *MD5Gateway) getFileIDByMD5(hash string) (int, error) {
-	var fileID int
-	query := "SELECT fileID FROM io_file WHERE hashMD5 = ? LIMIT 1"
-	err := g.db.QueryRow(query, hash).Scan(&fileID)
+// 网关索引状态
+func (g *MD5Gateway) handleIndexStatus(w http.ResponseWriter, r *http.Request) {
+	if g.indexer == nil {
+		http.Error(w, "未启用网关索引", http.StatusNotFound)
+		return
+	}
+	status, err := g.indexer.Status(r.Context())
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, nil // 未找到记录
-		}
-		return 0, err
+		log.Printf("查询索引状态失败: %v", err)
+		http.Error(w, "查询索引状态失败", http.StatusInternalServerError)
+		return
 	}
-	return fileID, nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
 }
 
-func (g *MD5Gateway) getSourceIDByFileID(fileID int) (int, error) {
-	var sourceID int
-	query := "SELECT sourceID FROM io_source WHERE fileId = ? LIMIT 1"
-	err := g.db.QueryRow(query, fileID).Scan(&sourceID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return 0, nil // 未找到记录
-		}
-		return 0, err
+// 立即重新索引，已在进行时返回 409
+func (g *MD5Gateway) handleIndexRescan(w http.ResponseWriter, r *http.Request) {
+	if g.indexer == nil {
+		http.Error(w, "未启用网关索引", http.StatusNotFound)
+		return
+	}
+	if !g.indexer.Trigger() {
+		http.Error(w, index.ErrRunning.Error(), http.StatusConflict)
+		return
 	}
-	return sourceID, nil
+	w.WriteHeader(http.StatusAccepted)
 }
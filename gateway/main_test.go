@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/gateway/internal/templates"
+)
+
+const helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// newTestGateway 创建只启用本地目录后端的网关，files 为目录中的文件名与内容
+func newTestGateway(t *testing.T, files map[string]string) *MD5Gateway {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	local, err := backend.NewLocal("files", root, "", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Rescan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	tmpl, err := templates.New(templates.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &MD5Gateway{
+		templates: tmpl,
+		backends:  backend.NewChain(local),
+		metrics:   metrics.New(),
+	}
+	g.config.Store(&Config{})
+	return g
+}
+
+func TestServeContentActiveTypes(t *testing.T) {
+	files := map[string]string{
+		"page.html": "<script>fetch('/api/stats')</script>",
+		"icon.svg":  `<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`,
+		"note.txt":  "<script>alert(1)</script>",
+	}
+	router := newTestGateway(t, files).routes()
+
+	tests := []struct {
+		name        string
+		url         string
+		disposition string
+	}{
+		// 请求在线显示时，会执行脚本的类型仍作为附件下载
+		{"page.html", "/view/raw?disposition=inline&hash=", "attachment"},
+		{"icon.svg", "/view/raw?disposition=inline&hash=", "attachment"},
+		{"page.html", "/api/md5?hash=", "attachment"},
+		{"note.txt", "/view/raw?hash=", "inline"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.url+md5Hex(files[tt.name]), nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Body.String() != files[tt.name] {
+			t.Errorf("%s %s: %d %q", tt.url, tt.name, rec.Code, rec.Body.String())
+			continue
+		}
+		h := rec.Header()
+		if got := h.Get("Content-Disposition"); !strings.HasPrefix(got, tt.disposition+";") {
+			t.Errorf("%s %s: Content-Disposition = %q, want %s", tt.url, tt.name, got, tt.disposition)
+		}
+		if got := h.Get("X-Content-Type-Options"); got != "nosniff" {
+			t.Errorf("%s %s: X-Content-Type-Options = %q", tt.url, tt.name, got)
+		}
+		if got := h.Get("Content-Security-Policy"); got != "sandbox" {
+			t.Errorf("%s %s: Content-Security-Policy = %q", tt.url, tt.name, got)
+		}
+	}
+}
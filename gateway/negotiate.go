@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-finder/gateway/internal/analytics"
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/gateway/internal/routing"
+	"smart-finder/shared/types"
+	"smart-finder/shared/utils"
+)
+
+// wantsJSON 判断请求的 Accept 头是否要求 JSON
+func wantsJSON(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") {
+			return true
+		}
+	}
+	return false
+}
+
+// handleLookupJSON 查询哈希并以 JSON 返回，不重定向也不输出文件内容
+//
+// 参数错误返回 400，未找到返回 404（exists 为 false），后端出错时无法确定
+// 文件是否存在，返回 503。
+func (g *MD5Gateway) handleLookupJSON(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	hash := r.URL.Query().Get("hash")
+	if hash == "" {
+		writeLookupError(w, http.StatusBadRequest, "", types.ErrCodeMissingHash, "缺少MD5哈希参数")
+		return
+	}
+	if !utils.ValidateMD5(hash) {
+		writeLookupError(w, http.StatusBadRequest, hash, types.ErrCodeInvalidHash, "无效的MD5哈希格式")
+		return
+	}
+
+	hash = strings.ToLower(hash)
+	res, err := g.lookup(r.Context(), hash)
+	g.recordResolution(r, metrics.SourceServer, hash, res, err, start)
+	if errors.Is(err, backend.ErrNotFound) {
+		writeLookupError(w, http.StatusNotFound, hash, types.ErrCodeNotFound, "文件不存在")
+		return
+	}
+	if err != nil {
+		log.Printf("查询文件失败: %v", err)
+		writeLookupError(w, http.StatusServiceUnavailable, hash, types.ErrCodeBackendUnavailable, "后端查询错误")
+		return
+	}
+	g.writeLookupJSON(w, hash, res)
+}
+
+// writeLookupJSON 以 JSON 返回哈希的查询结果
+func (g *MD5Gateway) writeLookupJSON(w http.ResponseWriter, hash string, res *backend.Result) {
+	loc := g.locations(hash, []*backend.Result{res})[0]
+	writeJSON(w, http.StatusOK, types.LookupResult{
+		Hash:     hash,
+		Exists:   true,
+		Backend:  loc.Backend,
+		Type:     loc.Type,
+		FileID:   loc.FileID,
+		SourceID: loc.SourceID,
+		Size:     loc.Size,
+		Name:     loc.Name,
+		URL:      loc.URL,
+		Host:     loc.Host,
+		Path:     loc.Path,
+	})
+}
+
+// writeLookupError 以 JSON 返回查询失败的原因
+func writeLookupError(w http.ResponseWriter, status int, hash, code, message string) {
+	writeJSON(w, status, types.LookupResult{Hash: hash, Error: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// 记录 md5.html 检查本地客户端的结果：found 表示已跳转到本地客户端，
+// not_found 表示客户端在运行但没有该文件，unavailable 表示客户端未运行，
+// 后两种情况页面随后由服务端处理
+//
+// 可选参数 latency_ms 为页面打开到得出结果的毫秒数，ref 为来源页面。
+func (g *MD5Gateway) handleClientOutcome(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	outcome := query.Get("outcome")
+	switch outcome {
+	case metrics.OutcomeFound, metrics.OutcomeNotFound, metrics.OutcomeUnavailable:
+	default:
+		http.Error(w, "无效的outcome参数", http.StatusBadRequest)
+		return
+	}
+	hash := query.Get("hash")
+	if hash != "" && !utils.ValidateMD5(hash) {
+		http.Error(w, "无效的MD5哈希格式", http.StatusBadRequest)
+		return
+	}
+	latency, _ := strconv.ParseInt(query.Get("latency_ms"), 10, 64)
+
+	g.metrics.Resolution(metrics.SourceClient, outcome)
+	path := analytics.PathServer
+	if outcome == metrics.OutcomeFound {
+		path = analytics.PathClient
+	}
+	if hash != "" {
+		g.analytics.Record(analytics.Event{
+			Hash:     strings.ToLower(hash),
+			Source:   metrics.SourceClient,
+			Outcome:  outcome,
+			Path:     path,
+			Referrer: query.Get(routing.RefParam), // 请求的 Referer 是 md5.html 页面本身
+			Latency:  time.Duration(max(latency, 0)) * time.Millisecond,
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
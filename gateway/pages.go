@@ -0,0 +1,58 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/templates"
+)
+
+// 错误页面的原因，对应模板文案的键
+const (
+	reasonBadRequest = "error.bad_request"
+	reasonBackend    = "error.backend"
+	reasonOpen       = "error.open"
+	reasonInternal   = "error.internal"
+)
+
+// lang 按请求的 Accept-Language 选择页面语言
+func (g *MD5Gateway) lang(r *http.Request) string {
+	return g.templates.Match(r.Header.Get("Accept-Language"))
+}
+
+// renderPage 以 status 输出 render 渲染的页面
+func (g *MD5Gateway) renderPage(w http.ResponseWriter, status int, render func(io.Writer) error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(status)
+	if err := render(w); err != nil {
+		log.Printf("模板渲染失败: %v", err)
+	}
+}
+
+// notFoundPage 文件不存在：配置了 error.not_found_page 时重定向，否则显示内置页面
+func (g *MD5Gateway) notFoundPage(w http.ResponseWriter, r *http.Request, hash string) {
+	if page := g.conf().Error.NotFoundPage; page != "" {
+		http.Redirect(w, r, page, http.StatusFound)
+		return
+	}
+	g.renderPage(w, http.StatusNotFound, func(out io.Writer) error {
+		return g.templates.RenderNotFoundPage(out, g.lang(r), templates.NotFoundData{Hash: hash})
+	})
+}
+
+// remotePage 文件只在已登记的客户端上，网关无法读取，显示所在的主机与路径
+func (g *MD5Gateway) remotePage(w http.ResponseWriter, r *http.Request, res *backend.Result) {
+	g.renderPage(w, http.StatusOK, func(out io.Writer) error {
+		return g.templates.RenderRemotePage(out, g.lang(r), templates.RemoteData{Host: res.Host, Path: res.Path})
+	})
+}
+
+// errorPage 显示错误页面，reason 为 reason* 常量之一
+func (g *MD5Gateway) errorPage(w http.ResponseWriter, r *http.Request, status int, reason string) {
+	g.renderPage(w, status, func(out io.Writer) error {
+		return g.templates.RenderErrorPage(out, g.lang(r), templates.ErrorData{Status: status, Reason: reason})
+	})
+}
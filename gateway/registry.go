@@ -0,0 +1,128 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"smart-finder/gateway/internal/registry"
+	"smart-finder/shared/types"
+)
+
+// maxPublishEntrySize 发布请求中单个文件的最大字节数（解压后），用于限制请求体
+const maxPublishEntrySize = 1024
+
+// requireRegistryToken 校验客户端携带的 Authorization: Bearer <registry.token>
+func (g *MD5Gateway) requireRegistryToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if g.registry == nil {
+			http.Error(w, "未启用客户端登记", http.StatusNotFound)
+			return
+		}
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(g.conf().Registry.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="smart-finder"`)
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeRegistryRequest 解析客户端的 JSON 请求体，请求体可以用
+// Content-Encoding: gzip 压缩，解压后最多读取 limit 字节
+func decodeRegistryRequest(r *http.Request, limit int64, v any) error {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	}
+	return json.NewDecoder(io.LimitReader(body, limit)).Decode(v)
+}
+
+// 客户端发布索引摘要，替换该客户端之前发布的全部文件
+func (g *MD5Gateway) handleRegistryPublish(w http.ResponseWriter, r *http.Request) {
+	var req types.RegistryPublish
+	limit := int64(g.registry.MaxFiles()+1) * maxPublishEntrySize
+	if err := decodeRegistryRequest(r, limit, &req); err != nil {
+		http.Error(w, "参数错误，无效的请求体", http.StatusBadRequest)
+		return
+	}
+
+	err := g.registry.Publish(r.Context(), &req)
+	switch {
+	case errors.Is(err, registry.ErrTooManyFiles):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, registry.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		log.Printf("保存客户端 %s 的索引摘要失败: %v", req.ClientID, err)
+		http.Error(w, "保存索引摘要失败", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("客户端 %s (%s) 发布了 %d 个文件", req.Name, req.ClientID, len(req.Files))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 客户端心跳，返回网关保存的摘要是否仍是最新的
+func (g *MD5Gateway) handleRegistryHeartbeat(w http.ResponseWriter, r *http.Request) {
+	var req types.RegistryHeartbeat
+	if err := decodeRegistryRequest(r, maxPublishEntrySize, &req); err != nil || req.ClientID == "" {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	current, err := g.registry.Heartbeat(r.Context(), req.ClientID, req.Digest)
+	if err != nil {
+		log.Printf("记录客户端心跳失败: %v", err)
+		http.Error(w, "记录心跳失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, types.RegistryHeartbeatResponse{Current: current})
+}
+
+// 已登记的主机列表
+func (g *MD5Gateway) handleListHosts(w http.ResponseWriter, r *http.Request) {
+	if g.registry == nil {
+		http.Error(w, "未启用客户端登记", http.StatusNotFound)
+		return
+	}
+	hosts, err := g.registry.Hosts(r.Context())
+	if err != nil {
+		log.Printf("查询已登记主机失败: %v", err)
+		http.Error(w, "查询已登记主机失败", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, hosts)
+}
+
+// 删除已登记的主机及其发布的文件
+func (g *MD5Gateway) handleRemoveHost(w http.ResponseWriter, r *http.Request) {
+	if g.registry == nil {
+		http.Error(w, "未启用客户端登记", http.StatusNotFound)
+		return
+	}
+	err := g.registry.Remove(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("删除已登记主机失败: %v", err)
+		http.Error(w, "删除已登记主机失败", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/shared/types"
+	"smart-finder/shared/utils"
+)
+
+// DefaultMaxBatchSize 批量解析单次请求默认允许的最大哈希数
+const DefaultMaxBatchSize = 1000
+
+// 批量解析哈希：每个哈希返回状态及所有位置
+//
+// 哈希去重并转为小写后由后端链一次查询，支持批量查询的后端（Kodbox、
+// 网关索引）使用集合查询，不逐个查询数据库。
+func (g *MD5Gateway) handleResolve(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	limit := g.conf().Server.MaxBatchSize
+	var req types.ResolveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, int64(limit)*64+1024)).Decode(&req); err != nil {
+		http.Error(w, "参数错误，无效的JSON格式", http.StatusBadRequest)
+		return
+	}
+	if len(req.Hashes) == 0 {
+		http.Error(w, "参数错误，hashes 不能为空", http.StatusBadRequest)
+		return
+	}
+	if len(req.Hashes) > limit {
+		http.Error(w, fmt.Sprintf("单次最多解析 %d 个哈希", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	var hashes []string
+	seen := make(map[string]bool)
+	for _, hash := range req.Hashes {
+		hash = strings.ToLower(hash)
+		if utils.ValidateMD5(hash) && !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	found, failed := g.lookupMany(r.Context(), hashes)
+
+	resp := types.ResolveResponse[*backend.Result]{Results: make([]types.ResolveItem[*backend.Result], 0, len(req.Hashes))}
+	for _, hash := range req.Hashes {
+		item := types.ResolveItem[*backend.Result]{Hash: hash}
+		key := strings.ToLower(hash)
+		switch {
+		case !utils.ValidateMD5(hash):
+			item.Status = types.ResolveInvalid
+			item.Error = "无效的MD5哈希格式"
+		case found[key] != nil:
+			item.Status = types.ResolveFound
+			item.Locations = g.locations(key, found[key])
+			resp.Found++
+			g.recordResolution(r, metrics.SourceBatch, key, found[key][0], nil, start)
+		case failed[key] != nil:
+			item.Status = types.ResolveError
+			item.Error = "后端查询错误"
+			g.recordResolution(r, metrics.SourceBatch, key, nil, failed[key], start)
+		default:
+			item.Status = types.ResolveNotFound
+			resp.NotFound++
+			g.recordResolution(r, metrics.SourceBatch, key, nil, backend.ErrNotFound, start)
+		}
+		resp.Results = append(resp.Results, item)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// locations 转换为对外的位置信息：隐藏服务器上的路径（客户端主动发布
+// 的路径除外），需要由网关直接输出的文件给出网关自身的地址
+func (g *MD5Gateway) locations(hash string, results []*backend.Result) []*backend.Result {
+	locs := make([]*backend.Result, len(results))
+	for i, res := range results {
+		loc := *res
+		if loc.Host == "" {
+			loc.Path = ""
+		}
+		if loc.URL == "" || g.conf().Server.Delivery == DeliveryStream {
+			loc.URL = strings.TrimRight(g.conf().Server.Domain, "/") + "/api/md5?hash=" + url.QueryEscape(hash)
+		}
+		locs[i] = &loc
+	}
+	return locs
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/index"
+	"smart-finder/gateway/internal/sqlitedb"
+	"smart-finder/shared/types"
+)
+
+const (
+	worldMD5   = "7d793037a0760186574b0282f2f435e7"
+	missingMD5 = "00000000000000000000000000000001"
+	brokenMD5  = "00000000000000000000000000000002"
+)
+
+// brokenBackend 查询 brokenMD5 时失败，其余哈希不存在
+type brokenBackend struct{}
+
+func (brokenBackend) Name() string { return "broken" }
+func (brokenBackend) Type() string { return backend.TypeLocal }
+func (brokenBackend) Lookup(_ context.Context, hash string) (*backend.Result, error) {
+	if hash == brokenMD5 {
+		return nil, errors.New("连接失败")
+	}
+	return nil, backend.ErrNotFound
+}
+
+// newIndexGateway 创建使用网关索引（SQLite）的网关，目录中 hello 有两个副本
+func newIndexGateway(t *testing.T, maxBatch int) *MD5Gateway {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range map[string]string{"hello.txt": "hello", "copy/hello.txt": "hello", "world.txt": "world"} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := index.NewStore(db, index.DriverSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ix, err := index.New(store, index.Config{Roots: []index.Root{{Name: "share", Path: root}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ix.Rescan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	g := newTestGateway(t, nil)
+	g.indexer = ix
+	g.backends = backend.NewChain(backend.NewIndex("index", ix), brokenBackend{})
+	config := &Config{}
+	config.Server.Domain = "https://gw.example.com/"
+	config.Server.MaxBatchSize = maxBatch
+	g.config.Store(config)
+	return g
+}
+
+func postResolve(t *testing.T, g *MD5Gateway, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	g.routes().ServeHTTP(rec, httptest.NewRequest("POST", "/api/resolve", strings.NewReader(body)))
+	return rec
+}
+
+func TestResolveBatch(t *testing.T) {
+	g := newIndexGateway(t, 6)
+	rec := postResolve(t, g, `{"hashes": ["`+strings.ToUpper(helloMD5)+`", "`+worldMD5+`", "xyz", "`+missingMD5+`", "`+brokenMD5+`", "`+helloMD5+`"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("resolve: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp types.ResolveResponse[*backend.Result]
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	// 结果顺序与请求一致，每个哈希有各自的状态
+	want := []struct {
+		hash, status string
+		locations    int
+	}{
+		{strings.ToUpper(helloMD5), types.ResolveFound, 2},
+		{worldMD5, types.ResolveFound, 1},
+		{"xyz", types.ResolveInvalid, 0},
+		{missingMD5, types.ResolveNotFound, 0},
+		{brokenMD5, types.ResolveError, 0},
+		{helloMD5, types.ResolveFound, 2},
+	}
+	if len(resp.Results) != len(want) {
+		t.Fatalf("results = %+v", resp.Results)
+	}
+	for i, w := range want {
+		item := resp.Results[i]
+		if item.Hash != w.hash || item.Status != w.status || len(item.Locations) != w.locations {
+			t.Errorf("results[%d] = %+v, want %s %s with %d locations", i, item, w.hash, w.status, w.locations)
+		}
+		if (w.status == types.ResolveInvalid || w.status == types.ResolveError) && item.Error == "" {
+			t.Errorf("results[%d]: 应给出错误说明", i)
+		}
+	}
+	if resp.Found != 3 || resp.NotFound != 1 {
+		t.Errorf("found = %d, not_found = %d", resp.Found, resp.NotFound)
+	}
+
+	// 不公开服务器上的路径，没有对外地址时指向网关
+	for _, loc := range resp.Results[0].Locations {
+		if loc.Path != "" || loc.Backend != "index" || loc.URL != "https://gw.example.com/api/md5?hash="+helloMD5 {
+			t.Errorf("location = %+v", loc)
+		}
+	}
+}
+
+func TestResolveBatchRejects(t *testing.T) {
+	g := newIndexGateway(t, 2)
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"too many", `{"hashes": ["` + helloMD5 + `", "` + worldMD5 + `", "` + missingMD5 + `"]}`, http.StatusRequestEntityTooLarge},
+		{"empty", `{"hashes": []}`, http.StatusBadRequest},
+		{"invalid json", `{"hashes": `, http.StatusBadRequest},
+		{"oversized body", `{"hashes": ["` + strings.Repeat("a", 4096) + `"]}`, http.StatusBadRequest},
+		{"at limit", `{"hashes": ["` + helloMD5 + `", "xyz"]}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rec := postResolve(t, g, tt.body); rec.Code != tt.code {
+			t.Errorf("%s: %d %s, want %d", tt.name, rec.Code, rec.Body.String(), tt.code)
+		}
+	}
+}
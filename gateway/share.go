@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/gateway/internal/share"
+	"smart-finder/gateway/internal/templates"
+)
+
+// shareCookiePrefix 输入分享密码后写入的 Cookie 名前缀，后接链接ID
+const shareCookiePrefix = "sf_share_"
+
+// shareRangeCookiePrefix 计次打开链接后写入的 Cookie 名前缀，后接链接ID
+const shareRangeCookiePrefix = "sf_range_"
+
+// shareResponse 管理接口返回的分享链接
+type shareResponse struct {
+	*share.Link
+	Token string `json:"token"`
+	URL   string `json:"url"`
+}
+
+func (g *MD5Gateway) shareResponse(link *share.Link) shareResponse {
+	token := g.shares.Token(link)
+	return shareResponse{
+		Link:  link,
+		Token: token,
+		URL:   strings.TrimRight(g.conf().Server.Domain, "/") + "/s/" + token,
+	}
+}
+
+// 打开分享链接：校验令牌、密码和使用次数后按哈希查找文件并直接输出
+//
+// 计次打开后写入有效期为 share.RangeWindow 的 Cookie，带该 Cookie 的 Range
+// 续传或拖动请求不再计次，避免播放视频时很快耗尽次数；其余请求都计次，
+// 次数用完的链接不再提供内容。
+func (g *MD5Gateway) handleShare(w http.ResponseWriter, r *http.Request) {
+	if g.shares == nil {
+		http.NotFound(w, r)
+		return
+	}
+	link, err := g.shares.Resolve(r.Context(), mux.Vars(r)["token"])
+	if err != nil {
+		g.shareError(w, r, err)
+		return
+	}
+
+	if link.HasPassword {
+		cookie, err := r.Cookie(shareCookiePrefix + link.ID)
+		if err != nil || !g.shares.CheckUnlock(link, cookie.Value) {
+			g.sharePassword(w, r, link)
+			return
+		}
+	}
+	if r.Method == http.MethodPost {
+		http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+		return
+	}
+
+	disposition := link.Disposition
+	if disposition == share.DispositionAny {
+		var ok bool
+		disposition, ok = requestDisposition(r, g.conf().Server.Disposition)
+		if !ok {
+			http.Error(w, "无效的disposition参数", http.StatusBadRequest)
+			return
+		}
+	}
+
+	start := time.Now()
+	res, err := g.lookup(r.Context(), link.Hash)
+	g.recordResolution(r, metrics.SourceShare, link.Hash, res, err, start)
+	if errors.Is(err, backend.ErrNotFound) || (err == nil && res.Host != "") {
+		// 其他用户电脑上的文件不能通过分享链接提供，也不向外部人员透露主机与路径
+		g.notFoundPage(w, r, "")
+		return
+	}
+	if err != nil {
+		log.Printf("查询文件失败: %v", err)
+		g.errorPage(w, r, http.StatusInternalServerError, reasonBackend)
+		return
+	}
+
+	if r.Header.Get("Range") == "" || !g.rangeUnlocked(r, link) {
+		if err := g.shares.Use(r.Context(), link); err != nil {
+			g.shareError(w, r, err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     shareRangeCookiePrefix + link.ID,
+			Value:    g.shares.RangeValue(link),
+			Path:     "/s/",
+			MaxAge:   int(share.RangeWindow / time.Second),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	w.Header().Set("Cache-Control", "private, no-store")
+	g.serveContent(w, r, res, disposition)
+}
+
+// rangeUnlocked 判断请求是否带有最近一次计次打开时写入的 Cookie
+func (g *MD5Gateway) rangeUnlocked(r *http.Request, link *share.Link) bool {
+	cookie, err := r.Cookie(shareRangeCookiePrefix + link.ID)
+	return err == nil && g.shares.CheckRange(link, cookie.Value)
+}
+
+// sharePassword 显示密码页，提交正确的密码后写入 Cookie 并重新打开链接
+func (g *MD5Gateway) sharePassword(w http.ResponseWriter, r *http.Request, link *share.Link) {
+	data := templates.SharePasswordData{}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		if g.shares.CheckPassword(link, r.PostFormValue("password")) {
+			http.SetCookie(w, &http.Cookie{
+				Name:     shareCookiePrefix + link.ID,
+				Value:    g.shares.UnlockValue(link),
+				Path:     "/s/",
+				Expires:  link.ExpiresAt,
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, r.URL.RequestURI(), http.StatusSeeOther)
+			return
+		}
+		data.WrongPassword = true
+		status = http.StatusForbidden
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	g.renderPage(w, status, func(out io.Writer) error {
+		return g.templates.RenderSharePasswordPage(out, g.lang(r), data)
+	})
+}
+
+// shareError 链接无效或不存在时显示文件不存在页面，已过期、已撤销或次数
+// 用完时显示链接失效页面
+func (g *MD5Gateway) shareError(w http.ResponseWriter, r *http.Request, err error) {
+	var reason string
+	switch {
+	case errors.Is(err, share.ErrInvalidToken), errors.Is(err, share.ErrNotFound):
+		g.notFoundPage(w, r, "")
+		return
+	case errors.Is(err, share.ErrExpired):
+		reason = "expired"
+	case errors.Is(err, share.ErrRevoked):
+		reason = "revoked"
+	case errors.Is(err, share.ErrExhausted):
+		reason = "exhausted"
+	default:
+		log.Printf("分享链接查询失败: %v", err)
+		g.errorPage(w, r, http.StatusInternalServerError, reasonInternal)
+		return
+	}
+	g.renderPage(w, http.StatusGone, func(out io.Writer) error {
+		return g.templates.RenderExpiredPage(out, g.lang(r), templates.ExpiredData{Reason: reason})
+	})
+}
+
+// 创建分享链接
+func (g *MD5Gateway) handleCreateShare(w http.ResponseWriter, r *http.Request) {
+	if g.shares == nil {
+		http.Error(w, "未启用分享链接", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Hash        string `json:"hash"`
+		ExpiresIn   string `json:"expires_in"` // 如 "24h"，省略时使用 share.default_ttl
+		MaxUses     int64  `json:"max_uses"`
+		Password    string `json:"password"`
+		Disposition string `json:"disposition"`
+		Note        string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "参数错误", http.StatusBadRequest)
+		return
+	}
+	opts := share.CreateOptions{
+		Hash:        req.Hash,
+		MaxUses:     req.MaxUses,
+		Password:    req.Password,
+		Disposition: req.Disposition,
+		Note:        req.Note,
+	}
+	if req.ExpiresIn != "" {
+		ttl, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "无效的expires_in参数", http.StatusBadRequest)
+			return
+		}
+		opts.TTL = ttl
+	}
+
+	link, err := g.shares.Create(r.Context(), opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(g.shareResponse(link))
+}
+
+// 分享链接列表，all=1 时包含已过期、已撤销和次数已用完的链接
+func (g *MD5Gateway) handleListShares(w http.ResponseWriter, r *http.Request) {
+	if g.shares == nil {
+		http.Error(w, "未启用分享链接", http.StatusNotFound)
+		return
+	}
+	links, err := g.shares.List(r.Context(), r.URL.Query().Get("all") == "1")
+	if err != nil {
+		log.Printf("查询分享链接失败: %v", err)
+		http.Error(w, "查询分享链接失败", http.StatusInternalServerError)
+		return
+	}
+	resp := make([]shareResponse, len(links))
+	for i, link := range links {
+		resp[i] = g.shareResponse(link)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// 撤销分享链接
+func (g *MD5Gateway) handleRevokeShare(w http.ResponseWriter, r *http.Request) {
+	if g.shares == nil {
+		http.Error(w, "未启用分享链接", http.StatusNotFound)
+		return
+	}
+	err := g.shares.Revoke(r.Context(), mux.Vars(r)["id"])
+	if errors.Is(err, share.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("撤销分享链接失败: %v", err)
+		http.Error(w, "撤销分享链接失败", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
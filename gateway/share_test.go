@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"smart-finder/gateway/internal/share"
+	"smart-finder/gateway/internal/sqlitedb"
+)
+
+// newShareGateway 创建启用分享链接的测试网关，目录中有内容为 hello 的文件
+func newShareGateway(t *testing.T) *MD5Gateway {
+	t.Helper()
+	g := newTestGateway(t, map[string]string{"hello.txt": "hello"})
+	db, err := sqlitedb.Open(filepath.Join(t.TempDir(), "share.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if g.shares, err = share.NewManager(db, share.Config{Secret: "0123456789abcdef", Driver: share.DriverSQLite}); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestShareRangeCounting(t *testing.T) {
+	g := newShareGateway(t)
+	router := g.routes()
+	link, err := g.shares.Create(context.Background(), share.CreateOptions{Hash: helloMD5, MaxUses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "/s/" + g.shares.Token(link)
+
+	get := func(rangeHeader string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", url, nil)
+		if rangeHeader != "" {
+			req.Header.Set("Range", rangeHeader)
+		}
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 第一次打开计次并写入续传 Cookie
+	rec := get("")
+	if rec.Code != http.StatusOK || rec.Body.String() != "hello" {
+		t.Fatalf("first open: %d %q", rec.Code, rec.Body.String())
+	}
+	var rangeCookie *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == shareRangeCookiePrefix+link.ID {
+			rangeCookie = c
+		}
+	}
+	if rangeCookie == nil {
+		t.Fatal("计次打开后应写入续传 Cookie")
+	}
+
+	// 带 Cookie 的 Range 请求不计次，次数用完后仍可续传
+	rec = get("bytes=1-3", rangeCookie)
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "ell" {
+		t.Errorf("range with cookie: %d %q", rec.Code, rec.Body.String())
+	}
+
+	// 次数用完后，没有 Cookie 的 Range 请求与普通请求一样被拒绝
+	if rec := get("bytes=0-1"); rec.Code != http.StatusGone {
+		t.Errorf("exhausted link range without cookie: %d, want 410", rec.Code)
+	}
+	if rec := get(""); rec.Code != http.StatusGone {
+		t.Errorf("exhausted link: %d, want 410", rec.Code)
+	}
+
+	// 其他链接的 Cookie 不能用于本链接
+	other, err := g.shares.Create(context.Background(), share.CreateOptions{Hash: helloMD5, MaxUses: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := &http.Cookie{Name: shareRangeCookiePrefix + link.ID, Value: g.shares.RangeValue(other)}
+	if rec := get("bytes=0-1", forged); rec.Code != http.StatusGone {
+		t.Errorf("range with other link's cookie: %d, want 410", rec.Code)
+	}
+
+	got, err := g.shares.Get(context.Background(), link.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Uses != 1 {
+		t.Errorf("uses = %d, want 1", got.Uses)
+	}
+}
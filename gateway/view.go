@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"smart-finder/gateway/internal/backend"
+	"smart-finder/gateway/internal/metrics"
+	"smart-finder/gateway/internal/preview"
+	"smart-finder/gateway/internal/routing"
+	"smart-finder/gateway/internal/templates"
+	"smart-finder/shared/utils"
+)
+
+// 文件预览页 /view?hash=
+//
+// 图片、音视频与 PDF 由浏览器显示 /view/raw 输出的内容，markdown 与代码在
+// 服务端渲染；不能预览的文件按 /api/md5 处理。页面地址的 #page=、#t= 与
+// #L10-L20 分别指定 PDF 页数、播放位置和高亮的代码行。
+func (g *MD5Gateway) handleView(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	hash := r.URL.Query().Get("hash")
+	if !utils.ValidateMD5(hash) {
+		g.errorPage(w, r, http.StatusBadRequest, reasonBadRequest)
+		return
+	}
+	hash = strings.ToLower(hash)
+
+	res, err := g.lookup(r.Context(), hash)
+	g.recordResolution(r, metrics.SourceView, hash, res, err, start)
+	if errors.Is(err, backend.ErrNotFound) {
+		g.notFoundPage(w, r, hash)
+		return
+	}
+	if err != nil {
+		log.Printf("查询文件失败: %v", err)
+		g.errorPage(w, r, http.StatusInternalServerError, reasonBackend)
+		return
+	}
+	w.Header().Set(BackendHeader, res.Backend)
+	if res.Host != "" {
+		g.remotePage(w, r, res)
+		return
+	}
+
+	content, err := g.backends.Open(r.Context(), res)
+	if errors.Is(err, backend.ErrNotSupported) && res.URL != "" {
+		// 后端不支持由网关读取，只能打开后端给出的地址
+		http.Redirect(w, r, res.URL, http.StatusFound)
+		return
+	}
+	if err != nil {
+		log.Printf("读取文件失败 %s: %v", res.Backend, err)
+		g.errorPage(w, r, http.StatusBadGateway, reasonOpen)
+		return
+	}
+	defer content.Close()
+
+	name := resultName(res)
+	kind := preview.Kind(name, utils.DetectContentType(name, content))
+	query := url.Values{"hash": {hash}}
+	if ref := routing.Referrer(r); ref != "" {
+		// 页面内的请求 Referer 为预览页本身，带上原始来源以匹配相同的路由规则
+		query.Set(routing.RefParam, ref)
+	}
+	if kind == preview.KindOther {
+		http.Redirect(w, r, "/api/md5?"+query.Encode(), http.StatusFound)
+		return
+	}
+
+	data := templates.ViewData{
+		Hash:   hash,
+		Name:   name,
+		Kind:   kind,
+		RawURL: "/view/raw?" + query.Encode(),
+	}
+	query.Set("disposition", utils.DispositionAttachment)
+	data.DownloadURL = "/view/raw?" + query.Encode()
+
+	if kind == preview.KindMarkdown || kind == preview.KindCode {
+		raw, err := io.ReadAll(io.LimitReader(content, preview.MaxTextSize+1))
+		if err != nil {
+			log.Printf("读取文件失败 %s: %v", res.Backend, err)
+			g.errorPage(w, r, http.StatusBadGateway, reasonOpen)
+			return
+		}
+		if len(raw) > preview.MaxTextSize {
+			raw, data.Truncated = raw[:preview.MaxTextSize], true
+		}
+		text := preview.Text(raw)
+		if kind == preview.KindMarkdown {
+			meta, body := preview.FrontMatter(text)
+			for _, f := range meta {
+				data.Meta = append(data.Meta, templates.ViewField{Key: f.Key, Value: f.Value})
+			}
+			data.Markdown = preview.Markdown(body)
+		} else {
+			data.Language = preview.Language(name)
+			for i, line := range preview.Lines(text) {
+				data.Lines = append(data.Lines, templates.ViewLine{Number: i + 1, Text: line})
+			}
+		}
+	}
+
+	g.renderPage(w, http.StatusOK, func(out io.Writer) error {
+		return g.templates.RenderViewPage(out, g.lang(r), data)
+	})
+}
+
+// 输出预览页中图片、音视频与 PDF 的内容，disposition=attachment 时下载
+//
+// 由网关直接读取文件，不受 server.delivery 影响；不计入解析记录。
+func (g *MD5Gateway) handleViewRaw(w http.ResponseWriter, r *http.Request) {
+	hash := strings.ToLower(r.URL.Query().Get("hash"))
+	if !utils.ValidateMD5(hash) {
+		http.Error(w, "无效的MD5哈希格式", http.StatusBadRequest)
+		return
+	}
+	disposition, ok := requestDisposition(r, utils.DispositionInline)
+	if !ok {
+		http.Error(w, "无效的disposition参数", http.StatusBadRequest)
+		return
+	}
+
+	res, err := g.lookup(r.Context(), hash)
+	if errors.Is(err, backend.ErrNotFound) {
+		http.Error(w, "文件不存在", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("查询文件失败: %v", err)
+		http.Error(w, "后端查询错误", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(BackendHeader, res.Backend)
+	g.serveContent(w, r, res, disposition)
+}
@@ -0,0 +1,146 @@
+// Package bloom 索引的布隆过滤器摘要
+//
+// 客户端把索引中的全部MD5写入过滤器，在 /api/index/summary 提供；网关和
+// 脚本取得摘要后用 Test 判断某个哈希是否可能在该主机上，Test 返回 false
+// 时哈希一定不在索引中，可以省去对客户端的请求。返回 true 时有
+// 约为创建时指定的概率误判。
+package bloom
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math"
+)
+
+// DefaultFalsePositiveRate 默认的误判率
+const DefaultFalsePositiveRate = 0.01
+
+// ContentType 序列化后摘要的 Content-Type
+const ContentType = "application/vnd.smart-finder.bloom"
+
+// 序列化格式：魔数、版本、哈希函数个数、位数组长度（位）、元素个数，
+// 之后是位数组，整数均为大端序
+const (
+	magic      = "SFBF"
+	version    = 1
+	headerSize = len(magic) + 1 + 1 + 8 + 8
+	maxHashes  = 32
+)
+
+// ErrInvalid 摘要数据格式错误
+var ErrInvalid = errors.New("无效的布隆过滤器数据")
+
+// Filter 以MD5为元素的布隆过滤器，不能并发写入
+type Filter struct {
+	bits  []uint64
+	m     uint64 // 位数组长度
+	k     uint8  // 哈希函数个数
+	count uint64 // 已加入的元素个数
+}
+
+// New 创建能以 fpRate 的误判率容纳 n 个哈希的过滤器
+func New(n int, fpRate float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if fpRate <= 0 || fpRate >= 1 {
+		fpRate = DefaultFalsePositiveRate
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	m = (m + 63) / 64 * 64
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	k = max(1, min(k, maxHashes))
+	return &Filter{bits: make([]uint64, m/64), m: m, k: uint8(k)}
+}
+
+// Add 加入一个MD5，不是32位十六进制的哈希被忽略
+func (f *Filter) Add(md5 string) {
+	h1, h2, ok := split(md5)
+	if !ok {
+		return
+	}
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+	f.count++
+}
+
+// Test 判断MD5是否可能在过滤器中，返回 false 时一定不在
+func (f *Filter) Test(md5 string) bool {
+	h1, h2, ok := split(md5)
+	if !ok {
+		return false
+	}
+	for i := uint64(0); i < uint64(f.k); i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Count 返回加入的元素个数
+func (f *Filter) Count() int {
+	return int(f.count)
+}
+
+// split MD5本身分布均匀，直接把两半作为双重哈希的两个哈希值
+func split(md5 string) (h1, h2 uint64, ok bool) {
+	var sum [16]byte
+	if len(md5) != 32 {
+		return 0, 0, false
+	}
+	if _, err := hex.Decode(sum[:], []byte(md5)); err != nil {
+		return 0, 0, false
+	}
+	h1 = binary.BigEndian.Uint64(sum[:8])
+	h2 = binary.BigEndian.Uint64(sum[8:]) | 1 // 奇数，避免各哈希函数落在同一位
+	return h1, h2, true
+}
+
+// MarshalBinary 序列化过滤器
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	data := make([]byte, headerSize, headerSize+len(f.bits)*8)
+	copy(data, magic)
+	data[4] = version
+	data[5] = f.k
+	binary.BigEndian.PutUint64(data[6:], f.m)
+	binary.BigEndian.PutUint64(data[14:], f.count)
+	for _, w := range f.bits {
+		data = binary.BigEndian.AppendUint64(data, w)
+	}
+	return data, nil
+}
+
+// UnmarshalBinary 解析 MarshalBinary 生成的数据
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < headerSize || string(data[:4]) != magic {
+		return ErrInvalid
+	}
+	if data[4] != version {
+		return errors.New("不支持的布隆过滤器版本")
+	}
+	k := data[5]
+	m := binary.BigEndian.Uint64(data[6:])
+	if k == 0 || k > maxHashes || m == 0 || m%64 != 0 || uint64(len(data)-headerSize) != m/8 {
+		return ErrInvalid
+	}
+	bits := make([]uint64, m/64)
+	for i := range bits {
+		bits[i] = binary.BigEndian.Uint64(data[headerSize+i*8:])
+	}
+	*f = Filter{bits: bits, m: m, k: k, count: binary.BigEndian.Uint64(data[14:])}
+	return nil
+}
+
+// Parse 解析序列化的过滤器
+func Parse(data []byte) (*Filter, error) {
+	f := new(Filter)
+	if err := f.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
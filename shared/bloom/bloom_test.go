@@ -0,0 +1,76 @@
+package bloom
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func hashOf(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFilter(t *testing.T) {
+	const n = 10000
+	f := New(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.Add(hashOf("in-" + strconv.Itoa(i)))
+	}
+	for i := 0; i < n; i++ {
+		if !f.Test(hashOf("in-" + strconv.Itoa(i))) {
+			t.Fatalf("false negative for element %d", i)
+		}
+	}
+	if !f.Test(strings.ToUpper(hashOf("in-0"))) {
+		t.Error("Test should ignore case")
+	}
+
+	fp := 0
+	for i := 0; i < n; i++ {
+		if f.Test(hashOf("out-" + strconv.Itoa(i))) {
+			fp++
+		}
+	}
+	if rate := float64(fp) / n; rate > 0.02 {
+		t.Errorf("false positive rate = %.4f, want about 0.01", rate)
+	}
+	if f.Test("not-a-hash") {
+		t.Error("invalid hash should not match")
+	}
+	if f.Count() != n {
+		t.Errorf("Count() = %d", f.Count())
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	f := New(100, 0)
+	f.Add(hashOf("hello"))
+	data, err := f.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := Parse(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !g.Test(hashOf("hello")) || g.Count() != 1 || g.m != f.m || g.k != f.k {
+		t.Errorf("round trip mismatch: %+v", g)
+	}
+
+	for _, bad := range [][]byte{nil, []byte("SFBF"), data[:len(data)-1], append([]byte("XXXX"), data[4:]...)} {
+		if _, err := Parse(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%d bytes) = %v, want ErrInvalid", len(bad), err)
+		}
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	f := New(0, DefaultFalsePositiveRate)
+	if f.Test(hashOf("hello")) {
+		t.Error("empty filter should not match")
+	}
+}
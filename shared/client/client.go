@@ -0,0 +1,304 @@
+// Package client 客户端与网关HTTP接口的Go SDK
+//
+// Client 访问本机运行的客户端，Gateway 访问网关，请求与响应使用
+// shared/types 中与两端服务共用的结构。所有方法都接受 context；普通请求
+// 另外受 constants 中的默认超时限制（可用 WithTimeout 修改），读取文件
+// 内容的请求只受 context 控制。服务端返回错误时方法返回 *Error，
+// 404 可以用 errors.Is(err, ErrNotFound) 判断。
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"smart-finder/shared/bloom"
+	"smart-finder/shared/constants"
+	"smart-finder/shared/types"
+)
+
+// DefaultURL 本机客户端的地址
+var DefaultURL = fmt.Sprintf("http://%s:%d", constants.ClientHost, constants.ClientPort)
+
+// Client 本机客户端的接口
+type Client struct {
+	base
+}
+
+// New 创建客户端的 SDK，baseURL 为空时使用 DefaultURL
+func New(baseURL string, opts ...Option) *Client {
+	if baseURL == "" {
+		baseURL = DefaultURL
+	}
+	b := newBase(baseURL, millis(constants.ClientTimeout), millis(constants.FileCheckTimeout), opts)
+	b.envelope = true
+	return &Client{base: b}
+}
+
+// Health 检查客户端是否在运行
+func (c *Client) Health(ctx context.Context) (*types.HealthStatus, error) {
+	var out types.HealthStatus
+	if err := c.do(ctx, http.MethodGet, constants.HealthEndpoint, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Status 索引的文件数与添加目录时的索引进度
+func (c *Client) Status(ctx context.Context) (*types.ClientStatus, error) {
+	var out types.ClientStatus
+	if err := c.do(ctx, http.MethodGet, constants.StatusEndpoint, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Exists 检查哈希对应的文件是否在本机上且可以打开
+func (c *Client) Exists(ctx context.Context, hash string) (bool, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, constants.FileEndpoint, url.Values{"hash": {hash}}, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set(constants.CheckRequestHeader, "true")
+	res, cancel, err := c.send(ctx, c.checkTimeout, req)
+	if isNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	cancel()
+	res.Body.Close()
+	return true, nil
+}
+
+// Open 读取哈希对应的文件内容
+func (c *Client) Open(ctx context.Context, hash string) (*File, error) {
+	return c.open(ctx, constants.FileEndpoint, url.Values{"hash": {hash}})
+}
+
+// Thumbnail 读取哈希对应文件的缩略图，size 为长边像素数，0 表示默认尺寸；
+// 不支持的文件返回 image/svg+xml 类型的占位图
+func (c *Client) Thumbnail(ctx context.Context, hash string, size int) (*File, error) {
+	query := url.Values{"hash": {hash}}
+	if size > 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
+	return c.open(ctx, constants.ThumbEndpoint, query)
+}
+
+// Locate 在本机的文件管理器中定位哈希对应的文件
+func (c *Client) Locate(ctx context.Context, hash string) error {
+	return c.do(ctx, http.MethodGet, constants.LocateEndpoint, url.Values{"hash": {hash}}, nil, nil)
+}
+
+// Resolve 批量查询哈希，结果顺序与 hashes 相同
+func (c *Client) Resolve(ctx context.Context, hashes []string) (*types.ResolveResponse[types.FileInfo], error) {
+	var out types.ResolveResponse[types.FileInfo]
+	if err := c.do(ctx, http.MethodPost, constants.ResolveEndpoint, nil, types.ResolveRequest{Hashes: hashes}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Query 搜索条件，零值的字段不参与过滤
+type Query struct {
+	Search         string // 文件名或路径包含的文本
+	MinSize        *int64
+	MaxSize        *int64
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	Extensions     []string // 如 "jpg" 或 ".jpg"
+	MIME           string   // 完整类型或 "image/" 这样的前缀
+	Root           string   // 监控目录
+	PathPrefix     string
+	HashPrefix     string
+	Sort           string // modified_at、size、filename、path 或 md5
+	Order          string // asc 或 desc
+	PageSize       int
+	Page           int    // 偏移分页，设置 Cursor 时忽略
+	Cursor         string // 上一页结果的 NextCursor
+
+	// 按索引时提取的元数据过滤，尚未提取元数据的文件不匹配
+	TakenAfter  time.Time
+	TakenBefore time.Time
+	Camera      string // 相机厂商或型号包含的文本
+	MinWidth    int
+	MinHeight   int
+	MinDuration time.Duration
+	MaxDuration time.Duration
+	HasLocation bool
+	Title       string // PDF 标题包含的文本
+}
+
+func (q Query) values() url.Values {
+	v := make(url.Values)
+	set := func(key, value string) {
+		if value != "" {
+			v.Set(key, value)
+		}
+	}
+	set("search", q.Search)
+	if q.MinSize != nil {
+		set("minSize", strconv.FormatInt(*q.MinSize, 10))
+	}
+	if q.MaxSize != nil {
+		set("maxSize", strconv.FormatInt(*q.MaxSize, 10))
+	}
+	if !q.ModifiedAfter.IsZero() {
+		set("modifiedAfter", q.ModifiedAfter.Format(time.RFC3339))
+	}
+	if !q.ModifiedBefore.IsZero() {
+		set("modifiedBefore", q.ModifiedBefore.Format(time.RFC3339))
+	}
+	set("ext", strings.Join(q.Extensions, ","))
+	set("mime", q.MIME)
+	set("root", q.Root)
+	set("pathPrefix", q.PathPrefix)
+	set("hashPrefix", q.HashPrefix)
+	set("sort", q.Sort)
+	set("order", q.Order)
+	if q.PageSize > 0 {
+		set("pageSize", strconv.Itoa(q.PageSize))
+	}
+	if q.Page > 0 {
+		set("page", strconv.Itoa(q.Page))
+	}
+	set("cursor", q.Cursor)
+	if !q.TakenAfter.IsZero() {
+		set("takenAfter", q.TakenAfter.Format(time.RFC3339))
+	}
+	if !q.TakenBefore.IsZero() {
+		set("takenBefore", q.TakenBefore.Format(time.RFC3339))
+	}
+	set("camera", q.Camera)
+	if q.MinWidth > 0 {
+		set("minWidth", strconv.Itoa(q.MinWidth))
+	}
+	if q.MinHeight > 0 {
+		set("minHeight", strconv.Itoa(q.MinHeight))
+	}
+	if q.MinDuration > 0 {
+		set("minDuration", strconv.FormatFloat(q.MinDuration.Seconds(), 'f', -1, 64))
+	}
+	if q.MaxDuration > 0 {
+		set("maxDuration", strconv.FormatFloat(q.MaxDuration.Seconds(), 'f', -1, 64))
+	}
+	if q.HasLocation {
+		set("hasLocation", "true")
+	}
+	set("title", q.Title)
+	return v
+}
+
+// Search 搜索已索引的文件
+func (c *Client) Search(ctx context.Context, q Query) (*types.FileList, error) {
+	var out types.FileList
+	if err := c.do(ctx, http.MethodGet, constants.FilesEndpoint, q.values(), nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Directories 监控目录列表
+func (c *Client) Directories(ctx context.Context) ([]string, error) {
+	var out []string
+	if err := c.do(ctx, http.MethodGet, constants.DirectoriesEndpoint, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AddDirectory 添加监控目录，客户端随即开始索引该目录
+func (c *Client) AddDirectory(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodPost, constants.DirectoriesEndpoint, nil, types.DirectoryRequest{Path: path}, nil)
+}
+
+// RemoveDirectory 删除监控目录
+func (c *Client) RemoveDirectory(ctx context.Context, path string) error {
+	return c.do(ctx, http.MethodDelete, constants.DirectoriesEndpoint, nil, types.DirectoryRequest{Path: path}, nil)
+}
+
+// IgnorePatterns 忽略规则
+func (c *Client) IgnorePatterns(ctx context.Context) ([]string, error) {
+	var out []string
+	if err := c.do(ctx, http.MethodGet, constants.IgnorePatternsEndpoint, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SetIgnorePatterns 替换全部忽略规则
+func (c *Client) SetIgnorePatterns(ctx context.Context, patterns []string) error {
+	req, err := c.newRequest(ctx, http.MethodPost, constants.IgnorePatternsEndpoint, nil,
+		strings.NewReader(strings.Join(patterns, "\n")))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	res, cancel, err := c.send(ctx, c.timeout, req)
+	if err != nil {
+		return err
+	}
+	cancel()
+	return res.Body.Close()
+}
+
+// TriggerScan 立即开始一次扫描，扫描已在进行时不重复执行
+func (c *Client) TriggerScan(ctx context.Context) error {
+	return c.do(ctx, http.MethodPost, constants.ScanTriggerEndpoint, nil, nil, nil)
+}
+
+// ScanStatus 定时扫描的状态
+func (c *Client) ScanStatus(ctx context.Context) (*types.ScanStatus, error) {
+	var out types.ScanStatus
+	if err := c.do(ctx, http.MethodGet, constants.ScanStatusEndpoint, nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delete 把哈希对应的文件移到所在目录的回收站并删除索引记录，
+// 每个哈希的结果见 DeleteResult.Status
+func (c *Client) Delete(ctx context.Context, hashes ...string) (*types.DeleteResponse, error) {
+	var out types.DeleteResponse
+	if err := c.do(ctx, http.MethodPost, constants.DeleteEndpoint, nil, types.DeleteRequest{MD5s: hashes}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Summary 获取索引的布隆过滤器摘要。etag 为上次返回的 ETag，摘要未变化
+// 时返回 nil 与原来的 etag
+func (c *Client) Summary(ctx context.Context, etag string) (*bloom.Filter, string, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, constants.IndexSummaryEndpoint, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	res, cancel, err := c.send(ctx, c.timeout, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cancel()
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	f, err := bloom.Parse(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, res.Header.Get("ETag"), nil
+}
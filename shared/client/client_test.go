@@ -0,0 +1,326 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"smart-finder/shared/bloom"
+	"smart-finder/shared/constants"
+	"smart-finder/shared/types"
+	"smart-finder/shared/utils"
+)
+
+const (
+	helloMD5 = "5d41402abc4b2a76b9719d911017c592"
+	worldMD5 = "7d793037a0760186574b0282f2f435e7"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeData 与 writeError 按客户端 /api/v1 的格式响应
+func writeData(w http.ResponseWriter, v any) {
+	writeJSON(w, 200, types.Envelope[any]{Data: v})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, types.Envelope[any]{Error: &types.APIError{Code: code, Message: message}})
+}
+
+// fakeClient 模拟客户端的接口，记录收到的请求体
+func fakeClient(t *testing.T) (*Client, *[]string) {
+	t.Helper()
+	var bodies []string
+	mux := http.NewServeMux()
+	mux.HandleFunc(constants.HealthEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, types.HealthStatus{Status: "ok", Version: constants.Version})
+	})
+	mux.HandleFunc(constants.FileEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hash") != helloMD5 {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get(constants.CheckRequestHeader) == "true" {
+			return
+		}
+		w.Header().Set("Content-Disposition", utils.ContentDisposition(utils.DispositionInline, "你好.txt"))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc(constants.ThumbEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("hash") != helloMD5 {
+			writeError(w, 404, types.ErrCodeNotFound, "未找到该md5对应的文件")
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		io.WriteString(w, "<svg>"+r.URL.Query().Get("size")+"</svg>")
+	})
+	mux.HandleFunc(constants.LocateEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, 404, types.ErrCodeNotFound, "未找到该md5对应的文件")
+	})
+	mux.HandleFunc(constants.ResolveEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		var req types.ResolveRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		writeData(w, types.ResolveResponse[types.FileInfo]{
+			Results: []types.ResolveItem[types.FileInfo]{
+				{Hash: req.Hashes[0], Status: types.ResolveFound, Locations: []types.FileInfo{{MD5: helloMD5, Path: "/data/hello.txt"}}},
+			},
+			Found: 1,
+		})
+	})
+	mux.HandleFunc(constants.FilesEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		bodies = append(bodies, r.URL.RawQuery)
+		writeData(w, types.FileList{Files: []types.FileInfo{{MD5: helloMD5}}, Total: 1, NextCursor: "next"})
+	})
+	record := func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, r.Method+" "+strings.TrimSpace(string(data)))
+	}
+	mux.HandleFunc(constants.DirectoriesEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			writeData(w, []string{"/data"})
+			return
+		}
+		record(w, r)
+	})
+	mux.HandleFunc(constants.IgnorePatternsEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			writeData(w, []string{"*.tmp"})
+			return
+		}
+		record(w, r)
+	})
+	mux.HandleFunc(constants.ScanTriggerEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, types.ScanTriggerResponse{Status: "triggered"})
+	})
+	mux.HandleFunc(constants.ScanStatusEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, types.ScanStatus{IsScanning: true, TotalFiles: 10})
+	})
+	mux.HandleFunc(constants.DeleteEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		var req types.DeleteRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		resp := types.DeleteResponse{Total: len(req.MD5s)}
+		for _, md5 := range req.MD5s {
+			resp.Results = append(resp.Results, types.DeleteResult{MD5: md5, Status: types.DeleteFailed})
+		}
+		writeData(w, resp)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return New(srv.URL + "/"), &bodies
+}
+
+func TestClientFiles(t *testing.T) {
+	ctx := context.Background()
+	c, _ := fakeClient(t)
+
+	if h, err := c.Health(ctx); err != nil || h.Status != "ok" {
+		t.Fatalf("Health() = %+v, %v", h, err)
+	}
+	if ok, err := c.Exists(ctx, helloMD5); err != nil || !ok {
+		t.Errorf("Exists(hello) = %v, %v", ok, err)
+	}
+	if ok, err := c.Exists(ctx, worldMD5); err != nil || ok {
+		t.Errorf("Exists(world) = %v, %v", ok, err)
+	}
+
+	f, err := c.Open(ctx, helloMD5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(f)
+	f.Close()
+	if string(data) != "hello" || f.Name != "你好.txt" || f.Size != 5 {
+		t.Errorf("Open() = %q, %+v", data, f)
+	}
+
+	_, err = c.Open(ctx, worldMD5)
+	var e *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &e) || e.StatusCode != 404 {
+		t.Errorf("Open(world) error = %v", err)
+	}
+	f, err = c.Thumbnail(ctx, helloMD5, 128)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ = io.ReadAll(f)
+	f.Close()
+	if string(data) != "<svg>128</svg>" || f.ContentType != "image/svg+xml" {
+		t.Errorf("Thumbnail() = %q, %+v", data, f)
+	}
+	if _, err := c.Thumbnail(ctx, worldMD5, 0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Thumbnail(world) error = %v", err)
+	}
+	if err := c.Locate(ctx, worldMD5); !errors.Is(err, ErrNotFound) || !errors.As(err, &e) || e.Code != types.ErrCodeNotFound {
+		t.Errorf("Locate() error = %v", err)
+	}
+
+	res, err := c.Resolve(ctx, []string{helloMD5})
+	if err != nil || res.Found != 1 || res.Results[0].Locations[0].Path != "/data/hello.txt" {
+		t.Errorf("Resolve() = %+v, %v", res, err)
+	}
+}
+
+func TestClientManage(t *testing.T) {
+	ctx := context.Background()
+	c, bodies := fakeClient(t)
+
+	minSize := int64(0)
+	list, err := c.Search(ctx, Query{
+		Search:        "报告",
+		MinSize:       &minSize,
+		ModifiedAfter: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Extensions:    []string{"pdf", ".md"},
+		PageSize:      50,
+	})
+	if err != nil || list.Total != 1 || list.NextCursor != "next" {
+		t.Fatalf("Search() = %+v, %v", list, err)
+	}
+
+	if dirs, err := c.Directories(ctx); err != nil || !reflect.DeepEqual(dirs, []string{"/data"}) {
+		t.Errorf("Directories() = %v, %v", dirs, err)
+	}
+	if err := c.AddDirectory(ctx, "/new"); err != nil {
+		t.Error(err)
+	}
+	if err := c.RemoveDirectory(ctx, "/old"); err != nil {
+		t.Error(err)
+	}
+	if patterns, err := c.IgnorePatterns(ctx); err != nil || !reflect.DeepEqual(patterns, []string{"*.tmp"}) {
+		t.Errorf("IgnorePatterns() = %v, %v", patterns, err)
+	}
+	if err := c.SetIgnorePatterns(ctx, []string{"*.tmp", "node_modules"}); err != nil {
+		t.Error(err)
+	}
+
+	want := []string{
+		"ext=pdf%2C.md&minSize=0&modifiedAfter=2024-01-02T03%3A04%3A05Z&pageSize=50&search=%E6%8A%A5%E5%91%8A",
+		`POST {"path":"/new"}`,
+		`DELETE {"path":"/old"}`,
+		"POST *.tmp\nnode_modules",
+	}
+	if !reflect.DeepEqual(*bodies, want) {
+		t.Errorf("requests = %q, want %q", *bodies, want)
+	}
+
+	if err := c.TriggerScan(ctx); err != nil {
+		t.Error(err)
+	}
+	if s, err := c.ScanStatus(ctx); err != nil || !s.IsScanning || s.TotalFiles != 10 {
+		t.Errorf("ScanStatus() = %+v, %v", s, err)
+	}
+	del, err := c.Delete(ctx, helloMD5, worldMD5)
+	if err != nil || del.Total != 2 || del.Results[1].MD5 != worldMD5 {
+		t.Errorf("Delete() = %+v, %v", del, err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	f := bloom.New(10, 0)
+	f.Add(helloMD5)
+	data, _ := f.MarshalBinary()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write(data)
+	}))
+	defer srv.Close()
+	c := New(srv.URL)
+
+	got, etag, err := c.Summary(context.Background(), "")
+	if err != nil || etag != `"v1"` || !got.Test(helloMD5) || got.Test(worldMD5) {
+		t.Fatalf("Summary() = %v, %q, %v", got, etag, err)
+	}
+	got, etag, err = c.Summary(context.Background(), etag)
+	if err != nil || got != nil || etag != `"v1"` {
+		t.Errorf("Summary(etag) = %v, %q, %v", got, etag, err)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(constants.LookupEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" || r.Header.Get("Accept") != "application/json" {
+			http.Error(w, "未授权", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("hash") != helloMD5 {
+			writeJSON(w, 404, types.LookupResult{Error: types.ErrCodeNotFound, Message: "文件不存在"})
+			return
+		}
+		writeJSON(w, 200, types.LookupResult{Hash: helloMD5, Exists: true, Backend: "kodbox", URL: "http://kodbox/1"})
+	})
+	mux.HandleFunc(constants.GatewayResolveEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, 200, types.ResolveResponse[*types.Location]{
+			Results: []types.ResolveItem[*types.Location]{
+				{Hash: helloMD5, Status: types.ResolveFound, Locations: []*types.Location{{Backend: "nas", Host: "alice-pc"}}},
+			},
+			Found: 1,
+		})
+	})
+	mux.HandleFunc(constants.ViewRawEndpoint, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://kodbox/1", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	ctx := context.Background()
+	if _, err := NewGateway(srv.URL).Lookup(ctx, helloMD5); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Lookup without key = %v", err)
+	}
+	g := NewGateway(srv.URL, WithAPIKey("secret"))
+	res, err := g.Lookup(ctx, helloMD5)
+	if err != nil || !res.Exists || res.Backend != "kodbox" {
+		t.Errorf("Lookup() = %+v, %v", res, err)
+	}
+	_, err = g.Lookup(ctx, worldMD5)
+	var e *Error
+	if !errors.Is(err, ErrNotFound) || !errors.As(err, &e) || e.Code != types.ErrCodeNotFound || e.Message != "文件不存在" {
+		t.Errorf("Lookup(world) error = %#v", err)
+	}
+
+	resolved, err := g.Resolve(ctx, []string{helloMD5})
+	if err != nil || resolved.Results[0].Locations[0].Host != "alice-pc" {
+		t.Errorf("Resolve() = %+v, %v", resolved, err)
+	}
+
+	_, err = g.Open(ctx, helloMD5)
+	if !errors.As(err, &e) || e.StatusCode != http.StatusFound || e.Message != "http://kodbox/1" {
+		t.Errorf("Open() on redirect = %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL, WithTimeout(20*time.Millisecond)).Health(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Health() error = %v, want deadline exceeded", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := New(srv.URL).Exists(ctx, helloMD5); !errors.Is(err, context.Canceled) {
+		t.Errorf("Exists() with canceled context = %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"smart-finder/shared/constants"
+	"smart-finder/shared/types"
+)
+
+// Gateway 网关的查询接口
+type Gateway struct {
+	base
+}
+
+// NewGateway 创建网关的 SDK，baseURL 为网关地址，如 https://finder.example.com。
+// 网关启用认证时用 WithAPIKey 或 WithBasicAuth 提供凭据
+func NewGateway(baseURL string, opts ...Option) *Gateway {
+	timeout := millis(constants.GatewayTimeout)
+	return &Gateway{base: newBase(baseURL, timeout, timeout, opts)}
+}
+
+// Lookup 按配置的后端顺序查询哈希，未找到时返回的 *Error 的 Code 为
+// types.ErrCodeNotFound
+func (g *Gateway) Lookup(ctx context.Context, hash string) (*types.LookupResult, error) {
+	var out types.LookupResult
+	if err := g.do(ctx, http.MethodGet, constants.LookupEndpoint, url.Values{"hash": {hash}}, nil, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Resolve 批量查询哈希，返回每个哈希的所有位置，结果顺序与 hashes 相同
+func (g *Gateway) Resolve(ctx context.Context, hashes []string) (*types.ResolveResponse[*types.Location], error) {
+	var out types.ResolveResponse[*types.Location]
+	if err := g.do(ctx, http.MethodPost, constants.GatewayResolveEndpoint, nil, types.ResolveRequest{Hashes: hashes}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Open 由网关读取哈希对应的文件内容，后端不支持直接读取时返回错误
+func (g *Gateway) Open(ctx context.Context, hash string) (*File, error) {
+	return g.open(ctx, constants.ViewRawEndpoint, url.Values{"hash": {hash}})
+}
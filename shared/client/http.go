@@ -0,0 +1,242 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"smart-finder/shared/types"
+)
+
+// ErrNotFound 哈希、路径或接口不存在，用 errors.Is 判断
+var ErrNotFound = errors.New("不存在")
+
+// Error 服务端返回的错误
+type Error struct {
+	StatusCode int
+	Code       string // JSON 响应中的错误码，见 types.ErrCode*；纯文本响应时为空
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("请求失败: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("请求失败: %d %s", e.StatusCode, e.Message)
+}
+
+// Is 404 视为 ErrNotFound
+func (e *Error) Is(target error) bool {
+	return target == ErrNotFound && e.StatusCode == http.StatusNotFound
+}
+
+// Option 创建 Client 或 Gateway 时的选项
+type Option func(*base)
+
+// WithHTTPClient 使用指定的 http.Client，例如配置了代理或 TLS 的客户端
+func WithHTTPClient(c *http.Client) Option {
+	return func(b *base) { b.http = c }
+}
+
+// WithTimeout 修改普通请求的超时，0 表示只受 context 控制；不影响读取文件内容
+func WithTimeout(d time.Duration) Option {
+	return func(b *base) { b.timeout, b.checkTimeout = d, d }
+}
+
+// WithHeader 为每个请求添加请求头
+func WithHeader(key, value string) Option {
+	return func(b *base) { b.header.Add(key, value) }
+}
+
+// WithAPIKey 网关启用 api_key 认证时携带的密钥
+func WithAPIKey(key string) Option {
+	return WithHeader("X-API-Key", key)
+}
+
+// WithBasicAuth 网关启用 basic 认证时的用户名和密码
+func WithBasicAuth(username, password string) Option {
+	return func(b *base) { b.username, b.password = username, password }
+}
+
+// base Client 与 Gateway 共用的请求逻辑
+type base struct {
+	url          string
+	http         *http.Client
+	timeout      time.Duration // 普通请求的超时
+	checkTimeout time.Duration // 检查文件是否存在的超时
+	header       http.Header
+	username     string
+	password     string
+	envelope     bool // 响应包装为 {"data": ...}，即客户端的 /api/v1 接口
+}
+
+func newBase(baseURL string, timeout, checkTimeout time.Duration, opts []Option) base {
+	b := base{
+		url:          strings.TrimRight(baseURL, "/"),
+		http:         http.DefaultClient,
+		timeout:      timeout,
+		checkTimeout: checkTimeout,
+		header:       make(http.Header),
+	}
+	for _, opt := range opts {
+		opt(&b)
+	}
+	return b
+}
+
+func (b *base) newRequest(ctx context.Context, method, path string, query url.Values, body io.Reader) (*http.Request, error) {
+	u := b.url + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range b.header {
+		req.Header[key] = values
+	}
+	if b.username != "" {
+		req.SetBasicAuth(b.username, b.password)
+	}
+	return req, nil
+}
+
+// send 在超时内发送请求，状态码不是 2xx 或 304 时返回 *Error
+func (b *base) send(ctx context.Context, timeout time.Duration, req *http.Request) (*http.Response, context.CancelFunc, error) {
+	return b.sendWith(ctx, b.http, timeout, req)
+}
+
+func (b *base) sendWith(ctx context.Context, client *http.Client, timeout time.Duration, req *http.Request) (*http.Response, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		req = req.WithContext(ctx)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	if (res.StatusCode < 200 || res.StatusCode >= 300) && res.StatusCode != http.StatusNotModified {
+		defer cancel()
+		defer res.Body.Close()
+		return nil, nil, readError(res)
+	}
+	return res, cancel, nil
+}
+
+// do 发送 JSON 请求，in 不为 nil 时作为请求体，out 不为 nil 时解析响应
+func (b *base) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := b.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	res, cancel, err := b.send(ctx, b.timeout, req)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	defer res.Body.Close()
+	if out == nil || res.StatusCode == http.StatusNoContent {
+		io.Copy(io.Discard, res.Body)
+		return nil
+	}
+	if b.envelope {
+		out = &types.Envelope[any]{Data: out}
+	}
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// open 请求文件内容，只受 ctx 控制，调用方负责关闭 File
+//
+// 不跟随重定向：网关的后端不支持直接读取时会重定向到后端给出的地址，
+// 这时返回状态码为 3xx、Message 为该地址的 *Error。
+func (b *base) open(ctx context.Context, path string, query url.Values) (*File, error) {
+	req, err := b.newRequest(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := *b.http
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	res, _, err := b.sendWith(ctx, &client, 0, req)
+	if err != nil {
+		return nil, err
+	}
+	f := &File{
+		ReadCloser:  res.Body,
+		ContentType: res.Header.Get("Content-Type"),
+		Size:        res.ContentLength,
+	}
+	if _, params, err := mime.ParseMediaType(res.Header.Get("Content-Disposition")); err == nil {
+		f.Name = params["filename"]
+	}
+	if t, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		f.ModTime = t
+	}
+	return f, nil
+}
+
+// readError 读取错误响应：网关的 JSON 错误带 error 与 message，其余为纯文本
+func readError(res *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+	e := &Error{StatusCode: res.StatusCode}
+	if location := res.Header.Get("Location"); location != "" {
+		e.Message = location
+		return e
+	}
+	// 客户端为 {"error": {"code", "message"}}，网关为 {"error": "code", "message": "..."}
+	var body struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if strings.HasPrefix(res.Header.Get("Content-Type"), "application/json") && json.Unmarshal(data, &body) == nil {
+		var apiErr types.APIError
+		if json.Unmarshal(body.Error, &apiErr) == nil {
+			e.Code, e.Message = apiErr.Code, apiErr.Message
+		} else {
+			json.Unmarshal(body.Error, &e.Code)
+			e.Message = body.Message
+		}
+	} else {
+		e.Message = strings.TrimSpace(string(data))
+	}
+	return e
+}
+
+// File 文件内容，读取完毕后需要 Close
+type File struct {
+	io.ReadCloser
+	Name        string // Content-Disposition 中的文件名
+	ContentType string
+	Size        int64 // 未知时为 -1
+	ModTime     time.Time
+}
+
+func isNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+func millis(ms int) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -12,8 +12,35 @@ const (
 	SQLiteDBPath = "data/md5fs.db"
 	
 	// API路径
-	HealthEndpoint = "/api/health"
-	MD5Endpoint    = "/md5"
+	ClientAPIPrefix = "/api/v1" // 客户端接口的版本前缀，不带版本的 /api/ 路径已弃用
+	HealthEndpoint  = ClientAPIPrefix + "/health"
+	MD5Endpoint     = "/md5" // 客户端为早期网关页面保留的已弃用别名，新代码使用 FileEndpoint 与 LocateEndpoint
+
+	// 客户端索引的布隆过滤器摘要
+	IndexSummaryEndpoint = ClientAPIPrefix + "/index/summary"
+
+	// 客户端接口
+	StatusEndpoint         = ClientAPIPrefix + "/status"
+	FileEndpoint           = ClientAPIPrefix + "/md5"        // 输出文件内容，带 X-Check-Request 时只检查是否存在
+	LocateEndpoint         = ClientAPIPrefix + "/locate/md5" // 在文件管理器中定位文件
+	ThumbEndpoint          = ClientAPIPrefix + "/thumb"      // 图片缩略图，不支持的类型返回SVG占位图
+	ResolveEndpoint        = ClientAPIPrefix + "/resolve"
+	FilesEndpoint          = ClientAPIPrefix + "/files"
+	DirectoriesEndpoint    = ClientAPIPrefix + "/directories"
+	IgnorePatternsEndpoint = ClientAPIPrefix + "/ignore-patterns"
+	ScanTriggerEndpoint    = ClientAPIPrefix + "/scan/trigger"
+	ScanStatusEndpoint     = ClientAPIPrefix + "/scan/status"
+	DeleteEndpoint         = ClientAPIPrefix + "/files/delete"
+	OpenAPIEndpoint        = ClientAPIPrefix + "/openapi.json"
+
+	// 网关接口
+	LookupEndpoint         = "/api/md5"
+	GatewayResolveEndpoint = "/api/resolve"
+	ViewRawEndpoint        = "/view/raw"
+
+	// 网关的客户端登记接口
+	RegistryPublishEndpoint   = "/api/registry/publish"
+	RegistryHeartbeatEndpoint = "/api/registry/heartbeat"
 	
 	// 请求头
 	CheckRequestHeader = "X-Check-Request"
@@ -24,4 +51,5 @@ const (
 	// 超时配置
 	ClientTimeout = 3000 // 毫秒
 	FileCheckTimeout = 5000 // 毫秒
+	GatewayTimeout = 10000 // 毫秒，网关需要查询后端
 )
@@ -1,12 +1,40 @@
+// Package types 客户端与网关HTTP接口的请求和响应结构
 package types
 
-// FileInfo 文件信息
+import "time"
+
+// FileInfo 客户端索引中的文件
 type FileInfo struct {
-	MD5        string `json:"md5"`
-	Path       string `json:"path"`
-	Filename   string `json:"filename"`
-	Size       int64  `json:"size"`
-	ModifiedAt string `json:"modified_at"`
+	MD5        string        `json:"md5"`
+	Path       string        `json:"path"`
+	Filename   string        `json:"filename"`
+	Size       int64         `json:"size"`
+	ModifiedAt string        `json:"modified_at"`
+	LinkType   string        `json:"link_type"` // 空、symlink 或 hardlink
+	LinkCount  int64         `json:"link_count"`
+	Metadata   *FileMetadata `json:"metadata,omitempty"` // 尚未提取时为空
+}
+
+// FileMetadata 索引时从文件内容中提取的元数据，不适用的字段为零值
+type FileMetadata struct {
+	MIME        string     `json:"mime"` // 按内容识别，不含参数
+	Width       int        `json:"width,omitempty"`
+	Height      int        `json:"height,omitempty"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"` // EXIF 拍摄时间
+	CameraMake  string     `json:"camera_make,omitempty"`
+	CameraModel string     `json:"camera_model,omitempty"`
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	Duration    float64    `json:"duration,omitempty"` // 音视频时长，秒
+	Pages       int        `json:"pages,omitempty"`
+	Title       string     `json:"title,omitempty"` // PDF 文档标题
+}
+
+// FileList 客户端 /api/files 的查询结果
+type FileList struct {
+	Files      []FileInfo `json:"files"`
+	Total      int        `json:"total"`
+	NextCursor string     `json:"nextCursor,omitempty"` // 游标分页时下一页的游标
 }
 
 // HealthStatus 健康状态
@@ -23,3 +51,170 @@ type ClientStatus struct {
 	IndexingTotal int64 `json:"indexingTotal"`
 	IndexingDone  int64 `json:"indexingDone"`
 }
+
+// ScanStatus 客户端定时扫描的状态
+type ScanStatus struct {
+	IsScanning     bool             `json:"is_scanning"`
+	StartTime      time.Time        `json:"start_time"`
+	TotalFiles     int64            `json:"total_files"`
+	ProcessedFiles int64            `json:"processed_files"`
+	SkippedFiles   int64            `json:"skipped_files"`
+	ErrorFiles     int64            `json:"error_files"`
+	DeletedFiles   int64            `json:"deleted_files"`
+	CurrentDir     string           `json:"current_dir"`
+	Progress       float64          `json:"progress"`
+	ElapsedTime    string           `json:"elapsed_time"`
+	SkipReasons    map[string]int64 `json:"skip_reasons"` // 按原因统计的跳过数（特殊文件、符号链接、重复硬链接）
+}
+
+// ScanTriggerResponse 手动触发扫描的响应
+type ScanTriggerResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// DirectoryRequest 添加或删除监控目录
+type DirectoryRequest struct {
+	Path string `json:"path"`
+}
+
+// 删除结果的状态
+const (
+	DeleteSuccess        = "success"
+	DeleteWarning        = "warning"         // 文件已不存在，只删除了索引记录
+	DeletePartialSuccess = "partial_success" // 文件已移到回收站，索引记录删除失败
+	DeleteFailed         = "failed"
+)
+
+// DeleteRequest 按MD5删除文件并移至回收站
+type DeleteRequest struct {
+	MD5s []string `json:"md5s"`
+}
+
+// DeleteResult 单个MD5的删除结果
+type DeleteResult struct {
+	MD5          string `json:"md5"`
+	Status       string `json:"status"`
+	Message      string `json:"message"`
+	OriginalPath string `json:"originalPath,omitempty"`
+	RecyclePath  string `json:"recyclePath,omitempty"`
+}
+
+// DeleteResponse 删除的结果，顺序与请求一致
+type DeleteResponse struct {
+	Total   int            `json:"total"`
+	Results []DeleteResult `json:"results"`
+}
+
+// 批量解析中单个哈希的状态
+const (
+	ResolveFound    = "found"
+	ResolveNotFound = "not_found"
+	ResolveInvalid  = "invalid"
+	ResolveError    = "error" // 网关有后端查询失败
+)
+
+// ResolveRequest 批量解析哈希
+type ResolveRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+// ResolveItem 单个哈希的解析结果。客户端的位置为 FileInfo，网关的位置为 *Location
+type ResolveItem[L any] struct {
+	Hash      string `json:"hash"`
+	Status    string `json:"status"`
+	Locations []L    `json:"locations,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ResolveResponse 批量解析的结果，顺序与请求一致
+type ResolveResponse[L any] struct {
+	Results  []ResolveItem[L] `json:"results"`
+	Found    int              `json:"found"`
+	NotFound int              `json:"not_found"`
+}
+
+// Location 网关的后端找到的文件
+type Location struct {
+	Backend  string `json:"backend"`
+	Type     string `json:"type"`
+	URL      string `json:"url"`
+	Name     string `json:"name,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	FileID   int    `json:"fileID,omitempty"`
+	SourceID int    `json:"sourceID,omitempty"`
+	Path     string `json:"path,omitempty"` // 本地路径、对象键或 Kodbox 的 io_file.path
+	Host     string `json:"host,omitempty"` // registry：文件所在的客户端主机，Path 为该主机上的路径
+}
+
+// 错误码，用于网关的 JSON 查询结果与客户端的 /api/v1 接口，取值保持稳定
+const (
+	ErrCodeInvalidRequest     = "invalid_request" // 参数或请求体错误
+	ErrCodeMissingHash        = "missing_hash"
+	ErrCodeInvalidHash        = "invalid_hash"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeMethodNotAllowed   = "method_not_allowed"
+	ErrCodeForbidden          = "forbidden"        // 其他网页发起的跨域写请求
+	ErrCodeTooLarge           = "too_large"        // 批量请求超过上限
+	ErrCodeDatabaseDamaged    = "database_damaged" // 客户端数据库损坏，等待恢复或重建
+	ErrCodeBackendUnavailable = "backend_unavailable"
+	ErrCodeUpstream           = "upstream_error" // 客户端请求网关失败
+	ErrCodeInternal           = "internal_error"
+)
+
+// APIError 客户端 /api/v1 接口的错误
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Envelope 客户端 /api/v1 接口的响应，成功时只有 Data，失败时只有 Error
+type Envelope[T any] struct {
+	Data  T         `json:"data,omitempty"`
+	Error *APIError `json:"error,omitempty"`
+}
+
+// LookupResult 网关 /md5 与 /api/md5 在 Accept: application/json 时的响应
+type LookupResult struct {
+	Hash     string `json:"hash,omitempty"`
+	Exists   bool   `json:"exists"`
+	Backend  string `json:"backend,omitempty"`
+	Type     string `json:"type,omitempty"`
+	FileID   int    `json:"fileID,omitempty"`
+	SourceID int    `json:"sourceID,omitempty"`
+	Size     int64  `json:"size,omitempty"`
+	Name     string `json:"name,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Host     string `json:"host,omitempty"`    // 文件在已登记的客户端上
+	Path     string `json:"path,omitempty"`    // 客户端发布的路径
+	Error    string `json:"error,omitempty"`   // 错误码
+	Message  string `json:"message,omitempty"` // 错误说明
+}
+
+// RegistryFile 客户端向网关发布的一个文件。按客户端的隐私设置，Path 为
+// 完整路径、相对所属目录的路径或为空
+type RegistryFile struct {
+	MD5  string `json:"md5"`
+	Path string `json:"path,omitempty"`
+	Size int64  `json:"size"`
+}
+
+// RegistryPublish 客户端向网关发布索引摘要，替换该客户端之前发布的全部文件
+type RegistryPublish struct {
+	ClientID string         `json:"client_id"`
+	Name     string         `json:"name"` // 显示给其他用户的主机名
+	Version  string         `json:"version"`
+	Digest   string         `json:"digest"` // Files 的摘要，心跳时用于判断是否需要重新发布
+	Files    []RegistryFile `json:"files"`
+}
+
+// RegistryHeartbeat 客户端心跳，Digest 为当前索引摘要
+type RegistryHeartbeat struct {
+	ClientID string `json:"client_id"`
+	Digest   string `json:"digest"`
+}
+
+// RegistryHeartbeatResponse 心跳的响应，Current 为 false 时客户端需要重新发布
+type RegistryHeartbeatResponse struct {
+	Current bool `json:"current"`
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// 文件的展示方式
+const (
+	DispositionInline     = "inline"
+	DispositionAttachment = "attachment"
+)
+
+// DetectContentType 推断文件的Content-Type
+//
+// markdown 固定为 text/markdown，其余先按扩展名判断，无法识别时读取开头
+// 512 字节推断，读取后回到文件开头。
+func DetectContentType(name string, r io.ReadSeeker) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if ext == ".md" || ext == ".markdown" {
+		return "text/markdown; charset=utf-8"
+	}
+	if contentType := mime.TypeByExtension(ext); contentType != "" {
+		return contentType
+	}
+
+	buf := make([]byte, 512)
+	n, _ := io.ReadFull(r, buf)
+	r.Seek(0, io.SeekStart)
+	return http.DetectContentType(buf[:n])
+}
+
+// ActiveContentType 判断浏览器是否会把该类型的内容作为页面解析并执行其中的脚本，
+// 如 HTML、SVG 与 XML
+func ActiveContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "text/html", "image/svg+xml", "application/xhtml+xml", "text/xml", "application/xml":
+		return true
+	}
+	return false
+}
+
+// ContentDisposition 生成 Content-Disposition 头，非ASCII文件名按 RFC 2231 编码
+func ContentDisposition(disposition, name string) string {
+	if disposition != DispositionAttachment {
+		disposition = DispositionInline
+	}
+	if v := mime.FormatMediaType(disposition, map[string]string{"filename": name}); v != "" {
+		return v
+	}
+	return disposition
+}
@@ -16,7 +16,8 @@ func CalculateMD5(filePath string) (string, error) {
 	defer file.Close()
 
 	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	buf := make([]byte, 4*1024*1024) // 4MB分块
+	if _, err := io.CopyBuffer(hash, file, buf); err != nil {
 		return "", err
 	}
 
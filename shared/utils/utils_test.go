@@ -1,8 +1,70 @@
 package utils
 
-import "testing"
+import (
+	"io"
+	"strings"
+	"testing"
+)
 
 func TestUtils(t *testing.T) {
 	// 这是一个简单的测试，确保测试框架正常工作
 	t.Log("Utils package test passed")
 }
+
+func TestDetectContentType(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"README.md", "# title", "text/markdown; charset=utf-8"},
+		{"photo.PNG", "", "image/png"},
+		{"noext", "%PDF-1.7", "application/pdf"},
+		{"noext", "plain", "text/plain; charset=utf-8"},
+	}
+	for _, tt := range tests {
+		r := strings.NewReader(tt.content)
+		if got := DetectContentType(tt.name, r); got != tt.want {
+			t.Errorf("DetectContentType(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if pos, _ := r.Seek(0, io.SeekCurrent); pos != 0 {
+			t.Errorf("DetectContentType(%q) left reader at %d", tt.name, pos)
+		}
+	}
+}
+
+func TestActiveContentType(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"image/svg+xml", true},
+		{"application/xhtml+xml", true},
+		{"text/xml; charset=utf-8", true},
+		{"TEXT/HTML", true},
+		{"text/plain; charset=utf-8", false},
+		{"image/png", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ActiveContentType(tt.contentType); got != tt.want {
+			t.Errorf("ActiveContentType(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		disposition, name, want string
+	}{
+		{DispositionInline, "a.txt", "inline; filename=a.txt"},
+		{DispositionAttachment, "my file.txt", `attachment; filename="my file.txt"`},
+		{"", "报告.pdf", "inline; filename*=utf-8''%E6%8A%A5%E5%91%8A.pdf"},
+	}
+	for _, tt := range tests {
+		if got := ContentDisposition(tt.disposition, tt.name); got != tt.want {
+			t.Errorf("ContentDisposition(%q, %q) = %q, want %q", tt.disposition, tt.name, got, tt.want)
+		}
+	}
+}
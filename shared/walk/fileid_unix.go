@@ -0,0 +1,18 @@
+//go:build !windows
+
+package walk
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FileIdentity 返回文件的设备号与inode组成的标识及硬链接数
+func FileIdentity(_ string, info os.FileInfo) (key string, links uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", 1, false
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino), uint64(st.Nlink), true
+}
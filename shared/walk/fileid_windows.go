@@ -0,0 +1,33 @@
+//go:build windows
+
+package walk
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FileIdentity 返回文件的卷序列号与文件索引组成的标识及硬链接数
+//
+// Windows 下 FileInfo.Sys 不含文件索引，需要重新打开文件查询。
+func FileIdentity(path string, _ os.FileInfo) (key string, links uint64, ok bool) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", 1, false
+	}
+	h, err := syscall.CreateFile(p, 0,
+		syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE|syscall.FILE_SHARE_DELETE,
+		nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_BACKUP_SEMANTICS, 0)
+	if err != nil {
+		return "", 1, false
+	}
+	defer syscall.CloseHandle(h)
+
+	var d syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(h, &d); err != nil {
+		return "", 1, false
+	}
+	index := uint64(d.FileIndexHigh)<<32 | uint64(d.FileIndexLow)
+	return fmt.Sprintf("%d:%d", d.VolumeSerialNumber, index), uint64(d.NumberOfLinks), true
+}
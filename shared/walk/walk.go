@@ -0,0 +1,224 @@
+// Package walk 遍历目录树，供客户端和网关的索引器共用
+//
+// 遍历时按策略处理符号链接，跳过 FIFO、设备、套接字等非普通文件，
+// 并提供识别硬链接所需的文件标识。
+package walk
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SymlinkPolicy 符号链接处理策略
+type SymlinkPolicy string
+
+const (
+	// SymlinkSkip 跳过所有符号链接
+	SymlinkSkip SymlinkPolicy = "skip"
+	// SymlinkIndex 索引指向文件的符号链接（以链接路径记录），不进入链接目录
+	SymlinkIndex SymlinkPolicy = "index"
+	// SymlinkFollow 跟随符号链接，包括链接目录，并检测循环
+	SymlinkFollow SymlinkPolicy = "follow"
+)
+
+// DefaultSymlinkPolicy 默认策略，与早期版本行为一致
+const DefaultSymlinkPolicy = SymlinkIndex
+
+// ParseSymlinkPolicy 解析符号链接策略
+func ParseSymlinkPolicy(s string) (SymlinkPolicy, error) {
+	switch p := SymlinkPolicy(s); p {
+	case SymlinkSkip, SymlinkIndex, SymlinkFollow:
+		return p, nil
+	case "":
+		return DefaultSymlinkPolicy, nil
+	default:
+		return "", fmt.Errorf("未知的符号链接策略: %s", s)
+	}
+}
+
+// 链接类型，客户端记录在索引的 link_type 字段
+const (
+	LinkTypeNone     = ""
+	LinkTypeSymlink  = "symlink"
+	LinkTypeHardlink = "hardlink"
+)
+
+// 跳过原因
+const (
+	SkipReasonSymlink    = "symlink"
+	SkipReasonSymlinkDir = "symlink_dir"
+	SkipReasonBroken     = "broken_symlink"
+	SkipReasonCycle      = "symlink_cycle"
+	SkipReasonVisited    = "symlink_visited"
+	SkipReasonFIFO       = "fifo"
+	SkipReasonDevice     = "device"
+	SkipReasonSocket     = "socket"
+	SkipReasonIrregular  = "irregular"
+	SkipReasonHardlink   = "hardlink_duplicate"
+)
+
+// Entry 遍历得到的待索引文件
+type Entry struct {
+	Path       string
+	Info       os.FileInfo // 目标文件信息（已跟随符号链接）
+	LinkType   string
+	LinkTarget string
+}
+
+// Options 遍历选项
+type Options struct {
+	Policy SymlinkPolicy
+	// Ignore 返回 true 时跳过该文件或目录，可为空
+	Ignore func(path string, info os.FileInfo) bool
+	// OnFile 处理普通文件
+	OnFile func(entry Entry)
+	// OnSkip 记录被跳过的条目及原因，可为空
+	OnSkip func(path, reason string)
+	// OnError 记录访问失败的条目，可为空
+	OnError func(path string, err error)
+}
+
+// SpecialFileReason 判断非普通文件的跳过原因，普通文件返回空串
+func SpecialFileReason(mode os.FileMode) string {
+	switch {
+	case mode.IsRegular():
+		return ""
+	case mode&os.ModeNamedPipe != 0:
+		return SkipReasonFIFO
+	case mode&os.ModeDevice != 0, mode&os.ModeCharDevice != 0:
+		return SkipReasonDevice
+	case mode&os.ModeSocket != 0:
+		return SkipReasonSocket
+	default:
+		return SkipReasonIrregular
+	}
+}
+
+// Tree 按符号链接策略遍历目录树
+//
+// 与 filepath.Walk 不同，它会显式处理符号链接，并跳过 FIFO、设备等
+// 非普通文件，避免计算哈希时阻塞。跟随链接目录时，指向自身祖先目录的
+// 链接视为循环，已经遍历过的真实目录不会重复进入。
+func Tree(root string, opts Options) error {
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s 不是目录", root)
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+	if opts.OnSkip == nil {
+		opts.OnSkip = func(string, string) {}
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(string, error) {}
+	}
+	visited := map[string]bool{realRoot: true}
+	walkDir(root, realRoot, opts, visited)
+	return nil
+}
+
+// walkDir 遍历目录，realDir 为该目录解析链接后的真实路径
+func walkDir(dir, realDir string, opts Options, visited map[string]bool) {
+	f, err := os.Open(dir)
+	if err != nil {
+		opts.OnError(dir, err)
+		return
+	}
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	if err != nil {
+		opts.OnError(dir, err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		info, err := os.Lstat(path)
+		if err != nil {
+			opts.OnError(path, err)
+			continue
+		}
+		if opts.Ignore != nil && opts.Ignore(path, info) {
+			continue
+		}
+
+		if info.Mode()&os.ModeSymlink != 0 {
+			walkSymlink(path, realDir, opts, visited)
+			continue
+		}
+
+		if info.IsDir() {
+			realPath := filepath.Join(realDir, name)
+			visited[realPath] = true
+			walkDir(path, realPath, opts, visited)
+			continue
+		}
+
+		if reason := SpecialFileReason(info.Mode()); reason != "" {
+			opts.OnSkip(path, reason)
+			continue
+		}
+		opts.OnFile(Entry{Path: path, Info: info, LinkType: LinkTypeNone})
+	}
+}
+
+// walkSymlink 按策略处理符号链接，parentReal 为链接所在目录的真实路径
+func walkSymlink(path, parentReal string, opts Options, visited map[string]bool) {
+	if opts.Policy == SymlinkSkip {
+		opts.OnSkip(path, SkipReasonSymlink)
+		return
+	}
+
+	target, _ := os.Readlink(path)
+	info, err := os.Stat(path)
+	if err != nil {
+		opts.OnSkip(path, SkipReasonBroken)
+		return
+	}
+
+	if info.IsDir() {
+		if opts.Policy != SymlinkFollow {
+			opts.OnSkip(path, SkipReasonSymlinkDir)
+			return
+		}
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			opts.OnSkip(path, SkipReasonBroken)
+			return
+		}
+		if isWithin(parentReal, real) {
+			opts.OnSkip(path, SkipReasonCycle)
+			return
+		}
+		if visited[real] {
+			opts.OnSkip(path, SkipReasonVisited)
+			return
+		}
+		visited[real] = true
+		walkDir(path, real, opts, visited)
+		return
+	}
+
+	if reason := SpecialFileReason(info.Mode()); reason != "" {
+		opts.OnSkip(path, reason)
+		return
+	}
+	opts.OnFile(Entry{Path: path, Info: info, LinkType: LinkTypeSymlink, LinkTarget: target})
+}
+
+// isWithin 判断 path 是否等于 dir 或位于 dir 之下
+func isWithin(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
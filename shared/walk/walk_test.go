@@ -0,0 +1,78 @@
+package walk
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	root := t.TempDir()
+	mustWrite := func(rel string) {
+		path := filepath.Join(root, rel)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(rel), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustWrite("a.txt")
+	mustWrite("sub/b.txt")
+	if err := os.Symlink(filepath.Join(root, "a.txt"), filepath.Join(root, "link.txt")); err != nil {
+		t.Skipf("无法创建符号链接: %v", err)
+	}
+	if err := os.Symlink(root, filepath.Join(root, "sub", "loop")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "missing"), filepath.Join(root, "broken")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		policy SymlinkPolicy
+		files  []string
+		skips  map[string]string
+	}{
+		{
+			policy: SymlinkSkip,
+			files:  []string{"a.txt", "sub/b.txt"},
+			skips:  map[string]string{"broken": SkipReasonSymlink, "link.txt": SkipReasonSymlink, "sub/loop": SkipReasonSymlink},
+		},
+		{
+			policy: SymlinkIndex,
+			files:  []string{"a.txt", "link.txt", "sub/b.txt"},
+			skips:  map[string]string{"broken": SkipReasonBroken, "sub/loop": SkipReasonSymlinkDir},
+		},
+		{
+			policy: SymlinkFollow,
+			files:  []string{"a.txt", "link.txt", "sub/b.txt"},
+			skips:  map[string]string{"broken": SkipReasonBroken, "sub/loop": SkipReasonCycle},
+		},
+	}
+	for _, tt := range tests {
+		var files []string
+		skips := make(map[string]string)
+		rel := func(path string) string {
+			r, _ := filepath.Rel(root, path)
+			return filepath.ToSlash(r)
+		}
+		err := Tree(root, Options{
+			Policy: tt.policy,
+			OnFile: func(e Entry) { files = append(files, rel(e.Path)) },
+			OnSkip: func(path, reason string) { skips[rel(path)] = reason },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(files, tt.files) {
+			t.Errorf("%s: files = %v, want %v", tt.policy, files, tt.files)
+		}
+		if !reflect.DeepEqual(skips, tt.skips) {
+			t.Errorf("%s: skips = %v, want %v", tt.policy, skips, tt.skips)
+		}
+	}
+}